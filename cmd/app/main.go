@@ -1,10 +1,22 @@
 package main
 
 import (
+	"context"
 	"log/slog"
+	"os"
+	"time"
 
+	"github.com/titoffon/lru-cache-service/internal/cluster"
+	"github.com/titoffon/lru-cache-service/internal/invalidation"
+	"github.com/titoffon/lru-cache-service/internal/membership"
+	"github.com/titoffon/lru-cache-service/internal/peerfill"
 	"github.com/titoffon/lru-cache-service/internal/config"
+	"github.com/titoffon/lru-cache-service/internal/proxy"
+	"github.com/titoffon/lru-cache-service/internal/replication"
 	"github.com/titoffon/lru-cache-service/internal/server"
+	"github.com/titoffon/lru-cache-service/internal/tracing"
+	"github.com/titoffon/lru-cache-service/internal/webhook"
+	"github.com/titoffon/lru-cache-service/pkg/cache"
 	"github.com/titoffon/lru-cache-service/pkg/logger"
 )
 
@@ -12,15 +24,244 @@ func main(){
 
 	cfg, err := config.ReadConfig()
 	if err != nil {
-		panic("Failed to parse configuration")
+		slog.Error("Failed to read configuration", slog.String("error", err.Error()))
+		os.Exit(1)
 	}
 
 	logger.InitGlobalLogger(cfg.LogLevel)
 
-	srv := server.NewServer(cfg.ServerHostPort, cfg.CacheSize, cfg.DefaultCacheTTL)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:     cfg.TracingExporter,
+		FilePath:     cfg.TracingFile,
+		OTLPEndpoint: cfg.TracingOTLPEndpoint,
+		OTLPInsecure: cfg.TracingOTLPInsecure,
+		SampleRatio:  cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		slog.Error("Failed to set up tracing", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Failed to flush traces", slog.String("error", err.Error()))
+		}
+	}()
+
+	opts := []server.Option{
+		server.WithDrainDelay(cfg.ShutdownDrainDelay),
+		server.WithExpirySweep(cfg.ExpirySweepInterval),
+	}
+
+	switch cfg.CacheCompression {
+	case "", "none":
+	case cache.EncodingGzip:
+		opts = append(opts, server.WithCacheOptions(cache.WithCompression(cache.CompressionOptions{
+			Threshold: cfg.CacheCompressionThreshold,
+		})))
+	default:
+		slog.Error("Unknown cache compression", slog.String("compression", cfg.CacheCompression))
+		os.Exit(1)
+	}
+
+	if cfg.CacheDiskDir != "" {
+		store, err := cache.OpenDiskStore(cache.DiskOptions{
+			Dir:      cfg.CacheDiskDir,
+			MaxBytes: cfg.CacheDiskMaxBytes,
+		})
+		if err != nil {
+			slog.Error("Failed to open disk cache", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		opts = append(opts, server.WithDiskTier(store))
+	}
+
+	switch cfg.CacheEngine {
+	case "", "lru":
+	case "slab":
+		if cfg.CacheCompression != "" && cfg.CacheCompression != "none" || cfg.CacheDiskDir != "" {
+			slog.Error("Slab cache engine does not support compression or the disk tier")
+			os.Exit(1)
+		}
+		opts = append(opts, server.WithSlabStorage(cache.SlabOptions{MaxBytes: cfg.CacheSlabMaxBytes}))
+	default:
+		slog.Error("Unknown cache engine", slog.String("engine", cfg.CacheEngine))
+		os.Exit(1)
+	}
+
+	if cfg.AuthKeysFile != "" {
+		auth, err := server.LoadAuthFile(cfg.AuthKeysFile)
+		if err != nil {
+			slog.Error("Failed to load auth keys", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		opts = append(opts, server.WithAuthenticator(auth))
+	}
+
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		opts = append(opts, server.WithTLS(server.TLSOptions{
+			CertFile:          cfg.TLSCertFile,
+			KeyFile:           cfg.TLSKeyFile,
+			ClientCAFile:      cfg.TLSClientCAFile,
+			RequireClientCert: cfg.TLSRequireClientCert,
+			MinVersion:        cfg.TLSMinVersion,
+			ReloadInterval:    cfg.TLSReloadInterval,
+		}))
+	}
+
+	if cfg.RateLimitReadRPS > 0 || cfg.RateLimitWriteRPS > 0 {
+		opts = append(opts, server.WithRateLimit(runtimeSettings(cfg).RateLimit))
+	}
+
+	if cfg.ProxyUpstream != "" {
+		upstream, err := proxy.ParseUpstream(cfg.ProxyUpstream)
+		if err != nil {
+			slog.Error("Invalid proxy upstream", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		opts = append(opts, server.WithProxy(proxy.Options{
+			Upstream: upstream,
+			Timeout:  cfg.ProxyTimeout,
+		}))
+	}
+
+	if cfg.WebhooksFile != "" {
+		endpoints, err := webhook.LoadFile(cfg.WebhooksFile)
+		if err != nil {
+			slog.Error("Failed to load webhooks", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		opts = append(opts, server.WithWebhooks(webhook.New(webhook.Options{
+			Endpoints:   endpoints,
+			QueueSize:   cfg.WebhookQueueSize,
+			MaxAttempts: cfg.WebhookMaxAttempts,
+		})))
+	}
+
+	if cfg.ClusterSelf != "" {
+		c, err := cluster.New(cluster.Options{
+			Self:         cfg.ClusterSelf,
+			Peers:        cfg.ClusterPeers,
+			PeersFile:    cfg.ClusterPeersFile,
+			VirtualNodes: cfg.ClusterVirtualNodes,
+		})
+		if err != nil {
+			slog.Error("Failed to configure cluster", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		opts = append(opts, server.WithCluster(c))
+	}
+
+	if cfg.GossipBind != "" {
+		m, err := membership.New(membership.Config{
+			Name:          cfg.GossipName,
+			BindAddr:      cfg.GossipBind,
+			AdvertiseAddr: cfg.GossipAdvertise,
+			Meta:          cfg.ClusterSelf,
+			Seeds:         cfg.GossipSeeds,
+		})
+		if err != nil {
+			slog.Error("Failed to configure gossip membership", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		opts = append(opts, server.WithMembership(m))
+	}
+
+	if len(cfg.InvalidationPeers) > 0 {
+		peers := make([]string, 0, len(cfg.InvalidationPeers))
+		for _, p := range cfg.InvalidationPeers {
+			peer, err := cluster.NormalizePeer(p)
+			if err != nil {
+				slog.Error("Invalid invalidation peer", slog.String("error", err.Error()))
+				os.Exit(1)
+			}
+			peers = append(peers, peer)
+		}
+		opts = append(opts, server.WithInvalidation(invalidation.Options{
+			Peers:     peers,
+			APIKey:    cfg.InvalidationAPIKey,
+			QueueSize: cfg.InvalidationQueueSize,
+		}))
+	}
+
+	if cfg.LoaderURL != "" {
+		fill := peerfill.Options{
+			Loader:  peerfill.HTTPLoader(cfg.LoaderURL, cfg.LoaderTimeout),
+			TTL:     cfg.LoaderTTL,
+			APIKey:  cfg.PeerFillAPIKey,
+			HotSize: cfg.PeerFillHotSize,
+			HotTTL:  cfg.PeerFillHotTTL,
+		}
+		if len(cfg.PeerFillPeers) > 0 {
+			self, err := cluster.NormalizePeer(cfg.PeerFillSelf)
+			if err != nil {
+				slog.Error("Invalid peer fill self address", slog.String("error", err.Error()))
+				os.Exit(1)
+			}
+			fill.Self = self
+			for _, p := range cfg.PeerFillPeers {
+				peer, err := cluster.NormalizePeer(p)
+				if err != nil {
+					slog.Error("Invalid peer fill peer", slog.String("error", err.Error()))
+					os.Exit(1)
+				}
+				fill.Peers = append(fill.Peers, peer)
+			}
+		}
+		opts = append(opts, server.WithPeerFill(fill))
+	}
+
+	if cfg.ReplicationEnabled || cfg.ReplicationLeader != "" {
+		repl := server.ReplicationOptions{LogSize: cfg.ReplicationLogSize}
+		if cfg.ReplicationLeader != "" {
+			leader, err := cluster.NormalizePeer(cfg.ReplicationLeader)
+			if err != nil {
+				slog.Error("Invalid replication leader", slog.String("error", err.Error()))
+				os.Exit(1)
+			}
+			repl.Follower = &replication.FollowerOptions{
+				Leader: leader,
+				APIKey: cfg.ReplicationAPIKey,
+			}
+		}
+		opts = append(opts, server.WithReplication(repl))
+	}
+
+	// last — конфигурация последнего успешного перечитывания: предупреждение
+	// о ключах, требующих перезапуска, выдаётся только при новом их изменении.
+	// Функция вызывается из одной горутины, поэтому last не требует блокировки.
+	last := cfg
+	opts = append(opts, server.WithReload(runtimeSettings(cfg), func() (server.RuntimeSettings, error) {
+		next, err := config.Reload()
+		if err != nil {
+			return server.RuntimeSettings{}, err
+		}
+		if keys := config.RestartRequired(last, next); len(keys) > 0 {
+			slog.Warn("Changed settings take effect only after restart", slog.Any("keys", keys))
+		}
+		last = next
+		return runtimeSettings(next), nil
+	}))
+
+	srv := server.NewServer(cfg.ServerHostPort, cfg.CacheSize, cfg.DefaultCacheTTL, opts...)
 
 	slog.Info("Starting server", slog.String("address", cfg.ServerHostPort))
 	if err := srv.Start(); err != nil {
 		slog.Error("Failed to start server", slog.String("error", err.Error()))
 	}
-}
\ No newline at end of file
+}
+
+// runtimeSettings выбирает из конфигурации параметры, применяемые без перезапуска.
+func runtimeSettings(cfg *config.Config) server.RuntimeSettings {
+	return server.RuntimeSettings{
+		LogLevel:   cfg.LogLevel,
+		CacheSize:  cfg.CacheSize,
+		DefaultTTL: cfg.DefaultCacheTTL,
+		RateLimit: server.RateLimitOptions{
+			Read:       server.RateLimit{Rate: cfg.RateLimitReadRPS, Burst: cfg.RateLimitReadBurst},
+			Write:      server.RateLimit{Rate: cfg.RateLimitWriteRPS, Burst: cfg.RateLimitWriteBurst},
+			MaxClients: cfg.RateLimitMaxClients,
+		},
+	}
+}
@@ -0,0 +1,251 @@
+// Package cluster реализует кластерный режим: ключи распределяются между
+// узлами по кольцу консистентного хеширования, а запросы к чужим ключам
+// пересылаются узлу-владельцу.
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Заголовки кластерных запросов.
+const (
+	// HeaderForwardedBy помечает запрос, пересланный другим узлом; такой
+	// запрос всегда обслуживается локально, чтобы не зациклиться, пока
+	// узлы по-разному видят состав кластера.
+	HeaderForwardedBy = "X-Cluster-Forwarded-By"
+	// HeaderNode в ответе указывает узел, обслуживший запрос.
+	HeaderNode = "X-Cluster-Node"
+)
+
+// Options описывает параметры кластера.
+type Options struct {
+	// Self — адрес этого узла в том же виде, в каком он указан у остальных
+	// (например, http://10.0.0.1:8080).
+	Self string
+	// Peers — статический список узлов; Self добавляется автоматически.
+	Peers []string
+	// PeersFile — JSON-файл вида {"peers": [...]}, перечитываемый при изменении.
+	// Если задан, заменяет Peers.
+	PeersFile string
+	// ReloadInterval — как часто проверять изменения PeersFile.
+	ReloadInterval time.Duration
+	// VirtualNodes — число точек на кольце для каждого узла.
+	VirtualNodes int
+	// Transport используется для пересылки запросов другим узлам.
+	Transport http.RoundTripper
+}
+
+// Cluster хранит текущее кольцо и пересылает запросы владельцам ключей.
+type Cluster struct {
+	self      string
+	opts      Options
+	transport http.RoundTripper
+
+	ring atomic.Pointer[Ring]
+
+	mu          sync.Mutex
+	peersMod    time.Time
+	subscribers []func(*Ring)
+}
+
+// peersFile описывает формат файла со списком узлов.
+type peersFile struct {
+	Peers []string `json:"peers"`
+}
+
+// New создаёт кластер и строит начальное кольцо.
+func New(opts Options) (*Cluster, error) {
+	self, err := NormalizePeer(opts.Self)
+	if err != nil {
+		return nil, fmt.Errorf("cluster self address: %w", err)
+	}
+	if opts.VirtualNodes <= 0 {
+		opts.VirtualNodes = DefaultVirtualNodes
+	}
+	if opts.ReloadInterval <= 0 {
+		opts.ReloadInterval = 5 * time.Second
+	}
+	transport := opts.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	c := &Cluster{self: self, opts: opts, transport: transport}
+
+	peers := opts.Peers
+	if opts.PeersFile != "" {
+		peers, c.peersMod, err = readPeersFile(opts.PeersFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := c.SetPeers(peers); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NormalizePeer проверяет адрес узла и приводит его к виду scheme://host:port.
+func NormalizePeer(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return "", fmt.Errorf("peer %q must look like http://host:port", raw)
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// Self возвращает адрес этого узла.
+func (c *Cluster) Self() string {
+	return c.self
+}
+
+// Ring возвращает текущее кольцо.
+func (c *Cluster) Ring() *Ring {
+	return c.ring.Load()
+}
+
+// SetPeers заменяет состав кластера. Этот узел всегда остаётся в кольце.
+func (c *Cluster) SetPeers(peers []string) error {
+	nodes := []string{c.self}
+	for _, p := range peers {
+		node, err := NormalizePeer(p)
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, node)
+	}
+
+	ring := NewRing(nodes, c.opts.VirtualNodes)
+	old := c.ring.Swap(ring)
+	if old != nil && slices.Equal(old.Nodes(), ring.Nodes()) {
+		return nil
+	}
+
+	slog.Info("Cluster membership updated", slog.Any("nodes", ring.Nodes()))
+
+	c.mu.Lock()
+	subscribers := slices.Clone(c.subscribers)
+	c.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(ring)
+	}
+	return nil
+}
+
+// OnChange регистрирует функцию, вызываемую при изменении состава кластера.
+func (c *Cluster) OnChange(fn func(*Ring)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribers = append(c.subscribers, fn)
+}
+
+// Owner возвращает владельца ключа и признак того, что это текущий узел.
+func (c *Cluster) Owner(key string) (string, bool) {
+	owner := c.ring.Load().Owner(key)
+	return owner, owner == c.self
+}
+
+// Watch перечитывает PeersFile при изменении, пока не отменён ctx.
+// Без PeersFile сразу возвращается.
+func (c *Cluster) Watch(ctx context.Context) {
+	if c.opts.PeersFile == "" {
+		return
+	}
+	ticker := time.NewTicker(c.opts.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.reloadPeersFile()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reloadPeersFile применяет новый список узлов, если файл изменился.
+// При ошибке остаётся прежний состав.
+func (c *Cluster) reloadPeersFile() {
+	info, err := os.Stat(c.opts.PeersFile)
+	if err != nil {
+		slog.Error("Failed to stat cluster peers file", slog.String("error", err.Error()))
+		return
+	}
+	if info.ModTime().Equal(c.peersMod) {
+		return
+	}
+
+	peers, mod, err := readPeersFile(c.opts.PeersFile)
+	if err == nil {
+		err = c.SetPeers(peers)
+	}
+	if err != nil {
+		slog.Error("Failed to reload cluster peers, keeping previous membership",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	c.peersMod = mod
+}
+
+func readPeersFile(path string) ([]string, time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("stat cluster peers file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("read cluster peers file: %w", err)
+	}
+
+	var f peersFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, time.Time{}, fmt.Errorf("parse cluster peers file: %w", err)
+	}
+	return f.Peers, info.ModTime(), nil
+}
+
+// Forward пересылает запрос узлу owner и копирует его ответ клиенту.
+// onError вызывается, если владелец недоступен.
+func (c *Cluster) Forward(w http.ResponseWriter, r *http.Request, owner string, onError func(http.ResponseWriter, *http.Request, error)) {
+	target, err := url.Parse(owner)
+	if err != nil {
+		onError(w, r, err)
+		return
+	}
+
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			pr.Out.Header.Set(HeaderForwardedBy, c.self)
+		},
+		Transport:    c.transport,
+		ErrorHandler: onError,
+	}
+	rp.ServeHTTP(w, r)
+}
+
+// Client возвращает HTTP-клиент для запросов к другим узлам.
+func (c *Cluster) Client() *http.Client {
+	return &http.Client{Transport: c.transport, Timeout: 30 * time.Second}
+}
@@ -0,0 +1,66 @@
+package cluster
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizePeer(t *testing.T) {
+	got, err := NormalizePeer(" http://127.0.0.1:8080/ ")
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:8080", got)
+
+	for _, raw := range []string{"127.0.0.1:8080", "ftp://host:1", "http://host:1/api"} {
+		_, err := NormalizePeer(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestClusterSetPeers(t *testing.T) {
+	c, err := New(Options{Self: "http://a:1", Peers: []string{"http://b:1"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://a:1", "http://b:1"}, c.Ring().Nodes())
+
+	var changes []*Ring
+	c.OnChange(func(r *Ring) { changes = append(changes, r) })
+
+	require.NoError(t, c.SetPeers([]string{"http://b:1"}))
+	assert.Empty(t, changes, "unchanged membership must not notify")
+
+	require.NoError(t, c.SetPeers([]string{"http://b:1", "http://c:1"}))
+	require.Len(t, changes, 1)
+	assert.Equal(t, []string{"http://a:1", "http://b:1", "http://c:1"}, changes[0].Nodes())
+
+	// Собственный узел остаётся в кольце, даже если его нет в списке.
+	require.NoError(t, c.SetPeers(nil))
+	owner, local := c.Owner("any")
+	assert.Equal(t, "http://a:1", owner)
+	assert.True(t, local)
+
+	assert.Error(t, c.SetPeers([]string{"bad"}))
+}
+
+func TestClusterPeersFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"peers":["http://b:1"]}`), 0o600))
+
+	c, err := New(Options{Self: "http://a:1", PeersFile: path})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://a:1", "http://b:1"}, c.Ring().Nodes())
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"peers":["http://b:1","http://c:1"]}`), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	c.reloadPeersFile()
+	assert.Equal(t, []string{"http://a:1", "http://b:1", "http://c:1"}, c.Ring().Nodes())
+
+	// Испорченный файл не меняет состав.
+	require.NoError(t, os.WriteFile(path, []byte(`{"peers":`), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)))
+	c.reloadPeersFile()
+	assert.Equal(t, []string{"http://a:1", "http://b:1", "http://c:1"}, c.Ring().Nodes())
+}
@@ -0,0 +1,85 @@
+package cluster
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// DefaultVirtualNodes — число виртуальных узлов на один узел кластера по умолчанию.
+const DefaultVirtualNodes = 128
+
+// Ring — неизменяемое кольцо консистентного хеширования. Каждый узел
+// представлен на кольце vnodes точками, поэтому ключи распределяются
+// равномерно, а при добавлении или удалении узла переезжает только доля
+// ключей, приходившаяся на этот узел.
+type Ring struct {
+	points []uint64
+	owners map[uint64]string
+	nodes  []string
+}
+
+// NewRing строит кольцо из узлов nodes; дубликаты игнорируются.
+func NewRing(nodes []string, vnodes int) *Ring {
+	if vnodes <= 0 {
+		vnodes = DefaultVirtualNodes
+	}
+
+	r := &Ring{owners: make(map[uint64]string, len(nodes)*vnodes)}
+	seen := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		r.nodes = append(r.nodes, node)
+
+		for i := 0; i < vnodes; i++ {
+			h := hash(node + "#" + strconv.Itoa(i))
+			// Коллизии 64-битных хешей практически невозможны, но порядок
+			// их разрешения должен быть одинаковым на всех узлах.
+			if owner, ok := r.owners[h]; ok && owner < node {
+				continue
+			}
+			if _, ok := r.owners[h]; !ok {
+				r.points = append(r.points, h)
+			}
+			r.owners[h] = node
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	sort.Strings(r.nodes)
+	return r
+}
+
+// Owner возвращает узел, отвечающий за ключ, или пустую строку, если кольцо пустое.
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// Nodes возвращает отсортированный список узлов кольца.
+func (r *Ring) Nodes() []string {
+	return append([]string(nil), r.nodes...)
+}
+
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	// FNV плохо перемешивает младшие биты для похожих строк, поэтому
+	// результат дополнительно прогоняется через финализатор splitmix64.
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,57 @@
+package cluster
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingDistribution(t *testing.T) {
+	nodes := []string{"http://a:1", "http://b:1", "http://c:1", "http://d:1"}
+	ring := NewRing(nodes, DefaultVirtualNodes)
+
+	const keys = 40000
+	counts := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		counts[ring.Owner("key-"+strconv.Itoa(i))]++
+	}
+
+	require.Len(t, counts, len(nodes))
+	for node, n := range counts {
+		// При 128 виртуальных узлах отклонение от равной доли невелико.
+		assert.InDelta(t, keys/len(nodes), n, 0.3*keys/float64(len(nodes)), node)
+	}
+}
+
+func TestRingMinimalMovement(t *testing.T) {
+	before := NewRing([]string{"http://a:1", "http://b:1", "http://c:1"}, DefaultVirtualNodes)
+	after := NewRing([]string{"http://a:1", "http://b:1", "http://c:1", "http://d:1"}, DefaultVirtualNodes)
+
+	const keys = 40000
+	moved := 0
+	for i := 0; i < keys; i++ {
+		key := "key-" + strconv.Itoa(i)
+		from, to := before.Owner(key), after.Owner(key)
+		if from != to {
+			moved++
+			// Ключи переезжают только на добавленный узел.
+			assert.Equal(t, "http://d:1", to, key)
+		}
+	}
+	// Переезжает около 1/4 ключей — доля нового узла.
+	assert.InDelta(t, keys/4, moved, 0.3*keys/4)
+}
+
+func TestRingOrderIndependent(t *testing.T) {
+	a := NewRing([]string{"http://a:1", "http://b:1", "http://c:1"}, 16)
+	b := NewRing([]string{"http://c:1", "http://a:1", "http://b:1", "http://a:1"}, 16)
+
+	assert.Equal(t, a.Nodes(), b.Nodes())
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		assert.Equal(t, a.Owner(key), b.Owner(key))
+	}
+	assert.Empty(t, NewRing(nil, 16).Owner("k"))
+}
@@ -3,7 +3,11 @@ package config
 
 import (
 	"flag"
+	"fmt"
+	"io"
 	"log/slog"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env/v11"
@@ -14,38 +18,286 @@ type Config struct {
 	CacheSize       int           `env:"CACHE_SIZE" envDefault:"10"`
 	DefaultCacheTTL time.Duration `env:"DEFAULT_CACHE_TTL" envDefault:"60s"`
 	LogLevel        string        `env:"LOG_LEVEL" envDefault:"WARN"`
+	// CacheCompression — none или gzip.
+	CacheCompression          string `env:"CACHE_COMPRESSION" envDefault:"none"`
+	CacheCompressionThreshold int    `env:"CACHE_COMPRESSION_THRESHOLD" envDefault:"1024"`
+	// CacheDiskDir — каталог второго уровня кэша на диске. Пустое значение отключает его.
+	CacheDiskDir      string `env:"CACHE_DISK_DIR"`
+	CacheDiskMaxBytes int64  `env:"CACHE_DISK_MAX_BYTES" envDefault:"1073741824"`
+	// CacheEngine — lru или slab.
+	CacheEngine       string `env:"CACHE_ENGINE" envDefault:"lru"`
+	CacheSlabMaxBytes int    `env:"CACHE_SLAB_MAX_BYTES" envDefault:"67108864"`
+	// ShutdownDrainDelay — сколько ждать после SIGTERM до остановки сервера,
+	// пока /readyz уже отвечает 503.
+	ShutdownDrainDelay time.Duration `env:"SHUTDOWN_DRAIN_DELAY" envDefault:"0s"`
+	// AuthKeysFile — путь к JSON-файлу с API-ключами. Пустое значение отключает аутентификацию.
+	AuthKeysFile string `env:"AUTH_KEYS_FILE"`
+
+	// TLS включается, если заданы TLSCertFile и TLSKeyFile.
+	TLSCertFile          string        `env:"TLS_CERT_FILE"`
+	TLSKeyFile           string        `env:"TLS_KEY_FILE"`
+	TLSClientCAFile      string        `env:"TLS_CLIENT_CA_FILE"`
+	TLSRequireClientCert bool          `env:"TLS_REQUIRE_CLIENT_CERT" envDefault:"false"`
+	TLSMinVersion        string        `env:"TLS_MIN_VERSION" envDefault:"1.2"`
+	TLSReloadInterval    time.Duration `env:"TLS_RELOAD_INTERVAL" envDefault:"30s"`
+
+	// Лимиты запросов на клиента; RPS = 0 отключает соответствующий лимит.
+	RateLimitReadRPS     float64 `env:"RATE_LIMIT_READ_RPS" envDefault:"0"`
+	RateLimitReadBurst   int     `env:"RATE_LIMIT_READ_BURST" envDefault:"100"`
+	RateLimitWriteRPS    float64 `env:"RATE_LIMIT_WRITE_RPS" envDefault:"0"`
+	RateLimitWriteBurst  int     `env:"RATE_LIMIT_WRITE_BURST" envDefault:"20"`
+	RateLimitMaxClients  int     `env:"RATE_LIMIT_MAX_CLIENTS" envDefault:"10000"`
+
+	// ProxyUpstream — базовый URL upstream для режима кэширующего прокси. Пустое значение выключает прокси.
+	ProxyUpstream string        `env:"PROXY_UPSTREAM"`
+	ProxyTimeout  time.Duration `env:"PROXY_TIMEOUT" envDefault:"30s"`
+
+	// WebhooksFile — путь к JSON-файлу с получателями вебхуков. Пустое значение отключает вебхуки.
+	WebhooksFile        string `env:"WEBHOOKS_FILE"`
+	WebhookQueueSize    int    `env:"WEBHOOK_QUEUE_SIZE" envDefault:"1000"`
+	WebhookMaxAttempts  int    `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"8"`
+	// ExpirySweepInterval — период удаления истёкших записей; 0 отключает фоновую очистку.
+	ExpirySweepInterval time.Duration `env:"EXPIRY_SWEEP_INTERVAL" envDefault:"1s"`
+
+	// ClusterSelf — адрес этого узла (http://host:port). Пустое значение отключает кластерный режим.
+	ClusterSelf         string   `env:"CLUSTER_SELF"`
+	ClusterPeers        []string `env:"CLUSTER_PEERS" envSeparator:","`
+	ClusterPeersFile    string   `env:"CLUSTER_PEERS_FILE"`
+	ClusterVirtualNodes int      `env:"CLUSTER_VIRTUAL_NODES" envDefault:"128"`
+
+	// ReplicationEnabled включает журнал репликации; с ReplicationLeader узел стартует ведомым.
+	ReplicationEnabled bool   `env:"REPLICATION_ENABLED" envDefault:"false"`
+	ReplicationLeader  string `env:"REPLICATION_LEADER"`
+	ReplicationAPIKey  string `env:"REPLICATION_API_KEY"`
+	ReplicationLogSize int    `env:"REPLICATION_LOG_SIZE" envDefault:"10000"`
+
+	// GossipBind — адрес UDP/TCP для обнаружения узлов. Пустое значение отключает gossip.
+	GossipBind      string   `env:"GOSSIP_BIND"`
+	GossipAdvertise string   `env:"GOSSIP_ADVERTISE"`
+	GossipName      string   `env:"GOSSIP_NAME"`
+	GossipSeeds     []string `env:"GOSSIP_SEEDS" envSeparator:","`
+
+	// InvalidationPeers — экземпляры, которым рассылаются удаления. Пустой список отключает рассылку.
+	InvalidationPeers     []string `env:"INVALIDATION_PEERS" envSeparator:","`
+	InvalidationAPIKey    string   `env:"INVALIDATION_API_KEY"`
+	InvalidationQueueSize int      `env:"INVALIDATION_QUEUE_SIZE" envDefault:"10000"`
+
+	// LoaderURL — адрес источника для чтения через загрузчик. Пустое значение отключает заполнение промахов.
+	LoaderURL        string        `env:"LOADER_URL"`
+	LoaderTTL        time.Duration `env:"LOADER_TTL" envDefault:"0s"`
+	LoaderTimeout    time.Duration `env:"LOADER_TIMEOUT" envDefault:"10s"`
+	PeerFillSelf     string        `env:"PEER_FILL_SELF"`
+	PeerFillPeers    []string      `env:"PEER_FILL_PEERS" envSeparator:","`
+	PeerFillAPIKey   string        `env:"PEER_FILL_API_KEY"`
+	PeerFillHotSize  int           `env:"PEER_FILL_HOT_SIZE" envDefault:"1000"`
+	PeerFillHotTTL   time.Duration `env:"PEER_FILL_HOT_TTL" envDefault:"10s"`
+
+	// TracingExporter — none, stdout, file или otlp.
+	TracingExporter     string  `env:"TRACING_EXPORTER" envDefault:"none"`
+	TracingFile         string  `env:"TRACING_FILE" envDefault:"traces.json"`
+	TracingOTLPEndpoint string  `env:"TRACING_OTLP_ENDPOINT"`
+	TracingOTLPInsecure bool    `env:"TRACING_OTLP_INSECURE" envDefault:"false"`
+	TracingSampleRatio  float64 `env:"TRACING_SAMPLE_RATIO" envDefault:"1"`
 }
 
+// ReadConfig читает конфигурацию из необязательного YAML-файла (флаг -config),
+// переменных окружения и флагов командной строки. Приоритет источников:
+// флаги > окружение > файл > значения по умолчанию.
 func ReadConfig() (*Config, error) {
+	return load(flag.CommandLine, os.Args[1:])
+}
+
+// Reload заново читает файл конфигурации и переменные окружения. Флаги,
+// заданные при запуске, по-прежнему имеют приоритет.
+func Reload() (*Config, error) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return load(fs, os.Args[1:])
+}
+
+func load(fs *flag.FlagSet, args []string) (*Config, error) {
 	var cfg Config
-	if err := env.Parse(&cfg); err != nil {
+	if err := env.ParseWithOptions(&cfg, env.Options{Environment: map[string]string{}}); err != nil {
+		return nil, err
+	}
+	path := configPath(args)
+	if path != "" {
+		if err := readFile(path, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := env.ParseWithOptions(&cfg, env.Options{DefaultValueTagName: noDefaultsTag}); err != nil {
 		return nil, err
 	}
 
-	serverHostPortFlag := flag.String("server-host-port", cfg.ServerHostPort, "server host and port")
-	cacheSizeFlag := flag.Int("cache-size", cfg.CacheSize, "LRU cache size")
-	cacheTTLFlag := flag.String("default-cache-ttl", cfg.DefaultCacheTTL.String(), "default TTL (e.g. 30s, 1m, 2m30s)")
-	logLevelFlag := flag.String("log-level", cfg.LogLevel, "log level (DEBUG|INFO|WARN|ERROR)")
+	// Значение уже прочитано configPath; флаг объявлен для -help и для того, чтобы Parse его принял.
+	fs.String("config", path, "path to YAML config file (precedence: flags > env > file > defaults)")
+
+	serverHostPortFlag := fs.String("server-host-port", cfg.ServerHostPort, "server host and port")
+	cacheSizeFlag := fs.Int("cache-size", cfg.CacheSize, "LRU cache size")
+	cacheTTLFlag := fs.Duration("default-cache-ttl", cfg.DefaultCacheTTL, "default TTL (e.g. 30s, 1m, 2m30s)")
+	logLevelFlag := fs.String("log-level", cfg.LogLevel, "log level (DEBUG|INFO|WARN|ERROR)")
+	cacheCompressionFlag := fs.String("cache-compression", cfg.CacheCompression, "value compression inside the cache (none|gzip)")
+	cacheCompressionThresholdFlag := fs.Int("cache-compression-threshold", cfg.CacheCompressionThreshold, "minimum value size in bytes to compress")
+	cacheDiskDirFlag := fs.String("cache-disk-dir", cfg.CacheDiskDir, "directory for the on-disk second cache tier (empty disables it)")
+	cacheDiskMaxBytesFlag := fs.Int64("cache-disk-max-bytes", cfg.CacheDiskMaxBytes, "maximum total size of the on-disk cache tier in bytes")
+	cacheEngineFlag := fs.String("cache-engine", cfg.CacheEngine, "cache storage engine (lru|slab)")
+	cacheSlabMaxBytesFlag := fs.Int("cache-slab-max-bytes", cfg.CacheSlabMaxBytes, "memory reserved for keys and values by the slab engine in bytes")
+	authKeysFileFlag := fs.String("auth-keys-file", cfg.AuthKeysFile, "path to JSON file with API keys (empty disables auth)")
+	tlsCertFileFlag := fs.String("tls-cert-file", cfg.TLSCertFile, "path to PEM server certificate (enables TLS)")
+	tlsKeyFileFlag := fs.String("tls-key-file", cfg.TLSKeyFile, "path to PEM server private key")
+	tlsClientCAFileFlag := fs.String("tls-client-ca-file", cfg.TLSClientCAFile, "path to PEM client CA bundle (enables mTLS)")
+	tlsRequireClientCertFlag := fs.Bool("tls-require-client-cert", cfg.TLSRequireClientCert, "reject TLS clients without a certificate")
+	tlsMinVersionFlag := fs.String("tls-min-version", cfg.TLSMinVersion, "minimum TLS version (1.2|1.3)")
+	tlsReloadIntervalFlag := fs.Duration("tls-reload-interval", cfg.TLSReloadInterval, "how often to check certificate files for changes (0 disables reload)")
+	rateLimitReadRPSFlag := fs.Float64("rate-limit-read-rps", cfg.RateLimitReadRPS, "per-client read requests per second (0 disables)")
+	rateLimitReadBurstFlag := fs.Int("rate-limit-read-burst", cfg.RateLimitReadBurst, "per-client read burst size")
+	rateLimitWriteRPSFlag := fs.Float64("rate-limit-write-rps", cfg.RateLimitWriteRPS, "per-client write requests per second (0 disables)")
+	rateLimitWriteBurstFlag := fs.Int("rate-limit-write-burst", cfg.RateLimitWriteBurst, "per-client write burst size")
+	rateLimitMaxClientsFlag := fs.Int("rate-limit-max-clients", cfg.RateLimitMaxClients, "maximum number of clients tracked by the rate limiter")
+	proxyUpstreamFlag := fs.String("proxy-upstream", cfg.ProxyUpstream, "upstream base URL for caching reverse-proxy mode (empty disables)")
+	proxyTimeoutFlag := fs.Duration("proxy-timeout", cfg.ProxyTimeout, "timeout for requests to the proxy upstream")
+	webhooksFileFlag := fs.String("webhooks-file", cfg.WebhooksFile, "path to JSON file with webhook receivers (empty disables webhooks)")
+	webhookQueueSizeFlag := fs.Int("webhook-queue-size", cfg.WebhookQueueSize, "maximum number of undelivered webhook events")
+	webhookMaxAttemptsFlag := fs.Int("webhook-max-attempts", cfg.WebhookMaxAttempts, "delivery attempts per webhook event")
+	expirySweepIntervalFlag := fs.Duration("expiry-sweep-interval", cfg.ExpirySweepInterval, "how often to remove expired entries (0 disables)")
+	clusterSelfFlag := fs.String("cluster-self", cfg.ClusterSelf, "this node's address as seen by peers, e.g. http://10.0.0.1:8080 (empty disables cluster mode)")
+	clusterPeersFlag := fs.String("cluster-peers", strings.Join(cfg.ClusterPeers, ","), "comma-separated list of peer addresses")
+	clusterPeersFileFlag := fs.String("cluster-peers-file", cfg.ClusterPeersFile, "path to JSON file with peer addresses, reloaded on change")
+	clusterVirtualNodesFlag := fs.Int("cluster-virtual-nodes", cfg.ClusterVirtualNodes, "number of virtual nodes per peer on the hash ring")
+	replicationEnabledFlag := fs.Bool("replication-enabled", cfg.ReplicationEnabled, "keep a replication log that followers can stream")
+	replicationLeaderFlag := fs.String("replication-leader", cfg.ReplicationLeader, "leader base URL; starts this node as a read-only follower")
+	replicationAPIKeyFlag := fs.String("replication-api-key", cfg.ReplicationAPIKey, "API key with admin scope used to connect to the leader")
+	replicationLogSizeFlag := fs.Int("replication-log-size", cfg.ReplicationLogSize, "number of recent write operations kept for resuming followers")
+	gossipBindFlag := fs.String("gossip-bind", cfg.GossipBind, "UDP/TCP address for gossip membership, e.g. 0.0.0.0:7946 (empty disables gossip)")
+	gossipAdvertiseFlag := fs.String("gossip-advertise", cfg.GossipAdvertise, "gossip address announced to other nodes")
+	gossipNameFlag := fs.String("gossip-name", cfg.GossipName, "unique node name in the gossip cluster (defaults to the advertise address)")
+	gossipSeedsFlag := fs.String("gossip-seeds", strings.Join(cfg.GossipSeeds, ","), "comma-separated gossip addresses of nodes to join")
+	invalidationPeersFlag := fs.String("invalidation-peers", strings.Join(cfg.InvalidationPeers, ","), "comma-separated base URLs of instances that receive evictions from this one")
+	invalidationAPIKeyFlag := fs.String("invalidation-api-key", cfg.InvalidationAPIKey, "API key with admin scope used to send evictions to peers")
+	invalidationQueueSizeFlag := fs.Int("invalidation-queue-size", cfg.InvalidationQueueSize, "maximum number of unacknowledged evictions kept per peer")
+	loaderURLFlag := fs.String("loader-url", cfg.LoaderURL, "backend base URL used to load missing keys as <url>/<key> (empty disables read-through)")
+	loaderTTLFlag := fs.Duration("loader-ttl", cfg.LoaderTTL, "TTL of loaded entries (0 uses the default TTL)")
+	loaderTimeoutFlag := fs.Duration("loader-timeout", cfg.LoaderTimeout, "timeout for requests to the loader backend")
+	peerFillSelfFlag := fs.String("peer-fill-self", cfg.PeerFillSelf, "this node's address in the peer fill group, e.g. http://10.0.0.1:8080")
+	peerFillPeersFlag := fs.String("peer-fill-peers", strings.Join(cfg.PeerFillPeers, ","), "comma-separated addresses of nodes that share loads (empty loads every key locally)")
+	peerFillAPIKeyFlag := fs.String("peer-fill-api-key", cfg.PeerFillAPIKey, "API key with read scope used to fetch keys from their owners")
+	peerFillHotSizeFlag := fs.Int("peer-fill-hot-size", cfg.PeerFillHotSize, "capacity of the local copy of keys fetched from owners (0 disables)")
+	peerFillHotTTLFlag := fs.Duration("peer-fill-hot-ttl", cfg.PeerFillHotTTL, "maximum lifetime of a local copy of a key fetched from its owner")
+	tracingExporterFlag := fs.String("tracing-exporter", cfg.TracingExporter, "trace exporter (none|stdout|file|otlp)")
+	tracingFileFlag := fs.String("tracing-file", cfg.TracingFile, "output file for the file trace exporter")
+	tracingOTLPEndpointFlag := fs.String("tracing-otlp-endpoint", cfg.TracingOTLPEndpoint, "OTLP/HTTP collector host:port")
+	tracingOTLPInsecureFlag := fs.Bool("tracing-otlp-insecure", cfg.TracingOTLPInsecure, "send traces to the OTLP collector without TLS")
+	tracingSampleRatioFlag := fs.Float64("tracing-sample-ratio", cfg.TracingSampleRatio, "fraction of root requests to trace (0..1)")
+	drainDelayFlag := fs.Duration("shutdown-drain-delay", cfg.ShutdownDrainDelay, "delay between SIGTERM and server shutdown while /readyz reports 503")
 
-	flag.Parse()
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
 
 	cfg.ServerHostPort = *serverHostPortFlag
 	cfg.CacheSize = *cacheSizeFlag
 	cfg.LogLevel = *logLevelFlag
+	cfg.ShutdownDrainDelay = *drainDelayFlag
+	cfg.CacheCompression = *cacheCompressionFlag
+	cfg.CacheCompressionThreshold = *cacheCompressionThresholdFlag
+	cfg.CacheDiskDir = *cacheDiskDirFlag
+	cfg.CacheDiskMaxBytes = *cacheDiskMaxBytesFlag
+	cfg.CacheEngine = *cacheEngineFlag
+	cfg.CacheSlabMaxBytes = *cacheSlabMaxBytesFlag
+	cfg.AuthKeysFile = *authKeysFileFlag
+	cfg.TLSCertFile = *tlsCertFileFlag
+	cfg.TLSKeyFile = *tlsKeyFileFlag
+	cfg.TLSClientCAFile = *tlsClientCAFileFlag
+	cfg.TLSRequireClientCert = *tlsRequireClientCertFlag
+	cfg.TLSMinVersion = *tlsMinVersionFlag
+	cfg.TLSReloadInterval = *tlsReloadIntervalFlag
+	cfg.RateLimitReadRPS = *rateLimitReadRPSFlag
+	cfg.RateLimitReadBurst = *rateLimitReadBurstFlag
+	cfg.RateLimitWriteRPS = *rateLimitWriteRPSFlag
+	cfg.RateLimitWriteBurst = *rateLimitWriteBurstFlag
+	cfg.RateLimitMaxClients = *rateLimitMaxClientsFlag
+	cfg.ProxyUpstream = *proxyUpstreamFlag
+	cfg.ProxyTimeout = *proxyTimeoutFlag
+	cfg.WebhooksFile = *webhooksFileFlag
+	cfg.WebhookQueueSize = *webhookQueueSizeFlag
+	cfg.WebhookMaxAttempts = *webhookMaxAttemptsFlag
+	cfg.ExpirySweepInterval = *expirySweepIntervalFlag
+	cfg.ClusterSelf = *clusterSelfFlag
+	cfg.ClusterPeers = splitList(*clusterPeersFlag)
+	cfg.ClusterPeersFile = *clusterPeersFileFlag
+	cfg.ClusterVirtualNodes = *clusterVirtualNodesFlag
+	cfg.ReplicationEnabled = *replicationEnabledFlag
+	cfg.ReplicationLeader = *replicationLeaderFlag
+	cfg.ReplicationAPIKey = *replicationAPIKeyFlag
+	cfg.ReplicationLogSize = *replicationLogSizeFlag
+	cfg.GossipBind = *gossipBindFlag
+	cfg.GossipAdvertise = *gossipAdvertiseFlag
+	cfg.GossipName = *gossipNameFlag
+	cfg.GossipSeeds = splitList(*gossipSeedsFlag)
+	cfg.InvalidationPeers = splitList(*invalidationPeersFlag)
+	cfg.InvalidationAPIKey = *invalidationAPIKeyFlag
+	cfg.InvalidationQueueSize = *invalidationQueueSizeFlag
+	cfg.LoaderURL = *loaderURLFlag
+	cfg.LoaderTTL = *loaderTTLFlag
+	cfg.LoaderTimeout = *loaderTimeoutFlag
+	cfg.PeerFillSelf = *peerFillSelfFlag
+	cfg.PeerFillPeers = splitList(*peerFillPeersFlag)
+	cfg.PeerFillAPIKey = *peerFillAPIKeyFlag
+	cfg.PeerFillHotSize = *peerFillHotSizeFlag
+	cfg.PeerFillHotTTL = *peerFillHotTTLFlag
+	cfg.TracingExporter = *tracingExporterFlag
+	cfg.TracingFile = *tracingFileFlag
+	cfg.TracingOTLPEndpoint = *tracingOTLPEndpointFlag
+	cfg.TracingOTLPInsecure = *tracingOTLPInsecureFlag
+	cfg.TracingSampleRatio = *tracingSampleRatioFlag
+
+	cfg.DefaultCacheTTL = *cacheTTLFlag
 
-	ttl, err := time.ParseDuration(*cacheTTLFlag)
-	if err != nil || ttl <= 0 {
-		slog.Warn("Invalid TTL provided, using default value", slog.String("ttl", *cacheTTLFlag))
-	} else {
-		cfg.DefaultCacheTTL = ttl
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
 	}
 
 	slog.Debug("Application configuration",
+		slog.String("config_file", path),
 		slog.String("server_host_port", cfg.ServerHostPort),
 		slog.Int("cache_size", cfg.CacheSize),
 		slog.String("cache_ttl", cfg.DefaultCacheTTL.String()),
 		slog.String("log_level", cfg.LogLevel),
+		slog.String("cache_compression", cfg.CacheCompression),
+		slog.String("cache_disk_dir", cfg.CacheDiskDir),
+		slog.String("cache_engine", cfg.CacheEngine),
+		slog.Duration("shutdown_drain_delay", cfg.ShutdownDrainDelay),
+		slog.Bool("auth_enabled", cfg.AuthKeysFile != ""),
+		slog.Bool("tls_enabled", cfg.TLSCertFile != ""),
+		slog.Bool("mtls_enabled", cfg.TLSClientCAFile != ""),
+		slog.Float64("rate_limit_read_rps", cfg.RateLimitReadRPS),
+		slog.Float64("rate_limit_write_rps", cfg.RateLimitWriteRPS),
+		slog.String("proxy_upstream", cfg.ProxyUpstream),
+		slog.Bool("webhooks_enabled", cfg.WebhooksFile != ""),
+		slog.Duration("expiry_sweep_interval", cfg.ExpirySweepInterval),
+		slog.String("cluster_self", cfg.ClusterSelf),
+		slog.Any("cluster_peers", cfg.ClusterPeers),
+		slog.Bool("replication_enabled", cfg.ReplicationEnabled || cfg.ReplicationLeader != ""),
+		slog.String("replication_leader", cfg.ReplicationLeader),
+		slog.String("gossip_bind", cfg.GossipBind),
+		slog.Any("gossip_seeds", cfg.GossipSeeds),
+		slog.Any("invalidation_peers", cfg.InvalidationPeers),
+		slog.String("loader_url", cfg.LoaderURL),
+		slog.Any("peer_fill_peers", cfg.PeerFillPeers),
+		slog.String("tracing_exporter", cfg.TracingExporter),
 	)
 
 	return &cfg, nil
-}
\ No newline at end of file
+}
+
+// splitList разбирает список через запятую, отбрасывая пустые элементы.
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
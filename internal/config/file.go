@@ -0,0 +1,185 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/caarlos0/env/v11"
+	"gopkg.in/yaml.v3"
+)
+
+// noDefaultsTag — несуществующий тег значений по умолчанию: с ним env меняет
+// только поля, для которых задана переменная, и не затирает значения из файла.
+const noDefaultsTag = "envNoDefault"
+
+// ReloadableKeys — ключи конфигурации, изменения которых применяются по SIGHUP
+// без перезапуска.
+var ReloadableKeys = []string{
+	"log_level",
+	"cache_size",
+	"default_cache_ttl",
+	"rate_limit_read_rps",
+	"rate_limit_read_burst",
+	"rate_limit_write_rps",
+	"rate_limit_write_burst",
+	"rate_limit_max_clients",
+}
+
+// fileKey описывает поле Config, доступное в файле конфигурации.
+type fileKey struct {
+	env  string
+	typ  string
+	list bool
+}
+
+// fileKeys возвращает ключи файла конфигурации: имена переменных окружения
+// в нижнем регистре.
+func fileKeys() map[string]fileKey {
+	keys := make(map[string]fileKey)
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("env"), ",")
+		if name == "" {
+			continue
+		}
+		keys[strings.ToLower(name)] = fileKey{env: name, typ: f.Type.String(), list: f.Type.Kind() == reflect.Slice}
+	}
+	return keys
+}
+
+// configPath находит значение флага -config до разбора остальных флагов:
+// от файла зависят их значения по умолчанию. Позиционных аргументов у
+// сервиса нет, поэтому прочие элементы — флаги и их значения — пропускаются.
+func configPath(args []string) string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// readFile применяет к cfg значения из YAML-файла. Файл — плоский словарь,
+// ключи которого совпадают с именами переменных окружения в нижнем регистре,
+// а значения разбираются так же, как значения переменных. Неизвестные ключи
+// и значения неверного типа дают ошибку с номером строки.
+func readFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("config file %s: line %d: top level must be a mapping of settings", path, root.Line)
+	}
+
+	keys := fileKeys()
+	seen := make(map[string]bool)
+	var errs []error
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		keyNode, valueNode := root.Content[i], root.Content[i+1]
+		key := keyNode.Value
+		fk, ok := keys[key]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("line %d: unknown key %q", keyNode.Line, key))
+			continue
+		case seen[key]:
+			errs = append(errs, fmt.Errorf("line %d: duplicate key %q", keyNode.Line, key))
+			continue
+		}
+		seen[key] = true
+
+		value, err := nodeValue(valueNode, fk.list)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %s: %w", valueNode.Line, key, err))
+			continue
+		}
+		if value == "" {
+			continue
+		}
+		err = env.ParseWithOptions(cfg, env.Options{
+			Environment:         map[string]string{fk.env: value},
+			DefaultValueTagName: noDefaultsTag,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %s: invalid value %q, expected %s", valueNode.Line, key, value, fk.typ))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("config file %s:\n%w", path, err)
+	}
+	return nil
+}
+
+// nodeValue приводит значение YAML к строке в формате переменной окружения;
+// списки допускаются только для полей-списков и склеиваются через запятую.
+func nodeValue(n *yaml.Node, list bool) (string, error) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return "", nil
+		}
+		return n.Value, nil
+	case yaml.SequenceNode:
+		if !list {
+			return "", errors.New("expected a single value, got a list")
+		}
+		items := make([]string, 0, len(n.Content))
+		for _, item := range n.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", errors.New("list items must be plain values")
+			}
+			items = append(items, item.Value)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", errors.New("expected a plain value")
+	}
+}
+
+// RestartRequired возвращает ключи, значения которых в next отличаются от
+// prev, но применяются только при запуске.
+func RestartRequired(prev, next *Config) []string {
+	var changed []string
+	pv, nv := reflect.ValueOf(*prev), reflect.ValueOf(*next)
+	t := pv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("env"), ",")
+		key := strings.ToLower(name)
+		if key == "" || slices.Contains(ReloadableKeys, key) {
+			continue
+		}
+		if !reflect.DeepEqual(pv.Field(i).Interface(), nv.Field(i).Interface()) {
+			changed = append(changed, key)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func loadArgs(t *testing.T, args ...string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return load(fs, args)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+cache_size: 100
+default_cache_ttl: 5m
+log_level: INFO
+cluster_peers:
+  - http://10.0.0.2:8080
+  - http://10.0.0.3:8080
+rate_limit_read_rps: 50
+`)
+	t.Setenv("CACHE_SIZE", "200")
+	t.Setenv("LOG_LEVEL", "")
+
+	cfg, err := loadArgs(t, "-config", path, "-default-cache-ttl", "10m")
+	require.NoError(t, err)
+
+	assert.Equal(t, 200, cfg.CacheSize, "env overrides file")
+	assert.Equal(t, 10*time.Minute, cfg.DefaultCacheTTL, "flag overrides file")
+	assert.Equal(t, "INFO", cfg.LogLevel, "empty env var does not override file")
+	assert.Equal(t, []string{"http://10.0.0.2:8080", "http://10.0.0.3:8080"}, cfg.ClusterPeers)
+	assert.Equal(t, 50.0, cfg.RateLimitReadRPS)
+	assert.Equal(t, 100, cfg.RateLimitReadBurst, "keys missing from the file keep defaults")
+	assert.Equal(t, "localhost:8080", cfg.ServerHostPort)
+
+	cfg, err = loadArgs(t, "-config="+path, "-cache-size", "300")
+	require.NoError(t, err)
+	assert.Equal(t, 300, cfg.CacheSize, "flag overrides env")
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	cfg, err := loadArgs(t)
+	require.NoError(t, err)
+	assert.Equal(t, 10, cfg.CacheSize)
+	assert.Equal(t, time.Minute, cfg.DefaultCacheTTL)
+	assert.Equal(t, "WARN", cfg.LogLevel)
+}
+
+func TestReadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{name: "Unknown key", content: "cache_size: 1\ncache_sise: 2\n", want: []string{`line 2: unknown key "cache_sise"`}},
+		{name: "Wrong type", content: "cache_size: many\n", want: []string{`line 1: cache_size: invalid value "many", expected int`}},
+		{name: "List for scalar", content: "log_level:\n  - INFO\n", want: []string{"line 2: log_level: expected a single value"}},
+		{name: "Nested mapping", content: "tls_cert_file:\n  path: a\n", want: []string{"line 2: tls_cert_file: expected a plain value"}},
+		{name: "Duplicate key", content: "cache_size: 1\ncache_size: 2\n", want: []string{`line 2: duplicate key "cache_size"`}},
+		{name: "Not a mapping", content: "- cache_size\n", want: []string{"top level must be a mapping"}},
+		{name: "Several errors", content: "a: 1\nb: 2\n", want: []string{`unknown key "a"`, `unknown key "b"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			err := readFile(writeConfigFile(t, tt.content), &cfg)
+			require.Error(t, err)
+			for _, want := range tt.want {
+				assert.Contains(t, err.Error(), want)
+			}
+		})
+	}
+
+	_, err := loadArgs(t, "-config", filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestValidate(t *testing.T) {
+	path := writeConfigFile(t, `
+cache_size: 0
+log_level: verbose
+tracing_sample_ratio: 2
+`)
+	_, err := loadArgs(t, "-config", path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cache_size: must be >= 1, got 0")
+	assert.Contains(t, err.Error(), `log_level: "verbose" is not one of [DEBUG INFO WARN ERROR]`)
+	assert.Contains(t, err.Error(), "tracing_sample_ratio: must be within [0, 1], got 2")
+}
+
+func TestInvalidDefaultTTL(t *testing.T) {
+	_, err := loadArgs(t, "-default-cache-ttl", "soon")
+	assert.ErrorContains(t, err, "default-cache-ttl")
+
+	_, err = loadArgs(t, "-default-cache-ttl", "0s")
+	assert.ErrorContains(t, err, "default_cache_ttl: must be > 0")
+
+	t.Setenv("DEFAULT_CACHE_TTL", "-1m")
+	_, err = loadArgs(t)
+	assert.ErrorContains(t, err, "default_cache_ttl: must be > 0, got -1m0s")
+}
+
+func TestConfigPath(t *testing.T) {
+	assert.Equal(t, "a.yaml", configPath([]string{"-cache-size", "5", "-config", "a.yaml"}))
+	assert.Equal(t, "b.yaml", configPath([]string{"--config=b.yaml"}))
+	assert.Empty(t, configPath([]string{"--", "-config", "c.yaml"}))
+	assert.Empty(t, configPath([]string{"-log-level", "INFO"}))
+}
+
+func TestRestartRequired(t *testing.T) {
+	prev, err := loadArgs(t)
+	require.NoError(t, err)
+	next := *prev
+	next.CacheSize = 50
+	next.LogLevel = "DEBUG"
+	next.ServerHostPort = "0.0.0.0:9090"
+	next.ClusterPeers = []string{"http://10.0.0.2:8080"}
+
+	assert.Equal(t, []string{"server_host_port", "cluster_peers"}, RestartRequired(prev, &next))
+}
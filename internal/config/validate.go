@@ -0,0 +1,43 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Validate проверяет значения, при которых сервис не может работать или
+// молча подменил бы их другими. Ошибки перечисляются по ключам файла
+// конфигурации (имя переменной окружения в нижнем регистре).
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]interface{}{key}, args...)...))
+		}
+	}
+	// Пустое значение означает значение по умолчанию и допустимо везде, где
+	// перечислены варианты.
+	oneOf := func(key, value string, allowed ...string) {
+		check(value == "" || slices.Contains(allowed, value), key, "%q is not one of %v", value, allowed)
+	}
+
+	check(c.ServerHostPort != "", "server_host_port", "must not be empty")
+	check(c.CacheSize >= 1, "cache_size", "must be >= 1, got %d", c.CacheSize)
+	check(c.DefaultCacheTTL > 0, "default_cache_ttl", "must be > 0, got %s", c.DefaultCacheTTL)
+	oneOf("log_level", c.LogLevel, "DEBUG", "INFO", "WARN", "ERROR")
+	oneOf("cache_compression", c.CacheCompression, "none", "gzip")
+	oneOf("cache_engine", c.CacheEngine, "lru", "slab")
+	check(c.CacheSlabMaxBytes > 0, "cache_slab_max_bytes", "must be > 0, got %d", c.CacheSlabMaxBytes)
+	check(c.CacheDiskMaxBytes > 0, "cache_disk_max_bytes", "must be > 0, got %d", c.CacheDiskMaxBytes)
+	oneOf("tls_min_version", c.TLSMinVersion, "1.2", "1.3")
+	check(c.RateLimitReadRPS >= 0, "rate_limit_read_rps", "must be >= 0, got %g", c.RateLimitReadRPS)
+	check(c.RateLimitWriteRPS >= 0, "rate_limit_write_rps", "must be >= 0, got %g", c.RateLimitWriteRPS)
+	check(c.RateLimitReadBurst >= 0, "rate_limit_read_burst", "must be >= 0, got %d", c.RateLimitReadBurst)
+	check(c.RateLimitWriteBurst >= 0, "rate_limit_write_burst", "must be >= 0, got %d", c.RateLimitWriteBurst)
+	check(c.ExpirySweepInterval >= 0, "expiry_sweep_interval", "must be >= 0, got %s", c.ExpirySweepInterval)
+	oneOf("tracing_exporter", c.TracingExporter, "none", "stdout", "file", "otlp")
+	check(c.TracingSampleRatio >= 0 && c.TracingSampleRatio <= 1, "tracing_sample_ratio", "must be within [0, 1], got %g", c.TracingSampleRatio)
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,456 @@
+// Package invalidation рассылает удаления ключей между независимыми
+// экземплярами кэша. Удаление на одном экземпляре передаётся остальным
+// HTTP-запросами с повторами до подтверждения (доставка «хотя бы один раз»),
+// получатель отбрасывает повторно доставленные сообщения по их идентификатору
+// и применяет остальные к своему кэшу.
+package invalidation
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// Path — эндпоинт, на который узлы присылают сообщения об инвалидации.
+const Path = "/api/invalidation"
+
+// Типы сообщений.
+const (
+	// TypeEvict — удалить ключ Key.
+	TypeEvict = "evict"
+	// TypeClear — очистить кэш полностью.
+	TypeClear = "clear"
+)
+
+// ErrInvalidMessage сообщает, что сообщение не может быть применено ни при
+// какой повторной доставке.
+var ErrInvalidMessage = errors.New("invalid invalidation message")
+
+// errRejected — узел отклонил пачку как некорректную; повторять её бессмысленно.
+var errRejected = errors.New("peer rejected the batch")
+
+// Message — сообщение об инвалидации.
+type Message struct {
+	// ID уникален для сообщения и одинаков во всех повторных доставках.
+	ID string `json:"id"`
+	// Origin — идентификатор экземпляра, на котором произошло удаление.
+	Origin string `json:"origin"`
+	Type   string `json:"type"`
+	Key    string `json:"key,omitempty"`
+	// Time — момент удаления по часам отправителя; по нему считается задержка распространения.
+	Time time.Time `json:"time"`
+}
+
+// Batch — тело запроса к Path.
+type Batch struct {
+	Messages []Message `json:"messages"`
+}
+
+// Options описывает параметры рассылки.
+type Options struct {
+	// Peers — базовые адреса остальных экземпляров (http://host:port).
+	Peers []string
+	// APIKey передаётся узлам в заголовке Authorization, если на них включена аутентификация.
+	APIKey string
+	// QueueSize ограничивает число неподтверждённых сообщений для одного узла;
+	// при переполнении отбрасываются самые старые.
+	QueueSize int
+	// BatchSize — сколько сообщений отправляется одним запросом.
+	BatchSize int
+	// RetryInterval и MaxRetryInterval задают экспоненциальную паузу между
+	// попытками отправки недоступному узлу.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	// Timeout ограничивает одну попытку отправки.
+	Timeout time.Duration
+	// DedupSize — сколько последних идентификаторов сообщений помнит получатель.
+	DedupSize int
+	// Transport позволяет подменить HTTP-транспорт (например, в тестах).
+	Transport http.RoundTripper
+}
+
+// Stats — счётчики рассылки и приёма.
+type Stats struct {
+	Origin string      `json:"origin"`
+	Peers  []PeerStats `json:"peers"`
+	// Received — число принятых сообщений, включая повторы; Duplicates — из них повторы.
+	Received   uint64 `json:"received"`
+	Duplicates uint64 `json:"duplicates"`
+	// Lag — задержка распространения: от удаления на отправителе до
+	// применения здесь, в миллисекундах.
+	Lag LagStats `json:"lag"`
+}
+
+// LagStats описывает задержку распространения в миллисекундах.
+type LagStats struct {
+	LastMs float64 `json:"last_ms"`
+	AvgMs  float64 `json:"avg_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+// PeerStats — состояние отправки одному узлу.
+type PeerStats struct {
+	URL       string `json:"url"`
+	Pending   int    `json:"pending"`
+	Sent      uint64 `json:"sent"`
+	Dropped   uint64 `json:"dropped"`
+	Failures  uint64 `json:"failures"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Bus рассылает удаления узлам и применяет полученные от них.
+type Bus struct {
+	cache  cache.ILRUCache
+	opts   Options
+	origin string
+	client *http.Client
+	peers  []*peer
+
+	mu         sync.Mutex
+	seen       map[string]struct{}
+	seenOrder  []string
+	seenNext   int
+	received   uint64
+	duplicates uint64
+	applied    uint64
+	lagLast    time.Duration
+	lagTotal   time.Duration
+	lagMax     time.Duration
+}
+
+// peer — очередь неподтверждённых сообщений для одного узла.
+type peer struct {
+	url    string
+	notify chan struct{}
+
+	mu        sync.Mutex
+	queue     []Message
+	sent      uint64
+	dropped   uint64
+	failures  uint64
+	lastError string
+}
+
+// New создаёт шину инвалидации для кэша c. Отправка начинается после вызова Run.
+func New(c cache.ILRUCache, opts Options) *Bus {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 10000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = 100 * time.Millisecond
+	}
+	if opts.MaxRetryInterval <= 0 {
+		opts.MaxRetryInterval = 30 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.DedupSize <= 0 {
+		opts.DedupSize = 100000
+	}
+	transport := opts.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	b := &Bus{
+		cache:     c,
+		opts:      opts,
+		origin:    newID(),
+		client:    &http.Client{Transport: transport, Timeout: opts.Timeout},
+		seen:      make(map[string]struct{}, opts.DedupSize),
+		seenOrder: make([]string, opts.DedupSize),
+	}
+	for _, u := range opts.Peers {
+		b.peers = append(b.peers, &peer{url: strings.TrimRight(u, "/"), notify: make(chan struct{}, 1)})
+	}
+	return b
+}
+
+// Origin возвращает идентификатор этого экземпляра в сообщениях.
+func (b *Bus) Origin() string {
+	return b.origin
+}
+
+// Run отправляет сообщения узлам, пока не отменён ctx. Неотправленные к
+// этому моменту сообщения теряются.
+func (b *Bus) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, p := range b.peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.deliver(ctx, p)
+		}()
+	}
+	wg.Wait()
+}
+
+// Evict рассылает удаление ключа key. Вызывается после удаления из локального кэша.
+func (b *Bus) Evict(key string) {
+	b.publish(Message{Type: TypeEvict, Key: key})
+}
+
+// Clear рассылает полную очистку кэша.
+func (b *Bus) Clear() {
+	b.publish(Message{Type: TypeClear})
+}
+
+func (b *Bus) publish(msg Message) {
+	msg.ID = newID()
+	msg.Origin = b.origin
+	msg.Time = time.Now()
+
+	// Собственное сообщение, вернувшееся от узла, не нужно применять повторно.
+	b.mu.Lock()
+	b.remember(msg.ID)
+	b.mu.Unlock()
+
+	for _, p := range b.peers {
+		p.mu.Lock()
+		if len(p.queue) >= b.opts.QueueSize {
+			p.queue = p.queue[1:]
+			p.dropped++
+			slog.Warn("Invalidation queue is full, dropping oldest message",
+				slog.String("peer", p.url),
+			)
+		}
+		p.queue = append(p.queue, msg)
+		p.mu.Unlock()
+
+		select {
+		case p.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Receive применяет сообщения, полученные от другого узла. Повторы и
+// собственные сообщения пропускаются. Возвращает число применённых сообщений.
+func (b *Bus) Receive(ctx context.Context, msgs []Message) (int, error) {
+	applied := 0
+	for _, msg := range msgs {
+		switch msg.Type {
+		case TypeEvict:
+			if msg.Key == "" {
+				return applied, fmt.Errorf("%w %q: empty key", ErrInvalidMessage, msg.ID)
+			}
+		case TypeClear:
+		default:
+			return applied, fmt.Errorf("%w %q: unknown type %q", ErrInvalidMessage, msg.ID, msg.Type)
+		}
+
+		b.mu.Lock()
+		b.received++
+		_, dup := b.seen[msg.ID]
+		if dup || msg.ID == "" || msg.Origin == b.origin {
+			b.duplicates++
+			b.mu.Unlock()
+			continue
+		}
+		b.mu.Unlock()
+
+		var err error
+		if msg.Type == TypeClear {
+			err = b.cache.EvictAll(ctx)
+		} else if _, err = b.cache.Evict(ctx, msg.Key); errors.Is(err, cache.ErrKeyNotFound) {
+			err = nil
+		}
+		if err != nil {
+			// Сообщение не запоминается, чтобы повторная доставка его применила.
+			return applied, err
+		}
+
+		lag := time.Since(msg.Time)
+		b.mu.Lock()
+		b.remember(msg.ID)
+		b.applied++
+		b.lagLast = lag
+		b.lagTotal += lag
+		b.lagMax = max(b.lagMax, lag)
+		b.mu.Unlock()
+		applied++
+	}
+	return applied, nil
+}
+
+// remember запоминает идентификатор, вытесняя самый старый. Вызывается под b.mu.
+func (b *Bus) remember(id string) {
+	if _, ok := b.seen[id]; ok {
+		return
+	}
+	if old := b.seenOrder[b.seenNext]; old != "" {
+		delete(b.seen, old)
+	}
+	b.seenOrder[b.seenNext] = id
+	b.seenNext = (b.seenNext + 1) % len(b.seenOrder)
+	b.seen[id] = struct{}{}
+}
+
+// Stats возвращает текущие счётчики.
+func (b *Bus) Stats() Stats {
+	b.mu.Lock()
+	st := Stats{
+		Origin:     b.origin,
+		Peers:      make([]PeerStats, 0, len(b.peers)),
+		Received:   b.received,
+		Duplicates: b.duplicates,
+		Lag: LagStats{
+			LastMs: milliseconds(b.lagLast),
+			MaxMs:  milliseconds(b.lagMax),
+		},
+	}
+	if b.applied > 0 {
+		st.Lag.AvgMs = milliseconds(b.lagTotal / time.Duration(b.applied))
+	}
+	b.mu.Unlock()
+
+	for _, p := range b.peers {
+		p.mu.Lock()
+		st.Peers = append(st.Peers, PeerStats{
+			URL:       p.url,
+			Pending:   len(p.queue),
+			Sent:      p.sent,
+			Dropped:   p.dropped,
+			Failures:  p.failures,
+			LastError: p.lastError,
+		})
+		p.mu.Unlock()
+	}
+	return st
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// deliver отправляет очередь узла пачками, повторяя пачку до подтверждения.
+func (b *Bus) deliver(ctx context.Context, p *peer) {
+	retry := b.opts.RetryInterval
+	for {
+		p.mu.Lock()
+		batch := p.queue[:min(len(p.queue), b.opts.BatchSize)]
+		batch = append([]Message(nil), batch...)
+		p.mu.Unlock()
+
+		if len(batch) == 0 {
+			select {
+			case <-p.notify:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		err := b.send(ctx, p.url, batch)
+		p.mu.Lock()
+		if errors.Is(err, errRejected) {
+			p.queue = dropAcked(p.queue, batch)
+			p.dropped += uint64(len(batch))
+			p.lastError = err.Error()
+			p.mu.Unlock()
+			slog.Error("Peer rejected invalidations, dropping them",
+				slog.String("peer", p.url),
+				slog.Int("messages", len(batch)),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		if err == nil {
+			p.queue = dropAcked(p.queue, batch)
+			p.sent += uint64(len(batch))
+			p.lastError = ""
+			p.mu.Unlock()
+			retry = b.opts.RetryInterval
+			continue
+		}
+		p.failures++
+		p.lastError = err.Error()
+		p.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+
+		delay := retry/2 + time.Duration(mathrand.Int64N(int64(retry)))
+		slog.Warn("Failed to send invalidations to peer, will retry",
+			slog.String("peer", p.url),
+			slog.Int("messages", len(batch)),
+			slog.Duration("retry_in", delay),
+			slog.String("error", err.Error()),
+		)
+		retry = min(retry*2, b.opts.MaxRetryInterval)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// dropAcked удаляет из начала очереди подтверждённые сообщения. Пока пачка
+// отправлялась, переполнение могло вытеснить часть из них.
+func dropAcked(queue, acked []Message) []Message {
+	last := acked[len(acked)-1].ID
+	for i, msg := range queue {
+		if msg.ID == last {
+			return queue[i+1:]
+		}
+	}
+	// Последнего сообщения пачки в очереди нет — вытеснена вся пачка.
+	return queue
+}
+
+// send отправляет пачку сообщений. Успехом считается только ответ 2xx; на
+// 400 возвращается errRejected, остальные ошибки считаются временными.
+func (b *Bus) send(ctx context.Context, url string, msgs []Message) error {
+	body, err := json.Marshal(Batch{Messages: msgs})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url+Path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.opts.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+b.opts.APIKey)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusBadRequest:
+		return fmt.Errorf("%w: status %d", errRejected, resp.StatusCode)
+	default:
+		return fmt.Errorf("peer responded with status %d", resp.StatusCode)
+	}
+}
+
+// newID генерирует случайный идентификатор сообщения или экземпляра.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
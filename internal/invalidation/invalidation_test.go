@@ -0,0 +1,182 @@
+package invalidation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// receiver поднимает HTTP-обработчик Path для шины b. Пока down == true,
+// он отвечает 503, имитируя недоступный узел.
+func receiver(t *testing.T, b **Bus, down *atomic.Bool) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != Path {
+			http.NotFound(w, r)
+			return
+		}
+		if down != nil && down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var batch Batch
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, err := (*b).Receive(r.Context(), batch.Messages); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func run(t *testing.T, b *Bus) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go b.Run(ctx)
+}
+
+func waitMissing(t *testing.T, c cache.ILRUCache, key string) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		_, _, err := c.Get(context.Background(), key)
+		return err != nil
+	}, 2*time.Second, 5*time.Millisecond, key)
+}
+
+func TestEvictAndClearPropagate(t *testing.T) {
+	ctx := context.Background()
+	ca := cache.NewLRUCache(10, time.Minute)
+	cb := cache.NewLRUCache(10, time.Minute)
+
+	var a, b *Bus
+	tsA := receiver(t, &a, nil)
+	tsB := receiver(t, &b, nil)
+	a = New(ca, Options{Peers: []string{tsB.URL}})
+	b = New(cb, Options{Peers: []string{tsA.URL}})
+	run(t, a)
+	run(t, b)
+
+	for _, c := range []cache.ILRUCache{ca, cb} {
+		require.NoError(t, c.Put(ctx, "k1", "v", 0))
+		require.NoError(t, c.Put(ctx, "k2", "v", 0))
+	}
+
+	_, err := ca.Evict(ctx, "k1")
+	require.NoError(t, err)
+	a.Evict("k1")
+	waitMissing(t, cb, "k1")
+	_, _, err = cb.Get(ctx, "k2")
+	assert.NoError(t, err)
+
+	b.Clear()
+	waitMissing(t, ca, "k2")
+
+	require.Eventually(t, func() bool { return a.Stats().Peers[0].Sent == 1 }, time.Second, 5*time.Millisecond)
+	st := b.Stats()
+	assert.Equal(t, uint64(1), st.Received)
+	assert.Greater(t, st.Lag.MaxMs, 0.0)
+	assert.Equal(t, st.Lag.LastMs, st.Lag.AvgMs)
+}
+
+func TestDeliveryRetriesUntilPeerIsBack(t *testing.T) {
+	ctx := context.Background()
+	cb := cache.NewLRUCache(10, time.Minute)
+	require.NoError(t, cb.Put(ctx, "k", "v", 0))
+
+	var down atomic.Bool
+	down.Store(true)
+	var b *Bus
+	tsB := receiver(t, &b, &down)
+	b = New(cb, Options{})
+
+	a := New(cache.NewLRUCache(10, time.Minute), Options{
+		Peers:            []string{tsB.URL},
+		RetryInterval:    5 * time.Millisecond,
+		MaxRetryInterval: 20 * time.Millisecond,
+	})
+	run(t, a)
+	a.Evict("k")
+
+	require.Eventually(t, func() bool { return a.Stats().Peers[0].Failures >= 2 }, time.Second, 5*time.Millisecond)
+	_, _, err := cb.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, 1, a.Stats().Peers[0].Pending)
+
+	down.Store(false)
+	waitMissing(t, cb, "k")
+	require.Eventually(t, func() bool {
+		p := a.Stats().Peers[0]
+		return p.Pending == 0 && p.LastError == ""
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestReceiveDeduplicates(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewLRUCache(10, time.Minute)
+	b := New(c, Options{DedupSize: 2})
+
+	msg := Message{ID: "m1", Origin: "other", Type: TypeEvict, Key: "k", Time: time.Now()}
+	require.NoError(t, c.Put(ctx, "k", "v", 0))
+	n, err := b.Receive(ctx, []Message{msg})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// Повторная доставка не удаляет записанное после неё значение.
+	require.NoError(t, c.Put(ctx, "k", "v2", 0))
+	n, err = b.Receive(ctx, []Message{msg})
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	got, _, err := c.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", got)
+
+	// Собственные сообщения не применяются.
+	n, err = b.Receive(ctx, []Message{{ID: "m2", Origin: b.Origin(), Type: TypeClear}})
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	// Самые старые идентификаторы забываются.
+	for _, id := range []string{"m3", "m4"} {
+		_, err = b.Receive(ctx, []Message{{ID: id, Origin: "other", Type: TypeEvict, Key: "x", Time: time.Now()}})
+		require.NoError(t, err)
+	}
+	n, err = b.Receive(ctx, []Message{msg})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	st := b.Stats()
+	assert.Equal(t, uint64(6), st.Received)
+	assert.Equal(t, uint64(2), st.Duplicates)
+
+	_, err = b.Receive(ctx, []Message{{ID: "bad", Type: "rename"}})
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+}
+
+func TestQueueOverflowDropsOldest(t *testing.T) {
+	b := New(cache.NewLRUCache(10, time.Minute), Options{Peers: []string{"http://127.0.0.1:1"}, QueueSize: 2})
+	b.Evict("a")
+	b.Evict("b")
+	b.Evict("c")
+
+	p := b.peers[0]
+	require.Len(t, p.queue, 2)
+	assert.Equal(t, []string{"b", "c"}, []string{p.queue[0].Key, p.queue[1].Key})
+	assert.Equal(t, uint64(1), b.Stats().Peers[0].Dropped)
+
+	assert.Equal(t, p.queue[1:], dropAcked(p.queue, p.queue[:1]))
+	assert.Equal(t, p.queue, dropAcked(p.queue, []Message{{ID: "gone"}}))
+}
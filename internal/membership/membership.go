@@ -0,0 +1,431 @@
+// Package membership реализует обнаружение узлов и отслеживание их
+// доступности по протоколу в духе SWIM: узлы проверяют друг друга прямыми и
+// косвенными пингами по UDP, недоступный узел сначала считается
+// подозреваемым и объявляется мёртвым только по истечении таймаута
+// подозрения, а изменения состава распространяются сплетнями (gossip).
+// Присоединение и периодическая сверка полного состава выполняются по TCP.
+package membership
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// State — состояние узла с точки зрения текущего узла.
+type State string
+
+const (
+	// StateAlive — узел отвечает на пинги.
+	StateAlive State = "alive"
+	// StateSuspect — узел не ответил ни на прямой, ни на косвенные пинги;
+	// если за таймаут подозрения он не опровергнет это, он будет признан мёртвым.
+	StateSuspect State = "suspect"
+	// StateDead — узел признан недоступным.
+	StateDead State = "dead"
+	// StateLeft — узел корректно покинул кластер.
+	StateLeft State = "left"
+)
+
+// Member описывает узел кластера.
+type Member struct {
+	Name string `json:"name"`
+	// Addr — адрес host:port для UDP и TCP сообщений протокола.
+	Addr string `json:"addr"`
+	// Meta — произвольные данные узла, например адрес его HTTP API.
+	Meta  string `json:"meta,omitempty"`
+	State State  `json:"state"`
+	// Incarnation увеличивает сам узел, опровергая подозрения о своей недоступности.
+	Incarnation uint64 `json:"incarnation"`
+	// Since — момент перехода в текущее состояние по часам текущего узла.
+	Since time.Time `json:"since"`
+}
+
+// Config описывает параметры узла.
+type Config struct {
+	// Name — уникальное имя узла; по умолчанию совпадает с AdvertiseAddr.
+	Name string
+	// BindAddr — адрес, на котором слушаются UDP и TCP (один и тот же порт).
+	BindAddr string
+	// AdvertiseAddr — адрес, по которому узел доступен остальным; по
+	// умолчанию — фактический адрес BindAddr, если в нём указан конкретный хост.
+	AdvertiseAddr string
+	// Meta передаётся остальным узлам вместе с адресом.
+	Meta string
+	// Seeds — адреса известных узлов для присоединения.
+	Seeds []string
+
+	// ProbeInterval — период проверки одного случайного узла.
+	ProbeInterval time.Duration
+	// ProbeTimeout — ожидание ответа на прямой пинг перед косвенными.
+	ProbeTimeout time.Duration
+	// IndirectChecks — сколько узлов просить проверить недоступный узел.
+	IndirectChecks int
+	// SuspicionTimeout — сколько узел остаётся подозреваемым до признания мёртвым.
+	SuspicionTimeout time.Duration
+	// GossipInterval — период рассылки изменений GossipNodes случайным узлам.
+	GossipInterval time.Duration
+	GossipNodes    int
+	// RetransmitMult — каждое изменение пересылается RetransmitMult * log10(N+1) раз.
+	RetransmitMult int
+	// PushPullInterval — период полной сверки состава со случайным узлом.
+	PushPullInterval time.Duration
+	// DeadTimeout — сколько мёртвые и ушедшие узлы остаются в списке.
+	DeadTimeout time.Duration
+}
+
+// Memberlist хранит состав кластера и выполняет протокол.
+type Memberlist struct {
+	cfg Config
+	udp *net.UDPConn
+	tcp net.Listener
+
+	mu          sync.Mutex
+	self        *Member
+	members     map[string]*Member
+	suspicions  map[string]*time.Timer
+	probeOrder  []string
+	broadcasts  []*broadcast
+	acks        map[uint32]chan struct{}
+	seq         uint32
+	leaving     bool
+	subscribers []func([]Member)
+}
+
+// broadcast — изменение, ожидающее рассылки.
+type broadcast struct {
+	u         update
+	transmits int
+}
+
+// New проверяет конфигурацию и открывает сокеты. Протокол запускается Run.
+func New(cfg Config) (*Memberlist, error) {
+	if cfg.BindAddr == "" {
+		return nil, errors.New("gossip bind address is required")
+	}
+	setDefaults(&cfg)
+
+	tcp, err := net.Listen("tcp", cfg.BindAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listen gossip tcp: %w", err)
+	}
+	// UDP слушается на том же порту, что и TCP: при порте 0 его выбирает TCP.
+	udpAddr, err := net.ResolveUDPAddr("udp", tcp.Addr().String())
+	if err != nil {
+		tcp.Close()
+		return nil, err
+	}
+	udp, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		tcp.Close()
+		return nil, fmt.Errorf("listen gossip udp: %w", err)
+	}
+
+	if cfg.AdvertiseAddr == "" {
+		host, _, _ := net.SplitHostPort(tcp.Addr().String())
+		if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+			tcp.Close()
+			udp.Close()
+			return nil, fmt.Errorf("gossip advertise address is required when binding to %s", cfg.BindAddr)
+		}
+		cfg.AdvertiseAddr = tcp.Addr().String()
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.AdvertiseAddr
+	}
+
+	self := &Member{Name: cfg.Name, Addr: cfg.AdvertiseAddr, Meta: cfg.Meta, State: StateAlive, Since: time.Now()}
+	return &Memberlist{
+		cfg:        cfg,
+		udp:        udp,
+		tcp:        tcp,
+		self:       self,
+		members:    map[string]*Member{self.Name: self},
+		suspicions: make(map[string]*time.Timer),
+		acks:       make(map[uint32]chan struct{}),
+	}, nil
+}
+
+func setDefaults(cfg *Config) {
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = time.Second
+	}
+	if cfg.ProbeTimeout <= 0 || cfg.ProbeTimeout >= cfg.ProbeInterval {
+		cfg.ProbeTimeout = cfg.ProbeInterval / 2
+	}
+	if cfg.IndirectChecks <= 0 {
+		cfg.IndirectChecks = 3
+	}
+	if cfg.SuspicionTimeout <= 0 {
+		cfg.SuspicionTimeout = 5 * cfg.ProbeInterval
+	}
+	if cfg.GossipInterval <= 0 {
+		cfg.GossipInterval = 200 * time.Millisecond
+	}
+	if cfg.GossipNodes <= 0 {
+		cfg.GossipNodes = 3
+	}
+	if cfg.RetransmitMult <= 0 {
+		cfg.RetransmitMult = 4
+	}
+	if cfg.PushPullInterval <= 0 {
+		cfg.PushPullInterval = 30 * time.Second
+	}
+	if cfg.DeadTimeout <= 0 {
+		cfg.DeadTimeout = time.Minute
+	}
+}
+
+// Name возвращает имя этого узла.
+func (m *Memberlist) Name() string {
+	return m.cfg.Name
+}
+
+// Addr возвращает адрес, который узел сообщает остальным.
+func (m *Memberlist) Addr() string {
+	return m.cfg.AdvertiseAddr
+}
+
+// Members возвращает всех известных узлов, включая этот, упорядоченных по имени.
+func (m *Memberlist) Members() []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshot()
+}
+
+func (m *Memberlist) snapshot() []Member {
+	members := make([]Member, 0, len(m.members))
+	for _, mem := range m.members {
+		members = append(members, *mem)
+	}
+	slices.SortFunc(members, func(a, b Member) int { return strings.Compare(a.Name, b.Name) })
+	return members
+}
+
+// OnChange регистрирует функцию, вызываемую с полным составом после каждого
+// изменения. Функция вызывается из горутин протокола и не должна блокироваться.
+func (m *Memberlist) OnChange(fn func([]Member)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscribers = append(m.subscribers, fn)
+}
+
+// Run выполняет протокол, пока не отменён ctx, после чего закрывает сокеты.
+// Присоединение к Seeds повторяется в фоне, пока не удастся хотя бы с одним.
+func (m *Memberlist) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, loop := range []func(context.Context){m.serveUDP, m.serveTCP, m.probeLoop, m.gossipLoop, m.pushPullLoop, m.reapLoop, m.joinSeeds} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loop(ctx)
+		}()
+	}
+
+	<-ctx.Done()
+	m.udp.Close()
+	m.tcp.Close()
+	wg.Wait()
+
+	m.mu.Lock()
+	for _, t := range m.suspicions {
+		t.Stop()
+	}
+	m.mu.Unlock()
+}
+
+// Leave сообщает остальным узлам, что этот узел уходит, и ждёт, пока
+// сообщение будет разослано, но не дольше timeout.
+func (m *Memberlist) Leave(timeout time.Duration) {
+	m.mu.Lock()
+	m.leaving = true
+	m.self.Incarnation++
+	m.self.State = StateLeft
+	m.self.Since = time.Now()
+	m.enqueue(m.self.update())
+	m.mu.Unlock()
+
+	slog.Info("Leaving gossip cluster", slog.String("name", m.cfg.Name))
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		pending := len(m.broadcasts)
+		others := len(m.aliveOthers())
+		m.mu.Unlock()
+		if pending == 0 || others == 0 {
+			return
+		}
+		time.Sleep(m.cfg.GossipInterval / 2)
+	}
+}
+
+// update — сообщение об изменении состояния узла.
+type update struct {
+	Name        string `json:"name"`
+	Addr        string `json:"addr"`
+	Meta        string `json:"meta,omitempty"`
+	State       State  `json:"state"`
+	Incarnation uint64 `json:"incarnation"`
+}
+
+func (mem *Member) update() update {
+	return update{Name: mem.Name, Addr: mem.Addr, Meta: mem.Meta, State: mem.State, Incarnation: mem.Incarnation}
+}
+
+// apply применяет изменение по правилам SWIM: более новое воплощение всегда
+// побеждает, а при равном воплощении dead и left сильнее suspect, а suspect
+// сильнее alive. Принятые изменения рассылаются дальше. Вызывается под m.mu;
+// возвращает true, если состав изменился.
+func (m *Memberlist) apply(u update) bool {
+	if u.Name == m.self.Name {
+		// Слухи о собственной недоступности, как и сведения о прошлой жизни
+		// узла до перезапуска, опровергаются новым воплощением.
+		stale := u.State != StateAlive || u.Incarnation > m.self.Incarnation
+		if stale && !m.leaving && u.Incarnation >= m.self.Incarnation {
+			m.self.Incarnation = u.Incarnation + 1
+			m.enqueue(m.self.update())
+			slog.Warn("Refuting gossip about this node",
+				slog.String("state", string(u.State)),
+				slog.Uint64("incarnation", m.self.Incarnation),
+			)
+		}
+		return false
+	}
+
+	cur, known := m.members[u.Name]
+	switch u.State {
+	case StateAlive:
+		if known && u.Incarnation <= cur.Incarnation {
+			return false
+		}
+		if !known {
+			cur = &Member{Name: u.Name}
+			m.members[u.Name] = cur
+		}
+		m.stopSuspicion(u.Name)
+		if !known || cur.State != StateAlive {
+			slog.Info("Gossip member is alive",
+				slog.String("name", u.Name),
+				slog.String("addr", u.Addr),
+			)
+			cur.Since = time.Now()
+		}
+
+	case StateSuspect:
+		if !known || cur.State == StateDead || cur.State == StateLeft || u.Incarnation < cur.Incarnation ||
+			(cur.State == StateSuspect && u.Incarnation == cur.Incarnation) {
+			return false
+		}
+		m.startSuspicion(u.Name, u.Incarnation)
+		slog.Warn("Gossip member is suspected",
+			slog.String("name", u.Name),
+			slog.String("addr", cur.Addr),
+		)
+		cur.Since = time.Now()
+
+	case StateDead, StateLeft:
+		if !known || cur.State == StateDead || cur.State == StateLeft || u.Incarnation < cur.Incarnation {
+			return false
+		}
+		m.stopSuspicion(u.Name)
+		slog.Warn("Gossip member is gone",
+			slog.String("name", u.Name),
+			slog.String("addr", cur.Addr),
+			slog.String("state", string(u.State)),
+		)
+		cur.Since = time.Now()
+
+	default:
+		return false
+	}
+
+	cur.Addr = u.Addr
+	cur.Meta = u.Meta
+	cur.State = u.State
+	cur.Incarnation = u.Incarnation
+	m.enqueue(u)
+	return true
+}
+
+// applyAll применяет изменения и уведомляет подписчиков, если состав изменился.
+func (m *Memberlist) applyAll(updates []update) {
+	m.mu.Lock()
+	changed := false
+	for _, u := range updates {
+		if m.apply(u) {
+			changed = true
+		}
+	}
+	m.mu.Unlock()
+	if changed {
+		m.notify()
+	}
+}
+
+func (m *Memberlist) notify() {
+	m.mu.Lock()
+	members := m.snapshot()
+	subscribers := slices.Clone(m.subscribers)
+	m.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(members)
+	}
+}
+
+// startSuspicion запускает таймер, по истечении которого подозреваемый узел
+// признаётся мёртвым. Вызывается под m.mu.
+func (m *Memberlist) startSuspicion(name string, incarnation uint64) {
+	m.stopSuspicion(name)
+	m.suspicions[name] = time.AfterFunc(m.cfg.SuspicionTimeout, func() {
+		m.mu.Lock()
+		cur, ok := m.members[name]
+		if !ok || cur.State != StateSuspect || cur.Incarnation != incarnation {
+			m.mu.Unlock()
+			return
+		}
+		changed := m.apply(update{Name: name, Addr: cur.Addr, Meta: cur.Meta, State: StateDead, Incarnation: incarnation})
+		m.mu.Unlock()
+		if changed {
+			m.notify()
+		}
+	})
+}
+
+// stopSuspicion отменяет таймер подозрения. Вызывается под m.mu.
+func (m *Memberlist) stopSuspicion(name string) {
+	if t, ok := m.suspicions[name]; ok {
+		t.Stop()
+		delete(m.suspicions, name)
+	}
+}
+
+// enqueue ставит изменение в очередь рассылки, заменяя прежнее о том же узле.
+// Вызывается под m.mu.
+func (m *Memberlist) enqueue(u update) {
+	m.broadcasts = slices.DeleteFunc(m.broadcasts, func(b *broadcast) bool { return b.u.Name == u.Name })
+	m.broadcasts = append(m.broadcasts, &broadcast{u: u})
+}
+
+// retransmitLimit — сколько раз пересылать каждое изменение. Вызывается под m.mu.
+func (m *Memberlist) retransmitLimit() int {
+	return m.cfg.RetransmitMult * int(math.Ceil(math.Log10(float64(len(m.members)+1))))
+}
+
+// aliveOthers возвращает остальных живых и подозреваемых узлов. Вызывается под m.mu.
+func (m *Memberlist) aliveOthers() []*Member {
+	var others []*Member
+	for _, mem := range m.members {
+		if mem != m.self && (mem.State == StateAlive || mem.State == StateSuspect) {
+			others = append(others, mem)
+		}
+	}
+	return others
+}
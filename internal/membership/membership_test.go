@@ -0,0 +1,178 @@
+package membership
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testNode struct {
+	*Memberlist
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// stop останавливает узел без Leave, как при падении процесса.
+func (n *testNode) stop() {
+	n.cancel()
+	<-n.done
+}
+
+// startNodes запускает n узлов на loopback; все присоединяются через первый.
+func startNodes(t *testing.T, n int) []*testNode {
+	t.Helper()
+	var nodes []*testNode
+	var seeds []string
+	for i := 0; i < n; i++ {
+		m, err := New(Config{
+			BindAddr:         "127.0.0.1:0",
+			Meta:             "meta-" + string(rune('a'+i)),
+			Seeds:            seeds,
+			ProbeInterval:    50 * time.Millisecond,
+			ProbeTimeout:     20 * time.Millisecond,
+			SuspicionTimeout: 300 * time.Millisecond,
+			GossipInterval:   20 * time.Millisecond,
+			PushPullInterval: 200 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		if i == 0 {
+			seeds = []string{m.Addr()}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		node := &testNode{Memberlist: m, cancel: cancel, done: make(chan struct{})}
+		go func() {
+			defer close(node.done)
+			m.Run(ctx)
+		}()
+		t.Cleanup(node.stop)
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// states возвращает состояния узлов по именам с точки зрения m.
+func states(m *Memberlist) map[string]State {
+	out := make(map[string]State)
+	for _, mem := range m.Members() {
+		out[mem.Name] = mem.State
+	}
+	return out
+}
+
+func waitState(t *testing.T, observer *Memberlist, name string, want State) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return states(observer)[name] == want
+	}, 5*time.Second, 10*time.Millisecond, "%s should see %s as %s", observer.Name(), name, want)
+}
+
+func TestJoinAndConverge(t *testing.T) {
+	nodes := startNodes(t, 4)
+
+	for _, observer := range nodes {
+		for _, n := range nodes {
+			waitState(t, observer.Memberlist, n.Name(), StateAlive)
+		}
+	}
+	members := nodes[3].Members()
+	require.Len(t, members, 4)
+	for _, mem := range members {
+		assert.NotEmpty(t, mem.Meta)
+		assert.NotEmpty(t, mem.Addr)
+	}
+}
+
+func TestFailureDetection(t *testing.T) {
+	nodes := startNodes(t, 3)
+	for _, n := range nodes {
+		waitState(t, nodes[0].Memberlist, n.Name(), StateAlive)
+		waitState(t, nodes[1].Memberlist, n.Name(), StateAlive)
+	}
+
+	var mu sync.Mutex
+	var seen []State
+	victim := nodes[2].Name()
+	nodes[0].OnChange(func(members []Member) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, mem := range members {
+			if mem.Name == victim && (len(seen) == 0 || seen[len(seen)-1] != mem.State) {
+				seen = append(seen, mem.State)
+			}
+		}
+	})
+
+	nodes[2].stop()
+	waitState(t, nodes[0].Memberlist, victim, StateDead)
+	waitState(t, nodes[1].Memberlist, victim, StateDead)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Узел сначала становится подозреваемым и лишь затем мёртвым.
+	require.NotEmpty(t, seen)
+	assert.Equal(t, StateSuspect, seen[0])
+	assert.Equal(t, StateDead, seen[len(seen)-1])
+}
+
+func TestGracefulLeave(t *testing.T) {
+	nodes := startNodes(t, 3)
+	for _, n := range nodes {
+		waitState(t, nodes[1].Memberlist, n.Name(), StateAlive)
+	}
+
+	nodes[0].Leave(time.Second)
+	nodes[0].stop()
+	waitState(t, nodes[1].Memberlist, nodes[0].Name(), StateLeft)
+	waitState(t, nodes[2].Memberlist, nodes[0].Name(), StateLeft)
+}
+
+func TestSuspicionIsRefuted(t *testing.T) {
+	nodes := startNodes(t, 2)
+	waitState(t, nodes[0].Memberlist, nodes[1].Name(), StateAlive)
+
+	// Ложное подозрение доходит до самого узла, и он опровергает его
+	// новым воплощением раньше, чем истечёт таймаут подозрения.
+	nodes[0].applyAll([]update{{Name: nodes[1].Name(), Addr: nodes[1].Addr(), State: StateSuspect}})
+	require.Eventually(t, func() bool {
+		for _, mem := range nodes[0].Members() {
+			if mem.Name == nodes[1].Name() {
+				return mem.State == StateAlive && mem.Incarnation >= 1
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestApplyRules(t *testing.T) {
+	m, err := New(Config{BindAddr: "127.0.0.1:0", Name: "self"})
+	require.NoError(t, err)
+	m.udp.Close()
+	m.tcp.Close()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	assert.False(t, m.apply(update{Name: "x", State: StateSuspect}), "suspect about unknown node is ignored")
+	assert.True(t, m.apply(update{Name: "x", Addr: "a", State: StateAlive, Incarnation: 1}))
+	assert.False(t, m.apply(update{Name: "x", State: StateAlive, Incarnation: 1}), "same incarnation is not news")
+	assert.False(t, m.apply(update{Name: "x", State: StateSuspect, Incarnation: 0}), "older incarnation loses")
+	assert.True(t, m.apply(update{Name: "x", Addr: "a", State: StateSuspect, Incarnation: 1}))
+	assert.True(t, m.apply(update{Name: "x", Addr: "a", State: StateAlive, Incarnation: 2}), "refutation wins")
+	assert.True(t, m.apply(update{Name: "x", Addr: "a", State: StateDead, Incarnation: 2}))
+	assert.False(t, m.apply(update{Name: "x", State: StateSuspect, Incarnation: 3}), "dead node cannot become suspect")
+	assert.True(t, m.apply(update{Name: "x", Addr: "b", State: StateAlive, Incarnation: 3}), "restarted node rejoins")
+	assert.Equal(t, "b", m.members["x"].Addr)
+
+	assert.False(t, m.apply(update{Name: "self", State: StateDead, Incarnation: 5}))
+	assert.Equal(t, uint64(6), m.self.Incarnation, "rumour about self is refuted")
+	assert.Equal(t, StateAlive, m.self.State)
+
+	for _, t := range m.suspicions {
+		t.Stop()
+	}
+}
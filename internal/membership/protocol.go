@@ -0,0 +1,447 @@
+package membership
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+// Типы UDP-сообщений.
+const (
+	msgPing    = "ping"
+	msgPingReq = "ping_req"
+	msgAck     = "ack"
+	msgGossip  = "gossip"
+)
+
+const (
+	// maxPacketSize — предел размера UDP-сообщения, чтобы оно не фрагментировалось.
+	maxPacketSize = 1400
+	// tcpTimeout ограничивает обмен при присоединении и сверке состава.
+	tcpTimeout = 5 * time.Second
+)
+
+// packet — UDP-сообщение протокола.
+type packet struct {
+	Type string `json:"type"`
+	Seq  uint32 `json:"seq,omitempty"`
+	// Target и TargetAddr — проверяемый узел для ping и ping_req.
+	Target     string   `json:"target,omitempty"`
+	TargetAddr string   `json:"target_addr,omitempty"`
+	Updates    []update `json:"updates,omitempty"`
+}
+
+// pushPull — полный состав, которым узлы обмениваются по TCP.
+type pushPull struct {
+	Members []update `json:"members"`
+}
+
+func (m *Memberlist) send(addr string, p packet) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		slog.Debug("Failed to resolve gossip peer", slog.String("addr", addr), slog.String("error", err.Error()))
+		return
+	}
+	if _, err := m.udp.WriteToUDP(data, udpAddr); err != nil {
+		slog.Debug("Failed to send gossip packet", slog.String("addr", addr), slog.String("error", err.Error()))
+	}
+}
+
+// serveUDP обрабатывает входящие UDP-сообщения, пока сокет не закрыт.
+func (m *Memberlist) serveUDP(ctx context.Context) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, from, err := m.udp.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		var p packet
+		if err := json.Unmarshal(buf[:n], &p); err != nil {
+			slog.Debug("Malformed gossip packet", slog.String("from", from.String()))
+			continue
+		}
+		m.handlePacket(ctx, p, from.String())
+	}
+}
+
+func (m *Memberlist) handlePacket(ctx context.Context, p packet, from string) {
+	switch p.Type {
+	case msgPing:
+		// Пинг, адресованный прежнему владельцу адреса, не подтверждается.
+		if p.Target == "" || p.Target == m.cfg.Name {
+			m.send(from, packet{Type: msgAck, Seq: p.Seq})
+		}
+
+	case msgPingReq:
+		// Косвенная проверка: пингуем цель сами и пересылаем подтверждение.
+		go func() {
+			if m.ping(ctx, p.Target, p.TargetAddr, m.cfg.ProbeTimeout) {
+				m.send(from, packet{Type: msgAck, Seq: p.Seq})
+			}
+		}()
+
+	case msgAck:
+		m.mu.Lock()
+		ch, ok := m.acks[p.Seq]
+		delete(m.acks, p.Seq)
+		m.mu.Unlock()
+		if ok {
+			close(ch)
+		}
+
+	case msgGossip:
+		m.applyAll(p.Updates)
+	}
+}
+
+// expectAck регистрирует ожидание подтверждения и возвращает номер сообщения.
+func (m *Memberlist) expectAck() (uint32, chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seq++
+	ch := make(chan struct{})
+	m.acks[m.seq] = ch
+	return m.seq, ch
+}
+
+func (m *Memberlist) forgetAck(seq uint32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.acks, seq)
+}
+
+// ping отправляет прямой пинг и ждёт подтверждения не дольше timeout.
+func (m *Memberlist) ping(ctx context.Context, name, addr string, timeout time.Duration) bool {
+	seq, ack := m.expectAck()
+	defer m.forgetAck(seq)
+
+	m.send(addr, packet{Type: msgPing, Seq: seq, Target: name})
+	select {
+	case <-ack:
+		return true
+	case <-time.After(timeout):
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// probeLoop каждые ProbeInterval проверяет очередной узел.
+func (m *Memberlist) probeLoop(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.probe(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// probe проверяет следующий узел: прямой пинг, затем косвенные через
+// IndirectChecks других узлов до конца периода. Не ответивший узел
+// становится подозреваемым.
+func (m *Memberlist) probe(ctx context.Context) {
+	target, ok := m.nextProbeTarget()
+	if !ok {
+		return
+	}
+
+	seq, ack := m.expectAck()
+	defer m.forgetAck(seq)
+
+	m.send(target.Addr, packet{Type: msgPing, Seq: seq, Target: target.Name})
+	select {
+	case <-ack:
+		return
+	case <-time.After(m.cfg.ProbeTimeout):
+	case <-ctx.Done():
+		return
+	}
+
+	m.mu.Lock()
+	helpers := addrs(randomMembers(m.aliveOthers(), m.cfg.IndirectChecks, func(mem *Member) bool {
+		return mem.Name != target.Name && mem.State == StateAlive
+	}))
+	m.mu.Unlock()
+	for _, addr := range helpers {
+		m.send(addr, packet{Type: msgPingReq, Seq: seq, Target: target.Name, TargetAddr: target.Addr})
+	}
+
+	select {
+	case <-ack:
+		return
+	case <-time.After(m.cfg.ProbeInterval - m.cfg.ProbeTimeout):
+	case <-ctx.Done():
+		return
+	}
+
+	m.mu.Lock()
+	changed := m.apply(update{Name: target.Name, Addr: target.Addr, Meta: target.Meta, State: StateSuspect, Incarnation: target.Incarnation})
+	m.mu.Unlock()
+	if changed {
+		m.notify()
+	}
+}
+
+// nextProbeTarget обходит узлы по кругу в случайном порядке, перемешивая
+// список на каждом круге.
+func (m *Memberlist) nextProbeTarget() (Member, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for attempts := 0; attempts < 2; attempts++ {
+		for len(m.probeOrder) > 0 {
+			name := m.probeOrder[0]
+			m.probeOrder = m.probeOrder[1:]
+			if mem, ok := m.members[name]; ok && mem != m.self && (mem.State == StateAlive || mem.State == StateSuspect) {
+				return *mem, true
+			}
+		}
+		for _, mem := range m.aliveOthers() {
+			m.probeOrder = append(m.probeOrder, mem.Name)
+		}
+		rand.Shuffle(len(m.probeOrder), func(i, j int) {
+			m.probeOrder[i], m.probeOrder[j] = m.probeOrder[j], m.probeOrder[i]
+		})
+	}
+	return Member{}, false
+}
+
+// gossipLoop рассылает накопленные изменения случайным узлам.
+func (m *Memberlist) gossipLoop(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.GossipInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.gossip()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Memberlist) gossip() {
+	m.mu.Lock()
+	if len(m.broadcasts) == 0 {
+		m.mu.Unlock()
+		return
+	}
+	// Мёртвым узлам сообщения тоже отправляются: так узел, ошибочно
+	// признанный мёртвым, узнаёт об этом и опровергает.
+	var others []*Member
+	for _, mem := range m.members {
+		if mem != m.self {
+			others = append(others, mem)
+		}
+	}
+	targets := addrs(randomMembers(others, m.cfg.GossipNodes, func(mem *Member) bool { return mem.State != StateLeft }))
+
+	var updates []update
+	size := 64
+	limit := m.retransmitLimit()
+	kept := m.broadcasts[:0]
+	for _, b := range m.broadcasts {
+		data, _ := json.Marshal(b.u)
+		if size+len(data) > maxPacketSize {
+			kept = append(kept, b)
+			continue
+		}
+		size += len(data) + 1
+		updates = append(updates, b.u)
+		if len(targets) > 0 {
+			b.transmits++
+		}
+		if b.transmits < limit {
+			kept = append(kept, b)
+		}
+	}
+	m.broadcasts = kept
+	m.mu.Unlock()
+
+	for _, addr := range targets {
+		m.send(addr, packet{Type: msgGossip, Updates: updates})
+	}
+}
+
+// randomMembers возвращает до n случайных узлов, удовлетворяющих keep.
+func randomMembers(members []*Member, n int, keep func(*Member) bool) []*Member {
+	var out []*Member
+	for _, i := range rand.Perm(len(members)) {
+		if len(out) == n {
+			break
+		}
+		if keep(members[i]) {
+			out = append(out, members[i])
+		}
+	}
+	return out
+}
+
+// addrs возвращает адреса узлов. Вызывается под m.mu.
+func addrs(members []*Member) []string {
+	out := make([]string, len(members))
+	for i, mem := range members {
+		out[i] = mem.Addr
+	}
+	return out
+}
+
+// serveTCP отвечает на запросы полной сверки состава.
+func (m *Memberlist) serveTCP(ctx context.Context) {
+	for {
+		conn, err := m.tcp.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go func() {
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(tcpTimeout))
+
+			var remote pushPull
+			if err := json.NewDecoder(conn).Decode(&remote); err != nil {
+				slog.Debug("Malformed gossip push-pull request", slog.String("from", conn.RemoteAddr().String()))
+				return
+			}
+			if err := json.NewEncoder(conn).Encode(m.localState()); err != nil {
+				return
+			}
+			m.applyAll(remote.Members)
+		}()
+	}
+}
+
+// pushPull обменивается полным составом с узлом addr.
+func (m *Memberlist) pushPull(ctx context.Context, addr string) error {
+	dialer := net.Dialer{Timeout: tcpTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(tcpTimeout))
+
+	if err := json.NewEncoder(conn).Encode(m.localState()); err != nil {
+		return err
+	}
+	var remote pushPull
+	if err := json.NewDecoder(conn).Decode(&remote); err != nil {
+		return err
+	}
+	m.applyAll(remote.Members)
+	return nil
+}
+
+func (m *Memberlist) localState() pushPull {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state := pushPull{Members: make([]update, 0, len(m.members))}
+	for _, mem := range m.members {
+		state.Members = append(state.Members, mem.update())
+	}
+	return state
+}
+
+// pushPullLoop периодически сверяет состав со случайным живым узлом, чтобы
+// исправить расхождения, которые не дошли сплетнями.
+func (m *Memberlist) pushPullLoop(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.PushPullInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.mu.Lock()
+			peers := addrs(randomMembers(m.aliveOthers(), 1, func(mem *Member) bool { return mem.State == StateAlive }))
+			m.mu.Unlock()
+			if len(peers) == 1 {
+				if err := m.pushPull(ctx, peers[0]); err != nil && ctx.Err() == nil {
+					slog.Debug("Gossip push-pull failed", slog.String("addr", peers[0]), slog.String("error", err.Error()))
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// joinSeeds присоединяется к кластеру через Seeds, повторяя попытки, пока
+// хотя бы одна не удастся.
+func (m *Memberlist) joinSeeds(ctx context.Context) {
+	var seeds []string
+	for _, seed := range m.cfg.Seeds {
+		if seed != m.cfg.AdvertiseAddr {
+			seeds = append(seeds, seed)
+		}
+	}
+	if len(seeds) == 0 {
+		return
+	}
+
+	delay := m.cfg.ProbeInterval
+	for {
+		joined := 0
+		for _, seed := range seeds {
+			if err := m.pushPull(ctx, seed); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				slog.Warn("Failed to join gossip seed", slog.String("seed", seed), slog.String("error", err.Error()))
+				continue
+			}
+			joined++
+		}
+		if joined > 0 {
+			slog.Info("Joined gossip cluster", slog.Int("seeds", joined), slog.Int("members", len(m.Members())))
+			return
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		delay = min(delay*2, 30*time.Second)
+	}
+}
+
+// reapLoop удаляет из списка узлы, которые дольше DeadTimeout мертвы или ушли.
+func (m *Memberlist) reapLoop(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.mu.Lock()
+			removed := false
+			for name, mem := range m.members {
+				if (mem.State == StateDead || mem.State == StateLeft) && time.Since(mem.Since) > m.cfg.DeadTimeout {
+					delete(m.members, name)
+					removed = true
+				}
+			}
+			m.mu.Unlock()
+			if removed {
+				m.notify()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,354 @@
+// Package peerfill заполняет промахи кэша в духе groupcache: у каждого ключа
+// есть узел-владелец, выбираемый консистентным хешированием. Только владелец
+// вызывает загрузчик, остальные узлы получают значение у него по HTTP и,
+// если включено, держат копию горячих ключей в небольшом локальном кэше.
+// Так ключ загружается из источника не больше одного раза на весь кластер.
+package peerfill
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/titoffon/lru-cache-service/internal/cluster"
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// FillPath — префикс эндпоинта, через который узлы запрашивают у владельца
+// значение ключа; ключ передаётся последним сегментом пути.
+const FillPath = "/api/peer/fill/"
+
+// ErrLoadFailed сообщает, что загрузчик или владелец ключа вернули ошибку.
+var ErrLoadFailed = errors.New("load failed")
+
+// maxResponseSize ограничивает ответ владельца.
+const maxResponseSize = 32 << 20
+
+// Options описывает параметры заполнения.
+type Options struct {
+	// Self — адрес этого узла (http://host:port) в списке Peers.
+	Self string
+	// Peers — адреса всех узлов, включая или не включая Self. Пустой список
+	// означает, что узел загружает все ключи сам.
+	Peers        []string
+	VirtualNodes int
+	// Loader загружает значение из источника; ошибка cache.ErrKeyNotFound
+	// означает, что ключа нет и в источнике.
+	Loader cache.Loader
+	// TTL — срок жизни загруженных записей у владельца; 0 — TTL кэша по умолчанию.
+	TTL time.Duration
+	// HotSize — ёмкость кэша копий, полученных от владельцев; 0 отключает его.
+	HotSize int
+	// HotTTL ограничивает срок жизни копии, чтобы изменения у владельца
+	// становились видны не позже чем через HotTTL.
+	HotTTL time.Duration
+	// APIKey передаётся владельцу в заголовке Authorization.
+	APIKey  string
+	Timeout time.Duration
+	// Transport позволяет подменить HTTP-транспорт (например, в тестах).
+	Transport http.RoundTripper
+}
+
+// Stats — счётчики заполнения.
+type Stats struct {
+	// Loads — вызовы загрузчика на этом узле.
+	Loads uint64 `json:"loads"`
+	// PeerFetches — значения, полученные от владельцев.
+	PeerFetches uint64 `json:"peer_fetches"`
+	// PeerErrors — неудачные обращения к владельцам; в этом случае ключ загружается локально.
+	PeerErrors uint64 `json:"peer_errors"`
+	HotHits    uint64 `json:"hot_hits"`
+}
+
+// Group заполняет промахи кэша с учётом владельцев ключей.
+type Group struct {
+	cache  cache.ILRUCache
+	opts   Options
+	ring   *cluster.Ring
+	hot    cache.ILRUCache
+	client *http.Client
+
+	mu      sync.Mutex
+	fetches map[string]*fetchCall
+
+	loads       atomic.Uint64
+	peerFetches atomic.Uint64
+	peerErrors  atomic.Uint64
+	hotHits     atomic.Uint64
+}
+
+// fetchCall — выполняющийся запрос к владельцу ключа.
+type fetchCall struct {
+	done      chan struct{}
+	value     interface{}
+	expiresAt time.Time
+	err       error
+}
+
+// response — ответ владельца. Значение, сохранённое как cache.RawValue,
+// передаётся в Raw, остальные — в Value как JSON.
+type response struct {
+	Value     json.RawMessage `json:"value,omitempty"`
+	Raw       *cache.RawValue `json:"raw,omitempty"`
+	ExpiresAt int64           `json:"expires_at"`
+}
+
+// New создаёт группу для кэша c. Владельцы ключей берутся из opts.Peers.
+func New(c cache.ILRUCache, opts Options) *Group {
+	if opts.HotTTL <= 0 {
+		opts.HotTTL = 10 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.VirtualNodes <= 0 {
+		opts.VirtualNodes = cluster.DefaultVirtualNodes
+	}
+	transport := opts.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	g := &Group{
+		cache:   c,
+		opts:    opts,
+		client:  &http.Client{Transport: transport, Timeout: opts.Timeout},
+		fetches: make(map[string]*fetchCall),
+	}
+	if len(opts.Peers) > 0 {
+		nodes := append([]string{opts.Self}, opts.Peers...)
+		g.ring = cluster.NewRing(nodes, opts.VirtualNodes)
+	}
+	if opts.HotSize > 0 {
+		g.hot = cache.NewLRUCache(opts.HotSize, opts.HotTTL)
+	}
+	return g
+}
+
+// Owner возвращает владельца key и признак того, что владелец — этот узел.
+func (g *Group) Owner(key string) (string, bool) {
+	if g.ring == nil {
+		return g.opts.Self, true
+	}
+	owner := g.ring.Owner(key)
+	return owner, owner == g.opts.Self
+}
+
+// Get возвращает значение ключа, отсутствующего в основном кэше: владелец
+// загружает его сам, остальные узлы запрашивают у владельца. Если владелец
+// недоступен, ключ загружается локально.
+func (g *Group) Get(ctx context.Context, key string) (interface{}, time.Time, error) {
+	owner, local := g.Owner(key)
+	if local {
+		return g.Load(ctx, key)
+	}
+
+	if g.hot != nil {
+		if value, expiresAt, err := g.hot.Get(ctx, key); err == nil {
+			g.hotHits.Add(1)
+			return value, expiresAt, nil
+		}
+	}
+
+	value, expiresAt, err := g.fetch(ctx, owner, key)
+	switch {
+	case err == nil:
+		if g.hot != nil {
+			if ttl := min(time.Until(expiresAt), g.opts.HotTTL); ttl > 0 {
+				_ = g.hot.Put(ctx, key, value, ttl)
+			}
+		}
+		return value, expiresAt, nil
+	case errors.Is(err, cache.ErrKeyNotFound), errors.Is(err, ErrLoadFailed), ctx.Err() != nil:
+		return nil, time.Time{}, err
+	}
+
+	g.peerErrors.Add(1)
+	slog.Warn("Failed to fetch value from key owner, loading locally",
+		slog.String("key", key),
+		slog.String("owner", owner),
+		slog.String("error", err.Error()),
+	)
+	return g.Load(ctx, key)
+}
+
+// Load загружает ключ на этом узле и сохраняет его в основном кэше.
+// Одновременные вызовы для одного ключа выполняют одну загрузку, если кэш
+// реализует cache.LoadingCache.
+func (g *Group) Load(ctx context.Context, key string) (interface{}, time.Time, error) {
+	load := func(ctx context.Context, key string) (interface{}, error) {
+		g.loads.Add(1)
+		value, err := g.opts.Loader(ctx, key)
+		if err != nil && !errors.Is(err, cache.ErrKeyNotFound) {
+			return nil, fmt.Errorf("%w: %w", ErrLoadFailed, err)
+		}
+		return value, err
+	}
+
+	if lc, ok := g.cache.(cache.LoadingCache); ok {
+		return lc.GetOrLoad(ctx, key, g.opts.TTL, load)
+	}
+	value, err := load(ctx, key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if err := g.cache.Put(ctx, key, value, g.opts.TTL); err != nil {
+		return nil, time.Time{}, err
+	}
+	_, expiresAt, err := g.cache.Get(ctx, key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return value, expiresAt, nil
+}
+
+// Stats возвращает текущие счётчики.
+func (g *Group) Stats() Stats {
+	return Stats{
+		Loads:       g.loads.Load(),
+		PeerFetches: g.peerFetches.Load(),
+		PeerErrors:  g.peerErrors.Load(),
+		HotHits:     g.hotHits.Load(),
+	}
+}
+
+// fetch запрашивает ключ у владельца; одновременные запросы одного ключа объединяются.
+func (g *Group) fetch(ctx context.Context, owner, key string) (interface{}, time.Time, error) {
+	g.mu.Lock()
+	if call, ok := g.fetches[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.value, call.expiresAt, call.err
+		case <-ctx.Done():
+			return nil, time.Time{}, ctx.Err()
+		}
+	}
+	call := &fetchCall{done: make(chan struct{})}
+	g.fetches[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.fetches, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.value, call.expiresAt, call.err = g.request(context.WithoutCancel(ctx), owner, key)
+	if call.err == nil {
+		g.peerFetches.Add(1)
+	}
+	return call.value, call.expiresAt, call.err
+}
+
+func (g *Group) request(ctx context.Context, owner, key string) (interface{}, time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, owner+FillPath+url.PathEscape(key), nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if g.opts.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.opts.APIKey)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, time.Time{}, cache.ErrKeyNotFound
+	case resp.StatusCode == http.StatusBadGateway:
+		// Владелец доступен, но его загрузчик вернул ошибку: повторять загрузку здесь бессмысленно.
+		return nil, time.Time{}, fmt.Errorf("%w: owner %s", ErrLoadFailed, owner)
+	case resp.StatusCode != http.StatusOK:
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return nil, time.Time{}, fmt.Errorf("owner responded with status %d", resp.StatusCode)
+	}
+
+	var r response
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&r); err != nil {
+		return nil, time.Time{}, fmt.Errorf("decode owner response: %w", err)
+	}
+	expiresAt := time.UnixMilli(r.ExpiresAt)
+	if r.Raw != nil {
+		return *r.Raw, expiresAt, nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(r.Value, &value); err != nil {
+		return nil, time.Time{}, fmt.Errorf("decode owner value: %w", err)
+	}
+	return value, expiresAt, nil
+}
+
+// MarshalResponse кодирует значение для ответа на FillPath.
+func MarshalResponse(value interface{}, expiresAt time.Time) ([]byte, error) {
+	r := response{ExpiresAt: expiresAt.UnixMilli()}
+	if raw, ok := value.(cache.RawValue); ok {
+		r.Raw = &raw
+	} else {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		r.Value = data
+	}
+	return json.Marshal(r)
+}
+
+// HTTPLoader возвращает загрузчик, запрашивающий ключ по адресу
+// baseURL/<ключ>. Ответ 404 означает отсутствие ключа; тело с типом
+// application/json разбирается как JSON, остальные сохраняются как
+// cache.RawValue с исходным Content-Type.
+func HTTPLoader(baseURL string, timeout time.Duration) cache.Loader {
+	client := &http.Client{Timeout: timeout}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	return func(ctx context.Context, key string) (interface{}, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/"+url.PathEscape(key), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, cache.ErrKeyNotFound
+		case resp.StatusCode != http.StatusOK:
+			return nil, fmt.Errorf("loader backend responded with status %d", resp.StatusCode)
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		if err != nil {
+			return nil, err
+		}
+
+		contentType := resp.Header.Get("Content-Type")
+		if strings.HasPrefix(contentType, "application/json") {
+			var value interface{}
+			if err := json.Unmarshal(data, &value); err != nil {
+				return nil, fmt.Errorf("decode loader response: %w", err)
+			}
+			return value, nil
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		return cache.RawValue{ContentType: contentType, Data: data}, nil
+	}
+}
@@ -0,0 +1,221 @@
+package peerfill
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// fillHandler отвечает на FillPath так же, как сервер.
+func fillHandler(g **Group) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, FillPath)
+		value, expiresAt, err := (*g).Load(r.Context(), key)
+		switch {
+		case errors.Is(err, cache.ErrKeyNotFound):
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case err != nil:
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		data, err := MarshalResponse(value, expiresAt)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	})
+}
+
+type node struct {
+	url   string
+	cache cache.ILRUCache
+	group *Group
+	ts    *httptest.Server
+}
+
+// startGroup поднимает n узлов с общим загрузчиком load.
+func startGroup(t *testing.T, n int, hotSize int, load cache.Loader) []*node {
+	t.Helper()
+	nodes := make([]*node, n)
+	urls := make([]string, n)
+	for i := range nodes {
+		nodes[i] = &node{ts: httptest.NewUnstartedServer(nil), cache: cache.NewLRUCache(100, time.Minute)}
+		urls[i] = "http://" + nodes[i].ts.Listener.Addr().String()
+		nodes[i].url = urls[i]
+	}
+	for _, nd := range nodes {
+		nd.group = New(nd.cache, Options{Self: nd.url, Peers: urls, Loader: load, HotSize: hotSize})
+		nd.ts.Config.Handler = fillHandler(&nd.group)
+		nd.ts.Start()
+		t.Cleanup(nd.ts.Close)
+	}
+	return nodes
+}
+
+// keyOwnedBy подбирает ключ, владелец которого — owner.
+func keyOwnedBy(t *testing.T, g *Group, owner string) string {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		key := "key-" + string(rune('a'+i%26)) + strings.Repeat("x", i/26)
+		if o, _ := g.Owner(key); o == owner {
+			return key
+		}
+	}
+	t.Fatalf("no key owned by %s", owner)
+	return ""
+}
+
+func TestKeyIsLoadedOnceClusterWide(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	nodes := startGroup(t, 3, 0, func(ctx context.Context, key string) (interface{}, error) {
+		loads.Add(1)
+		<-release
+		return map[string]interface{}{"key": key}, nil
+	})
+
+	key := keyOwnedBy(t, nodes[0].group, nodes[2].url)
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _, err := nodes[i%3].group.Get(context.Background(), key)
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{"key": key}, v)
+		}()
+	}
+	require.Eventually(t, func() bool { return loads.Load() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), loads.Load())
+	assert.Equal(t, uint64(1), nodes[2].group.Stats().Loads)
+	// Значение хранит только владелец.
+	_, _, err := nodes[2].cache.Get(context.Background(), key)
+	assert.NoError(t, err)
+	_, _, err = nodes[0].cache.Get(context.Background(), key)
+	assert.ErrorIs(t, err, cache.ErrKeyNotFound)
+	assert.Equal(t, uint64(1), nodes[0].group.Stats().PeerFetches)
+}
+
+func TestHotCacheAndRawValues(t *testing.T) {
+	raw := cache.RawValue{ContentType: "image/png", Data: []byte{0x89, 'P', 'N', 'G'}}
+	nodes := startGroup(t, 2, 10, func(ctx context.Context, key string) (interface{}, error) {
+		return raw, nil
+	})
+	key := keyOwnedBy(t, nodes[0].group, nodes[1].url)
+	ctx := context.Background()
+
+	v, expiresAt, err := nodes[0].group.Get(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, raw, v)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expiresAt, time.Second)
+
+	// Копия живёт не дольше HotTTL.
+	for i := 0; i < 2; i++ {
+		v, expiresAt, err = nodes[0].group.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, raw, v)
+		assert.WithinDuration(t, time.Now().Add(10*time.Second), expiresAt, time.Second)
+	}
+	st := nodes[0].group.Stats()
+	assert.Equal(t, uint64(1), st.PeerFetches)
+	assert.Equal(t, uint64(2), st.HotHits)
+}
+
+func TestOwnerErrors(t *testing.T) {
+	backendErr := errors.New("backend down")
+	nodes := startGroup(t, 2, 0, func(ctx context.Context, key string) (interface{}, error) {
+		switch {
+		case strings.HasPrefix(key, "missing"):
+			return nil, cache.ErrKeyNotFound
+		case strings.HasPrefix(key, "broken"):
+			return nil, backendErr
+		}
+		return "v", nil
+	})
+	ctx := context.Background()
+	remote := nodes[1].url
+
+	_, _, err := nodes[0].group.Get(ctx, keyOwnedBy(t, nodes[0].group, remote))
+	require.NoError(t, err)
+
+	for _, prefix := range []string{"missing", "broken"} {
+		var key string
+		for i := 0; ; i++ {
+			key = prefix + "-" + strings.Repeat("k", i)
+			if o, _ := nodes[0].group.Owner(key); o == remote {
+				break
+			}
+		}
+		_, _, err = nodes[0].group.Get(ctx, key)
+		if prefix == "missing" {
+			assert.ErrorIs(t, err, cache.ErrKeyNotFound)
+		} else {
+			assert.ErrorIs(t, err, ErrLoadFailed)
+		}
+	}
+	assert.Zero(t, nodes[0].group.Stats().Loads, "owner errors must not trigger a local load")
+
+	// Недоступный владелец — ключ загружается локально.
+	nodes[1].ts.Close()
+	key := keyOwnedBy(t, nodes[0].group, remote) + "-down"
+	for o, _ := nodes[0].group.Owner(key); o != remote; o, _ = nodes[0].group.Owner(key) {
+		key += "x"
+	}
+	v, _, err := nodes[0].group.Get(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, "v", v)
+	st := nodes[0].group.Stats()
+	assert.Equal(t, uint64(1), st.PeerErrors)
+	assert.Equal(t, uint64(1), st.Loads)
+}
+
+func TestHTTPLoader(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/1":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			_, _ = w.Write([]byte(`{"name":"Ann"}`))
+		case "/users/avatar 1":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte{1, 2})
+		case "/users/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer backend.Close()
+
+	load := HTTPLoader(backend.URL+"/users/", time.Second)
+	ctx := context.Background()
+
+	v, err := load(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "Ann"}, v)
+
+	v, err = load(ctx, "avatar 1")
+	require.NoError(t, err)
+	assert.Equal(t, cache.RawValue{ContentType: "image/png", Data: []byte{1, 2}}, v)
+
+	_, err = load(ctx, "2")
+	assert.ErrorIs(t, err, cache.ErrKeyNotFound)
+	_, err = load(ctx, "fail")
+	assert.Error(t, err)
+}
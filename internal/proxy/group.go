@@ -0,0 +1,44 @@
+package proxy
+
+import "sync"
+
+// call — выполняющийся или завершённый запрос к upstream.
+type call struct {
+	wg  sync.WaitGroup
+	res *fetchResult
+	err error
+}
+
+// group объединяет одновременные промахи по одному ключу в один запрос к upstream.
+type group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// do выполняет fn один раз для всех одновременных вызовов с одинаковым key.
+// shared == true означает, что результат получен чужим вызовом.
+func (g *group) do(key string, fn func() (*fetchResult, error)) (res *fetchResult, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.res, true, c.err
+	}
+	c := &call{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+
+	c.res, c.err = fn()
+	return c.res, false, c.err
+}
@@ -0,0 +1,394 @@
+// Package proxy реализует кэширующий обратный прокси: GET-запросы пересылаются
+// в upstream, а ответы сохраняются в LRU-кэше с учётом Cache-Control и Vary.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// keyPrefix — префикс ключей записей прокси.
+const keyPrefix = "proxy:"
+
+// Options описывает параметры прокси.
+type Options struct {
+	// Upstream — базовый URL сервиса, к которому пересылаются запросы
+	// (см. ParseUpstream).
+	Upstream *url.URL
+	// Timeout ограничивает время запроса к upstream.
+	Timeout time.Duration
+	// MaxBodySize — максимальный размер тела ответа upstream в байтах.
+	MaxBodySize int64
+	// Transport позволяет подменить HTTP-транспорт (например, в тестах).
+	Transport http.RoundTripper
+	// StripCredentials запрещает пересылать в upstream заголовки Authorization
+	// и Cookie: при включённой аутентификации в них учётные данные самого
+	// сервиса. Ответы на такие запросы кэшируются как анонимные.
+	StripCredentials bool
+	// WriteError пишет ответ об ошибке самого прокси (метод не разрешён,
+	// upstream недоступен). По умолчанию — текстовый http.Error.
+	WriteError func(w http.ResponseWriter, r *http.Request, status int, detail string)
+}
+
+// Proxy — кэширующий обратный прокси.
+type Proxy struct {
+	upstream    *url.URL
+	client      *http.Client
+	cache       cache.ILRUCache
+	maxBodySize int64
+	// stripCredentials — см. Options.StripCredentials.
+	stripCredentials bool
+	writeError       func(w http.ResponseWriter, r *http.Request, status int, detail string)
+	group            group
+}
+
+// cachedResponse — ответ upstream, сохранённый в кэше.
+type cachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// varySpec хранится под базовым ключом ресурса и перечисляет заголовки
+// запроса из Vary, значения которых входят в ключ конкретного варианта.
+type varySpec struct {
+	Headers []string
+}
+
+// fetchResult — результат запроса к upstream, разделяемый между
+// объединёнными запросами.
+type fetchResult struct {
+	resp *cachedResponse
+	// varyHeaders — заголовки из Vary ответа; nil, если Vary нет.
+	varyHeaders []string
+	// variantKey — ключ варианта, для которого получен ответ.
+	variantKey string
+}
+
+// ParseUpstream разбирает и проверяет адрес upstream.
+func ParseUpstream(raw string) (*url.URL, error) {
+	upstream, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse upstream: %w", err)
+	}
+	if (upstream.Scheme != "http" && upstream.Scheme != "https") || upstream.Host == "" {
+		return nil, fmt.Errorf("upstream %q must be an absolute http or https URL", raw)
+	}
+	return upstream, nil
+}
+
+// New создаёт прокси, сохраняющий ответы в c. Кэш должен принадлежать
+// только прокси: его записи хранят заголовки и тела ответов upstream.
+func New(c cache.ILRUCache, opts Options) *Proxy {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 8 << 20
+	}
+	if opts.WriteError == nil {
+		opts.WriteError = func(w http.ResponseWriter, _ *http.Request, status int, detail string) {
+			http.Error(w, detail, status)
+		}
+	}
+
+	return &Proxy{
+		upstream: opts.Upstream,
+		client: &http.Client{
+			Timeout:   opts.Timeout,
+			Transport: opts.Transport,
+			// Редиректы отдаются клиенту как есть, а не выполняются прокси.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		cache:            c,
+		maxBodySize:      opts.MaxBodySize,
+		stripCredentials: opts.StripCredentials,
+		writeError:       opts.WriteError,
+	}
+}
+
+// ServeHTTP обрабатывает запрос: отдаёт ответ из кэша или идёт в upstream.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		p.writeError(w, r, http.StatusMethodNotAllowed, "only GET and HEAD are proxied")
+		return
+	}
+
+	ctx := r.Context()
+	baseKey := keyPrefix + http.MethodGet + " " + r.URL.RequestURI()
+
+	// Запросы с авторизацией не кэшируются: ответ может быть персональным.
+	if !p.stripCredentials && r.Header.Get("Authorization") != "" {
+		res, err := p.fetch(ctx, r, baseKey)
+		if err != nil {
+			p.writeUpstreamError(w, r, err)
+			return
+		}
+		p.writeResponse(w, r, res.resp, "MISS")
+		return
+	}
+
+	var varyHeaders []string
+	if v, _, err := p.cache.Get(ctx, baseKey); err == nil {
+		if spec, ok := v.(varySpec); ok {
+			varyHeaders = spec.Headers
+		}
+	}
+	variantKey := variantKeyFor(baseKey, varyHeaders, r.Header)
+
+	if v, _, err := p.cache.Get(ctx, variantKey); err == nil {
+		if resp, ok := v.(*cachedResponse); ok {
+			p.writeResponse(w, r, resp, "HIT")
+			return
+		}
+	}
+
+	res, shared, err := p.group.do(variantKey, func() (*fetchResult, error) {
+		return p.fetchAndStore(ctx, r, baseKey)
+	})
+	if err != nil {
+		p.writeUpstreamError(w, r, err)
+		return
+	}
+
+	// Ответ, полученный чужим запросом, подходит, только если значения
+	// заголовков из Vary у нас те же.
+	if shared && variantKeyFor(baseKey, res.varyHeaders, r.Header) != res.variantKey {
+		res, err = p.fetchAndStore(ctx, r, baseKey)
+		if err != nil {
+			p.writeUpstreamError(w, r, err)
+			return
+		}
+	}
+
+	p.writeResponse(w, r, res.resp, "MISS")
+}
+
+// fetchAndStore запрашивает ресурс в upstream и сохраняет ответ, если он кэшируемый.
+func (p *Proxy) fetchAndStore(ctx context.Context, r *http.Request, baseKey string) (*fetchResult, error) {
+	res, err := p.fetch(ctx, r, baseKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, cacheable := cacheTTL(res.resp)
+	if !cacheable {
+		return res, nil
+	}
+
+	// Список заголовков Vary хранится под базовым ключом; если upstream
+	// перестал присылать Vary, старый список нужно забыть.
+	if res.varyHeaders != nil {
+		err = p.cache.Put(ctx, baseKey, varySpec{Headers: res.varyHeaders}, ttl)
+	} else {
+		_, err = p.cache.Evict(ctx, baseKey)
+		if errors.Is(err, cache.ErrKeyNotFound) {
+			err = nil
+		}
+	}
+	if err == nil {
+		err = p.cache.Put(ctx, res.variantKey, res.resp, ttl)
+	}
+	if err != nil {
+		slog.Warn("Failed to store proxied response",
+			slog.String("key", res.variantKey),
+			slog.String("error", err.Error()),
+		)
+	}
+	return res, nil
+}
+
+// fetch выполняет запрос к upstream и читает ответ целиком.
+func (p *Proxy) fetch(ctx context.Context, r *http.Request, baseKey string) (*fetchResult, error) {
+	target := *p.upstream
+	target.Path = singleJoiningSlash(p.upstream.Path, r.URL.Path)
+	target.RawQuery = r.URL.RawQuery
+
+	// Запрос не привязан к контексту клиента: его результат может понадобиться
+	// другим объединённым запросам, даже если инициатор отключился.
+	outReq, err := http.NewRequestWithContext(context.WithoutCancel(ctx), http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	copyHeaders(outReq.Header, r.Header)
+	if p.stripCredentials {
+		outReq.Header.Del("Authorization")
+		outReq.Header.Del("Cookie")
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
+			host = prior + ", " + host
+		}
+		outReq.Header.Set("X-Forwarded-For", host)
+	}
+
+	resp, err := p.client.Do(outReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, p.maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > p.maxBodySize {
+		return nil, errResponseTooLarge
+	}
+
+	header := make(http.Header, len(resp.Header))
+	copyHeaders(header, resp.Header)
+
+	varyHeaders := parseVary(resp.Header)
+	return &fetchResult{
+		resp:        &cachedResponse{Status: resp.StatusCode, Header: header, Body: body},
+		varyHeaders: varyHeaders,
+		variantKey:  variantKeyFor(baseKey, varyHeaders, r.Header),
+	}, nil
+}
+
+var errResponseTooLarge = errors.New("upstream response is too large")
+
+func (p *Proxy) writeResponse(w http.ResponseWriter, r *http.Request, resp *cachedResponse, status string) {
+	for k, vv := range resp.Header {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	w.Header().Set("X-Cache", status)
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	w.WriteHeader(resp.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(resp.Body)
+	}
+}
+
+func (p *Proxy) writeUpstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.Warn("Upstream request failed",
+		slog.String("url", r.URL.RequestURI()),
+		slog.String("error", err.Error()),
+	)
+	status, detail := http.StatusBadGateway, "upstream request failed"
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		status, detail = http.StatusGatewayTimeout, "upstream request timed out"
+	}
+	w.Header().Set("X-Cache", "MISS")
+	p.writeError(w, r, status, detail)
+}
+
+// cacheTTL определяет по Cache-Control, можно ли сохранить ответ и на сколько.
+// TTL == 0 означает TTL кэша по умолчанию.
+func cacheTTL(resp *cachedResponse) (time.Duration, bool) {
+	if resp.Header.Get("Set-Cookie") != "" || resp.Header.Get("Vary") == "*" {
+		return 0, false
+	}
+
+	var maxAge, sMaxAge = -1, -1
+	for _, directive := range strings.Split(resp.Header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache", "private":
+			return 0, false
+		case "max-age":
+			if n, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil {
+				maxAge = n
+			}
+		case "s-maxage":
+			if n, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil {
+				sMaxAge = n
+			}
+		}
+	}
+	// s-maxage предназначен именно для разделяемых кэшей и важнее max-age.
+	if sMaxAge >= 0 {
+		maxAge = sMaxAge
+	}
+
+	switch {
+	case maxAge == 0:
+		return 0, false
+	case maxAge > 0:
+		return time.Duration(maxAge) * time.Second, true
+	case resp.Status == http.StatusOK:
+		return 0, true
+	default:
+		// Ответы с другими статусами кэшируются только при явном max-age.
+		return 0, false
+	}
+}
+
+// parseVary возвращает отсортированный список заголовков из Vary.
+func parseVary(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" && name != "*" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return names
+}
+
+// variantKeyFor строит ключ варианта ресурса из базового ключа и значений заголовков Vary.
+func variantKeyFor(baseKey string, varyHeaders []string, h http.Header) string {
+	if len(varyHeaders) == 0 {
+		return baseKey + "|"
+	}
+	var b strings.Builder
+	b.WriteString(baseKey)
+	for _, name := range varyHeaders {
+		b.WriteString("|")
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strings.Join(h.Values(name), ","))
+	}
+	return b.String()
+}
+
+// hopHeaders — заголовки, относящиеся к конкретному соединению (RFC 7230, 6.1).
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+func copyHeaders(dst, src http.Header) {
+	for k, vv := range src {
+		dst[k] = append([]string(nil), vv...)
+	}
+	for _, h := range hopHeaders {
+		dst.Del(h)
+	}
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
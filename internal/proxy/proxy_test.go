@@ -0,0 +1,234 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+func newTestProxy(t *testing.T, upstream http.Handler) *Proxy {
+	t.Helper()
+	ts := httptest.NewServer(upstream)
+	t.Cleanup(ts.Close)
+
+	u, err := ParseUpstream(ts.URL)
+	require.NoError(t, err)
+	return New(cache.NewLRUCache(100, time.Minute), Options{Upstream: u})
+}
+
+func doGet(p *Proxy, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, vv := range header {
+		req.Header[k] = vv
+	}
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestParseUpstream(t *testing.T) {
+	_, err := ParseUpstream("http://backend:8080/base")
+	assert.NoError(t, err)
+
+	for _, raw := range []string{"", "backend:8080", "ftp://backend", "/relative"} {
+		_, err := ParseUpstream(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestProxyCachesResponses(t *testing.T) {
+	var hits atomic.Int32
+	p := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("hello " + r.URL.RequestURI()))
+	}))
+
+	rr := doGet(p, "/page?x=1", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "MISS", rr.Header().Get("X-Cache"))
+	assert.Equal(t, "hello /page?x=1", rr.Body.String())
+
+	rr = doGet(p, "/page?x=1", nil)
+	assert.Equal(t, "HIT", rr.Header().Get("X-Cache"))
+	assert.Equal(t, "hello /page?x=1", rr.Body.String())
+	assert.Equal(t, int32(1), hits.Load())
+
+	rr = doGet(p, "/page?x=2", nil)
+	assert.Equal(t, "MISS", rr.Header().Get("X-Cache"))
+	assert.Equal(t, int32(2), hits.Load())
+}
+
+func TestProxyRespectsCacheControl(t *testing.T) {
+	var hits atomic.Int32
+	p := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/cookie":
+			w.Header().Set("Set-Cookie", "session=1")
+		case "/not-found":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	for _, path := range []string{"/no-store", "/private", "/cookie", "/not-found"} {
+		doGet(p, path, nil)
+		rr := doGet(p, path, nil)
+		assert.Equal(t, "MISS", rr.Header().Get("X-Cache"), path)
+	}
+	assert.Equal(t, int32(8), hits.Load())
+}
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		header    http.Header
+		ttl       time.Duration
+		cacheable bool
+	}{
+		{"default", http.StatusOK, http.Header{}, 0, true},
+		{"max-age", http.StatusOK, http.Header{"Cache-Control": {"public, max-age=30"}}, 30 * time.Second, true},
+		{"s-maxage wins", http.StatusOK, http.Header{"Cache-Control": {"max-age=30, s-maxage=5"}}, 5 * time.Second, true},
+		{"max-age zero", http.StatusOK, http.Header{"Cache-Control": {"max-age=0"}}, 0, false},
+		{"no-cache", http.StatusOK, http.Header{"Cache-Control": {"no-cache"}}, 0, false},
+		{"vary star", http.StatusOK, http.Header{"Vary": {"*"}}, 0, false},
+		{"404 with max-age", http.StatusNotFound, http.Header{"Cache-Control": {"max-age=10"}}, 10 * time.Second, true},
+		{"404 without max-age", http.StatusNotFound, http.Header{}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ttl, cacheable := cacheTTL(&cachedResponse{Status: tt.status, Header: tt.header})
+			assert.Equal(t, tt.cacheable, cacheable)
+			assert.Equal(t, tt.ttl, ttl)
+		})
+	}
+}
+
+func TestProxyVary(t *testing.T) {
+	var hits atomic.Int32
+	p := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = w.Write([]byte("lang=" + r.Header.Get("Accept-Language")))
+	}))
+
+	en := http.Header{"Accept-Language": {"en"}}
+	ru := http.Header{"Accept-Language": {"ru"}}
+
+	assert.Equal(t, "lang=en", doGet(p, "/", en).Body.String())
+	assert.Equal(t, "lang=ru", doGet(p, "/", ru).Body.String())
+
+	rr := doGet(p, "/", en)
+	assert.Equal(t, "HIT", rr.Header().Get("X-Cache"))
+	assert.Equal(t, "lang=en", rr.Body.String())
+	rr = doGet(p, "/", ru)
+	assert.Equal(t, "HIT", rr.Header().Get("X-Cache"))
+	assert.Equal(t, "lang=ru", rr.Body.String())
+	assert.Equal(t, int32(2), hits.Load())
+}
+
+func TestProxyCoalescesConcurrentMisses(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	p := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-release
+		_, _ = w.Write([]byte("slow"))
+	}))
+
+	const n = 10
+	var wg sync.WaitGroup
+	bodies := make([]string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bodies[i] = doGet(p, "/slow", nil).Body.String()
+		}(i)
+	}
+
+	// Даём всем запросам дойти до group.do, пока upstream держит первый.
+	require.Eventually(t, func() bool { return hits.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), hits.Load())
+	for _, body := range bodies {
+		assert.Equal(t, "slow", body)
+	}
+}
+
+func TestProxyBypassesCacheForAuthorizedRequests(t *testing.T) {
+	var hits atomic.Int32
+	p := newTestProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+
+	auth := http.Header{"Authorization": {"Bearer secret"}}
+	doGet(p, "/me", auth)
+	rr := doGet(p, "/me", auth)
+	assert.Equal(t, "MISS", rr.Header().Get("X-Cache"))
+	assert.Equal(t, "Bearer secret", rr.Body.String())
+
+	rr = doGet(p, "/me", nil)
+	assert.Equal(t, "MISS", rr.Header().Get("X-Cache"), "authorized response must not be cached")
+	assert.Equal(t, int32(3), hits.Load())
+}
+
+func TestProxyStripsCredentials(t *testing.T) {
+	var hits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		assert.Empty(t, r.Header.Get("Authorization"), "service token must not reach upstream")
+		assert.Empty(t, r.Header.Get("Cookie"))
+		assert.Equal(t, "text/html", r.Header.Get("Accept"))
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("public"))
+	}))
+	defer ts.Close()
+	u, err := ParseUpstream(ts.URL)
+	require.NoError(t, err)
+	p := New(cache.NewLRUCache(10, time.Minute), Options{Upstream: u, StripCredentials: true})
+
+	header := http.Header{
+		"Authorization": {"Bearer cache-token"},
+		"Cookie":        {"session=1"},
+		"Accept":        {"text/html"},
+	}
+	for _, want := range []string{"MISS", "HIT"} {
+		rr := doGet(p, "/page", header)
+		assert.Equal(t, want, rr.Header().Get("X-Cache"))
+		assert.Equal(t, "public", rr.Body.String())
+	}
+	assert.Equal(t, int32(1), hits.Load())
+}
+
+func TestProxyErrors(t *testing.T) {
+	u, _ := url.Parse("http://127.0.0.1:1")
+	p := New(cache.NewLRUCache(10, time.Minute), Options{Upstream: u})
+
+	rr := doGet(p, "/", nil)
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
@@ -0,0 +1,360 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// errIdleTimeout сообщает, что ведущий слишком долго не присылал кадров.
+var errIdleTimeout = errors.New("no data from leader within idle timeout")
+
+// FollowerOptions описывает подключение ведомого к ведущему.
+type FollowerOptions struct {
+	// Leader — базовый URL ведущего узла, например http://10.0.0.1:8080.
+	Leader string
+	// APIKey — ключ с правом admin, если на ведущем включена аутентификация.
+	APIKey string
+	// RetryInterval — начальная пауза перед переподключением; удваивается
+	// до MaxRetryInterval, пока соединение не восстановится.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	// IdleTimeout — через сколько без единого кадра соединение считается
+	// оборванным. Ведущий присылает ping каждые 5 секунд.
+	IdleTimeout time.Duration
+	// Transport используется для запросов к ведущему.
+	Transport http.RoundTripper
+}
+
+// FollowerStatus описывает состояние ведомого.
+type FollowerStatus struct {
+	Leader    string `json:"leader"`
+	Connected bool   `json:"connected"`
+	// Synced — получен хотя бы один полный снимок или поток продолжен после него.
+	Synced bool   `json:"synced"`
+	Epoch  string `json:"epoch,omitempty"`
+	// Offset — смещение последней применённой операции журнала ведущего.
+	Offset uint64 `json:"offset"`
+	// LeaderOffset — последнее известное смещение головы журнала ведущего.
+	LeaderOffset uint64 `json:"leader_offset"`
+	// Lag — сколько операций ведомый ещё не применил.
+	Lag       uint64 `json:"lag"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Follower получает поток репликации от ведущего и применяет его к локальному кэшу.
+type Follower struct {
+	opts  FollowerOptions
+	cache cache.ILRUCache
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	mu           sync.Mutex
+	running      bool
+	connected    bool
+	epoch        string
+	offset       uint64
+	leaderOffset uint64
+	lastErr      string
+}
+
+// NewFollower создаёт ведомого, применяющего операции к c.
+func NewFollower(c cache.ILRUCache, opts FollowerOptions) *Follower {
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Second
+	}
+	if opts.MaxRetryInterval <= 0 {
+		opts.MaxRetryInterval = 30 * time.Second
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = 3 * pingInterval
+	}
+	if opts.Transport == nil {
+		opts.Transport = http.DefaultTransport
+	}
+	return &Follower{
+		opts:  opts,
+		cache: c,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// Run синхронизируется с ведущим и переподключается после обрывов, пока не
+// отменён ctx или не вызван Stop.
+func (f *Follower) Run(ctx context.Context) {
+	f.mu.Lock()
+	f.running = true
+	f.mu.Unlock()
+	defer close(f.done)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-f.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	delay := f.opts.RetryInterval
+	for {
+		synced, err := f.sync(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if synced {
+			delay = f.opts.RetryInterval
+		}
+		f.setError(err)
+		slog.Warn("Replication stream interrupted, reconnecting",
+			slog.String("leader", f.opts.Leader),
+			slog.Duration("retry_in", delay),
+			slog.String("error", err.Error()),
+		)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		delay = min(delay*2, f.opts.MaxRetryInterval)
+	}
+}
+
+// Stop прекращает репликацию и ждёт завершения Run. После Stop узел
+// перестаёт быть ведомым; повторный вызов безопасен.
+func (f *Follower) Stop() {
+	f.stopOnce.Do(func() { close(f.stop) })
+
+	f.mu.Lock()
+	running := f.running
+	f.mu.Unlock()
+	if running {
+		<-f.done
+	}
+}
+
+// Active сообщает, что Stop ещё не вызывался.
+func (f *Follower) Active() bool {
+	select {
+	case <-f.stop:
+		return false
+	default:
+		return true
+	}
+}
+
+// Leader возвращает адрес ведущего.
+func (f *Follower) Leader() string {
+	return f.opts.Leader
+}
+
+// Status возвращает текущее состояние репликации.
+func (f *Follower) Status() FollowerStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	st := FollowerStatus{
+		Leader:       f.opts.Leader,
+		Connected:    f.connected,
+		Synced:       f.epoch != "",
+		Epoch:        f.epoch,
+		Offset:       f.offset,
+		LeaderOffset: f.leaderOffset,
+		LastError:    f.lastErr,
+	}
+	if st.LeaderOffset > st.Offset {
+		st.Lag = st.LeaderOffset - st.Offset
+	}
+	return st
+}
+
+// sync выполняет одно подключение к ведущему и применяет кадры, пока поток
+// не оборвётся. synced == true, если соединение успело установиться.
+func (f *Follower) sync(ctx context.Context) (synced bool, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	f.mu.Lock()
+	epoch, offset := f.epoch, f.offset
+	f.mu.Unlock()
+
+	q := url.Values{}
+	q.Set("epoch", epoch)
+	q.Set("offset", strconv.FormatUint(offset, 10))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.opts.Leader+StreamPath+"?"+q.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+	if f.opts.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+f.opts.APIKey)
+	}
+
+	// Соединение рвётся, если ведущий замолчал дольше IdleTimeout.
+	var timedOut atomic.Bool
+	idle := time.AfterFunc(f.opts.IdleTimeout, func() {
+		timedOut.Store(true)
+		cancel()
+	})
+	defer idle.Stop()
+
+	resp, err := (&http.Client{Transport: f.opts.Transport}).Do(req)
+	if err != nil {
+		if timedOut.Load() {
+			return false, errIdleTimeout
+		}
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return false, fmt.Errorf("leader responded with status %d: %s", resp.StatusCode, body)
+	}
+
+	f.setConnected(true)
+	defer f.setConnected(false)
+
+	dec := json.NewDecoder(resp.Body)
+	// snapshot — эпоха и смещение снимка, который сейчас принимается.
+	var snapshot *frame
+	for {
+		var fr frame
+		if err := dec.Decode(&fr); err != nil {
+			if timedOut.Load() {
+				return true, errIdleTimeout
+			}
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return true, err
+		}
+		idle.Reset(f.opts.IdleTimeout)
+
+		switch fr.Type {
+		case frameSnapshot:
+			slog.Info("Receiving replication snapshot",
+				slog.String("leader", f.opts.Leader),
+				slog.String("epoch", fr.Epoch),
+				slog.Uint64("offset", fr.Offset),
+			)
+			if err := f.cache.EvictAll(ctx); err != nil {
+				return true, err
+			}
+			snapshot = &fr
+			// Позиция сбрасывается, чтобы после обрыва посреди снимка
+			// ведомый запросил его заново.
+			f.mu.Lock()
+			f.epoch, f.offset, f.leaderOffset = "", 0, fr.Offset
+			f.mu.Unlock()
+
+		case frameSnapshotEnd:
+			if snapshot == nil {
+				return true, errors.New("unexpected end of snapshot")
+			}
+			f.mu.Lock()
+			f.epoch, f.offset = snapshot.Epoch, snapshot.Offset
+			f.mu.Unlock()
+			snapshot = nil
+
+		case frameResume:
+			if fr.Epoch != epoch || fr.Offset != offset {
+				return true, fmt.Errorf("leader resumed from %s/%d instead of %s/%d", fr.Epoch, fr.Offset, epoch, offset)
+			}
+			slog.Info("Replication stream resumed",
+				slog.String("leader", f.opts.Leader),
+				slog.Uint64("offset", offset),
+			)
+
+		case framePing:
+			f.setLeaderOffset(fr.Offset)
+
+		case framePut, frameEvict, frameClear:
+			if err := f.apply(ctx, fr); err != nil {
+				return true, err
+			}
+			if snapshot == nil {
+				f.mu.Lock()
+				f.offset = fr.Offset
+				f.leaderOffset = max(f.leaderOffset, fr.Offset)
+				f.mu.Unlock()
+			}
+
+		default:
+			return true, fmt.Errorf("unknown replication frame %q", fr.Type)
+		}
+	}
+}
+
+// apply применяет операцию к локальному кэшу.
+func (f *Follower) apply(ctx context.Context, fr frame) error {
+	switch fr.Type {
+	case frameClear:
+		return f.cache.EvictAll(ctx)
+
+	case frameEvict:
+		if _, err := f.cache.Evict(ctx, fr.Key); err != nil && !errors.Is(err, cache.ErrKeyNotFound) {
+			return err
+		}
+		return nil
+	}
+
+	now := time.Now()
+	ttl := time.Unix(0, fr.ExpiresAt).Sub(now)
+	if ttl <= 0 {
+		// Запись истекла, пока шла по сети.
+		if _, err := f.cache.Evict(ctx, fr.Key); err != nil && !errors.Is(err, cache.ErrKeyNotFound) {
+			return err
+		}
+		return nil
+	}
+
+	var value interface{}
+	if fr.Raw != nil {
+		value = *fr.Raw
+	} else if err := json.Unmarshal(fr.Value, &value); err != nil {
+		return fmt.Errorf("decode value of %q: %w", fr.Key, err)
+	}
+
+	if sc, ok := f.cache.(cache.StaleCache); ok && fr.StaleAt != 0 {
+		// Уже устаревшая запись остаётся устаревшей: мягкий TTL не может быть нулевым.
+		softTTL := min(max(time.Unix(0, fr.StaleAt).Sub(now), time.Nanosecond), ttl)
+		return sc.PutStale(ctx, fr.Key, value, softTTL, ttl)
+	}
+	return f.cache.Put(ctx, fr.Key, value, ttl)
+}
+
+func (f *Follower) setConnected(connected bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connected = connected
+	if connected {
+		f.lastErr = ""
+	}
+}
+
+func (f *Follower) setLeaderOffset(offset uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.leaderOffset = offset
+}
+
+func (f *Follower) setError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastErr = err.Error()
+}
@@ -0,0 +1,246 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+const (
+	// DefaultLogSize — сколько последних операций хранит журнал по умолчанию.
+	DefaultLogSize = 10000
+	// subscriptionBuffer — буфер подписки журнала на события кэша.
+	subscriptionBuffer = 4096
+	// pingInterval — период кадров ping при простое; по ним ведомый узнаёт
+	// отставание и замечает оборванное соединение.
+	pingInterval = 5 * time.Second
+	// readBatch — сколько операций журнала отправляется за одну запись в поток.
+	readBatch = 256
+)
+
+// ErrFollowerBehind возвращается Stream, если ведомый отстал больше, чем
+// хранит журнал; после переподключения он получит полный снимок.
+var ErrFollowerBehind = errors.New("follower fell behind the replication log")
+
+// ErrSnapshotUnsupported возвращается Stream, если кэш не умеет отдавать снимок.
+var ErrSnapshotUnsupported = errors.New("cache does not support snapshots")
+
+// Leader ведёт журнал операций записи и отдаёт его ведомым.
+type Leader struct {
+	cache cache.ILRUCache
+	bus   *cache.EventBus
+	sub   *cache.Subscription
+
+	mu    sync.Mutex
+	epoch string
+	// first и head — смещения самой старой и самой новой операции в журнале;
+	// журнал пуст, если first > head.
+	first  uint64
+	head   uint64
+	ops    []frame
+	notify chan struct{}
+
+	followers atomic.Int64
+}
+
+// NewLeader создаёт журнал на size операций и сразу подписывает его на
+// события кэша из bus, чтобы не пропустить записи до вызова Run.
+func NewLeader(c cache.ILRUCache, bus *cache.EventBus, size int) *Leader {
+	if size <= 0 {
+		size = DefaultLogSize
+	}
+	return &Leader{
+		cache:  c,
+		bus:    bus,
+		sub:    bus.Subscribe("", subscriptionBuffer),
+		epoch:  newEpoch(),
+		first:  1,
+		ops:    make([]frame, size),
+		notify: make(chan struct{}),
+	}
+}
+
+// Run переносит события кэша в журнал, пока не отменён ctx. Если журнал
+// отстал от шины событий, он сбрасывается с новой эпохой.
+func (l *Leader) Run(ctx context.Context) {
+	for {
+		if !l.consume(ctx, l.sub) {
+			l.sub.Close()
+			return
+		}
+		slog.Error("Replication log fell behind cache events, resetting; followers will resync",
+			slog.Any("error", l.sub.Err()),
+		)
+		l.sub = l.bus.Subscribe("", subscriptionBuffer)
+		l.reset()
+	}
+}
+
+// consume переносит события подписки в журнал. Возвращает false, если ctx
+// отменён, и true, если шина закрыла подписку.
+func (l *Leader) consume(ctx context.Context, sub *cache.Subscription) bool {
+	for {
+		select {
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return true
+			}
+			if f, ok := eventFrame(ev); ok {
+				l.append(f)
+			}
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// append добавляет операцию в журнал, вытесняя самую старую при переполнении.
+func (l *Leader) append(f frame) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.head++
+	f.Offset = l.head
+	l.ops[l.head%uint64(len(l.ops))] = f
+	if l.head-l.first >= uint64(len(l.ops)) {
+		l.first = l.head - uint64(len(l.ops)) + 1
+	}
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// reset начинает новую эпоху с пустым журналом.
+func (l *Leader) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.epoch = newEpoch()
+	l.first = l.head + 1
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// Position возвращает эпоху и смещение последней операции журнала.
+func (l *Leader) Position() (epoch string, offset uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.epoch, l.head
+}
+
+// Followers возвращает число подключённых ведомых.
+func (l *Leader) Followers() int {
+	return int(l.followers.Load())
+}
+
+// read возвращает до max операций после смещения after. ok == false, если
+// эпоха сменилась или операции после after уже вытеснены из журнала.
+// Если новых операций нет, wait закроется, когда они появятся.
+func (l *Leader) read(epoch string, after uint64, max int) (ops []frame, wait <-chan struct{}, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if epoch != l.epoch || after+1 < l.first || after > l.head {
+		return nil, nil, false
+	}
+	for off := after + 1; off <= l.head && len(ops) < max; off++ {
+		ops = append(ops, l.ops[off%uint64(len(l.ops))])
+	}
+	return ops, l.notify, true
+}
+
+// Stream пишет в w поток репликации для ведомого, применившего операции до
+// смещения offset эпохи epoch, и вызывает flush после каждой порции кадров.
+// Если продолжить с этого места нельзя, сначала отправляется полный снимок.
+// Возвращает ctx.Err() при отмене ctx и ErrFollowerBehind, если ведомый
+// не успевает за журналом.
+func (l *Leader) Stream(ctx context.Context, w io.Writer, flush func() error, epoch string, offset uint64) error {
+	l.followers.Add(1)
+	defer l.followers.Add(-1)
+
+	enc := json.NewEncoder(w)
+	if _, _, ok := l.read(epoch, offset, 0); ok {
+		if err := enc.Encode(frame{Type: frameResume, Epoch: epoch, Offset: offset}); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if epoch, offset, err = l.writeSnapshot(ctx, enc); err != nil {
+			return err
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+
+	for {
+		ops, wait, ok := l.read(epoch, offset, readBatch)
+		if !ok {
+			return ErrFollowerBehind
+		}
+		if len(ops) > 0 {
+			for _, f := range ops {
+				if err := enc.Encode(f); err != nil {
+					return err
+				}
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+			offset = ops[len(ops)-1].Offset
+			continue
+		}
+
+		select {
+		case <-wait:
+		case <-ping.C:
+			_, head := l.Position()
+			if err := enc.Encode(frame{Type: framePing, Offset: head}); err != nil {
+				return err
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// writeSnapshot отправляет полный снимок кэша и возвращает место журнала,
+// с которого нужно продолжить. Позиция запоминается до снятия снимка, поэтому
+// часть операций после неё может уже входить в снимок; их повторное
+// применение безопасно, так как итог определяется последней операцией с ключом.
+func (l *Leader) writeSnapshot(ctx context.Context, enc *json.Encoder) (string, uint64, error) {
+	snap, ok := l.cache.(cache.Snapshotter)
+	if !ok {
+		return "", 0, ErrSnapshotUnsupported
+	}
+	epoch, offset := l.Position()
+	entries, err := snap.Snapshot(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := enc.Encode(frame{Type: frameSnapshot, Epoch: epoch, Offset: offset}); err != nil {
+		return "", 0, err
+	}
+	for _, e := range entries {
+		if err := enc.Encode(putFrame(e.Key, e.Value, e.ExpiresAt, e.StaleAt)); err != nil {
+			return "", 0, err
+		}
+	}
+	if err := enc.Encode(frame{Type: frameSnapshotEnd, Epoch: epoch, Offset: offset}); err != nil {
+		return "", 0, err
+	}
+	return epoch, offset, nil
+}
@@ -0,0 +1,98 @@
+// Package replication реализует асинхронную репликацию «ведущий — ведомые».
+// Ведущий ведёт журнал операций записи (Put, Evict, EvictAll) с абсолютными
+// сроками жизни записей, а ведомые получают по HTTP сначала полный снимок
+// кэша, затем поток операций и после обрыва продолжают с последнего
+// применённого смещения.
+package replication
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// StreamPath — путь HTTP-потока репликации на ведущем узле.
+const StreamPath = "/api/replication/stream"
+
+// Типы кадров потока репликации. Кадры передаются в формате NDJSON.
+const (
+	// frameSnapshot начинает полный снимок: ведомый очищает кэш, а Epoch и
+	// Offset указывают, с какого места журнала поток продолжится после снимка.
+	frameSnapshot = "snapshot"
+	// frameSnapshotEnd завершает снимок.
+	frameSnapshotEnd = "snapshot_end"
+	// frameResume подтверждает, что поток продолжается с запрошенного смещения.
+	frameResume = "resume"
+	framePut    = "put"
+	frameEvict  = "evict"
+	frameClear  = "clear"
+	// framePing отправляется при простое; Offset — текущая голова журнала.
+	framePing = "ping"
+)
+
+// frame — кадр потока репликации.
+type frame struct {
+	Type   string `json:"type"`
+	Epoch  string `json:"epoch,omitempty"`
+	Offset uint64 `json:"offset,omitempty"`
+	Key    string `json:"key,omitempty"`
+	// Value — значение в JSON; для cache.RawValue вместо него заполняется Raw,
+	// чтобы ведомый восстановил тип значения.
+	Value json.RawMessage `json:"value,omitempty"`
+	Raw   *cache.RawValue `json:"raw,omitempty"`
+	// ExpiresAt и StaleAt — абсолютные сроки в наносекундах Unix-времени.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+	StaleAt   int64 `json:"stale_at,omitempty"`
+}
+
+// eventFrame превращает событие кэша в операцию журнала. Истечение TTL не
+// реплицируется: ведомый удаляет такие записи сам по тем же срокам.
+func eventFrame(ev cache.Event) (frame, bool) {
+	switch ev.Type {
+	case cache.EventPut, cache.EventUpdate:
+		return putFrame(ev.Key, ev.Value, ev.ExpiresAt, ev.StaleAt), true
+	case cache.EventEvict:
+		return frame{Type: frameEvict, Key: ev.Key}, true
+	case cache.EventClear:
+		return frame{Type: frameClear}, true
+	default:
+		return frame{}, false
+	}
+}
+
+// putFrame кодирует запись значения. Значение, которое не удалось закодировать,
+// реплицируется как удаление, чтобы ведомый не отдавал прежнее.
+func putFrame(key string, value interface{}, expiresAt, staleAt time.Time) frame {
+	f := frame{Type: framePut, Key: key, ExpiresAt: expiresAt.UnixNano()}
+	if !staleAt.IsZero() {
+		f.StaleAt = staleAt.UnixNano()
+	}
+	if raw, ok := value.(cache.RawValue); ok {
+		f.Raw = &raw
+		return f
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		slog.Warn("Failed to encode value for replication, replicating as eviction",
+			slog.String("key", key),
+			slog.String("error", err.Error()),
+		)
+		return frame{Type: frameEvict, Key: key}
+	}
+	f.Value = data
+	return f
+}
+
+// newEpoch возвращает случайный идентификатор журнала. Смещения имеют смысл
+// только внутри одной эпохи: после перезапуска или сброса журнала ведомые
+// проходят полную синхронизацию.
+func newEpoch() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
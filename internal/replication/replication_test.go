@@ -0,0 +1,187 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// startLeader поднимает ведущего с журналом на size операций и HTTP-потоком.
+func startLeader(t *testing.T, size int) (cache.ILRUCache, *Leader, *httptest.Server) {
+	t.Helper()
+	bus := cache.NewEventBus()
+	c := cache.NewLRUCache(100, time.Minute, cache.WithEventBus(bus))
+	l := NewLeader(c, bus, size)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go l.Run(ctx)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.ParseUint(r.URL.Query().Get("offset"), 10, 64)
+		w.WriteHeader(http.StatusOK)
+		_ = l.Stream(r.Context(), w, http.NewResponseController(w).Flush, r.URL.Query().Get("epoch"), offset)
+	}))
+	t.Cleanup(ts.Close)
+	return c, l, ts
+}
+
+func startFollower(t *testing.T, leaderURL string) (cache.ILRUCache, *Follower) {
+	t.Helper()
+	c := cache.NewLRUCache(100, time.Minute)
+	f := NewFollower(c, FollowerOptions{Leader: leaderURL, RetryInterval: 10 * time.Millisecond})
+	go f.Run(context.Background())
+	t.Cleanup(f.Stop)
+	return c, f
+}
+
+// waitValue ждёт, пока в c появится key со значением want.
+func waitValue(t *testing.T, c cache.ILRUCache, key string, want interface{}) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		got, _, err := c.Get(context.Background(), key)
+		return err == nil && assert.ObjectsAreEqual(want, got)
+	}, 2*time.Second, 5*time.Millisecond, key)
+}
+
+// waitMissing ждёт, пока key исчезнет из c.
+func waitMissing(t *testing.T, c cache.ILRUCache, key string) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		_, _, err := c.Get(context.Background(), key)
+		return err != nil
+	}, 2*time.Second, 5*time.Millisecond, key)
+}
+
+func TestFollowerSnapshotAndStream(t *testing.T) {
+	ctx := context.Background()
+	lc, l, ts := startLeader(t, 100)
+
+	// Записи до подключения ведомого приходят в снимке вместе со сроками жизни.
+	require.NoError(t, lc.Put(ctx, "old", "snapshot", time.Hour))
+	require.NoError(t, lc.(cache.StaleCache).PutStale(ctx, "soft", 1.0, time.Second, time.Minute))
+	require.Eventually(t, func() bool { _, off := l.Position(); return off == 2 }, time.Second, time.Millisecond)
+
+	fc, f := startFollower(t, ts.URL)
+	waitValue(t, fc, "old", "snapshot")
+	_, leaderExp, _ := lc.Get(ctx, "old")
+	_, followerExp, _ := fc.Get(ctx, "old")
+	assert.WithinDuration(t, leaderExp, followerExp, 100*time.Millisecond)
+
+	// Затем — поток операций.
+	raw := cache.RawValue{ContentType: "image/png", Data: []byte{0x89, 'P', 'N', 'G'}}
+	require.NoError(t, lc.Put(ctx, "raw", raw, 0))
+	require.NoError(t, lc.Put(ctx, "doc", map[string]interface{}{"a": []interface{}{1.0, "b"}}, 0))
+	waitValue(t, fc, "raw", raw)
+	waitValue(t, fc, "doc", map[string]interface{}{"a": []interface{}{1.0, "b"}})
+
+	_, err := lc.Evict(ctx, "old")
+	require.NoError(t, err)
+	waitMissing(t, fc, "old")
+
+	require.NoError(t, lc.EvictAll(ctx))
+	waitMissing(t, fc, "raw")
+
+	st := f.Status()
+	assert.True(t, st.Connected)
+	assert.True(t, st.Synced)
+	_, head := l.Position()
+	assert.Equal(t, head, st.Offset)
+	assert.Zero(t, st.Lag)
+	assert.Equal(t, 1, l.Followers())
+}
+
+func TestFollowerResumesFromOffset(t *testing.T) {
+	ctx := context.Background()
+	lc, _, ts := startLeader(t, 100)
+	fc, f := startFollower(t, ts.URL)
+
+	require.NoError(t, lc.Put(ctx, "a", "1", 0))
+	waitValue(t, fc, "a", "1")
+	epoch := f.Status().Epoch
+
+	// Запись, которой нет у ведущего, пропала бы при повторном снимке.
+	require.NoError(t, fc.Put(ctx, "local", "marker", 0))
+
+	ts.CloseClientConnections()
+	require.NoError(t, lc.Put(ctx, "b", "2", 0))
+	waitValue(t, fc, "b", "2")
+
+	_, _, err := fc.Get(ctx, "local")
+	assert.NoError(t, err, "resumed stream must not resend the snapshot")
+	assert.Equal(t, epoch, f.Status().Epoch)
+}
+
+func TestStreamSendsSnapshotWhenOffsetIsGone(t *testing.T) {
+	ctx := context.Background()
+	lc, l, _ := startLeader(t, 2)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, lc.Put(ctx, "k"+strconv.Itoa(i), i, 0))
+	}
+	require.Eventually(t, func() bool { _, off := l.Position(); return off == 5 }, time.Second, time.Millisecond)
+	epoch, _ := l.Position()
+
+	stream := func(epoch string, offset uint64) []frame {
+		var buf bytes.Buffer
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_ = l.Stream(ctx, &buf, func() error { return nil }, epoch, offset)
+
+		var frames []frame
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var f frame
+			require.NoError(t, dec.Decode(&f))
+			frames = append(frames, f)
+		}
+		return frames
+	}
+
+	// В журнале остались только операции 4 и 5: с 3 можно продолжить, с 2 — нет.
+	frames := stream(epoch, 3)
+	require.Len(t, frames, 3)
+	assert.Equal(t, frameResume, frames[0].Type)
+	assert.Equal(t, []uint64{4, 5}, []uint64{frames[1].Offset, frames[2].Offset})
+
+	frames = stream(epoch, 2)
+	require.Len(t, frames, 7)
+	assert.Equal(t, frame{Type: frameSnapshot, Epoch: epoch, Offset: 5}, frames[0])
+	assert.Equal(t, "k0", frames[1].Key)
+	assert.Equal(t, frameSnapshotEnd, frames[6].Type)
+
+	// Чужая эпоха — тоже снимок.
+	assert.Equal(t, frameSnapshot, stream("other", 5)[0].Type)
+}
+
+func TestFollowerStop(t *testing.T) {
+	ctx := context.Background()
+	lc, _, ts := startLeader(t, 100)
+	fc, f := startFollower(t, ts.URL)
+
+	require.NoError(t, lc.Put(ctx, "a", "1", 0))
+	waitValue(t, fc, "a", "1")
+
+	f.Stop()
+	assert.False(t, f.Active())
+	assert.False(t, f.Status().Connected)
+
+	// После остановки изменения ведущего не применяются.
+	require.NoError(t, lc.Put(ctx, "a", "2", 0))
+	time.Sleep(50 * time.Millisecond)
+	got, _, err := fc.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", got)
+
+	// Stop без Run не блокируется.
+	NewFollower(fc, FollowerOptions{Leader: ts.URL}).Stop()
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Scope — право, выдаваемое API-ключу.
+type Scope string
+
+const (
+	ScopeRead   Scope = "read"
+	ScopeWrite  Scope = "write"
+	ScopeDelete Scope = "delete"
+	// ScopeAdmin включает в себя все остальные права.
+	ScopeAdmin Scope = "admin"
+)
+
+// Principal — аутентифицированный клиент и его права.
+type Principal struct {
+	ID string
+	// Scopes — выданные права.
+	Scopes []Scope
+	// KeyPrefixes ограничивает набор ключей кэша, с которыми может работать клиент.
+	// Пустой список означает доступ ко всем ключам.
+	KeyPrefixes []string
+}
+
+// Can сообщает, выдано ли клиенту право scope.
+func (p *Principal) Can(scope Scope) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsKey сообщает, попадает ли ключ в разрешённые клиенту префиксы.
+func (p *Principal) AllowsKey(key string) bool {
+	if len(p.KeyPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range p.KeyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// authFile описывает формат файла с API-ключами.
+type authFile struct {
+	Keys []struct {
+		ID string `json:"id"`
+		// Token — ключ в открытом виде; вместо него можно указать TokenSHA256.
+		Token       string   `json:"token"`
+		TokenSHA256 string   `json:"token_sha256"`
+		Scopes      []Scope  `json:"scopes"`
+		KeyPrefixes []string `json:"key_prefixes"`
+	} `json:"keys"`
+	// ClientCerts сопоставляет идентификатор из клиентского сертификата (CN или SAN) с правами.
+	ClientCerts []struct {
+		Identity    string   `json:"identity"`
+		Scopes      []Scope  `json:"scopes"`
+		KeyPrefixes []string `json:"key_prefixes"`
+	} `json:"client_certs"`
+}
+
+// Authenticator проверяет Bearer-токены и клиентские сертификаты по загруженному
+// набору ключей. Токены хранятся только в виде SHA-256.
+type Authenticator struct {
+	byHash     map[[sha256.Size]byte]*Principal
+	byIdentity map[string]*Principal
+}
+
+// LoadAuthFile читает JSON-файл с API-ключами и возвращает Authenticator.
+func LoadAuthFile(path string) (*Authenticator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read auth file: %w", err)
+	}
+
+	var f authFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parse auth file: %w", err)
+	}
+
+	a := &Authenticator{byHash: make(map[[sha256.Size]byte]*Principal, len(f.Keys))}
+	for i, k := range f.Keys {
+		if k.ID == "" {
+			return nil, fmt.Errorf("auth key #%d: missing id", i)
+		}
+
+		var hash [sha256.Size]byte
+		switch {
+		case k.Token != "" && k.TokenSHA256 != "":
+			return nil, fmt.Errorf("auth key %q: token and token_sha256 are mutually exclusive", k.ID)
+		case k.Token != "":
+			hash = sha256.Sum256([]byte(k.Token))
+		case k.TokenSHA256 != "":
+			raw, err := hex.DecodeString(k.TokenSHA256)
+			if err != nil || len(raw) != sha256.Size {
+				return nil, fmt.Errorf("auth key %q: token_sha256 must be %d hex-encoded bytes", k.ID, sha256.Size)
+			}
+			copy(hash[:], raw)
+		default:
+			return nil, fmt.Errorf("auth key %q: missing token", k.ID)
+		}
+
+		if err := validateScopes(k.Scopes); err != nil {
+			return nil, fmt.Errorf("auth key %q: %w", k.ID, err)
+		}
+
+		if _, dup := a.byHash[hash]; dup {
+			return nil, fmt.Errorf("auth key %q: duplicate token", k.ID)
+		}
+		a.byHash[hash] = &Principal{ID: k.ID, Scopes: k.Scopes, KeyPrefixes: k.KeyPrefixes}
+	}
+
+	a.byIdentity = make(map[string]*Principal, len(f.ClientCerts))
+	for i, c := range f.ClientCerts {
+		if c.Identity == "" {
+			return nil, fmt.Errorf("client cert #%d: missing identity", i)
+		}
+		if err := validateScopes(c.Scopes); err != nil {
+			return nil, fmt.Errorf("client cert %q: %w", c.Identity, err)
+		}
+		if _, dup := a.byIdentity[c.Identity]; dup {
+			return nil, fmt.Errorf("client cert %q: duplicate identity", c.Identity)
+		}
+		a.byIdentity[c.Identity] = &Principal{ID: c.Identity, Scopes: c.Scopes, KeyPrefixes: c.KeyPrefixes}
+	}
+
+	return a, nil
+}
+
+func validateScopes(scopes []Scope) error {
+	for _, s := range scopes {
+		switch s {
+		case ScopeRead, ScopeWrite, ScopeDelete, ScopeAdmin:
+		default:
+			return fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	return nil
+}
+
+// Authenticate возвращает клиента по токену или nil, если токен неизвестен.
+func (a *Authenticator) Authenticate(token string) *Principal {
+	return a.byHash[sha256.Sum256([]byte(token))]
+}
+
+// AuthenticateCert возвращает клиента по проверенному клиентскому сертификату
+// или nil, если ни одно из имён сертификата не сопоставлено с правами.
+func (a *Authenticator) AuthenticateCert(cert *x509.Certificate) *Principal {
+	for _, id := range certIdentities(cert) {
+		if p, ok := a.byIdentity[id]; ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// WithAuthenticator включает аутентификацию запросов к /api.
+func WithAuthenticator(a *Authenticator) Option {
+	return func(s *Server) {
+		s.auth = a
+	}
+}
+
+type principalCtxKey struct{}
+
+type principalSlotCtxKey struct{}
+
+// principalSlot получает клиента, прошедшего аутентификацию дальше по цепочке
+// middleware, чтобы его видели и внешние middleware (access-лог).
+type principalSlot struct {
+	p *Principal
+}
+
+// withPrincipalSlot кладёт в контекст пустой principalSlot.
+func withPrincipalSlot(ctx context.Context) (context.Context, *principalSlot) {
+	slot := &principalSlot{}
+	return context.WithValue(ctx, principalSlotCtxKey{}, slot), slot
+}
+
+// withPrincipal кладёт клиента в контекст и добавляет его идентификатор к логгеру запроса.
+func withPrincipal(ctx context.Context, p *Principal) context.Context {
+	if slot, ok := ctx.Value(principalSlotCtxKey{}).(*principalSlot); ok {
+		slot.p = p
+	}
+	ctx = context.WithValue(ctx, principalCtxKey{}, p)
+	return withLogger(ctx, loggerFromContext(ctx).With(slog.String("principal", p.ID)))
+}
+
+// principalFromContext возвращает клиента, прошедшего аутентификацию, или nil.
+func principalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalCtxKey{}).(*Principal)
+	return p
+}
+
+// authenticate проверяет заголовок Authorization (или, если его нет, проверенный
+// клиентский сертификат) и кладёт Principal в контекст запроса.
+// Если аутентификация не настроена, запрос пропускается без изменений.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.auth == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		logger := loggerFromContext(r.Context())
+
+		header := r.Header.Get("Authorization")
+		if header == "" && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			if p := s.auth.AuthenticateCert(r.TLS.VerifiedChains[0][0]); p != nil {
+				next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+				return
+			}
+		}
+
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			logger.Warn("Missing bearer token",
+				slog.String("method", r.Method),
+				slog.String("url", r.URL.Path),
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+			writeProblem(w, r, http.StatusUnauthorized, codeUnauthorized, "missing bearer token", "")
+			return
+		}
+
+		p := s.auth.Authenticate(strings.TrimSpace(token))
+		if p == nil {
+			logger.Warn("Invalid bearer token",
+				slog.String("method", r.Method),
+				slog.String("url", r.URL.Path),
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+			writeProblem(w, r, http.StatusUnauthorized, codeUnauthorized, "invalid bearer token", "")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+	})
+}
+
+// requireScope пропускает запрос, только если клиенту выдано право scope.
+func (s *Server) requireScope(scope Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p := principalFromContext(r.Context()); s.auth != nil && (p == nil || !p.Can(scope)) {
+				loggerFromContext(r.Context()).Warn("Insufficient scope",
+					slog.String("scope", string(scope)),
+					slog.String("method", r.Method),
+					slog.String("url", r.URL.Path),
+				)
+				writeProblem(w, r, http.StatusForbidden, codeForbidden, fmt.Sprintf("scope %q required", scope), "")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authorizeKey проверяет, может ли клиент работать с ключом key.
+// При отказе пишет 403 в ответ и возвращает false.
+func (s *Server) authorizeKey(w http.ResponseWriter, r *http.Request, key string) bool {
+	p := principalFromContext(r.Context())
+	if p == nil || p.AllowsKey(key) {
+		return true
+	}
+	loggerFromContext(r.Context()).Warn("Key outside of allowed prefixes",
+		slog.String("key", key),
+		slog.String("method", r.Method),
+	)
+	writeProblem(w, r, http.StatusForbidden, codeForbidden, "key is outside of allowed prefixes", key)
+	return false
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeAuthFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadAuthFile(t *testing.T) {
+	sum := sha256.Sum256([]byte("hashed-token"))
+
+	path := writeAuthFile(t, `{"keys": [
+		{"id": "reader", "token": "read-token", "scopes": ["read"]},
+		{"id": "hashed", "token_sha256": "`+hex.EncodeToString(sum[:])+`", "scopes": ["admin"]}
+	]}`)
+
+	a, err := LoadAuthFile(path)
+	require.NoError(t, err)
+
+	p := a.Authenticate("read-token")
+	require.NotNil(t, p)
+	assert.Equal(t, "reader", p.ID)
+	assert.True(t, p.Can(ScopeRead))
+	assert.False(t, p.Can(ScopeWrite))
+
+	p = a.Authenticate("hashed-token")
+	require.NotNil(t, p)
+	assert.True(t, p.Can(ScopeDelete), "admin scope should imply every other scope")
+
+	assert.Nil(t, a.Authenticate("unknown"))
+}
+
+func TestLoadAuthFileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "Unknown scope", content: `{"keys": [{"id": "a", "token": "t", "scopes": ["root"]}]}`},
+		{name: "Missing token", content: `{"keys": [{"id": "a", "scopes": ["read"]}]}`},
+		{name: "Missing id", content: `{"keys": [{"token": "t", "scopes": ["read"]}]}`},
+		{name: "Duplicate token", content: `{"keys": [{"id": "a", "token": "t"}, {"id": "b", "token": "t"}]}`},
+		{name: "Unknown field", content: `{"keys": [{"id": "a", "token": "t", "scope": ["read"]}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadAuthFile(writeAuthFile(t, tt.content))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	a, err := LoadAuthFile(writeAuthFile(t, `{"keys": [
+		{"id": "reader", "token": "read-token", "scopes": ["read"]},
+		{"id": "writer", "token": "write-token", "scopes": ["read", "write", "delete"], "key_prefixes": ["user:"]},
+		{"id": "admin", "token": "admin-token", "scopes": ["admin"]}
+	]}`))
+	require.NoError(t, err)
+
+	srv := NewServer("localhost:0", 10, time.Minute, WithAuthenticator(a))
+	handler := srv.httpServer.Handler
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		token      string
+		statusCode int
+	}{
+		{name: "No token", method: http.MethodGet, url: "/api/lru", statusCode: http.StatusUnauthorized},
+		{name: "Unknown token", method: http.MethodGet, url: "/api/lru", token: "nope", statusCode: http.StatusUnauthorized},
+		{name: "Reader cannot write", method: http.MethodPost, url: "/api/lru", body: `{"key": "user:1", "value": 1}`, token: "read-token", statusCode: http.StatusForbidden},
+		{name: "Writer stores allowed key", method: http.MethodPost, url: "/api/lru", body: `{"key": "user:1", "value": 1}`, token: "write-token", statusCode: http.StatusCreated},
+		{name: "Writer cannot store foreign key", method: http.MethodPost, url: "/api/lru", body: `{"key": "order:1", "value": 1}`, token: "write-token", statusCode: http.StatusForbidden},
+		{name: "Reader reads", method: http.MethodGet, url: "/api/lru/user:1", token: "read-token", statusCode: http.StatusOK},
+		{name: "Writer cannot evict all", method: http.MethodDelete, url: "/api/lru", token: "write-token", statusCode: http.StatusForbidden},
+		{name: "Admin evicts all", method: http.MethodDelete, url: "/api/lru", token: "admin-token", statusCode: http.StatusNoContent},
+		{name: "Probes stay open", method: http.MethodGet, url: "/healthz", statusCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, bytes.NewBufferString(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+		})
+	}
+}
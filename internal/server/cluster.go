@@ -0,0 +1,285 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/titoffon/lru-cache-service/internal/cluster"
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// WithCluster включает кластерный режим: запросы к ключам, которыми по
+// кольцу владеет другой узел, пересылаются ему.
+func WithCluster(c *cluster.Cluster) Option {
+	return func(s *Server) {
+		s.cluster = c
+	}
+}
+
+// routeToOwner пересылает запрос к ключу узлу-владельцу. Ставится после
+// authenticate, rateLimit и requireScope: проверки выполняет узел, принявший
+// запрос, а владелец повторяет аутентификацию по тому же заголовку Authorization.
+func (s *Server) routeToOwner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cluster == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get(cluster.HeaderForwardedBy) != "" {
+			w.Header().Set(cluster.HeaderNode, s.cluster.Self())
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := chi.URLParam(r, "key")
+		if r.Method == http.MethodPost {
+			var err error
+			if key, err = peekKey(w, r); err != nil {
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					loggerFromContext(r.Context()).Warn("Body too large in POST request",
+						slog.Int64("limit", maxErr.Limit),
+					)
+					writeProblem(w, r, http.StatusRequestEntityTooLarge, codeValueTooLarge,
+						"request body exceeds "+strconv.FormatInt(maxErr.Limit, 10)+" bytes", "")
+					return
+				}
+			}
+		}
+		owner, local := s.cluster.Owner(key)
+		if key == "" || local {
+			w.Header().Set(cluster.HeaderNode, s.cluster.Self())
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		loggerFromContext(r.Context()).Debug("Forwarding request to key owner",
+			slog.String("key", key),
+			slog.String("owner", owner),
+		)
+		s.cluster.Forward(w, r, owner, func(w http.ResponseWriter, r *http.Request, err error) {
+			loggerFromContext(r.Context()).Warn("Failed to forward request to key owner",
+				slog.String("key", key),
+				slog.String("owner", owner),
+				slog.String("error", err.Error()),
+			)
+			w.Header().Set(cluster.HeaderNode, owner)
+			writeProblem(w, r, http.StatusBadGateway, codeOwnerUnavailable, "owner node "+owner+" is unavailable", key)
+		})
+	})
+}
+
+// peerNodes возвращает остальные узлы кольца, если запрос ко всему кэшу нужно
+// разослать по кластеру, и nil, если кластер выключен или запрос уже
+// переслан другим узлом.
+func (s *Server) peerNodes(r *http.Request) []string {
+	if s.cluster == nil || r.Header.Get(cluster.HeaderForwardedBy) != "" {
+		return nil
+	}
+	var nodes []string
+	for _, node := range s.cluster.Ring().Nodes() {
+		if node != s.cluster.Self() {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// broadcastToPeers параллельно выполняет method /api/lru на узлах nodes от
+// имени клиента r и передаёт ответы со статусом 2xx в handle; вызовы handle
+// не пересекаются. Возвращает узлы, на которых запрос не удался, и ошибки по ним.
+func (s *Server) broadcastToPeers(r *http.Request, method string, nodes []string, handle func(node string, resp *http.Response) error) ([]string, error) {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		failed []string
+		errs   []error
+	)
+	for _, node := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.peerRequest(r, method, node, func(resp *http.Response) error {
+				mu.Lock()
+				defer mu.Unlock()
+				return handle(node, resp)
+			})
+			if err != nil {
+				mu.Lock()
+				failed = append(failed, node)
+				errs = append(errs, fmt.Errorf("node %s: %w", node, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	sort.Strings(failed)
+	return failed, errors.Join(errs...)
+}
+
+// peerRequest выполняет method /api/lru на узле node. Заголовок Authorization
+// клиента передаётся узлу, чтобы тот сам проверил права.
+func (s *Server) peerRequest(r *http.Request, method, node string, handle func(resp *http.Response) error) error {
+	req, err := http.NewRequestWithContext(r.Context(), method, node+"/api/lru", nil)
+	if err != nil {
+		return err
+	}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(cluster.HeaderForwardedBy, s.cluster.Self())
+
+	resp, err := s.cluster.Client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return handle(resp)
+}
+
+// collectPeerEntries дополняет локальные записи keys и values записями
+// остальных узлов кластера. Ключ, найденный на нескольких узлах, берётся один раз.
+func (s *Server) collectPeerEntries(r *http.Request, nodes, keys []string, values []interface{}) ([]string, []interface{}, []string, error) {
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		seen[k] = true
+	}
+	failed, err := s.broadcastToPeers(r, http.MethodGet, nodes, func(_ string, resp *http.Response) error {
+		if resp.StatusCode == http.StatusNoContent {
+			return nil
+		}
+		var body struct {
+			Keys   []string      `json:"keys"`
+			Values []interface{} `json:"values"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return err
+		}
+		if len(body.Keys) != len(body.Values) {
+			return errors.New("keys and values differ in length")
+		}
+		for i, k := range body.Keys {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+				values = append(values, body.Values[i])
+			}
+		}
+		return nil
+	})
+	return keys, values, failed, err
+}
+
+// peekKey достаёт ключ из тела POST-запроса, не потребляя тело. Тело
+// ограничено maxRawValueSize так же, как в handlePost; при превышении
+// возвращается *http.MaxBytesError. Если тело не удалось разобрать, ключ
+// пустой: запрос обслуживается локально и обработчик сам сообщит об ошибке.
+func peekKey(w http.ResponseWriter, r *http.Request) (string, error) {
+	dec := requestCodec(r)
+	if dec == nil {
+		return "", nil
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRawValueSize))
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	var req requestBody
+	if err := dec.Decode(bytes.NewReader(data), &req); err != nil {
+		return "", nil
+	}
+	return req.Key, nil
+}
+
+// remoteCommand выполняет команду WebSocket API на узле-владельце ключа
+// через его HTTP API.
+func (c *wsConn) remoteCommand(ctx context.Context, owner string, cmd wsCommand) wsResponse {
+	endpoint := owner + "/api/lru/" + url.PathEscape(cmd.Key)
+
+	var req *http.Request
+	var err error
+	switch cmd.Op {
+	case wsOpGet:
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if req != nil {
+			req.Header.Set("Accept", "application/json")
+		}
+	case wsOpPut:
+		body, merr := json.Marshal(requestBody{Key: cmd.Key, Value: cmd.Value, TTLSeconds: cmd.TTLSeconds, SoftTTLSeconds: cmd.SoftTTLSeconds})
+		if merr != nil {
+			return wsFail(cmd, http.StatusBadRequest, codeInvalidBody, "value cannot be encoded")
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, owner+"/api/lru", bytes.NewReader(body))
+		if req != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	case wsOpEvict:
+		req, err = http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	}
+	if err != nil {
+		return wsFail(cmd, http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
+	req.Header.Set(cluster.HeaderForwardedBy, c.s.cluster.Self())
+
+	resp, err := c.s.cluster.Client().Do(req)
+	if err != nil {
+		c.logger.Warn("Failed to forward WebSocket command to key owner",
+			slog.String("key", cmd.Key),
+			slog.String("owner", owner),
+			slog.String("error", err.Error()),
+		)
+		return wsFail(cmd, http.StatusBadGateway, codeOwnerUnavailable, "owner node "+owner+" is unavailable")
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRawValueSize))
+	if err != nil {
+		return wsFail(cmd, http.StatusBadGateway, codeOwnerUnavailable, "failed to read response from owner node "+owner)
+	}
+
+	if resp.StatusCode >= 300 {
+		var p problem
+		if json.Unmarshal(data, &p) != nil || p.Code == "" {
+			return wsFail(cmd, http.StatusBadGateway, codeOwnerUnavailable, "owner node "+owner+" responded with status "+strconv.Itoa(resp.StatusCode))
+		}
+		return wsFail(cmd, p.Status, p.Code, p.Detail)
+	}
+	if cmd.Op != wsOpGet {
+		return wsResponse{ID: cmd.ID, OK: true, Key: cmd.Key}
+	}
+
+	stale := resp.Header.Get(staleHeader) == "true"
+	// Значение, сохранённое через PUT, владелец отдаёт как есть, со временем
+	// истечения в заголовке X-Expires-At.
+	if raw := resp.Header.Get("X-Expires-At"); raw != "" {
+		expiresAt, _ := strconv.ParseInt(raw, 10, 64)
+		return wsResponse{ID: cmd.ID, OK: true, Key: cmd.Key, ExpiresAt: expiresAt, Stale: stale,
+			Value: cache.RawValue{ContentType: resp.Header.Get("Content-Type"), Data: data}}
+	}
+
+	var body responseBody
+	if err := json.Unmarshal(data, &body); err != nil {
+		return wsFail(cmd, http.StatusBadGateway, codeOwnerUnavailable, "invalid response from owner node "+owner)
+	}
+	return wsResponse{ID: cmd.ID, OK: true, Key: cmd.Key, Value: body.Value, ExpiresAt: body.ExpiresAt, Stale: stale}
+}
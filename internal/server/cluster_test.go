@@ -0,0 +1,274 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/titoffon/lru-cache-service/internal/cluster"
+)
+
+type testNode struct {
+	url string
+	srv *Server
+}
+
+// startCluster поднимает n узлов кластера на локальных портах.
+func startCluster(t *testing.T, n int) []testNode {
+	t.Helper()
+	listeners := make([]*httptest.Server, n)
+	urls := make([]string, n)
+	for i := range listeners {
+		listeners[i] = httptest.NewUnstartedServer(nil)
+		urls[i] = "http://" + listeners[i].Listener.Addr().String()
+	}
+
+	nodes := make([]testNode, n)
+	for i, ts := range listeners {
+		c, err := cluster.New(cluster.Options{Self: urls[i], Peers: urls})
+		require.NoError(t, err)
+		srv := NewServer("localhost:0", 100, time.Minute, WithCluster(c))
+		ts.Config.Handler = srv.httpServer.Handler
+		ts.Start()
+		t.Cleanup(ts.Close)
+		nodes[i] = testNode{url: urls[i], srv: srv}
+	}
+	return nodes
+}
+
+func TestClusterForwarding(t *testing.T) {
+	nodes := startCluster(t, 3)
+
+	const keys = 30
+	for i := 0; i < keys; i++ {
+		key := "key-" + strconv.Itoa(i)
+		body, _ := json.Marshal(requestBody{Key: key, Value: i})
+		// Запись через произвольный узел.
+		resp, err := http.Post(nodes[i%len(nodes)].url+"/api/lru", "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	perNode := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		key := "key-" + strconv.Itoa(i)
+
+		// Ключ хранится ровно на одном узле — на владельце.
+		owner, _ := nodes[0].srv.cluster.Owner(key)
+		holders := 0
+		for _, n := range nodes {
+			if _, _, err := n.srv.cache.Get(context.Background(), key); err == nil {
+				holders++
+				assert.Equal(t, owner, n.url, key)
+			}
+		}
+		assert.Equal(t, 1, holders, key)
+		perNode[owner]++
+
+		// Ключ читается с любого узла.
+		for _, n := range nodes {
+			resp, err := http.Get(n.url + "/api/lru/" + key)
+			require.NoError(t, err)
+			var got responseBody
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, owner, resp.Header.Get(cluster.HeaderNode))
+			assert.EqualValues(t, i, got.Value)
+		}
+	}
+	assert.Len(t, perNode, len(nodes), "keys should spread over all nodes")
+
+	// Удаление через чужой узел удаляет ключ у владельца.
+	owner, _ := nodes[0].srv.cluster.Owner("key-0")
+	for _, n := range nodes {
+		if n.url == owner {
+			continue
+		}
+		req, _ := http.NewRequest(http.MethodDelete, n.url+"/api/lru/key-0", nil)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		break
+	}
+	resp, err := http.Get(owner + "/api/lru/key-0")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestClusterRawValueForwarding(t *testing.T) {
+	nodes := startCluster(t, 2)
+
+	// Ищем ключ, которым владеет второй узел, и пишем его через первый.
+	var key string
+	for i := 0; ; i++ {
+		key = "raw-" + strconv.Itoa(i)
+		if owner, _ := nodes[0].srv.cluster.Owner(key); owner == nodes[1].url {
+			break
+		}
+	}
+	req, _ := http.NewRequest(http.MethodPut, nodes[0].url+"/api/lru/"+key, strings.NewReader("hello"))
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, nodes[1].url, resp.Header.Get(cluster.HeaderNode))
+
+	// WebSocket-команды к чужому ключу выполняются на владельце.
+	conn, wsResp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(nodes[0].url, "http")+"/api/lru/_ws", nil)
+	require.NoError(t, err)
+	wsResp.Body.Close()
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	require.NoError(t, conn.WriteJSON(wsCommand{ID: "1", Op: wsOpGet, Key: key}))
+	got := readResponses(t, conn, 1)["1"]
+	require.True(t, got.OK, got.Error)
+	// Как и локально, сырое значение приходит вместе с типом содержимого.
+	assert.Equal(t, map[string]interface{}{"content_type": "text/plain", "data": "aGVsbG8="}, got.Value)
+	assert.NotZero(t, got.ExpiresAt)
+
+	require.NoError(t, conn.WriteJSON(wsCommand{ID: "2", Op: wsOpEvict, Key: key}))
+	evicted := readResponses(t, conn, 1)["2"]
+	assert.True(t, evicted.OK, evicted.Error)
+
+	require.NoError(t, conn.WriteJSON(wsCommand{ID: "3", Op: wsOpEvict, Key: key}))
+	missing := readResponses(t, conn, 1)["3"]
+	require.NotNil(t, missing.Error)
+	assert.Equal(t, codeKeyNotFound, missing.Error.Code)
+}
+
+func TestClusterOwnerUnavailable(t *testing.T) {
+	down := httptest.NewServer(nil)
+	downURL := down.URL
+	down.Close()
+
+	self := httptest.NewUnstartedServer(nil)
+	selfURL := "http://" + self.Listener.Addr().String()
+	c, err := cluster.New(cluster.Options{Self: selfURL, Peers: []string{downURL}})
+	require.NoError(t, err)
+	srv := NewServer("localhost:0", 10, time.Minute, WithCluster(c))
+	self.Config.Handler = srv.httpServer.Handler
+	self.Start()
+	defer self.Close()
+
+	var key string
+	for i := 0; ; i++ {
+		key = "k" + strconv.Itoa(i)
+		if _, local := c.Owner(key); !local {
+			break
+		}
+	}
+	resp, err := http.Get(selfURL + "/api/lru/" + key)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	var p problem
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+	assert.Equal(t, codeOwnerUnavailable, p.Code)
+}
+
+func TestClusterGetAllAndDeleteAll(t *testing.T) {
+	nodes := startCluster(t, 2)
+
+	want := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		key := "key-" + strconv.Itoa(i)
+		want = append(want, key)
+		require.Equal(t, http.StatusCreated, postJSON(t, nodes[0].url, requestBody{Key: key, Value: i}).StatusCode)
+	}
+	local, _, err := nodes[0].srv.cache.GetAll(context.Background())
+	require.NoError(t, err)
+	require.Less(t, len(local), len(want), "keys must be spread over both nodes")
+
+	// Любой узел отдаёт ключи всего кластера.
+	for _, n := range nodes {
+		resp, err := http.Get(n.url + "/api/lru")
+		require.NoError(t, err)
+		var body struct {
+			Keys   []string      `json:"keys"`
+			Values []interface{} `json:"values"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		resp.Body.Close()
+		assert.ElementsMatch(t, want, body.Keys, n.url)
+		assert.Len(t, body.Values, len(want))
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, nodes[1].url+"/api/lru", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	for _, n := range nodes {
+		keys, _, err := n.srv.cache.GetAll(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, keys, n.url)
+	}
+
+	resp, err = http.Get(nodes[0].url + "/api/lru")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestClusterPeerUnavailableForWholeCache(t *testing.T) {
+	down := httptest.NewServer(nil)
+	downURL := down.URL
+	down.Close()
+
+	self := httptest.NewUnstartedServer(nil)
+	selfURL := "http://" + self.Listener.Addr().String()
+	c, err := cluster.New(cluster.Options{Self: selfURL, Peers: []string{downURL}})
+	require.NoError(t, err)
+	srv := NewServer("localhost:0", 10, time.Minute, WithCluster(c))
+	self.Config.Handler = srv.httpServer.Handler
+	self.Start()
+	defer self.Close()
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		req, err := http.NewRequest(method, selfURL+"/api/lru", nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		var p problem
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode, method)
+		assert.Equal(t, codeOwnerUnavailable, p.Code, method)
+		assert.Contains(t, p.Detail, downURL, method)
+	}
+}
+
+func TestClusterPostBodyLimit(t *testing.T) {
+	nodes := startCluster(t, 2)
+	standalone := httptest.NewServer(NewServer("localhost:0", 10, time.Minute).httpServer.Handler)
+	defer standalone.Close()
+
+	body := `{"key": "big", "value": "` + strings.Repeat("x", maxRawValueSize) + `"}`
+	for _, u := range []string{nodes[0].url, standalone.URL} {
+		resp, err := http.Post(u+"/api/lru", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		var p problem
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+		resp.Body.Close()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode, u)
+		assert.Equal(t, codeValueTooLarge, p.Code, u)
+	}
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// codec — формат сериализации тел запросов и ответов API.
+// Чтобы добавить новый формат, достаточно реализовать codec и добавить его в codecs.
+type codec interface {
+	// ContentType возвращает основной MIME-тип формата.
+	ContentType() string
+	// Aliases возвращает дополнительные MIME-типы, под которыми формат встречается у клиентов.
+	Aliases() []string
+	// Encode пишет v в w.
+	Encode(w io.Writer, v interface{}) error
+	// Decode читает значение из r в v. Вложенные объекты в interface{} должны
+	// декодироваться в map[string]interface{}, чтобы их можно было отдать в любом формате.
+	Decode(r io.Reader, v interface{}) error
+	// Binary сообщает, что формат не является текстом; ошибки разбора
+	// таких тел не называются "invalid JSON".
+	Binary() bool
+}
+
+// codecs — поддерживаемые форматы. Первый используется по умолчанию.
+var codecs = []codec{jsonCodec{}, msgpackCodec{}, cborCodec{}}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return "application/json" }
+func (jsonCodec) Aliases() []string   { return nil }
+func (jsonCodec) Binary() bool        { return false }
+
+func (jsonCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (jsonCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+func (msgpackCodec) Aliases() []string {
+	return []string{"application/x-msgpack", "application/vnd.msgpack"}
+}
+func (msgpackCodec) Binary() bool { return true }
+
+func (msgpackCodec) Encode(w io.Writer, v interface{}) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	enc.SetOmitEmpty(true)
+	return enc.Encode(v)
+}
+
+func (msgpackCodec) Decode(r io.Reader, v interface{}) error {
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// cborDecMode декодирует CBOR-мапы в map[string]interface{} вместо
+// map[interface{}]interface{}, который нельзя сериализовать в JSON.
+var cborDecMode, _ = cbor.DecOptions{
+	DefaultMapType: reflect.TypeOf(map[string]interface{}(nil)),
+}.DecMode()
+
+type cborCodec struct{}
+
+func (cborCodec) ContentType() string { return "application/cbor" }
+func (cborCodec) Aliases() []string   { return nil }
+func (cborCodec) Binary() bool        { return true }
+
+func (cborCodec) Encode(w io.Writer, v interface{}) error {
+	return cbor.NewEncoder(w).Encode(v)
+}
+
+func (cborCodec) Decode(r io.Reader, v interface{}) error {
+	return cborDecMode.NewDecoder(r).Decode(v)
+}
+
+// codecByMediaType ищет формат по MIME-типу без параметров.
+func codecByMediaType(mediaType string) codec {
+	for _, c := range codecs {
+		if c.ContentType() == mediaType {
+			return c
+		}
+		for _, alias := range c.Aliases() {
+			if alias == mediaType {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// requestCodec выбирает формат тела запроса по Content-Type.
+// Отсутствующий Content-Type означает JSON; неизвестный — nil.
+func requestCodec(r *http.Request) codec {
+	header := r.Header.Get("Content-Type")
+	if header == "" {
+		return codecs[0]
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return nil
+	}
+	return codecByMediaType(mediaType)
+}
+
+// responseCodec выбирает формат ответа по заголовку Accept с учётом q-значений.
+// Если подходящего формата нет, используется JSON.
+func responseCodec(r *http.Request) codec {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return codecs[0]
+	}
+
+	type candidate struct {
+		mediaType string
+		q         float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(raw, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{mediaType: mediaType, q: q})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+
+	for _, c := range candidates {
+		if c.mediaType == "*/*" || c.mediaType == "application/*" {
+			return codecs[0]
+		}
+		if found := codecByMediaType(c.mediaType); found != nil {
+			return found
+		}
+	}
+	return codecs[0]
+}
+
+// writeEncoded сериализует v выбранным форматом и пишет ответ со статусом status.
+// Тело сначала кодируется в буфер, поэтому при ошибке кодирования в ответ ещё
+// ничего не записано и вызывающий может ответить ошибкой. Ошибки записи в
+// соединение не возвращаются: клиент к этому моменту уже ушёл.
+func writeEncoded(w http.ResponseWriter, c codec, status int, v interface{}) error {
+	var buf bytes.Buffer
+	if err := c.Encode(&buf, v); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", c.ContentType())
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+	return nil
+}
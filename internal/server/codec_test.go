@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+func TestResponseCodecNegotiation(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{accept: "", expected: "application/json"},
+		{accept: "application/msgpack", expected: "application/msgpack"},
+		{accept: "application/x-msgpack", expected: "application/msgpack"},
+		{accept: "application/cbor", expected: "application/cbor"},
+		{accept: "text/html, application/cbor;q=0.5, application/msgpack;q=0.9", expected: "application/msgpack"},
+		{accept: "application/msgpack;q=0, */*", expected: "application/json"},
+		{accept: "text/html", expected: "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/lru", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			assert.Equal(t, tt.expected, responseCodec(req).ContentType())
+		})
+	}
+}
+
+func TestBinaryCodecsRoundTrip(t *testing.T) {
+	srv := NewServer("localhost:0", 10, time.Minute)
+	handler := srv.httpServer.Handler
+
+	value := map[string]interface{}{"name": "widget", "tags": []interface{}{"a", "b"}}
+
+	for _, c := range codecs {
+		t.Run(c.ContentType(), func(t *testing.T) {
+			var body bytes.Buffer
+			require.NoError(t, c.Encode(&body, map[string]interface{}{"key": "item", "value": value}))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/lru", &body)
+			req.Header.Set("Content-Type", c.ContentType())
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+			// Значение, записанное в одном формате, читается в любом другом.
+			for _, out := range codecs {
+				req = httptest.NewRequest(http.MethodGet, "/api/lru/item", nil)
+				req.Header.Set("Accept", out.ContentType())
+				rec = httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				require.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, out.ContentType(), rec.Header().Get("Content-Type"))
+				assert.Contains(t, rec.Header().Values("Vary"), "Accept")
+
+				var resp struct {
+					Key   string                 `json:"key"`
+					Value map[string]interface{} `json:"value"`
+				}
+				require.NoError(t, out.Decode(rec.Body, &resp))
+				assert.Equal(t, "item", resp.Key)
+				assert.Equal(t, "widget", resp.Value["name"])
+			}
+		})
+	}
+}
+
+func TestPostCodecErrors(t *testing.T) {
+	srv := NewServer("localhost:0", 10, time.Minute)
+	handler := srv.httpServer.Handler
+
+	msgpackBody, err := msgpack.Marshal("not an object")
+	require.NoError(t, err)
+	cborBody, err := cbor.Marshal([]int{1, 2})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		statusCode  int
+	}{
+		{name: "Unsupported media type", contentType: "text/csv", body: []byte("a,b"), statusCode: http.StatusUnsupportedMediaType},
+		{name: "Malformed msgpack", contentType: "application/msgpack", body: msgpackBody, statusCode: http.StatusBadRequest},
+		{name: "Malformed cbor", contentType: "application/cbor", body: cborBody, statusCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/lru", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+			assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestMsgpackValueSurvivesCompression(t *testing.T) {
+	srv := NewServer("localhost:0", 10, time.Minute,
+		WithCacheOptions(cache.WithCompression(cache.CompressionOptions{Threshold: 64})))
+	handler := srv.httpServer.Handler
+
+	value := map[string]interface{}{"count": 7, "blob": bytes.Repeat([]byte{0x01, 0x02}, 256)}
+	body, err := msgpack.Marshal(map[string]interface{}{"key": "doc", "value": value})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/api/lru", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/msgpack")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/api/lru/doc", nil)
+	req.Header.Set("Accept", "application/msgpack")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Value map[string]interface{} `msgpack:"value"`
+	}
+	require.NoError(t, msgpack.NewDecoder(rec.Body).Decode(&resp))
+	// Целое остаётся целым, а двоичное поле — двоичным, как и без сжатия.
+	assert.EqualValues(t, 7, resp.Value["count"])
+	assert.IsType(t, int8(0), resp.Value["count"])
+	assert.Equal(t, value["blob"], resp.Value["blob"])
+}
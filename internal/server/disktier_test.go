@@ -0,0 +1,45 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+func TestDiskTier(t *testing.T) {
+	store, err := cache.OpenDiskStore(cache.DiskOptions{Dir: t.TempDir(), MaxBytes: 1 << 20})
+	require.NoError(t, err)
+	srv := NewServer("localhost:0", 1, time.Minute, WithDiskTier(store))
+	ts := httptest.NewServer(srv.httpServer.Handler)
+	defer ts.Close()
+
+	ttl := int64(30)
+	require.Equal(t, http.StatusCreated, postJSON(t, ts.URL, requestBody{Key: "a", Value: "va", TTLSeconds: &ttl}).StatusCode)
+	require.Equal(t, http.StatusCreated, postJSON(t, ts.URL, requestBody{Key: "b", Value: "vb"}).StatusCode)
+	// На диск записи переносятся в фоне.
+	assert.Eventually(t, func() bool { return store.Len() == 1 }, time.Second, 5*time.Millisecond)
+
+	resp, err := http.Get(ts.URL + "/api/lru/a")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var got responseBody
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	resp.Body.Close()
+	assert.Equal(t, "va", got.Value)
+	assert.InDelta(t, time.Now().Add(30*time.Second).Unix(), got.ExpiresAt, 2)
+
+	// Теперь на диске b; удаление через API убирает и его.
+	assert.Equal(t, http.StatusNoContent, deleteKey(t, ts.URL+"/api/lru/b"))
+	assert.Zero(t, store.Len())
+	resp, err = http.Get(ts.URL + "/api/lru/b")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -1,9 +1,12 @@
 package server
 
 import (
-	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"context"
@@ -14,101 +17,304 @@ import (
 )
 
 
+// maxRawValueSize ограничивает размер тела PUT- и POST-запроса.
+const maxRawValueSize = 8 << 20
+
+// staleHeader помечает ответы со значением, у которого истёк мягкий TTL.
+const staleHeader = "X-Cache-Stale"
+
 type requestBody struct {
-	Key        string      `json:"key"`
-	Value      interface{} `json:"value"`
-	TTLSeconds *int64      `json:"ttl_seconds,omitempty"`
+	Key            string      `json:"key"`
+	Value          interface{} `json:"value"`
+	TTLSeconds     *int64      `json:"ttl_seconds,omitempty"`
+	SoftTTLSeconds *int64      `json:"soft_ttl_seconds,omitempty"`
 }
 
 type responseBody struct {
 	Key       string      `json:"key"`
 	Value     interface{} `json:"value"`
 	ExpiresAt int64       `json:"expires_at"`
+	Stale     bool        `json:"stale,omitempty"`
 }
 
 // handlePost обрабатывает POST /api/lru — добавление данных в кэш.
 func (s *Server) handlePost(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
+	logger := loggerFromContext(r.Context())
+
+	dec := requestCodec(r)
+	if dec == nil {
+		logger.Warn("Unsupported content type in POST request",
+			slog.String("content_type", r.Header.Get("Content-Type")),
+		)
+		writeProblem(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMediaType,
+			"unsupported Content-Type "+r.Header.Get("Content-Type"), "")
+		return
+	}
 
 	var req requestBody
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		slog.Warn("Invalid JSON in POST request",
+	if err := dec.Decode(http.MaxBytesReader(w, r.Body, maxRawValueSize), &req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			logger.Warn("Body too large in POST request",
+				slog.Int64("limit", maxErr.Limit),
+			)
+			writeProblem(w, r, http.StatusRequestEntityTooLarge, codeValueTooLarge,
+				"request body exceeds "+strconv.FormatInt(maxErr.Limit, 10)+" bytes", "")
+			return
+		}
+		logger.Warn("Invalid body in POST request",
 			slog.String("error", err.Error()),
+			slog.String("content_type", dec.ContentType()),
 			slog.String("method", r.Method),
 			slog.String("url", r.URL.Path),
 		)
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		if dec.Binary() {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "request body is not valid "+dec.ContentType(), "")
+			return
+		}
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "request body is not valid JSON", "")
 		return
 	}
 	if req.Key == "" {
-		slog.Warn("Missing key in POST request",
+		logger.Warn("Missing key in POST request",
 			slog.String("method", r.Method),
 			slog.String("url", r.URL.Path),
 		)
-		http.Error(w, "missing key", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, codeMissingKey, "key must not be empty", "")
+		return
+	}
+	if !s.authorizeKey(w, r, req.Key) {
 		return
 	}
 
 	ttl := time.Duration(0)
 	if req.TTLSeconds != nil {
 		if *req.TTLSeconds < 0 {
-			slog.Warn("Invalid TTL in POST request",
+			logger.Warn("Invalid TTL in POST request",
 				slog.String("key", req.Key),
 				slog.Int64("ttl_seconds", *req.TTLSeconds),
 			)
-			http.Error(w, "ttl_seconds must be >= 0", http.StatusBadRequest)
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidTTL, "ttl_seconds must be >= 0", req.Key)
 			return
 		}
 		ttl = time.Duration(*req.TTLSeconds) * time.Second
 	}
 
-	ctx := context.Background()
-	if err := s.cache.Put(ctx, req.Key, req.Value, ttl); err != nil {
-		slog.Error("Failed to store data in cache",
+	softTTL := time.Duration(0)
+	if req.SoftTTLSeconds != nil {
+		if *req.SoftTTLSeconds <= 0 {
+			logger.Warn("Invalid soft TTL in POST request",
+				slog.String("key", req.Key),
+				slog.Int64("soft_ttl_seconds", *req.SoftTTLSeconds),
+			)
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidTTL, "soft_ttl_seconds must be > 0", req.Key)
+			return
+		}
+		softTTL = time.Duration(*req.SoftTTLSeconds) * time.Second
+	}
+
+	if err := s.put(r.Context(), req.Key, req.Value, softTTL, ttl); err != nil {
+		logger.Error("Failed to store data in cache",
 			slog.String("key", req.Key),
 			slog.String("error", err.Error()),
 		)
-		http.Error(w, "failed to put data", http.StatusInternalServerError)
+		writeCacheError(w, r, err, req.Key)
 		return
 	}
 
-	slog.Info("Data stored successfully",
+	logger.Info("Data stored successfully",
 		slog.String("key", req.Key),
 		slog.Duration("ttl", ttl),
+		slog.Duration("soft_ttl", softTTL),
 		slog.Duration("duration", time.Since(start)),
 	)
 
 	w.WriteHeader(http.StatusCreated)
 }
 
+// handlePut обрабатывает PUT /api/lru/{key} — сохранение произвольного тела запроса
+// как есть вместе с его Content-Type. TTL задаётся параметром ?ttl_seconds=,
+// мягкий TTL — параметром ?soft_ttl_seconds=.
+func (s *Server) handlePut(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	logger := loggerFromContext(r.Context())
+
+	key := chi.URLParam(r, "key")
+	if key == "" {
+		logger.Warn("Missing key in PUT request",
+			slog.String("method", r.Method),
+			slog.String("url", r.URL.Path),
+		)
+		writeProblem(w, r, http.StatusBadRequest, codeMissingKey, "key must not be empty", "")
+		return
+	}
+	if !s.authorizeKey(w, r, key) {
+		return
+	}
+
+	ttl := time.Duration(0)
+	if raw := r.URL.Query().Get("ttl_seconds"); raw != "" {
+		seconds, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || seconds < 0 {
+			logger.Warn("Invalid TTL in PUT request",
+				slog.String("key", key),
+				slog.String("ttl_seconds", raw),
+			)
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidTTL, "ttl_seconds must be an integer >= 0", key)
+			return
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+
+	softTTL := time.Duration(0)
+	if raw := r.URL.Query().Get("soft_ttl_seconds"); raw != "" {
+		seconds, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || seconds <= 0 {
+			logger.Warn("Invalid soft TTL in PUT request",
+				slog.String("key", key),
+				slog.String("soft_ttl_seconds", raw),
+			)
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidTTL, "soft_ttl_seconds must be an integer > 0", key)
+			return
+		}
+		softTTL = time.Duration(seconds) * time.Second
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRawValueSize))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			logger.Warn("Value too large in PUT request",
+				slog.String("key", key),
+				slog.Int64("limit", maxErr.Limit),
+			)
+			writeProblem(w, r, http.StatusRequestEntityTooLarge, codeValueTooLarge,
+				"value exceeds "+strconv.FormatInt(maxErr.Limit, 10)+" bytes", key)
+			return
+		}
+		logger.Warn("Failed to read PUT body",
+			slog.String("key", key),
+			slog.String("error", err.Error()),
+		)
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "failed to read request body", key)
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	value := cache.RawValue{ContentType: contentType, Data: data}
+	if err := s.put(r.Context(), key, value, softTTL, ttl); err != nil {
+		logger.Error("Failed to store data in cache",
+			slog.String("key", key),
+			slog.String("error", err.Error()),
+		)
+		writeCacheError(w, r, err, key)
+		return
+	}
+
+	logger.Info("Raw data stored successfully",
+		slog.String("key", key),
+		slog.String("content_type", contentType),
+		slog.Int("size", len(data)),
+		slog.Duration("ttl", ttl),
+		slog.Duration("soft_ttl", softTTL),
+		slog.Duration("duration", time.Since(start)),
+	)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // handleGet обрабатывает GET /api/lru/{key} — получение данных по ключу.
 func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
+	logger := loggerFromContext(r.Context())
 
 	key := chi.URLParam(r, "key")
 	if key == "" {
-		slog.Warn("Missing key in GET request",
+		logger.Warn("Missing key in GET request",
 			slog.String("method", r.Method),
 			slog.String("url", r.URL.Path),
 		)
-		http.Error(w, "Missing key in GET request", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, codeMissingKey, "key must not be empty", "")
+		return
+	}
+	if !s.authorizeKey(w, r, key) {
 		return
 	}
 
-	value, expiresAt, err := s.cache.Get(r.Context(), key)
+	// Если клиент принимает gzip и значение хранится сжатым, отдаём его без распаковки.
+	if cr, ok := s.cache.(cache.CompressedReader); ok && acceptsGzip(r) {
+		cv, expiresAt, err := cr.GetCompressed(r.Context(), key)
+		if err == nil && cv.ContentType != "" {
+			w.Header().Set("Content-Type", cv.ContentType)
+			w.Header().Set("Content-Encoding", cv.Encoding)
+			w.Header().Set("Content-Length", strconv.Itoa(len(cv.Data)))
+			w.Header().Set("X-Expires-At", strconv.FormatInt(expiresAt.Unix(), 10))
+			w.Header().Add("Vary", "Accept-Encoding")
+			if cv.Stale {
+				w.Header().Set(staleHeader, "true")
+			}
+			if _, err := w.Write(cv.Data); err != nil {
+				logger.Warn("Failed to write compressed response",
+					slog.String("key", key),
+					slog.String("error", err.Error()),
+				)
+				return
+			}
+
+			logger.Info("Compressed data retrieved successfully",
+				slog.String("key", key),
+				slog.Duration("duration", time.Since(start)),
+			)
+			return
+		}
+	}
+
+	value, expiresAt, stale, err := s.get(r.Context(), key)
+	if errors.Is(err, cache.ErrKeyNotFound) && s.fill != nil {
+		value, expiresAt, err = s.fill.Get(r.Context(), key)
+	}
 	if err != nil {
-		if err == cache.ErrKeyNotFound {
-			slog.Warn("Key not found in GET request",
+		if errors.Is(err, cache.ErrKeyNotFound) {
+			logger.Warn("Key not found in GET request",
+				slog.String("key", key),
+			)
+		} else {
+			logger.Error("Failed to retrieve data",
 				slog.String("key", key),
+				slog.String("error", err.Error()),
+			)
+		}
+		writeCacheError(w, r, err, key)
+		return
+	}
+
+	if stale {
+		w.Header().Set(staleHeader, "true")
+	}
+
+	// Значения, сохранённые через PUT, отдаются как есть с исходным Content-Type.
+	if raw, ok := value.(cache.RawValue); ok {
+		w.Header().Set("Content-Type", raw.ContentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(raw.Data)))
+		w.Header().Add("Vary", "Accept-Encoding")
+		w.Header().Set("X-Expires-At", strconv.FormatInt(expiresAt.Unix(), 10))
+		if _, err := w.Write(raw.Data); err != nil {
+			logger.Warn("Failed to write raw response",
+				slog.String("key", key),
+				slog.String("error", err.Error()),
 			)
-			http.Error(w, "not found", http.StatusNotFound)
 			return
 		}
-		slog.Error("Failed to retrieve data",
+
+		logger.Info("Raw data retrieved successfully",
 			slog.String("key", key),
-			slog.String("error", err.Error()),
+			slog.Duration("duration", time.Since(start)),
 		)
-		http.Error(w, "failed to get data", http.StatusInternalServerError)
 		return
 	}
 
@@ -116,20 +322,21 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 		Key:       key,
 		Value:     value,
 		ExpiresAt: expiresAt.Unix(),
+		Stale:     stale,
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		slog.Error("Failed to encode JSON response",
+	if err := writeEncoded(w, responseCodec(r), http.StatusOK, resp); err != nil {
+		logger.Error("Failed to encode response",
 			slog.String("error", err.Error()),
 			slog.String("method", r.Method),
 			slog.String("url", r.URL.Path),
 		)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, "failed to encode response", "")
 		return
 	}
 
-	slog.Info("Data retrieved successfully",
+	logger.Info("Data retrieved successfully",
 		slog.String("key", key),
+		slog.Bool("stale", stale),
 		slog.Duration("duration", time.Since(start)),
 	)
 }
@@ -137,18 +344,34 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 // handleGetAll обрабатывает GET /api/lru — получение всего кэша.
 func (s *Server) handleGetAll(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
+	logger := loggerFromContext(r.Context())
 
 	keys, values, err := s.cache.GetAll(r.Context())
 	if err != nil {
-		slog.Error("Failed to retrieve all data from cache",
+		logger.Error("Failed to retrieve all data from cache",
 			slog.String("error", err.Error()),
 		)
-		http.Error(w, "Failed to retrieve all data from cache", http.StatusInternalServerError)
+		writeCacheError(w, r, err, "")
 		return
 	}
+	if p := principalFromContext(r.Context()); p != nil {
+		keys, values = filterAllowed(p, keys, values)
+	}
+	// В кластере каждый узел хранит только свою часть ключей.
+	if nodes := s.peerNodes(r); len(nodes) > 0 {
+		var failed []string
+		keys, values, failed, err = s.collectPeerEntries(r, nodes, keys, values)
+		if err != nil {
+			logger.Warn("Failed to collect data from cluster nodes",
+				slog.String("error", err.Error()),
+			)
+			writeProblem(w, r, http.StatusBadGateway, codeOwnerUnavailable, "cluster nodes are unavailable: "+strings.Join(failed, ", "), "")
+			return
+		}
+	}
 	if len(keys) == 0 {
 
-		slog.Info("No content in GET all request")
+		logger.Info("No content in GET all request")
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
@@ -160,18 +383,17 @@ func (s *Server) handleGetAll(w http.ResponseWriter, r *http.Request) {
 		Keys:   keys,
 		Values: values,
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		slog.Error("Failed to encode JSON response",
+	if err := writeEncoded(w, responseCodec(r), http.StatusOK, resp); err != nil {
+		logger.Error("Failed to encode response",
 			slog.String("error", err.Error()),
 			slog.String("method", r.Method),
 			slog.String("url", r.URL.Path),
 		)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, "failed to encode response", "")
 		return
 	}
 
-	slog.Info("All data retrieved successfully",
+	logger.Info("All data retrieved successfully",
 		slog.Int("keys_count", len(keys)),
 		slog.Duration("duration", time.Since(start)),
 	)
@@ -180,30 +402,40 @@ func (s *Server) handleGetAll(w http.ResponseWriter, r *http.Request) {
 // handleDelete обрабатывает DELETE /api/lru/{key} — удаление данных по ключу.
 func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
+	logger := loggerFromContext(r.Context())
 
 	key := chi.URLParam(r, "key")
 	if key == "" {
-		slog.Warn("Missing key in DELETE request",
+		logger.Warn("Missing key in DELETE request",
 			slog.String("method", r.Method),
 			slog.String("url", r.URL.Path),
 		)
-		http.Error(w, "missing key", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, codeMissingKey, "key must not be empty", "")
+		return
+	}
+	if !s.authorizeKey(w, r, key) {
 		return
 	}
 	_, err := s.cache.Evict(r.Context(), key)
+	if err == nil || errors.Is(err, cache.ErrKeyNotFound) {
+		s.broadcastEvict(key)
+	}
 	if err != nil {
-		if err == cache.ErrKeyNotFound {
-			slog.Warn("Key not found in DELETE request",
+		if errors.Is(err, cache.ErrKeyNotFound) {
+			logger.Warn("Key not found in DELETE request",
 				slog.String("key", key),
 			)
-			http.Error(w, "not found", http.StatusNotFound)
-			return
+		} else {
+			logger.Error("Failed to evict data",
+				slog.String("key", key),
+				slog.String("error", err.Error()),
+			)
 		}
-		http.Error(w, "Key not found", http.StatusInternalServerError)
+		writeCacheError(w, r, err, key)
 		return
 	}
 
-	slog.Info("Key deleted successfully",
+	logger.Info("Key deleted successfully",
 		slog.String("key", key),
 		slog.Duration("duration", time.Since(start)),
 	)
@@ -214,18 +446,100 @@ func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
 // handleDeleteAll обрабатывает DELETE /api/lru — полная очистка кэша.
 func (s *Server) handleDeleteAll(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
+	logger := loggerFromContext(r.Context())
+
+	// Полная очистка затронула бы чужие ключи, поэтому клиентам с ограничением
+	// по префиксам она запрещена.
+	if p := principalFromContext(r.Context()); p != nil && len(p.KeyPrefixes) > 0 {
+		logger.Warn("Prefix-restricted principal attempted to evict all data")
+		writeProblem(w, r, http.StatusForbidden, codeForbidden, "evicting all data requires unrestricted key access", "")
+		return
+	}
 
 	if err := s.cache.EvictAll(r.Context()); err != nil {
-		slog.Error("Failed to evict all data",
+		logger.Error("Failed to evict all data",
 			slog.String("error", err.Error()),
 		)
-		http.Error(w, "Failed to evict all data", http.StatusInternalServerError)
+		writeCacheError(w, r, err, "")
 		return
 	}
+	s.broadcastClear()
 
-	slog.Info("All data evicted successfully",
+	if nodes := s.peerNodes(r); len(nodes) > 0 {
+		failed, err := s.broadcastToPeers(r, http.MethodDelete, nodes, func(string, *http.Response) error { return nil })
+		if err != nil {
+			logger.Warn("Failed to evict all data on cluster nodes",
+				slog.String("error", err.Error()),
+			)
+			writeProblem(w, r, http.StatusBadGateway, codeOwnerUnavailable, "cache cleared on this node, but cluster nodes are unavailable: "+strings.Join(failed, ", "), "")
+			return
+		}
+	}
+
+	logger.Info("All data evicted successfully",
 		slog.Duration("duration", time.Since(start)),
 	)
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// errSoftTTLUnsupported возвращается put, если мягкий TTL задан, а кэш его не поддерживает.
+var errSoftTTLUnsupported = errors.New("soft ttl is not supported by the cache engine")
+
+// errSoftTTLWithoutLoader возвращается put, если мягкий TTL задан, а обновлять
+// устаревшую запись нечем.
+var errSoftTTLWithoutLoader = errors.New("soft ttl requires a loader")
+
+// put сохраняет значение; softTTL > 0 включает мягкий TTL.
+func (s *Server) put(ctx context.Context, key string, value interface{}, softTTL, ttl time.Duration) error {
+	if softTTL > 0 {
+		sc, ok := s.cache.(cache.StaleCache)
+		if !ok {
+			return errSoftTTLUnsupported
+		}
+		if !sc.Refreshes() {
+			return errSoftTTLWithoutLoader
+		}
+		return sc.PutStale(ctx, key, value, softTTL, ttl)
+	}
+	return s.cache.Put(ctx, key, value, ttl)
+}
+
+// get читает значение и, если кэш поддерживает мягкий TTL, признак его устаревания.
+func (s *Server) get(ctx context.Context, key string) (interface{}, time.Time, bool, error) {
+	if sc, ok := s.cache.(cache.StaleCache); ok {
+		return sc.GetStale(ctx, key)
+	}
+	value, expiresAt, err := s.cache.Get(ctx, key)
+	return value, expiresAt, false, err
+}
+
+// filterAllowed оставляет только пары ключ-значение, доступные клиенту p.
+func filterAllowed(p *Principal, keys []string, values []interface{}) ([]string, []interface{}) {
+	filteredKeys := keys[:0]
+	filteredValues := values[:0]
+	for i, key := range keys {
+		if p.AllowsKey(key) {
+			filteredKeys = append(filteredKeys, key)
+			filteredValues = append(filteredValues, values[i])
+		}
+	}
+	return filteredKeys, filteredValues
+}
+
+// acceptsGzip сообщает, принимает ли клиент ответы с Content-Encoding: gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), cache.EncodingGzip) {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
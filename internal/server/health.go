@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type probeResponse struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// handleHealthz обрабатывает GET /healthz — проверка того, что процесс жив.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, http.StatusOK, probeResponse{Status: "ok"})
+}
+
+// handleReadyz обрабатывает GET /readyz — готовность принимать трафик.
+// Сервер не готов, пока не начал слушать порт и не завершил загрузки из
+// WithStartupLoad, и перестаёт быть готовым сразу после получения сигнала
+// остановки.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if reason := s.notReadyReason(); reason != "" {
+		writeProbe(w, http.StatusServiceUnavailable, probeResponse{Status: "unavailable", Reason: reason})
+		return
+	}
+	writeProbe(w, http.StatusOK, probeResponse{Status: "ok"})
+}
+
+// notReadyReason возвращает причину неготовности или пустую строку, если сервер готов.
+func (s *Server) notReadyReason() string {
+	switch {
+	case s.shuttingDown.Load():
+		return "shutting down"
+	case !s.listening.Load():
+		return "not listening"
+	case s.restoring.Load():
+		return "restoring cache"
+	case s.isReplica() && !s.follower.Status().Synced:
+		// Пустая реплика не должна получать чтения, пока не примет снимок.
+		return "replica not synced"
+	default:
+		return ""
+	}
+}
+
+func writeProbe(w http.ResponseWriter, status int, resp probeResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+func TestHandleHealthz(t *testing.T) {
+	srv := &Server{cache: cache.NewLRUCache(10, time.Minute)}
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	rec := httptest.NewRecorder()
+
+	srv.handleHealthz(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHandleReadyz(t *testing.T) {
+	srv := &Server{cache: cache.NewLRUCache(10, time.Minute)}
+
+	tests := []struct {
+		name         string
+		listening    bool
+		shuttingDown bool
+		statusCode   int
+		reason       string
+	}{
+		{
+			name:       "Not listening yet",
+			statusCode: http.StatusServiceUnavailable,
+			reason:     "not listening",
+		},
+		{
+			name:       "Ready",
+			listening:  true,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:         "Shutting down",
+			listening:    true,
+			shuttingDown: true,
+			statusCode:   http.StatusServiceUnavailable,
+			reason:       "shutting down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.listening.Store(tt.listening)
+			srv.shuttingDown.Store(tt.shuttingDown)
+
+			req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			rec := httptest.NewRecorder()
+
+			srv.handleReadyz(rec, req)
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+
+			var resp probeResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.reason, resp.Reason)
+		})
+	}
+}
+
+func TestReadyzWaitsForStartupLoad(t *testing.T) {
+	release := make(chan struct{})
+	srv := NewServer("localhost:0", 10, time.Minute,
+		WithStartupLoad(func(ctx context.Context, c cache.ILRUCache) error {
+			<-release
+			return c.Put(ctx, "warm", "v", 0)
+		}),
+		WithStartupLoad(func(context.Context, cache.ILRUCache) error {
+			return errors.New("snapshot is corrupted")
+		}),
+	)
+	srv.listening.Store(true)
+
+	readyz := func() (int, string) {
+		rec := httptest.NewRecorder()
+		srv.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var resp probeResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return rec.Code, resp.Reason
+	}
+
+	status, reason := readyz()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "restoring cache", reason)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv.startBackground(ctx)
+	status, _ = readyz()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	// Ошибка одной из загрузок не мешает стать готовым.
+	close(release)
+	assert.Eventually(t, func() bool {
+		status, _ := readyz()
+		return status == http.StatusOK
+	}, time.Second, 5*time.Millisecond)
+	_, _, err := srv.cache.Get(ctx, "warm")
+	assert.NoError(t, err)
+}
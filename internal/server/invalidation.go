@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/titoffon/lru-cache-service/internal/invalidation"
+)
+
+// maxInvalidationBatchSize ограничивает тело запроса с пачкой инвалидаций.
+const maxInvalidationBatchSize = 4 << 20
+
+// WithInvalidation включает рассылку удалений независимым экземплярам:
+// DELETE /api/lru/{key}, DELETE /api/lru и команда evict WebSocket API
+// передаются узлам opts.Peers, а удаления, полученные от них, применяются локально.
+func WithInvalidation(opts invalidation.Options) Option {
+	return func(s *Server) {
+		s.invalidationOpts = &opts
+	}
+}
+
+// broadcastEvict рассылает удаление ключа, если рассылка включена. Рассылается
+// и удаление отсутствующего локально ключа: на других узлах он может быть.
+func (s *Server) broadcastEvict(key string) {
+	if s.invalidation != nil {
+		s.invalidation.Evict(key)
+	}
+}
+
+// broadcastClear рассылает полную очистку, если рассылка включена.
+func (s *Server) broadcastClear() {
+	if s.invalidation != nil {
+		s.invalidation.Clear()
+	}
+}
+
+// handleInvalidate обрабатывает POST /api/invalidation — пачку удалений от другого узла.
+func (s *Server) handleInvalidate(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFromContext(r.Context())
+
+	var batch invalidation.Batch
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxInvalidationBatchSize)).Decode(&batch); err != nil {
+		logger.Warn("Invalid invalidation batch",
+			slog.String("error", err.Error()),
+		)
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "request body is not valid JSON", "")
+		return
+	}
+
+	applied, err := s.invalidation.Receive(r.Context(), batch.Messages)
+	if err != nil {
+		if errors.Is(err, invalidation.ErrInvalidMessage) {
+			logger.Warn("Invalid invalidation message",
+				slog.String("error", err.Error()),
+			)
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, err.Error(), "")
+			return
+		}
+		logger.Error("Failed to apply invalidations",
+			slog.Int("applied", applied),
+			slog.String("error", err.Error()),
+		)
+		writeCacheError(w, r, err, "")
+		return
+	}
+
+	logger.Debug("Invalidations applied",
+		slog.Int("received", len(batch.Messages)),
+		slog.Int("applied", applied),
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleInvalidationStatus обрабатывает GET /api/admin/invalidation.
+func (s *Server) handleInvalidationStatus(w http.ResponseWriter, r *http.Request) {
+	if err := writeEncoded(w, responseCodec(r), http.StatusOK, s.invalidation.Stats()); err != nil {
+		loggerFromContext(r.Context()).Error("Failed to encode response",
+			slog.String("error", err.Error()),
+		)
+	}
+}
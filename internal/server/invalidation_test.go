@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/titoffon/lru-cache-service/internal/invalidation"
+)
+
+func deleteKey(t *testing.T, url string) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func waitStatus(t *testing.T, url string, want int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(url)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == want
+	}, 2*time.Second, 5*time.Millisecond, url)
+}
+
+func TestInvalidationBroadcast(t *testing.T) {
+	// Адреса нужны до создания серверов: каждый узел знает другой.
+	listeners := []*httptest.Server{httptest.NewUnstartedServer(nil), httptest.NewUnstartedServer(nil)}
+	urls := []string{"http://" + listeners[0].Listener.Addr().String(), "http://" + listeners[1].Listener.Addr().String()}
+	for i, ts := range listeners {
+		srv := NewServer("localhost:0", 100, time.Minute, WithInvalidation(invalidation.Options{Peers: []string{urls[1-i]}}))
+		ts.Config.Handler = srv.httpServer.Handler
+		ts.Start()
+		t.Cleanup(ts.Close)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		srv.startBackground(ctx)
+	}
+
+	for _, u := range urls {
+		for _, key := range []string{"a", "b"} {
+			require.Equal(t, http.StatusCreated, postJSON(t, u, requestBody{Key: key, Value: 1}).StatusCode)
+		}
+	}
+
+	// Удаление на первом узле доходит до второго.
+	require.Equal(t, http.StatusNoContent, deleteKey(t, urls[0]+"/api/lru/a"))
+	waitStatus(t, urls[1]+"/api/lru/a", http.StatusNotFound)
+
+	// Ключа, отсутствующего локально, удаление всё равно рассылается.
+	require.Equal(t, http.StatusCreated, postJSON(t, urls[1], requestBody{Key: "only-b", Value: 1}).StatusCode)
+	require.Equal(t, http.StatusNotFound, deleteKey(t, urls[0]+"/api/lru/only-b"))
+	waitStatus(t, urls[1]+"/api/lru/only-b", http.StatusNotFound)
+
+	// Полная очистка на втором узле очищает первый.
+	require.Equal(t, http.StatusNoContent, deleteKey(t, urls[1]+"/api/lru"))
+	waitStatus(t, urls[0]+"/api/lru/b", http.StatusNotFound)
+
+	resp, err := http.Get(urls[1] + "/api/admin/invalidation")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var st invalidation.Stats
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&st))
+	assert.Equal(t, uint64(2), st.Received)
+	assert.Zero(t, st.Duplicates)
+	require.Len(t, st.Peers, 1)
+	assert.Equal(t, urls[0], st.Peers[0].URL)
+}
+
+func TestInvalidationRejectsInvalidBatch(t *testing.T) {
+	_, url := startNode(t, WithInvalidation(invalidation.Options{}))
+
+	resp, err := http.Post(url+invalidation.Path, "application/json",
+		strings.NewReader(`{"messages":[{"id":"1","origin":"x","type":"rename"}]}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, problemContentType, resp.Header.Get("Content-Type"))
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/titoffon/lru-cache-service/internal/membership"
+)
+
+// WithMembership включает обнаружение узлов по gossip. Состав доступен на
+// GET /api/cluster/members; в кластерном режиме кольцо строится из Meta
+// живых и подозреваемых узлов.
+func WithMembership(m *membership.Memberlist) Option {
+	return func(s *Server) {
+		s.members = m
+	}
+}
+
+// membersResponse — ответ GET /api/cluster/members.
+type membersResponse struct {
+	Self    string              `json:"self"`
+	Members []membership.Member `json:"members"`
+}
+
+func (s *Server) handleMembers(w http.ResponseWriter, r *http.Request) {
+	writeEncoded(w, responseCodec(r), http.StatusOK, membersResponse{
+		Self:    s.members.Name(),
+		Members: s.members.Members(),
+	})
+}
+
+// syncClusterPeers перестраивает кольцо по составу кластера. Подозреваемые
+// узлы остаются в кольце, чтобы ложное подозрение не перераспределяло ключи.
+func (s *Server) syncClusterPeers(members []membership.Member) {
+	var peers []string
+	for _, m := range members {
+		if m.Name == s.members.Name() || m.Meta == "" {
+			continue
+		}
+		if m.State == membership.StateAlive || m.State == membership.StateSuspect {
+			peers = append(peers, m.Meta)
+		}
+	}
+	if err := s.cluster.SetPeers(peers); err != nil {
+		slog.Error("Failed to update cluster peers from gossip membership",
+			slog.String("error", err.Error()),
+		)
+	}
+}
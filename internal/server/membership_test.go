@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/titoffon/lru-cache-service/internal/cluster"
+	"github.com/titoffon/lru-cache-service/internal/membership"
+)
+
+func TestClusterMembersDiscoveredByGossip(t *testing.T) {
+	listeners := make([]*httptest.Server, 2)
+	urls := make([]string, 2)
+	for i := range listeners {
+		listeners[i] = httptest.NewUnstartedServer(nil)
+		urls[i] = "http://" + listeners[i].Listener.Addr().String()
+	}
+
+	var seeds []string
+	clusters := make([]*cluster.Cluster, 2)
+	for i, ts := range listeners {
+		m, err := membership.New(membership.Config{
+			BindAddr:         "127.0.0.1:0",
+			Meta:             urls[i],
+			Seeds:            seeds,
+			ProbeInterval:    50 * time.Millisecond,
+			GossipInterval:   20 * time.Millisecond,
+			PushPullInterval: 200 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		seeds = []string{m.Addr()}
+
+		// Кольцо изначально знает только сам узел.
+		clusters[i], err = cluster.New(cluster.Options{Self: urls[i]})
+		require.NoError(t, err)
+		srv := NewServer("localhost:0", 100, time.Minute, WithCluster(clusters[i]), WithMembership(m))
+		ts.Config.Handler = srv.httpServer.Handler
+		ts.Start()
+		t.Cleanup(ts.Close)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		srv.startBackground(ctx)
+	}
+
+	var got membersResponse
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(urls[0] + "/api/cluster/members")
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		got = membersResponse{}
+		return resp.StatusCode == http.StatusOK &&
+			json.NewDecoder(resp.Body).Decode(&got) == nil &&
+			len(got.Members) == 2
+	}, 5*time.Second, 20*time.Millisecond)
+
+	assert.NotEmpty(t, got.Self)
+	metas := []string{got.Members[0].Meta, got.Members[1].Meta}
+	assert.ElementsMatch(t, urls, metas)
+	for _, m := range got.Members {
+		assert.Equal(t, membership.StateAlive, m.State)
+	}
+
+	// Найденные узлы попадают в кольцо кластера.
+	for _, c := range clusters {
+		require.Eventually(t, func() bool {
+			return len(c.Ring().Nodes()) == 2
+		}, 5*time.Second, 20*time.Millisecond)
+	}
+}
+
+func TestClusterMembersDisabled(t *testing.T) {
+	_, url := startNode(t)
+	resp, err := http.Get(url + "/api/cluster/members")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
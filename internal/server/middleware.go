@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// maxRequestIDLen ограничивает длину принимаемого от клиента X-Request-ID.
+const maxRequestIDLen = 128
+
+type requestIDCtxKey struct{}
+
+type loggerCtxKey struct{}
+
+// requestIDFromContext возвращает идентификатор запроса или пустую строку.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// loggerFromContext возвращает логгер запроса с уже проставленными атрибутами
+// (request_id, principal). Вне HTTP-запроса возвращает глобальный логгер.
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerCtxKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// withLogger кладёт логгер в контекст.
+func withLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerCtxKey{}, l)
+}
+
+// newRequestID генерирует случайный идентификатор запроса.
+func newRequestID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID проверяет, что пришедший от клиента идентификатор безопасно
+// писать в логи и заголовки: непустой, ограниченной длины, только печатный ASCII.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestID берёт идентификатор запроса из заголовка X-Request-ID или генерирует
+// новый, возвращает его клиенту и создаёт логгер запроса с атрибутом request_id.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), requestIDCtxKey{}, id)
+		ctx = withLogger(ctx, slog.Default().With(slog.String("request_id", id)))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// responseRecorder запоминает статус и размер ответа для access-лога.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += int64(n)
+	return n, err
+}
+
+// Flush нужен потоковым ответам, которые проверяют http.Flusher напрямую.
+func (rr *responseRecorder) Flush() {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	if f, ok := rr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack нужен обработчикам, которые забирают соединение себе.
+func (rr *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	if rr.status == 0 {
+		rr.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// Unwrap позволяет http.ResponseController добраться до исходного ResponseWriter.
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// accessLog пишет по одной структурированной строке на каждый запрос.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		ctx, slot := withPrincipalSlot(r.Context())
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		loggerFromContext(r.Context()).Info("Request completed",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("bytes", rec.bytes),
+			slog.Duration("duration", time.Since(start)),
+			// Клиент берётся из slot: authenticate стоит дальше по цепочке.
+			slog.String("client", clientIdentityOf(slot.p, r.RemoteAddr)),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+	})
+}
+
+// recoverer перехватывает панику в обработчике, пишет стек в лог и отвечает 500.
+func recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// ErrAbortHandler — штатный способ прервать ответ, его не нужно глушить.
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			loggerFromContext(r.Context()).Error("Panic in HTTP handler",
+				slog.Any("panic", rec),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("stack", string(debug.Stack())),
+			)
+			writeProblem(w, r, http.StatusInternalServerError, codeInternal, "internal server error", "")
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
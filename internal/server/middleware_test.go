@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs подменяет глобальный логгер на JSON-логгер в буфер до конца теста.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+// findLogLine возвращает первую запись лога с заданным сообщением.
+func findLogLine(t *testing.T, logs *bytes.Buffer, msg string) map[string]interface{} {
+	t.Helper()
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		if entry["msg"] == msg {
+			return entry
+		}
+	}
+	t.Fatalf("log line %q not found in:\n%s", msg, logs.String())
+	return nil
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	handler := requestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(requestIDFromContext(r.Context())))
+	}))
+
+	tests := []struct {
+		name     string
+		inbound  string
+		expected string
+	}{
+		{name: "Propagated", inbound: "upstream-id-42", expected: "upstream-id-42"},
+		{name: "Generated when missing", inbound: ""},
+		{name: "Generated when invalid", inbound: "bad id\n"},
+		{name: "Generated when too long", inbound: strings.Repeat("a", maxRequestIDLen+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.inbound != "" {
+				req.Header.Set("X-Request-ID", tt.inbound)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			id := rec.Header().Get("X-Request-ID")
+			assert.Equal(t, id, rec.Body.String())
+			if tt.expected != "" {
+				assert.Equal(t, tt.expected, id)
+			} else {
+				assert.NotEqual(t, tt.inbound, id)
+				assert.True(t, validRequestID(id))
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	logs := captureLogs(t)
+
+	handler := requestID(accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/lru/k", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	entry := findLogLine(t, logs, "Request completed")
+	assert.Equal(t, "req-1", entry["request_id"])
+	assert.Equal(t, float64(http.StatusTeapot), entry["status"])
+	assert.Equal(t, float64(len("short and stout")), entry["bytes"])
+	assert.Equal(t, "/api/lru/k", entry["path"])
+	assert.Contains(t, entry, "duration")
+	assert.Contains(t, entry, "client")
+}
+
+func TestRecoverer(t *testing.T) {
+	logs := captureLogs(t)
+
+	handler := requestID(accessLog(recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/lru/k", nil)
+	rec := httptest.NewRecorder()
+
+	assert.NotPanics(t, func() { handler.ServeHTTP(rec, req) })
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+
+	entry := findLogLine(t, logs, "Panic in HTTP handler")
+	assert.Equal(t, "boom", entry["panic"])
+	assert.Contains(t, entry["stack"], "runtime/debug.Stack")
+	assert.Equal(t, rec.Header().Get("X-Request-ID"), entry["request_id"])
+
+	access := findLogLine(t, logs, "Request completed")
+	assert.Equal(t, float64(http.StatusInternalServerError), access["status"])
+}
+
+func TestAccessLogAuthenticatedClient(t *testing.T) {
+	a, err := LoadAuthFile(writeAuthFile(t, `{"keys": [{"id": "reader", "token": "read-token", "scopes": ["read"]}]}`))
+	require.NoError(t, err)
+	srv := NewServer("localhost:0", 10, time.Minute, WithAuthenticator(a))
+	logs := captureLogs(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/lru", nil)
+	req.Header.Set("Authorization", "Bearer read-token")
+	srv.httpServer.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	entry := findLogLine(t, logs, "Request completed")
+	assert.Equal(t, "principal:reader", entry["client"])
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/titoffon/lru-cache-service/internal/peerfill"
+)
+
+// WithPeerFill включает чтение через загрузчик: промах GET /api/lru/{key}
+// заполняется значением из opts.Loader, причём загружает ключ только его
+// владелец среди opts.Peers, а остальные узлы получают значение у владельца.
+func WithPeerFill(opts peerfill.Options) Option {
+	return func(s *Server) {
+		s.fillOpts = &opts
+	}
+}
+
+// handlePeerFill обрабатывает GET /api/peer/fill/{key}: узел-владелец
+// загружает ключ, если его ещё нет, и возвращает значение запросившему узлу.
+func (s *Server) handlePeerFill(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	logger := loggerFromContext(r.Context())
+
+	key := chi.URLParam(r, "key")
+	if key == "" {
+		writeProblem(w, r, http.StatusBadRequest, codeMissingKey, "key must not be empty", "")
+		return
+	}
+	if !s.authorizeKey(w, r, key) {
+		return
+	}
+
+	value, expiresAt, err := s.fill.Load(r.Context(), key)
+	if err != nil {
+		logger.Warn("Failed to fill key for peer",
+			slog.String("key", key),
+			slog.String("error", err.Error()),
+		)
+		writeCacheError(w, r, err, key)
+		return
+	}
+
+	data, err := peerfill.MarshalResponse(value, expiresAt)
+	if err != nil {
+		logger.Error("Failed to encode peer fill response",
+			slog.String("key", key),
+			slog.String("error", err.Error()),
+		)
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, "value cannot be encoded", key)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	_, _ = w.Write(data)
+
+	logger.Debug("Key filled for peer",
+		slog.String("key", key),
+		slog.Duration("duration", time.Since(start)),
+	)
+}
+
+// handlePeerFillStatus обрабатывает GET /api/admin/peer-fill.
+func (s *Server) handlePeerFillStatus(w http.ResponseWriter, r *http.Request) {
+	if err := writeEncoded(w, responseCodec(r), http.StatusOK, s.fill.Stats()); err != nil {
+		loggerFromContext(r.Context()).Error("Failed to encode response",
+			slog.String("error", err.Error()),
+		)
+	}
+}
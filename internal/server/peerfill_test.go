@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/titoffon/lru-cache-service/internal/peerfill"
+)
+
+func TestPeerFillLoadsOnceAcrossNodes(t *testing.T) {
+	var loads atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			loads.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+		}
+	}))
+	t.Cleanup(backend.Close)
+
+	listeners := []*httptest.Server{httptest.NewUnstartedServer(nil), httptest.NewUnstartedServer(nil)}
+	urls := []string{"http://" + listeners[0].Listener.Addr().String(), "http://" + listeners[1].Listener.Addr().String()}
+	for i, ts := range listeners {
+		srv := NewServer("localhost:0", 100, time.Minute, WithPeerFill(peerfill.Options{
+			Self:   urls[i],
+			Peers:  urls,
+			Loader: peerfill.HTTPLoader(backend.URL, time.Second),
+		}))
+		ts.Config.Handler = srv.httpServer.Handler
+		ts.Start()
+		t.Cleanup(ts.Close)
+	}
+
+	get := func(url string) (int, string) {
+		resp, err := http.Get(url)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		for _, u := range urls {
+			status, body := get(u + "/api/lru/" + key)
+			require.Equal(t, http.StatusOK, status)
+			var got responseBody
+			require.NoError(t, json.Unmarshal([]byte(body), &got))
+			assert.Equal(t, map[string]interface{}{"path": "/" + key}, got.Value)
+		}
+	}
+	assert.Equal(t, int32(4), loads.Load(), "each key is loaded from the backend once")
+
+	status, _ := get(urls[0] + "/api/lru/missing")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, body := get(urls[1] + "/api/lru/broken")
+	assert.Equal(t, http.StatusBadGateway, status)
+	assert.Contains(t, body, codeLoadFailed)
+
+	status, body = get(urls[0] + "/api/admin/peer-fill")
+	require.Equal(t, http.StatusOK, status)
+	var st peerfill.Stats
+	require.NoError(t, json.Unmarshal([]byte(body), &st))
+	assert.Zero(t, st.PeerErrors)
+}
+
+func TestPeerFillRefreshesStaleEntries(t *testing.T) {
+	var loads atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loads.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`"fresh"`))
+	}))
+	t.Cleanup(backend.Close)
+
+	srv := NewServer("localhost:0", 10, time.Minute, WithPeerFill(peerfill.Options{
+		Loader: peerfill.HTTPLoader(backend.URL, time.Second),
+	}))
+	ts := httptest.NewServer(srv.httpServer.Handler)
+	t.Cleanup(ts.Close)
+
+	soft, ttl := int64(1), int64(60)
+	resp := postJSON(t, ts.URL, requestBody{Key: "k", Value: "old", TTLSeconds: &ttl, SoftTTLSeconds: &soft})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	get := func() responseBody {
+		resp, err := http.Get(ts.URL + "/api/lru/k")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var got responseBody
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+		return got
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	// Первое чтение устаревшей записи отдаёт старое значение и запускает обновление.
+	got := get()
+	assert.Equal(t, "old", got.Value)
+	assert.True(t, got.Stale)
+
+	assert.Eventually(t, func() bool {
+		got := get()
+		return got.Value == "fresh" && !got.Stale
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.Equal(t, int32(1), loads.Load())
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/titoffon/lru-cache-service/internal/peerfill"
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// Машиночитаемые коды ошибок API. Значения стабильны и являются частью контракта.
+const (
+	codeInvalidJSON          = "invalid_json"
+	codeMissingKey           = "missing_key"
+	codeInvalidTTL           = "invalid_ttl"
+	codeInvalidBody          = "invalid_body"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeValueTooLarge        = "value_too_large"
+	codeKeyNotFound          = "key_not_found"
+	codeUnauthorized         = "unauthorized"
+	codeForbidden            = "forbidden"
+	codeRateLimited          = "rate_limited"
+	codeInvalidCommand       = "invalid_command"
+	codeSubscriberTooSlow    = "subscriber_too_slow"
+	codeOwnerUnavailable     = "owner_unavailable"
+	codeReadOnlyReplica      = "read_only_replica"
+	codeInvalidOffset        = "invalid_offset"
+	codeLoadFailed           = "load_failed"
+	codeMethodNotAllowed     = "method_not_allowed"
+	codeUpstreamUnavailable  = "upstream_unavailable"
+	codeUpstreamTimeout      = "upstream_timeout"
+	codeInternal             = "internal_error"
+)
+
+const problemContentType = "application/problem+json"
+
+// problem — тело ответа об ошибке в формате RFC 7807.
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	Key       string `json:"key,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeProblem пишет ответ об ошибке в формате application/problem+json.
+// key указывается, если ошибка относится к конкретному ключу кэша.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail, key string) {
+	p := problem{
+		Type:      "urn:lru-cache:problem:" + code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		Key:       key,
+		RequestID: requestIDFromContext(r.Context()),
+	}
+
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="lru-cache"`)
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// writeProxyError пишет ошибку кэширующего прокси в формате problem+json.
+func writeProxyError(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	code := codeUpstreamUnavailable
+	switch status {
+	case http.StatusMethodNotAllowed:
+		code = codeMethodNotAllowed
+	case http.StatusGatewayTimeout:
+		code = codeUpstreamTimeout
+	}
+	writeProblem(w, r, status, code, detail, "")
+}
+
+// writeCacheError переводит ошибку кэша в HTTP-статус и код ошибки API.
+func writeCacheError(w http.ResponseWriter, r *http.Request, err error, key string) {
+	status, code, detail := cacheErrorStatus(err)
+	writeProblem(w, r, status, code, detail, key)
+}
+
+// cacheErrorStatus сопоставляет ошибке кэша HTTP-статус, код ошибки API и описание.
+func cacheErrorStatus(err error) (status int, code, detail string) {
+	switch {
+	case errors.Is(err, cache.ErrKeyNotFound):
+		return http.StatusNotFound, codeKeyNotFound, "key not found"
+	case errors.Is(err, cache.ErrEmptyKey):
+		return http.StatusBadRequest, codeMissingKey, "key must not be empty"
+	case errors.Is(err, peerfill.ErrLoadFailed):
+		return http.StatusBadGateway, codeLoadFailed, "failed to load value from the backend"
+	case errors.Is(err, cache.ErrInvalidTTL):
+		return http.StatusBadRequest, codeInvalidTTL, "ttl must be >= 0 and soft_ttl_seconds must be > 0 and not exceed it"
+	case errors.Is(err, errSoftTTLUnsupported):
+		return http.StatusBadRequest, codeInvalidTTL, "soft_ttl_seconds is not supported by the cache engine"
+	case errors.Is(err, errSoftTTLWithoutLoader):
+		return http.StatusBadRequest, codeInvalidTTL, "soft_ttl_seconds requires a loader to refresh stale entries"
+	case errors.Is(err, cache.ErrInvalidCapacity):
+		return http.StatusBadRequest, codeInvalidBody, "capacity must be >= 1"
+	case errors.Is(err, cache.ErrValueTooLarge):
+		return http.StatusRequestEntityTooLarge, codeValueTooLarge, "value does not fit into the cache storage"
+	case errors.Is(err, cache.ErrUnsupportedValue):
+		return http.StatusBadRequest, codeInvalidBody, "value type is not supported by the cache storage"
+	default:
+		return http.StatusInternalServerError, codeInternal, "internal cache error"
+	}
+}
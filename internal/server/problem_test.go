@@ -0,0 +1,54 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProblemResponses(t *testing.T) {
+	srv := NewServer("localhost:0", 10, time.Minute)
+	handler := srv.httpServer.Handler
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		statusCode int
+		code       string
+		key        string
+	}{
+		{name: "Invalid JSON", method: http.MethodPost, url: "/api/lru", body: `{`, statusCode: http.StatusBadRequest, code: codeInvalidJSON},
+		{name: "Missing key", method: http.MethodPost, url: "/api/lru", body: `{"value": 1}`, statusCode: http.StatusBadRequest, code: codeMissingKey},
+		{name: "Invalid TTL", method: http.MethodPost, url: "/api/lru", body: `{"key": "k", "ttl_seconds": -1}`, statusCode: http.StatusBadRequest, code: codeInvalidTTL, key: "k"},
+		{name: "GET missing key", method: http.MethodGet, url: "/api/lru/nope", statusCode: http.StatusNotFound, code: codeKeyNotFound, key: "nope"},
+		{name: "DELETE missing key", method: http.MethodDelete, url: "/api/lru/nope", statusCode: http.StatusNotFound, code: codeKeyNotFound, key: "nope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, bytes.NewBufferString(tt.body))
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+			assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+
+			var p problem
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+			assert.Equal(t, tt.statusCode, p.Status)
+			assert.Equal(t, tt.code, p.Code)
+			assert.Equal(t, tt.key, p.Key)
+			assert.NotEmpty(t, p.RequestID)
+			assert.Equal(t, rec.Header().Get("X-Request-ID"), p.RequestID)
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"container/list"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit задаёт параметры token bucket: Rate токенов в секунду и ёмкость Burst.
+// Rate <= 0 отключает ограничение.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitOptions описывает ограничения частоты запросов на одного клиента.
+type RateLimitOptions struct {
+	// Read применяется к GET-запросам, Write — ко всем остальным.
+	Read  RateLimit
+	Write RateLimit
+	// MaxClients ограничивает число одновременно отслеживаемых клиентов;
+	// при переполнении вытесняются давно не появлявшиеся.
+	MaxClients int
+	// IdleTTL — через сколько простоя состояние клиента забывается.
+	IdleTTL time.Duration
+}
+
+// WithRateLimit включает ограничение частоты запросов к /api.
+func WithRateLimit(opts RateLimitOptions) Option {
+	return func(s *Server) {
+		s.limiter.Store(newRateLimiter(opts))
+	}
+}
+
+// setRateLimit заменяет лимиты частоты запросов. Состояние клиентов
+// сбрасывается, только если лимиты действительно изменились.
+func (s *Server) setRateLimit(opts RateLimitOptions) {
+	if !opts.enabled() {
+		s.limiter.Store(nil)
+		return
+	}
+	if cur := s.limiter.Load(); cur != nil && cur.opts == opts.withDefaults() {
+		return
+	}
+	s.limiter.Store(newRateLimiter(opts))
+}
+
+// tokenBucket — классический token bucket с ленивым пополнением.
+type tokenBucket struct {
+	mu     sync.Mutex
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: now}
+}
+
+// take забирает токен. Если токенов нет, возвращает false и время,
+// через которое появится следующий.
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := (1 - b.tokens) / b.limit.Rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// rateLimiter хранит bucket'ы клиентов в собственном LRU-списке, поэтому
+// память под состояние ограничена MaxClients независимо от числа клиентов.
+// Общий кэш для этого не используется: он пишет span'ы с ключами, а ключ
+// здесь — идентификатор клиента.
+type rateLimiter struct {
+	opts RateLimitOptions
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	// order — клиенты от недавних к давним; значения — *clientBucket.
+	order *list.List
+}
+
+// clientBucket — запись rateLimiter.order.
+type clientBucket struct {
+	key    string
+	bucket *tokenBucket
+	seen   time.Time
+}
+
+// withDefaults подставляет значения по умолчанию для незаданных параметров.
+func (o RateLimitOptions) withDefaults() RateLimitOptions {
+	if o.MaxClients <= 0 {
+		o.MaxClients = 10000
+	}
+	if o.IdleTTL <= 0 {
+		o.IdleTTL = 10 * time.Minute
+	}
+	return o
+}
+
+// enabled сообщает, задан ли хотя бы один лимит.
+func (o RateLimitOptions) enabled() bool {
+	return o.Read.Rate > 0 || o.Write.Rate > 0
+}
+
+func newRateLimiter(opts RateLimitOptions) *rateLimiter {
+	opts = opts.withDefaults()
+	return &rateLimiter{
+		opts:    opts,
+		buckets: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// allow проверяет, может ли клиент client выполнить ещё один запрос;
+// write выбирает лимит на запись вместо лимита на чтение.
+func (l *rateLimiter) allow(client string, write bool, now time.Time) (bool, time.Duration) {
+	limit, kind := l.opts.Read, "read:"
+	if write {
+		limit, kind = l.opts.Write, "write:"
+	}
+	if limit.Rate <= 0 {
+		return true, 0
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+
+	key := kind + client
+
+	l.mu.Lock()
+	b := l.bucket(key, limit, now)
+	l.mu.Unlock()
+
+	return b.take(now)
+}
+
+// bucket возвращает bucket клиента key, создавая его, если клиента нет или он
+// простаивал дольше IdleTTL. Обращение продлевает IdleTTL клиента.
+// Вызывается под l.mu.
+func (l *rateLimiter) bucket(key string, limit RateLimit, now time.Time) *tokenBucket {
+	if el, ok := l.buckets[key]; ok {
+		cb := el.Value.(*clientBucket)
+		if now.Sub(cb.seen) > l.opts.IdleTTL {
+			cb.bucket = newTokenBucket(limit, now)
+		}
+		cb.seen = now
+		l.order.MoveToFront(el)
+		return cb.bucket
+	}
+
+	cb := &clientBucket{key: key, bucket: newTokenBucket(limit, now), seen: now}
+	l.buckets[key] = l.order.PushFront(cb)
+	if l.order.Len() > l.opts.MaxClients {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.buckets, oldest.Value.(*clientBucket).key)
+	}
+	return cb.bucket
+}
+
+// clientIdentity определяет, по какому ключу считать лимит: по аутентифицированному
+// клиенту (API-ключ или mTLS), а для анонимных запросов — по IP-адресу.
+func clientIdentity(r *http.Request) string {
+	return clientIdentityOf(principalFromContext(r.Context()), r.RemoteAddr)
+}
+
+// clientIdentityOf — clientIdentity для клиента p (nil — анонимный) с адресом remoteAddr.
+func clientIdentityOf(p *Principal, remoteAddr string) string {
+	if p != nil {
+		return "principal:" + p.ID
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimit отклоняет запросы сверх лимита клиента с кодом 429.
+// Должен стоять после authenticate, чтобы видеть Principal.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter := s.limiter.Load()
+		if limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := clientIdentity(r)
+		write := r.Method != http.MethodGet && r.Method != http.MethodHead
+
+		ok, retryAfter := limiter.allow(client, write, time.Now())
+		if !ok {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			loggerFromContext(r.Context()).Warn("Rate limit exceeded",
+				slog.String("client", client),
+				slog.Bool("write", write),
+				slog.String("method", r.Method),
+				slog.String("url", r.URL.Path),
+			)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeProblem(w, r, http.StatusTooManyRequests, codeRateLimited, "too many requests, retry after "+strconv.Itoa(seconds)+"s", "")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(RateLimit{Rate: 2, Burst: 2}, now)
+
+	ok, _ := b.take(now)
+	assert.True(t, ok)
+	ok, _ = b.take(now)
+	assert.True(t, ok)
+
+	ok, retryAfter := b.take(now)
+	assert.False(t, ok, "burst should be exhausted")
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	ok, _ = b.take(now.Add(500 * time.Millisecond))
+	assert.True(t, ok, "one token should be refilled after 1/rate seconds")
+}
+
+func TestRateLimiterBoundedState(t *testing.T) {
+	l := newRateLimiter(RateLimitOptions{
+		Read:       RateLimit{Rate: 1, Burst: 1},
+		MaxClients: 2,
+		IdleTTL:    time.Minute,
+	})
+	now := time.Now()
+
+	ok, _ := l.allow("a", false, now)
+	assert.True(t, ok)
+	ok, _ = l.allow("a", false, now)
+	assert.False(t, ok)
+
+	// Клиенты b и c вытесняют состояние клиента a.
+	l.allow("b", false, now)
+	l.allow("c", false, now)
+
+	assert.Len(t, l.buckets, 2)
+	assert.Equal(t, 2, l.order.Len())
+
+	ok, _ = l.allow("a", false, now)
+	assert.True(t, ok, "evicted client starts with a full bucket")
+	ok, _ = l.allow("a", false, now)
+	assert.False(t, ok)
+
+	// После IdleTTL простоя состояние клиента забывается.
+	ok, _ = l.allow("a", false, now.Add(2*time.Minute))
+	assert.True(t, ok)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	srv := NewServer("localhost:0", 10, time.Minute, WithRateLimit(RateLimitOptions{
+		Read:  RateLimit{Rate: 0.001, Burst: 2},
+		Write: RateLimit{Rate: 0.001, Burst: 1},
+	}))
+	handler := srv.httpServer.Handler
+
+	do := func(method, remoteAddr, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/lru", bytes.NewBufferString(body))
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusCreated, do(http.MethodPost, "10.0.0.1:1000", `{"key": "k", "value": 1}`).Code)
+	rec := do(http.MethodPost, "10.0.0.1:1001", `{"key": "k", "value": 2}`)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	// Лимит на чтение считается отдельно от лимита на запись.
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "10.0.0.1:1002", "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "10.0.0.1:1003", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodGet, "10.0.0.1:1004", "").Code)
+
+	// Другой клиент не затронут.
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "10.0.0.2:1000", "").Code)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+	"github.com/titoffon/lru-cache-service/pkg/logger"
+)
+
+// RuntimeSettings — параметры, которые применяются без перезапуска.
+type RuntimeSettings struct {
+	LogLevel   string
+	CacheSize  int
+	DefaultTTL time.Duration
+	// RateLimit без единого положительного Rate отключает ограничение.
+	RateLimit RateLimitOptions
+}
+
+// WithReload включает перечитывание параметров по SIGHUP. current —
+// параметры, с которыми запущен сервер; load возвращает новые значения.
+// Применяются только параметры, отличающиеся от предыдущего перечитывания,
+// поэтому ёмкость и TTL, заданные через PUT /api/admin/config, сохраняются,
+// пока их не изменят в конфигурации. Если load вернул ошибку или значения не
+// прошли проверку, действующие параметры не меняются. load вызывается
+// последовательно из одной горутины.
+func WithReload(current RuntimeSettings, load func() (RuntimeSettings, error)) Option {
+	return func(s *Server) {
+		s.reload = load
+		s.reloaded = current
+	}
+}
+
+// watchReload применяет новые параметры на каждый сигнал из sig, пока не
+// отменён ctx.
+func (s *Server) watchReload(ctx context.Context, sig <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			if err := s.reloadSettings(ctx); err != nil {
+				slog.Error("Failed to reload configuration, keeping current settings",
+					slog.String("error", err.Error()),
+				)
+			}
+		}
+	}
+}
+
+// reloadSettings запрашивает параметры у функции из WithReload и применяет
+// изменившиеся. Значения проверяются до применения, чтобы ошибка не оставила
+// изменения применёнными частично.
+func (s *Server) reloadSettings(ctx context.Context) error {
+	next, err := s.reload()
+	if err != nil {
+		return err
+	}
+	prev := s.reloaded
+	ttlChanged := next.DefaultTTL != prev.DefaultTTL
+	sizeChanged := next.CacheSize != prev.CacheSize
+
+	rc, reconfigurable := s.cache.(cache.Reconfigurable)
+	switch {
+	case (ttlChanged || sizeChanged) && !reconfigurable:
+		return errors.New("cache does not support changing capacity or default TTL")
+	case sizeChanged && next.CacheSize < 1:
+		return fmt.Errorf("cache_size must be >= 1, got %d", next.CacheSize)
+	case ttlChanged && next.DefaultTTL <= 0:
+		return fmt.Errorf("default_cache_ttl must be > 0, got %s", next.DefaultTTL)
+	}
+
+	var attrs []any
+	if ttlChanged {
+		if err := rc.SetDefaultTTL(next.DefaultTTL); err != nil {
+			return err
+		}
+		attrs = append(attrs, slog.Duration("default_cache_ttl", next.DefaultTTL))
+	}
+	if sizeChanged {
+		evicted, err := rc.Resize(ctx, next.CacheSize)
+		if err != nil {
+			return err
+		}
+		attrs = append(attrs, slog.Int("cache_size", next.CacheSize), slog.Int("evicted", evicted))
+	}
+	if next.LogLevel != prev.LogLevel {
+		logger.SetLevel(next.LogLevel)
+		attrs = append(attrs, slog.String("log_level", next.LogLevel))
+	}
+	if next.RateLimit != prev.RateLimit {
+		s.setRateLimit(next.RateLimit)
+		attrs = append(attrs,
+			slog.Float64("rate_limit_read_rps", next.RateLimit.Read.Rate),
+			slog.Float64("rate_limit_write_rps", next.RateLimit.Write.Rate),
+		)
+	}
+	s.reloaded = next
+
+	slog.Info("Configuration reloaded", attrs...)
+	return nil
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// reloadHarness подменяет перечитываемую конфигурацию и отправляет SIGHUP.
+type reloadHarness struct {
+	mu   sync.Mutex
+	next RuntimeSettings
+	fail error
+	sig  chan os.Signal
+}
+
+func (h *reloadHarness) load() (RuntimeSettings, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.next, h.fail
+}
+
+// reload задаёт результат перечитывания и дожидается его обработки.
+func (h *reloadHarness) reload(st RuntimeSettings, err error) {
+	h.mu.Lock()
+	h.next, h.fail = st, err
+	h.mu.Unlock()
+	// Небуферизованный канал: второй сигнал уходит, только когда первый обработан.
+	h.sig <- syscall.SIGHUP
+	h.sig <- syscall.SIGHUP
+}
+
+func startReload(t *testing.T, initial RuntimeSettings) (*Server, *reloadHarness) {
+	t.Helper()
+	h := &reloadHarness{next: initial, sig: make(chan os.Signal)}
+	srv := NewServer("localhost:0", initial.CacheSize, initial.DefaultTTL, WithReload(initial, h.load))
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go srv.watchReload(ctx, h.sig)
+	return srv, h
+}
+
+func TestReloadSettings(t *testing.T) {
+	initial := RuntimeSettings{LogLevel: "WARN", CacheSize: 4, DefaultTTL: time.Minute}
+	srv, h := startReload(t, initial)
+	ctx := context.Background()
+	for _, k := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, srv.cache.Put(ctx, k, k, 0))
+	}
+
+	rl := RateLimitOptions{Read: RateLimit{Rate: 10, Burst: 5}}
+	h.reload(RuntimeSettings{LogLevel: "WARN", CacheSize: 2, DefaultTTL: time.Hour, RateLimit: rl}, nil)
+	settings := srv.cache.(cache.Reconfigurable).Settings()
+	assert.Equal(t, cache.Settings{Capacity: 2, DefaultTTL: time.Hour, Len: 2}, settings)
+	limiter := srv.limiter.Load()
+	require.NotNil(t, limiter)
+	assert.Equal(t, rl.withDefaults(), limiter.opts)
+
+	// Те же лимиты не сбрасывают состояние клиентов.
+	h.reload(RuntimeSettings{LogLevel: "WARN", CacheSize: 2, DefaultTTL: time.Hour, RateLimit: rl}, nil)
+	assert.Same(t, limiter, srv.limiter.Load())
+
+	// Ошибка чтения конфигурации оставляет действующие параметры.
+	h.reload(RuntimeSettings{}, errors.New("broken file"))
+	assert.Equal(t, settings, srv.cache.(cache.Reconfigurable).Settings())
+	assert.Same(t, limiter, srv.limiter.Load())
+
+	h.reload(RuntimeSettings{LogLevel: "WARN", CacheSize: 3, DefaultTTL: time.Hour}, nil)
+	assert.Nil(t, srv.limiter.Load())
+	assert.Equal(t, 3, srv.cache.(cache.Reconfigurable).Settings().Capacity)
+}
+
+func TestReloadKeepsLiveSettings(t *testing.T) {
+	initial := RuntimeSettings{LogLevel: "WARN", CacheSize: 10, DefaultTTL: time.Minute}
+	srv, h := startReload(t, initial)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/admin/config", strings.NewReader(`{"capacity": 50, "default_ttl_seconds": 300}`))
+	rec := httptest.NewRecorder()
+	srv.httpServer.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// Файл не менялся: заданные на лету ёмкость и TTL сохраняются.
+	h.reload(initial, nil)
+	st := srv.cache.(cache.Reconfigurable).Settings()
+	assert.Equal(t, 50, st.Capacity)
+	assert.Equal(t, 5*time.Minute, st.DefaultTTL)
+
+	// Изменился только TTL: ёмкость по-прежнему не трогается.
+	changed := initial
+	changed.DefaultTTL = 2 * time.Minute
+	h.reload(changed, nil)
+	st = srv.cache.(cache.Reconfigurable).Settings()
+	assert.Equal(t, 50, st.Capacity)
+	assert.Equal(t, 2*time.Minute, st.DefaultTTL)
+}
+
+func TestReloadRejectsInvalidSettingsAtomically(t *testing.T) {
+	initial := RuntimeSettings{LogLevel: "WARN", CacheSize: 10, DefaultTTL: time.Minute}
+	srv, _ := startReload(t, initial)
+
+	srv.reload = func() (RuntimeSettings, error) {
+		return RuntimeSettings{
+			LogLevel:   "DEBUG",
+			CacheSize:  0,
+			DefaultTTL: time.Hour,
+			RateLimit:  RateLimitOptions{Read: RateLimit{Rate: 1}},
+		}, nil
+	}
+	require.Error(t, srv.reloadSettings(context.Background()))
+
+	assert.Equal(t, initial, srv.reloaded)
+	assert.Equal(t, time.Minute, srv.cache.(cache.Reconfigurable).Settings().DefaultTTL)
+	assert.Nil(t, srv.limiter.Load())
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/titoffon/lru-cache-service/internal/replication"
+)
+
+// Роли узла в репликации.
+const (
+	roleLeader   = "leader"
+	roleFollower = "follower"
+)
+
+// ReplicationOptions описывает участие узла в репликации.
+type ReplicationOptions struct {
+	// LogSize — сколько последних операций хранит журнал для ведомых.
+	LogSize int
+	// Follower задаётся, если узел запускается ведомым.
+	Follower *replication.FollowerOptions
+}
+
+// replicationStatus — ответ GET /api/admin/replication.
+type replicationStatus struct {
+	Role string `json:"role"`
+	// Epoch и Offset — позиция собственного журнала узла.
+	Epoch     string                      `json:"epoch"`
+	Offset    uint64                      `json:"offset"`
+	Followers int                         `json:"followers"`
+	Follower  *replication.FollowerStatus `json:"follower,omitempty"`
+}
+
+// WithReplication включает журнал репликации, из которого другие узлы могут
+// получать изменения. Если задан opts.Follower, узел стартует ведомым: он
+// отдаёт данные на чтение, отклоняет запись и применяет поток ведущего,
+// пока его не повысят через POST /api/admin/replication/promote.
+func WithReplication(opts ReplicationOptions) Option {
+	return func(s *Server) {
+		s.replOpts = &opts
+	}
+}
+
+// isReplica сообщает, что узел сейчас работает ведомым.
+func (s *Server) isReplica() bool {
+	return s.follower != nil && s.follower.Active()
+}
+
+// rejectOnReplica отклоняет запросы на запись, пока узел ведомый: иначе
+// данные реплики разошлись бы с ведущим.
+func (s *Server) rejectOnReplica(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.isReplica() {
+			loggerFromContext(r.Context()).Warn("Write request rejected on read-only replica",
+				slog.String("method", r.Method),
+				slog.String("url", r.URL.Path),
+			)
+			writeReadOnlyReplica(w, r, s.follower.Leader())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeReadOnlyReplica отвечает 409 и сообщает адрес ведущего в заголовке X-Replication-Leader.
+func writeReadOnlyReplica(w http.ResponseWriter, r *http.Request, leader string) {
+	w.Header().Set("X-Replication-Leader", leader)
+	writeProblem(w, r, http.StatusConflict, codeReadOnlyReplica, "this node is a read-only replica of "+leader, "")
+}
+
+// handleReplicationStream обрабатывает GET /api/replication/stream?epoch=&offset= —
+// поток операций журнала в формате NDJSON для ведомых узлов.
+func (s *Server) handleReplicationStream(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	logger := loggerFromContext(r.Context())
+
+	epoch := r.URL.Query().Get("epoch")
+	var offset uint64
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		var err error
+		if offset, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidOffset, "offset must be a non-negative integer", "")
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		// Сервер останавливается: Shutdown не дождался бы бесконечного потока.
+		select {
+		case <-s.streamsDone:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	logger.Info("Replication follower connected",
+		slog.String("epoch", epoch),
+		slog.Uint64("offset", offset),
+	)
+	err := s.leader.Stream(ctx, w, rc.Flush, epoch, offset)
+	switch {
+	case errors.Is(err, replication.ErrFollowerBehind):
+		logger.Warn("Replication follower fell behind the log, it will resync",
+			slog.Duration("duration", time.Since(start)),
+		)
+	case err != nil && ctx.Err() == nil:
+		logger.Error("Replication stream failed",
+			slog.String("error", err.Error()),
+			slog.Duration("duration", time.Since(start)),
+		)
+	default:
+		logger.Info("Replication follower disconnected",
+			slog.Duration("duration", time.Since(start)),
+		)
+	}
+}
+
+// handleReplicationStatus обрабатывает GET /api/admin/replication.
+func (s *Server) handleReplicationStatus(w http.ResponseWriter, r *http.Request) {
+	if err := writeEncoded(w, responseCodec(r), http.StatusOK, s.replicationStatus()); err != nil {
+		loggerFromContext(r.Context()).Error("Failed to encode response",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// handlePromote обрабатывает POST /api/admin/replication/promote: ведомый
+// отключается от ведущего и начинает принимать запись. Для ведущего запрос
+// ничего не меняет.
+func (s *Server) handlePromote(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFromContext(r.Context())
+
+	if s.isReplica() {
+		status := s.follower.Status()
+		s.follower.Stop()
+		logger.Warn("Replica promoted to leader",
+			slog.String("previous_leader", status.Leader),
+			slog.Uint64("offset", status.Offset),
+			slog.Uint64("lag", status.Lag),
+		)
+	}
+
+	if err := writeEncoded(w, responseCodec(r), http.StatusOK, s.replicationStatus()); err != nil {
+		logger.Error("Failed to encode response",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+func (s *Server) replicationStatus() replicationStatus {
+	epoch, offset := s.leader.Position()
+	st := replicationStatus{
+		Role:      roleLeader,
+		Epoch:     epoch,
+		Offset:    offset,
+		Followers: s.leader.Followers(),
+	}
+	if s.follower != nil {
+		fs := s.follower.Status()
+		st.Follower = &fs
+		if s.follower.Active() {
+			st.Role = roleFollower
+		}
+	}
+	return st
+}
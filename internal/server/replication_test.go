@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/titoffon/lru-cache-service/internal/replication"
+)
+
+// startNode запускает сервер с фоновыми задачами на локальном порту.
+func startNode(t *testing.T, opts ...Option) (*Server, string) {
+	t.Helper()
+	srv := NewServer("localhost:0", 100, time.Minute, opts...)
+	ts := httptest.NewServer(srv.httpServer.Handler)
+	t.Cleanup(ts.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	srv.startBackground(ctx)
+	srv.listening.Store(true)
+	return srv, ts.URL
+}
+
+func postJSON(t *testing.T, url string, body requestBody) *http.Response {
+	t.Helper()
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	resp, err := http.Post(url+"/api/lru", "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp
+}
+
+func TestReplicationFailover(t *testing.T) {
+	_, leaderURL := startNode(t, WithReplication(ReplicationOptions{}))
+	require.Equal(t, http.StatusCreated, postJSON(t, leaderURL, requestBody{Key: "before", Value: "snapshot"}).StatusCode)
+
+	follower, followerURL := startNode(t, WithReplication(ReplicationOptions{
+		Follower: &replication.FollowerOptions{Leader: leaderURL, RetryInterval: 10 * time.Millisecond},
+	}))
+
+	require.Equal(t, http.StatusCreated, postJSON(t, leaderURL, requestBody{Key: "after", Value: 42}).StatusCode)
+	for key, want := range map[string]interface{}{"before": "snapshot", "after": 42.0} {
+		require.Eventually(t, func() bool {
+			resp, err := http.Get(followerURL + "/api/lru/" + key)
+			if err != nil {
+				return false
+			}
+			defer resp.Body.Close()
+			var got responseBody
+			return resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&got) == nil && got.Value == want
+		}, 2*time.Second, 10*time.Millisecond, key)
+	}
+
+	// Ведомый готов к чтению и отклоняет запись.
+	resp, err := http.Get(followerURL + "/readyz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = postJSON(t, followerURL, requestBody{Key: "k", Value: 1})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, leaderURL, resp.Header.Get("X-Replication-Leader"))
+
+	var st replicationStatus
+	resp, err = http.Get(followerURL + "/api/admin/replication")
+	require.NoError(t, err)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&st))
+	resp.Body.Close()
+	assert.Equal(t, roleFollower, st.Role)
+	require.NotNil(t, st.Follower)
+	assert.True(t, st.Follower.Synced)
+
+	// После повышения бывший ведомый принимает запись и сам отдаёт журнал.
+	resp, err = http.Post(followerURL+"/api/admin/replication/promote", "", nil)
+	require.NoError(t, err)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&st))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, roleLeader, st.Role)
+	assert.False(t, follower.isReplica())
+
+	assert.Equal(t, http.StatusCreated, postJSON(t, followerURL, requestBody{Key: "k", Value: 1}).StatusCode)
+
+	_, chainedURL := startNode(t, WithReplication(ReplicationOptions{
+		Follower: &replication.FollowerOptions{Leader: followerURL, RetryInterval: 10 * time.Millisecond},
+	}))
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(chainedURL + "/api/lru/k")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestReplicaNotReadyUntilSynced(t *testing.T) {
+	down := httptest.NewServer(nil)
+	downURL := down.URL
+	down.Close()
+
+	srv, url := startNode(t, WithReplication(ReplicationOptions{
+		Follower: &replication.FollowerOptions{Leader: downURL, RetryInterval: time.Hour},
+	}))
+
+	resp, err := http.Get(url + "/readyz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "replica not synced", srv.notReadyReason())
+}
@@ -3,15 +3,25 @@ package server
 
 import (
 	"context"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/titoffon/lru-cache-service/internal/cluster"
+	"github.com/titoffon/lru-cache-service/internal/invalidation"
+	"github.com/titoffon/lru-cache-service/internal/membership"
+	"github.com/titoffon/lru-cache-service/internal/peerfill"
+	"github.com/titoffon/lru-cache-service/internal/proxy"
+	"github.com/titoffon/lru-cache-service/internal/replication"
+	"github.com/titoffon/lru-cache-service/internal/webhook"
 	"github.com/titoffon/lru-cache-service/pkg/cache"
 )
 
@@ -19,30 +29,239 @@ import (
 type Server struct {
 	httpServer *http.Server
 	cache      cache.ILRUCache
+	// auth — проверка API-ключей; nil означает, что API открыт.
+	auth *Authenticator
+	// tlsOpts — настройки TLS; nil означает обычный HTTP.
+	tlsOpts *TLSOptions
+	// limiter — ограничение частоты запросов; nil означает отсутствие лимитов.
+	// Атомарен, потому что заменяется при перечитывании конфигурации.
+	limiter atomic.Pointer[rateLimiter]
+	// cacheOpts — дополнительные параметры создаваемого LRUCache.
+	cacheOpts []cache.Option
+	// diskTier — дисковый второй уровень кэша; nil означает, что кэш только в памяти.
+	diskTier *cache.DiskStore
+	// slabOpts — параметры слабового хранилища; nil означает обычный LRUCache.
+	slabOpts *cache.SlabOptions
+	// proxyOpts — параметры кэширующего прокси; nil означает, что прокси выключен.
+	proxyOpts *proxy.Options
+	// events — шина изменений кэша для подписчиков /api/lru/_watch.
+	events *cache.EventBus
+	// cluster — кластерный режим; nil означает, что узел работает один.
+	cluster *cluster.Cluster
+	// members — состав кластера по gossip; nil означает, что обнаружение выключено.
+	members *membership.Memberlist
+	// replOpts — параметры репликации; nil означает, что репликация выключена.
+	replOpts *ReplicationOptions
+	// leader — журнал операций для ведомых; follower — подключение к ведущему,
+	// если узел запущен ведомым.
+	leader   *replication.Leader
+	follower *replication.Follower
+	// invalidationOpts — параметры рассылки удалений; nil означает, что она выключена.
+	invalidationOpts *invalidation.Options
+	invalidation     *invalidation.Bus
+	// fillOpts — параметры чтения через загрузчик; nil означает, что промахи не заполняются.
+	fillOpts *peerfill.Options
+	fill     *peerfill.Group
+	// webhooks — доставка событий кэша во внешние системы; nil означает, что вебхуки выключены.
+	webhooks *webhook.Dispatcher
+	// sweepInterval — период удаления истёкших записей; 0 означает, что
+	// записи удаляются только при обращении к ним.
+	sweepInterval time.Duration
+	// reload возвращает параметры, применяемые по SIGHUP; nil означает, что
+	// сигнал не обрабатывается.
+	reload func() (RuntimeSettings, error)
+	// reloaded — параметры последнего успешного перечитывания; с ними
+	// сравниваются новые, чтобы применить только изменившиеся.
+	reloaded RuntimeSettings
+	// streamsDone закрывается при остановке сервера, чтобы завершить
+	// долгоживущие потоки, которых Shutdown не дождётся.
+	streamsDone chan struct{}
+
+	// drainDelay — пауза между получением сигнала остановки и вызовом
+	// httpServer.Shutdown, за которую балансировщик успевает увидеть 503 на /readyz.
+	drainDelay time.Duration
+
+	// startupLoads — загрузки кэша при запуске; restoring установлен, пока
+	// они не завершились.
+	startupLoads []StartupLoad
+	restoring    atomic.Bool
+
+	listening    atomic.Bool
+	shuttingDown atomic.Bool
+}
+
+// Option настраивает необязательные параметры Server.
+type Option func(*Server)
+
+// WithDrainDelay задаёт паузу перед остановкой HTTP-сервера после получения сигнала.
+func WithDrainDelay(d time.Duration) Option {
+	return func(s *Server) {
+		s.drainDelay = d
+	}
+}
+
+// WithCacheOptions передаёт дополнительные параметры в создаваемый LRUCache.
+func WithCacheOptions(opts ...cache.Option) Option {
+	return func(s *Server) {
+		s.cacheOpts = append(s.cacheOpts, opts...)
+	}
+}
+
+// WithDiskTier добавляет к кэшу дисковый второй уровень: записи, вытесненные
+// из памяти из-за нехватки места, переносятся в store и возвращаются оттуда
+// при следующем чтении.
+func WithDiskTier(store *cache.DiskStore) Option {
+	return func(s *Server) {
+		s.diskTier = store
+	}
+}
+
+// WithSlabStorage хранит записи в SlabCache вместо LRUCache: ключи и значения
+// лежат в предвыделенных байтовых страницах, что снижает нагрузку на сборщик
+// мусора при большом числе записей. Параметры WithCacheOptions и WithDiskTier
+// при этом не применяются.
+func WithSlabStorage(opts cache.SlabOptions) Option {
+	return func(s *Server) {
+		s.slabOpts = &opts
+	}
+}
+
+// WithProxy включает режим кэширующего обратного прокси: GET-запросы, не
+// совпавшие ни с одним маршрутом API, пересылаются в upstream. Ответы
+// хранятся в собственном LRUCache той же ёмкости, что и основной кэш.
+func WithProxy(opts proxy.Options) Option {
+	return func(s *Server) {
+		s.proxyOpts = &opts
+	}
+}
+
+// WithWebhooks включает доставку событий кэша через d. Диспетчер работает,
+// пока запущен сервер.
+func WithWebhooks(d *webhook.Dispatcher) Option {
+	return func(s *Server) {
+		s.webhooks = d
+	}
+}
+
+// WithExpirySweep включает периодическое удаление истёкших записей. Без него
+// истечение обнаруживается только при обращении к ключу, и события expire
+// для невостребованных ключей не публикуются.
+func WithExpirySweep(interval time.Duration) Option {
+	return func(s *Server) {
+		s.sweepInterval = interval
+	}
 }
 
 // NewServer создаёт новый Server, регистрирует все HTTP-эндпоинты.
 // Возвращает ссылку на сконфигурированный Server.
-func NewServer(addr string, cacheSize int, defaultCacheTTL time.Duration) *Server {
+func NewServer(addr string, cacheSize int, defaultCacheTTL time.Duration, opts ...Option) *Server {
 	r := chi.NewRouter()
 
-	lru := cache.NewLRUCache(cacheSize, defaultCacheTTL)
-
 	s := &Server{
-		cache: lru,
 		httpServer: &http.Server{
 			Addr:              addr,
 			Handler:           r,
 			ReadHeaderTimeout: 10 * time.Second,
 			IdleTimeout:       60 * time.Second,
 		},
+		events:      cache.NewEventBus(),
+		streamsDone: make(chan struct{}),
+	}
+	s.httpServer.RegisterOnShutdown(func() { close(s.streamsDone) })
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.members != nil && s.cluster != nil {
+		s.members.OnChange(s.syncClusterPeers)
 	}
 
-	r.Post("/api/lru", s.handlePost)
-	r.Get("/api/lru/{key}", s.handleGet)
-	r.Get("/api/lru", s.handleGetAll)
-	r.Delete("/api/lru/{key}", s.handleDelete)
-	r.Delete("/api/lru", s.handleDeleteAll)
+	var cacheOpts []cache.Option
+	if s.fillOpts != nil {
+		// Загрузчик чтения через источник обновляет и устаревшие по мягкому TTL
+		// записи; загрузчик из WithCacheOptions имеет приоритет.
+		cacheOpts = append(cacheOpts, cache.WithLoader(s.fillOpts.Loader))
+	}
+	cacheOpts = append(cacheOpts, s.cacheOpts...)
+	cacheOpts = append(cacheOpts, cache.WithEventBus(s.events))
+	switch {
+	case s.slabOpts != nil:
+		slabOpts := *s.slabOpts
+		slabOpts.Events = s.events
+		s.cache = cache.NewSlabCache(cacheSize, defaultCacheTTL, slabOpts)
+	case s.diskTier != nil:
+		s.cache = cache.NewTieredCache(cacheSize, defaultCacheTTL, s.diskTier, cacheOpts...)
+	default:
+		s.cache = cache.NewLRUCache(cacheSize, defaultCacheTTL, cacheOpts...)
+	}
+	if s.replOpts != nil {
+		// Журнал ведёт и ведомый, чтобы после повышения сразу отдавать его другим узлам.
+		s.leader = replication.NewLeader(s.cache, s.events, s.replOpts.LogSize)
+		if s.replOpts.Follower != nil {
+			s.follower = replication.NewFollower(s.cache, *s.replOpts.Follower)
+		}
+	}
+
+	if s.invalidationOpts != nil {
+		s.invalidation = invalidation.New(s.cache, *s.invalidationOpts)
+	}
+	if s.fillOpts != nil {
+		s.fill = peerfill.New(s.cache, *s.fillOpts)
+	}
+
+	r.Use(requestID, tracing, accessLog, recoverer)
+
+	r.Get("/healthz", s.handleHealthz)
+	r.Get("/readyz", s.handleReadyz)
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.authenticate, s.rateLimit)
+
+		r.With(s.requireScope(ScopeWrite), s.rejectOnReplica, s.routeToOwner).Post("/api/lru", s.handlePost)
+		r.With(s.requireScope(ScopeWrite), s.rejectOnReplica, s.routeToOwner).Put("/api/lru/{key}", s.handlePut)
+		r.With(s.requireScope(ScopeRead)).Get("/api/lru/_watch", s.handleWatch)
+		// Права на отдельные операции WebSocket проверяются в каждой команде.
+		r.Get("/api/lru/_ws", s.handleWebSocket)
+		r.With(s.requireScope(ScopeRead), s.routeToOwner).Get("/api/lru/{key}", s.handleGet)
+		r.With(s.requireScope(ScopeRead)).Get("/api/lru", s.handleGetAll)
+		r.With(s.requireScope(ScopeDelete), s.rejectOnReplica, s.routeToOwner).Delete("/api/lru/{key}", s.handleDelete)
+		r.With(s.requireScope(ScopeDelete), s.rejectOnReplica).Delete("/api/lru", s.handleDeleteAll)
+
+		if s.leader != nil {
+			r.With(s.requireScope(ScopeAdmin)).Get(replication.StreamPath, s.handleReplicationStream)
+			r.With(s.requireScope(ScopeAdmin)).Get("/api/admin/replication", s.handleReplicationStatus)
+			r.With(s.requireScope(ScopeAdmin)).Post("/api/admin/replication/promote", s.handlePromote)
+		}
+		if _, ok := s.cache.(cache.Reconfigurable); ok {
+			r.With(s.requireScope(ScopeAdmin)).Get("/api/admin/config", s.handleGetSettings)
+			r.With(s.requireScope(ScopeAdmin)).Put("/api/admin/config", s.handlePutSettings)
+		}
+		if s.members != nil {
+			r.With(s.requireScope(ScopeRead)).Get("/api/cluster/members", s.handleMembers)
+		}
+		if s.fill != nil {
+			r.With(s.requireScope(ScopeRead)).Get(peerfill.FillPath+"{key}", s.handlePeerFill)
+			r.With(s.requireScope(ScopeAdmin)).Get("/api/admin/peer-fill", s.handlePeerFillStatus)
+		}
+		if s.invalidation != nil {
+			r.With(s.requireScope(ScopeAdmin)).Post(invalidation.Path, s.handleInvalidate)
+			r.With(s.requireScope(ScopeAdmin)).Get("/api/admin/invalidation", s.handleInvalidationStatus)
+		}
+	})
+
+	if s.proxyOpts != nil {
+		// Прокси закрыт той же аутентификацией и лимитами, что и API: иначе
+		// анонимные клиенты заполняли бы общий кэш и нагружали upstream.
+		proxyOpts := *s.proxyOpts
+		proxyOpts.StripCredentials = s.auth != nil
+		proxyOpts.WriteError = writeProxyError
+		protected := chi.Chain(s.authenticate, s.rateLimit, s.requireScope(ScopeRead))
+		// Ответы upstream хранятся в отдельном кэше: они не должны попадать в
+		// /api/lru, события, вебхуки, репликацию и на дисковый уровень.
+		proxyCache := cache.NewLRUCache(cacheSize, defaultCacheTTL)
+		r.NotFound(protected.Handler(proxy.New(proxyCache, proxyOpts)).ServeHTTP)
+	}
 
 	return s
 }
@@ -57,10 +276,53 @@ func (s *Server) Start() error {
 
 	errChan := make(chan error, 1)
 
-	s.httpServer.Handler = s.loggingMiddleware(s.httpServer.Handler)
+	if s.tlsOpts != nil {
+		reloader, err := newCertReloader(*s.tlsOpts)
+		if err != nil {
+			return err
+		}
+		tlsConfig, err := reloader.tlsConfig()
+		if err != nil {
+			return err
+		}
+		s.httpServer.TLSConfig = tlsConfig
+
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		go reloader.watch(watchCtx)
+	}
+
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return err
+	}
+
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	s.startBackground(bgCtx)
+
+	// SIGHUP не останавливает сервер, а перечитывает конфигурацию.
+	if s.reload != nil {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		go s.watchReload(bgCtx, hup)
+	}
+
 	go func() {
-		slog.Info("Server is starting", slog.String("addr", s.httpServer.Addr))
-		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Info("Server is starting",
+			slog.String("addr", ln.Addr().String()),
+			slog.Bool("tls", s.tlsOpts != nil),
+		)
+		s.listening.Store(true)
+
+		var err error
+		if s.tlsOpts != nil {
+			err = s.httpServer.ServeTLS(ln, "", "")
+		} else {
+			err = s.httpServer.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			errChan <- err
 		}
 	}()
@@ -71,6 +333,14 @@ func (s *Server) Start() error {
 			slog.String("signal", sig.String()),
 		)
 
+		// Сначала переводим /readyz в 503, чтобы балансировщик перестал слать трафик,
+		// и только после паузы закрываем слушающий сокет.
+		s.shuttingDown.Store(true)
+		if s.drainDelay > 0 {
+			slog.Info("Draining before shutdown", slog.Duration("delay", s.drainDelay))
+			time.Sleep(s.drainDelay)
+		}
+
 		shutdownStart := time.Now()
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -81,6 +351,16 @@ func (s *Server) Start() error {
 			return err
 		}
 
+		s.listening.Store(false)
+		if s.members != nil {
+			s.members.Leave(time.Second)
+		}
+		// Дисковый уровень дописывает вытесненные записи, чтобы они пережили перезапуск.
+		if c, ok := s.cache.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				slog.Error("Failed to close cache", slog.String("error", err.Error()))
+			}
+		}
 		shutdownElapsed := time.Since(shutdownStart)
 		slog.Info("Server gracefully stopped",
 			slog.Duration("shutdown_time", shutdownElapsed),
@@ -88,18 +368,49 @@ func (s *Server) Start() error {
 		return nil
 
 	case err := <-errChan:
-
+		s.listening.Store(false)
 		return err
 	}
 }
 
-func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		next.ServeHTTP(w, r)
+// startBackground запускает фоновые задачи сервера, работающие до отмены ctx.
+func (s *Server) startBackground(ctx context.Context) {
+	if len(s.startupLoads) > 0 {
+		go s.runStartupLoads(ctx)
+	}
+	if s.webhooks != nil {
+		go s.webhooks.Run(ctx, s.events)
+	}
+	if s.cluster != nil {
+		go s.cluster.Watch(ctx)
+	}
+	if s.members != nil {
+		go s.members.Run(ctx)
+	}
+	if s.invalidation != nil {
+		go s.invalidation.Run(ctx)
+	}
+	if s.leader != nil {
+		go s.leader.Run(ctx)
+	}
+	if s.follower != nil {
+		go s.follower.Run(ctx)
+	}
 
-		slog.Debug("Incoming request",
-			slog.String("method", r.Method),
-			slog.String("path", r.URL.Path),
-			slog.String("remote_addr", r.RemoteAddr))
-	})
+	if sweeper, ok := s.cache.(cache.ExpirySweeper); ok && s.sweepInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(s.sweepInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if n := sweeper.DeleteExpired(ctx); n > 0 {
+						slog.Debug("Expired entries removed", slog.Int("count", n))
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
 }
@@ -2,15 +2,20 @@ package server
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/titoffon/lru-cache-service/internal/proxy"
 	"github.com/titoffon/lru-cache-service/pkg/cache"
 )
 
@@ -243,3 +248,301 @@ func TestHandleDeleteAll(t *testing.T) {
 		assert.Empty(t, values)
 	})
 }
+
+func TestHandlePutRaw(t *testing.T) {
+	mockCache := cache.NewLRUCache(10, time.Minute)
+	srv := &Server{cache: mockCache}
+
+	png := []byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0xff}
+
+	tests := []struct {
+		name        string
+		key         string
+		query       string
+		contentType string
+		body        []byte
+		statusCode  int
+	}{
+		{
+			name:        "Binary body",
+			key:         "image",
+			contentType: "image/png",
+			body:        png,
+			statusCode:  http.StatusNoContent,
+		},
+		{
+			name:       "Default content type",
+			key:        "blob",
+			query:      "?ttl_seconds=30",
+			body:       []byte("opaque"),
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "Invalid TTL",
+			key:        "blob",
+			query:      "?ttl_seconds=soon",
+			body:       []byte("opaque"),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Too large",
+			key:        "huge",
+			body:       make([]byte, maxRawValueSize+1),
+			statusCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/api/lru/"+tt.key+tt.query, bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, &chi.Context{
+				URLParams: chi.RouteParams{Keys: []string{"key"}, Values: []string{tt.key}},
+			}))
+			rec := httptest.NewRecorder()
+
+			srv.handlePut(rec, req)
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+		})
+	}
+
+	t.Run("GET returns raw bytes with original content type", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/lru/image", nil)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, &chi.Context{
+			URLParams: chi.RouteParams{Keys: []string{"key"}, Values: []string{"image"}},
+		}))
+		rec := httptest.NewRecorder()
+
+		srv.handleGet(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+		assert.Equal(t, png, rec.Body.Bytes())
+		assert.NotEmpty(t, rec.Header().Get("X-Expires-At"))
+	})
+
+	t.Run("Default content type is octet-stream", func(t *testing.T) {
+		value, _, err := mockCache.Get(context.Background(), "blob")
+		assert.NoError(t, err)
+		assert.Equal(t, cache.RawValue{ContentType: "application/octet-stream", Data: []byte("opaque")}, value)
+	})
+}
+
+func TestHandleGetGzip(t *testing.T) {
+	srv := NewServer("localhost:0", 10, time.Minute,
+		WithCacheOptions(cache.WithCompression(cache.CompressionOptions{Threshold: 64})))
+	handler := srv.httpServer.Handler
+
+	html := bytes.Repeat([]byte("<li>item</li>"), 200)
+	req := httptest.NewRequest(http.MethodPut, "/api/lru/page", bytes.NewReader(html))
+	req.Header.Set("Content-Type", "text/html")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	t.Run("Client accepts gzip", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/lru/page", nil)
+		req.Header.Set("Accept-Encoding", "br, gzip")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, "text/html", rec.Header().Get("Content-Type"))
+
+		zr, err := gzip.NewReader(rec.Body)
+		require.NoError(t, err)
+		plain, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		assert.Equal(t, html, plain)
+	})
+
+	t.Run("Client does not accept gzip", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/lru/page", nil)
+		req.Header.Set("Accept-Encoding", "gzip;q=0")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, html, rec.Body.Bytes())
+	})
+}
+
+func TestProxyMode(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("upstream " + r.URL.Path))
+	}))
+	defer upstream.Close()
+
+	u, err := proxy.ParseUpstream(upstream.URL)
+	require.NoError(t, err)
+	srv := NewServer("localhost:0", 10, time.Minute, WithProxy(proxy.Options{Upstream: u}))
+	handler := srv.httpServer.Handler
+
+	for _, want := range []string{"MISS", "HIT"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/static/app.js", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, want, rec.Header().Get("X-Cache"))
+		assert.Equal(t, "upstream /static/app.js", rec.Body.String())
+	}
+
+	// Маршруты API по-прежнему обслуживаются самим сервисом.
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/lru/missing", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, rec.Header().Get("X-Cache"))
+
+	// Ответы upstream не попадают в основной кэш и не видны через API.
+	keys, _, err := srv.cache.GetAll(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/lru", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestProxyModeErrors(t *testing.T) {
+	u, err := proxy.ParseUpstream("http://127.0.0.1:1")
+	require.NoError(t, err)
+	srv := NewServer("localhost:0", 10, time.Minute, WithProxy(proxy.Options{Upstream: u}))
+	handler := srv.httpServer.Handler
+
+	tests := []struct {
+		method string
+		status int
+		code   string
+	}{
+		{method: http.MethodGet, status: http.StatusBadGateway, code: codeUpstreamUnavailable},
+		{method: http.MethodPost, status: http.StatusMethodNotAllowed, code: codeMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, "/static/app.js", nil))
+		assert.Equal(t, tt.status, rec.Code, tt.method)
+		assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"), tt.method)
+		var p problem
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		assert.Equal(t, tt.code, p.Code)
+		assert.NotEmpty(t, p.RequestID)
+	}
+}
+
+func TestProxyModeProtected(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		assert.Empty(t, r.Header.Get("Authorization"), "API token must not reach upstream")
+		_, _ = w.Write([]byte("upstream"))
+	}))
+	defer upstream.Close()
+
+	a, err := LoadAuthFile(writeAuthFile(t, `{"keys": [
+		{"id": "reader", "token": "read-token", "scopes": ["read"]},
+		{"id": "writer", "token": "write-token", "scopes": ["write"]}
+	]}`))
+	require.NoError(t, err)
+	u, err := proxy.ParseUpstream(upstream.URL)
+	require.NoError(t, err)
+	srv := NewServer("localhost:0", 10, time.Minute,
+		WithProxy(proxy.Options{Upstream: u}),
+		WithAuthenticator(a),
+		WithRateLimit(RateLimitOptions{Read: RateLimit{Rate: 0.001, Burst: 1}}),
+	)
+	handler := srv.httpServer.Handler
+
+	get := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/static/app.js", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, get(""))
+	assert.Equal(t, http.StatusForbidden, get("write-token"))
+	assert.Equal(t, http.StatusOK, get("read-token"))
+	assert.Equal(t, http.StatusTooManyRequests, get("read-token"))
+	assert.Equal(t, int32(1), hits.Load())
+}
+
+func TestHandleGetStale(t *testing.T) {
+	c := cache.NewLRUCache(10, time.Minute)
+	sc := c.(cache.StaleCache)
+	require.NoError(t, sc.PutStale(context.Background(), "fresh", "v1", time.Minute, time.Hour))
+	require.NoError(t, sc.PutStale(context.Background(), "stale", "v2", 10*time.Millisecond, time.Hour))
+	require.NoError(t, sc.PutStale(context.Background(), "raw", cache.RawValue{ContentType: "text/plain", Data: []byte("v3")}, 10*time.Millisecond, time.Hour))
+	time.Sleep(20 * time.Millisecond)
+
+	srv := &Server{cache: c}
+
+	tests := []struct {
+		key   string
+		stale bool
+	}{
+		{key: "fresh", stale: false},
+		{key: "stale", stale: true},
+		{key: "raw", stale: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/lru/"+tt.key, nil)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, &chi.Context{
+				URLParams: chi.RouteParams{Keys: []string{"key"}, Values: []string{tt.key}},
+			}))
+			rec := httptest.NewRecorder()
+			srv.handleGet(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			if tt.stale {
+				assert.Equal(t, "true", rec.Header().Get(staleHeader))
+			} else {
+				assert.Empty(t, rec.Header().Get(staleHeader))
+			}
+			if tt.key != "raw" {
+				var resp responseBody
+				require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+				assert.Equal(t, tt.stale, resp.Stale)
+			}
+		})
+	}
+}
+
+func TestHandlePostSoftTTL(t *testing.T) {
+	loader := func(context.Context, string) (interface{}, error) { return "fresh", nil }
+	srv := NewServer("localhost:0", 10, time.Minute, WithCacheOptions(cache.WithLoader(loader)))
+	handler := srv.httpServer.Handler
+
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+	}{
+		{"Valid soft TTL", `{"key":"k","value":"v","ttl_seconds":60,"soft_ttl_seconds":10}`, http.StatusCreated},
+		{"Soft TTL not positive", `{"key":"k","value":"v","soft_ttl_seconds":0}`, http.StatusBadRequest},
+		{"Soft TTL exceeds TTL", `{"key":"k","value":"v","ttl_seconds":5,"soft_ttl_seconds":10}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/lru", bytes.NewBufferString(tt.body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.statusCode, rec.Code)
+		})
+	}
+
+	// Без загрузчика устаревшую запись нечем обновить: мягкий TTL отклоняется.
+	handler = NewServer("localhost:0", 10, time.Minute).httpServer.Handler
+	req := httptest.NewRequest(http.MethodPost, "/api/lru", bytes.NewBufferString(`{"key":"k","value":"v","ttl_seconds":60,"soft_ttl_seconds":10}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), codeInvalidTTL)
+}
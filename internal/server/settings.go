@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// maxSettingsBodySize ограничивает размер тела PUT /api/admin/config.
+const maxSettingsBodySize = 4 << 10
+
+// settingsRequest — тело PUT /api/admin/config; отсутствующие поля не меняются.
+type settingsRequest struct {
+	Capacity          *int   `json:"capacity,omitempty"`
+	DefaultTTLSeconds *int64 `json:"default_ttl_seconds,omitempty"`
+}
+
+// settingsResponse — ответ GET и PUT /api/admin/config.
+type settingsResponse struct {
+	Capacity          int   `json:"capacity"`
+	DefaultTTLSeconds int64 `json:"default_ttl_seconds"`
+	Entries           int   `json:"entries"`
+	// Evicted — сколько записей вытеснено при уменьшении ёмкости.
+	Evicted int `json:"evicted,omitempty"`
+}
+
+func newSettingsResponse(st cache.Settings, evicted int) settingsResponse {
+	return settingsResponse{
+		Capacity:          st.Capacity,
+		DefaultTTLSeconds: int64(st.DefaultTTL / time.Second),
+		Entries:           st.Len,
+		Evicted:           evicted,
+	}
+}
+
+// handleGetSettings обрабатывает GET /api/admin/config.
+func (s *Server) handleGetSettings(w http.ResponseWriter, r *http.Request) {
+	st := s.cache.(cache.Reconfigurable).Settings()
+	if err := writeEncoded(w, responseCodec(r), http.StatusOK, newSettingsResponse(st, 0)); err != nil {
+		loggerFromContext(r.Context()).Error("Failed to encode response",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// handlePutSettings обрабатывает PUT /api/admin/config: меняет ёмкость и TTL
+// по умолчанию без перезапуска. Изменение действует только на этом узле.
+func (s *Server) handlePutSettings(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFromContext(r.Context())
+	rc := s.cache.(cache.Reconfigurable)
+
+	var req settingsRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSettingsBodySize)).Decode(&req); err != nil {
+		logger.Warn("Invalid body in config request",
+			slog.String("error", err.Error()),
+		)
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidJSON, "request body is not valid JSON", "")
+		return
+	}
+	switch {
+	case req.Capacity == nil && req.DefaultTTLSeconds == nil:
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "capacity or default_ttl_seconds must be set", "")
+		return
+	case req.Capacity != nil && *req.Capacity < 1:
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "capacity must be >= 1", "")
+		return
+	case req.DefaultTTLSeconds != nil && *req.DefaultTTLSeconds <= 0:
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidTTL, "default_ttl_seconds must be > 0", "")
+		return
+	}
+
+	before := rc.Settings()
+	if req.DefaultTTLSeconds != nil {
+		if err := rc.SetDefaultTTL(time.Duration(*req.DefaultTTLSeconds) * time.Second); err != nil {
+			writeCacheError(w, r, err, "")
+			return
+		}
+	}
+	evicted := 0
+	if req.Capacity != nil {
+		var err error
+		evicted, err = rc.Resize(r.Context(), *req.Capacity)
+		if err != nil {
+			writeCacheError(w, r, err, "")
+			return
+		}
+	}
+	after := rc.Settings()
+
+	logger.Info("Cache settings changed",
+		slog.Int("capacity_before", before.Capacity),
+		slog.Int("capacity", after.Capacity),
+		slog.Duration("default_ttl_before", before.DefaultTTL),
+		slog.Duration("default_ttl", after.DefaultTTL),
+		slog.Int("evicted", evicted),
+	)
+
+	if err := writeEncoded(w, responseCodec(r), http.StatusOK, newSettingsResponse(after, evicted)); err != nil {
+		logger.Error("Failed to encode response",
+			slog.String("error", err.Error()),
+		)
+	}
+}
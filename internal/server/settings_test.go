@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettingsEndpoint(t *testing.T) {
+	a, err := LoadAuthFile(writeAuthFile(t, `{"keys": [
+		{"id": "writer", "token": "write-token", "scopes": ["read", "write"]},
+		{"id": "admin", "token": "admin-token", "scopes": ["admin"]}
+	]}`))
+	require.NoError(t, err)
+	srv := NewServer("localhost:0", 4, time.Minute, WithAuthenticator(a))
+	handler := srv.httpServer.Handler
+
+	do := func(method, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/admin/config", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/lru", bytes.NewBufferString(`{"key": "k`+strconv.Itoa(i)+`", "value": 1}`))
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	rec := do(http.MethodGet, "", "admin-token")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got settingsResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	assert.Equal(t, settingsResponse{Capacity: 4, DefaultTTLSeconds: 60, Entries: 4}, got)
+
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, `{"capacity": 2}`, "write-token").Code)
+
+	rec = do(http.MethodPut, `{"capacity": 2, "default_ttl_seconds": 300}`, "admin-token")
+	require.Equal(t, http.StatusOK, rec.Code)
+	got = settingsResponse{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	assert.Equal(t, settingsResponse{Capacity: 2, DefaultTTLSeconds: 300, Entries: 2, Evicted: 2}, got)
+
+	// Новый TTL по умолчанию применяется к последующим записям.
+	req := httptest.NewRequest(http.MethodPost, "/api/lru", bytes.NewBufferString(`{"key": "fresh", "value": 1}`))
+	req.Header.Set("Authorization", "Bearer admin-token")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	req = httptest.NewRequest(http.MethodGet, "/api/lru/fresh", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var entry responseBody
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&entry))
+	assert.InDelta(t, time.Now().Add(5*time.Minute).Unix(), entry.ExpiresAt, 2)
+
+	tests := []struct {
+		name string
+		body string
+		code string
+	}{
+		{name: "Not JSON", body: `capacity=2`, code: codeInvalidJSON},
+		{name: "Empty", body: `{}`, code: codeInvalidBody},
+		{name: "Zero capacity", body: `{"capacity": 0}`, code: codeInvalidBody},
+		{name: "Negative TTL", body: `{"default_ttl_seconds": -1}`, code: codeInvalidTTL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(http.MethodPut, tt.body, "admin-token")
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			var p problem
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+			assert.Equal(t, tt.code, p.Code)
+		})
+	}
+}
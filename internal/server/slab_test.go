@@ -0,0 +1,60 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+func TestSlabStorage(t *testing.T) {
+	srv := NewServer("localhost:0", 2, time.Minute, WithSlabStorage(cache.SlabOptions{MaxBytes: 1 << 20}))
+	_, ok := srv.cache.(*cache.SlabCache)
+	require.True(t, ok)
+	ts := httptest.NewServer(srv.httpServer.Handler)
+	defer ts.Close()
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.Equal(t, http.StatusCreated, postJSON(t, ts.URL, requestBody{Key: key, Value: map[string]interface{}{"n": key}}).StatusCode)
+	}
+
+	resp, err := http.Get(ts.URL + "/api/lru/c")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var got responseBody
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	resp.Body.Close()
+	assert.Equal(t, map[string]interface{}{"n": "c"}, got.Value)
+
+	resp, err = http.Get(ts.URL + "/api/lru/a")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Значение больше всей памяти хранилища не помещается даже после вытеснения.
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/lru/big", bytes.NewReader(make([]byte, 2<<20)))
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	var p problem
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.Equal(t, codeValueTooLarge, p.Code)
+
+	// Мягкий TTL слабовое хранилище не поддерживает: запись отклоняется, а не
+	// сохраняется молча с одним жёстким TTL.
+	soft := int64(10)
+	resp = postJSON(t, ts.URL, requestBody{Key: "soft", Value: "v", SoftTTLSeconds: &soft})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	_, _, err = srv.cache.Get(context.Background(), "soft")
+	assert.ErrorIs(t, err, cache.ErrKeyNotFound)
+}
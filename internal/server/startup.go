@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// StartupLoad заполняет кэш при запуске, например восстанавливает его из
+// снимка.
+type StartupLoad func(ctx context.Context, c cache.ILRUCache) error
+
+// WithStartupLoad регистрирует загрузку, которая выполняется в фоне после
+// открытия порта. Пока не завершились все загрузки, /readyz отвечает 503,
+// а /healthz — 200. Ошибка загрузки пишется в лог, и сервер становится
+// готовым с тем, что успело загрузиться.
+func WithStartupLoad(load StartupLoad) Option {
+	return func(s *Server) {
+		s.startupLoads = append(s.startupLoads, load)
+		s.restoring.Store(true)
+	}
+}
+
+// runStartupLoads выполняет загрузки из WithStartupLoad по очереди и
+// снимает признак restoring.
+func (s *Server) runStartupLoads(ctx context.Context) {
+	defer s.restoring.Store(false)
+
+	start := time.Now()
+	for _, load := range s.startupLoads {
+		if err := load(ctx, s.cache); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Error("Startup cache load failed", slog.String("error", err.Error()))
+		}
+	}
+	slog.Info("Startup cache load finished",
+		slog.Int("loads", len(s.startupLoads)),
+		slog.Duration("duration", time.Since(start)),
+	)
+}
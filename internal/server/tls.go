@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSOptions описывает настройки TLS для HTTP-листенера.
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile — PEM с корневыми сертификатами для проверки клиентов (mTLS).
+	// Пустое значение отключает проверку клиентских сертификатов.
+	ClientCAFile string
+	// RequireClientCert запрещает подключения без клиентского сертификата.
+	// Если false, сертификат проверяется, только когда клиент его предъявил.
+	RequireClientCert bool
+	// MinVersion — минимальная версия протокола: "1.2" или "1.3".
+	MinVersion string
+	// ReloadInterval — период проверки файлов сертификатов на изменения.
+	ReloadInterval time.Duration
+}
+
+// WithTLS включает TLS на HTTP-листенере.
+func WithTLS(opts TLSOptions) Option {
+	return func(s *Server) {
+		s.tlsOpts = &opts
+	}
+}
+
+// parseTLSVersion преобразует строку вида "1.2" в константу crypto/tls.
+func parseTLSVersion(v string) (uint16, error) {
+	switch v {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q (want 1.2 or 1.3)", v)
+	}
+}
+
+// certReloader хранит текущие сертификат и пул клиентских CA и перечитывает
+// их с диска, когда файлы меняются. Старые значения остаются в силе, если
+// новые файлы не удалось разобрать.
+type certReloader struct {
+	opts TLSOptions
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+func newCertReloader(opts TLSOptions) (*certReloader, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("TLS requires both cert and key files")
+	}
+	cr := &certReloader{opts: opts}
+	if _, err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// files возвращает список отслеживаемых файлов.
+func (cr *certReloader) files() []string {
+	files := []string{cr.opts.CertFile, cr.opts.KeyFile}
+	if cr.opts.ClientCAFile != "" {
+		files = append(files, cr.opts.ClientCAFile)
+	}
+	return files
+}
+
+// reload перечитывает файлы, если хотя бы один из них изменился.
+// Возвращает true, если сертификаты были обновлены.
+func (cr *certReloader) reload() (bool, error) {
+	modTimes := make(map[string]time.Time, 3)
+	changed := false
+	for _, f := range cr.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return false, fmt.Errorf("stat %s: %w", f, err)
+		}
+		modTimes[f] = info.ModTime()
+
+		cr.mu.RLock()
+		prev, ok := cr.modTimes[f]
+		cr.mu.RUnlock()
+		if !ok || !prev.Equal(info.ModTime()) {
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.opts.CertFile, cr.opts.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("load key pair: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if cr.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(cr.opts.ClientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("read client CA: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("client CA %s contains no certificates", cr.opts.ClientCAFile)
+		}
+	}
+
+	cr.mu.Lock()
+	cr.cert = &cert
+	cr.clientCA = pool
+	cr.modTimes = modTimes
+	cr.mu.Unlock()
+
+	return true, nil
+}
+
+// watch периодически проверяет файлы сертификатов до отмены ctx.
+func (cr *certReloader) watch(ctx context.Context) {
+	interval := cr.opts.ReloadInterval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := cr.reload()
+			if err != nil {
+				slog.Error("Failed to reload TLS certificates, keeping previous ones",
+					slog.String("error", err.Error()),
+				)
+				continue
+			}
+			if reloaded {
+				slog.Info("TLS certificates reloaded", slog.String("cert_file", cr.opts.CertFile))
+			}
+		}
+	}
+}
+
+// tlsConfig строит *tls.Config, который берёт актуальные сертификаты из reloader'а
+// на каждом рукопожатии.
+func (cr *certReloader) tlsConfig() (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(cr.opts.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion: minVersion,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cr.mu.RLock()
+			defer cr.mu.RUnlock()
+			return cr.cert, nil
+		},
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cr.mu.RLock()
+		defer cr.mu.RUnlock()
+
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		if cr.clientCA != nil {
+			cfg.ClientCAs = cr.clientCA
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+			if cr.opts.RequireClientCert {
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+		return cfg, nil
+	}
+	return base, nil
+}
+
+// certIdentities возвращает кандидатов на идентификатор клиента из проверенного
+// сертификата: CommonName, затем DNS- и URI-имена из SAN.
+func certIdentities(cert *x509.Certificate) []string {
+	ids := make([]string, 0, 1+len(cert.DNSNames)+len(cert.URIs))
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	ids = append(ids, cert.DNSNames...)
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	return ids
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// issueCert выпускает сертификат, подписанный parent (или самоподписанный, если parent == nil).
+func issueCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) writePEM(t *testing.T, certPath, keyPath string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600))
+	if keyPath == "" {
+		return
+	}
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	ca := issueCert(t, "test-ca", nil, true)
+	issueCert(t, "first", ca, false).writePEM(t, certPath, keyPath)
+
+	cr, err := newCertReloader(TLSOptions{CertFile: certPath, KeyFile: keyPath})
+	require.NoError(t, err)
+	assert.Equal(t, "first", leafCN(t, cr.cert))
+
+	reloaded, err := cr.reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "unchanged files should not be reloaded")
+
+	issueCert(t, "second", ca, false).writePEM(t, certPath, keyPath)
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certPath, future, future))
+
+	reloaded, err = cr.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "second", leafCN(t, cr.cert))
+
+	// Битый файл не должен заменять рабочий сертификат.
+	require.NoError(t, os.WriteFile(certPath, []byte("garbage"), 0o600))
+	future = future.Add(time.Minute)
+	require.NoError(t, os.Chtimes(certPath, future, future))
+
+	_, err = cr.reload()
+	assert.Error(t, err)
+	assert.Equal(t, "second", leafCN(t, cr.cert))
+}
+
+func leafCN(t *testing.T, c *tls.Certificate) string {
+	t.Helper()
+	leaf, err := x509.ParseCertificate(c.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestMutualTLSIdentity(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	caPath := filepath.Join(dir, "ca.crt")
+
+	ca := issueCert(t, "test-ca", nil, true)
+	ca.writePEM(t, caPath, "")
+	issueCert(t, "server", ca, false).writePEM(t, certPath, keyPath)
+
+	a, err := LoadAuthFile(writeAuthFile(t, `{"client_certs": [
+		{"identity": "reader-svc", "scopes": ["read"]}
+	]}`))
+	require.NoError(t, err)
+
+	srv := NewServer("127.0.0.1:0", 10, time.Minute,
+		WithAuthenticator(a),
+		WithTLS(TLSOptions{CertFile: certPath, KeyFile: keyPath, ClientCAFile: caPath}),
+	)
+
+	cr, err := newCertReloader(*srv.tlsOpts)
+	require.NoError(t, err)
+	tlsConfig, err := cr.tlsConfig()
+	require.NoError(t, err)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	require.NoError(t, err)
+	httpServer := &http.Server{Handler: srv.httpServer.Handler}
+	go httpServer.Serve(ln)
+	t.Cleanup(func() { httpServer.Close() })
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	clientFor := func(c *testCert) *http.Client {
+		tlsCfg := &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+		if c != nil {
+			tlsCfg.Certificates = []tls.Certificate{{Certificate: [][]byte{c.der}, PrivateKey: c.key}}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsCfg}}
+	}
+	url := "https://" + ln.Addr().String()
+
+	tests := []struct {
+		name       string
+		client     *http.Client
+		method     string
+		statusCode int
+	}{
+		{name: "No client cert", client: clientFor(nil), method: http.MethodGet, statusCode: http.StatusUnauthorized},
+		{name: "Unmapped identity", client: clientFor(issueCert(t, "stranger", ca, false)), method: http.MethodGet, statusCode: http.StatusUnauthorized},
+		{name: "Mapped identity reads", client: clientFor(issueCert(t, "reader-svc", ca, false)), method: http.MethodGet, statusCode: http.StatusNoContent},
+		{name: "Mapped identity cannot delete", client: clientFor(issueCert(t, "reader-svc", ca, false)), method: http.MethodDelete, statusCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, url+"/api/lru", nil)
+			require.NoError(t, err)
+
+			resp, err := tt.client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	srv := NewServer("localhost:0", 10, time.Minute)
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodGet, "/api/lru/missing", nil)
+	req.Header.Set("traceparent", traceparent)
+	rec := httptest.NewRecorder()
+
+	srv.httpServer.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	var serverSpan, cacheSpan sdktrace.ReadOnlySpan
+	for _, s := range recorder.Ended() {
+		switch s.Name() {
+		case "GET /api/lru/{key}":
+			serverSpan = s
+		case "LRUCache.Get":
+			cacheSpan = s
+		}
+	}
+	require.NotNil(t, serverSpan, "server span should be named after the route pattern")
+	require.NotNil(t, cacheSpan)
+
+	assert.Equal(t, trace.SpanKindServer, serverSpan.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", serverSpan.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", serverSpan.Parent().SpanID().String())
+	assert.Equal(t, serverSpan.SpanContext().SpanID(), cacheSpan.Parent().SpanID())
+
+	// Запись через POST тоже идёт под span'ом своего запроса.
+	req = httptest.NewRequest(http.MethodPost, "/api/lru", strings.NewReader(`{"key": "k", "value": "v"}`))
+	rec = httptest.NewRecorder()
+	srv.httpServer.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	serverSpan, cacheSpan = nil, nil
+	for _, s := range recorder.Ended() {
+		switch s.Name() {
+		case "POST /api/lru":
+			serverSpan = s
+		case "LRUCache.Put":
+			cacheSpan = s
+		}
+	}
+	require.NotNil(t, serverSpan)
+	require.NotNil(t, cacheSpan)
+	assert.Equal(t, serverSpan.SpanContext().TraceID(), cacheSpan.SpanContext().TraceID())
+	assert.Equal(t, serverSpan.SpanContext().SpanID(), cacheSpan.Parent().SpanID())
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+const (
+	// watchBufferSize — сколько событий может накопиться у подписчика,
+	// прежде чем он будет отключён как медленный.
+	watchBufferSize = 256
+	// watchHeartbeat — период комментариев-пингов, которые не дают прокси
+	// закрыть простаивающее соединение.
+	watchHeartbeat = 15 * time.Second
+)
+
+// handleWatch обрабатывает GET /api/lru/_watch?prefix= — поток изменений
+// кэша в формате Server-Sent Events.
+func (s *Server) handleWatch(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	logger := loggerFromContext(r.Context())
+
+	prefix := r.URL.Query().Get("prefix")
+	p := principalFromContext(r.Context())
+	// Клиент с ограничением по префиксам может подписаться только на свои ключи.
+	if p != nil && !p.AllowsKey(prefix) {
+		logger.Warn("Watch prefix outside of allowed key prefixes",
+			slog.String("prefix", prefix),
+		)
+		writeProblem(w, r, http.StatusForbidden, codeForbidden, "watching prefix "+strconv.Quote(prefix)+" is not allowed", "")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	sub := s.events.Subscribe(prefix, watchBufferSize)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		logger.Error("Streaming is not supported by response writer",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	logger.Info("Watch subscription started",
+		slog.String("prefix", prefix),
+	)
+
+	heartbeat := time.NewTicker(watchHeartbeat)
+	defer heartbeat.Stop()
+
+	sent := 0
+	for {
+		select {
+		case ev, ok := <-sub.Events():
+			if !ok {
+				// Шина отключила подписчика: сообщаем причину, клиент переподключится.
+				logger.Warn("Watch subscriber dropped",
+					slog.String("prefix", prefix),
+					slog.Int("events_sent", sent),
+					slog.Any("error", sub.Err()),
+				)
+				fmt.Fprintf(w, "event: dropped\ndata: %s\n\n", sub.Err())
+				_ = rc.Flush()
+				return
+			}
+			if ev.Key != "" && p != nil && !p.AllowsKey(ev.Key) {
+				continue
+			}
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+			sent++
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+
+		case <-r.Context().Done():
+			logger.Info("Watch subscription closed",
+				slog.String("prefix", prefix),
+				slog.Int("events_sent", sent),
+				slog.Duration("duration", time.Since(start)),
+			)
+			return
+
+		case <-s.streamsDone:
+			// Сервер останавливается: Shutdown не дождался бы бесконечного потока.
+			return
+		}
+	}
+}
+
+// writeEvent пишет событие кэша в формате SSE.
+func writeEvent(w http.ResponseWriter, ev cache.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Type, data)
+	return err
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// readSSE читает из потока очередное событие (без комментариев-пингов).
+func readSSE(t *testing.T, sc *bufio.Scanner) (event string, data string) {
+	t.Helper()
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "" && event != "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	t.Fatalf("stream ended: %v", sc.Err())
+	return "", ""
+}
+
+func TestHandleWatch(t *testing.T) {
+	srv := NewServer("localhost:0", 10, time.Minute)
+	ts := httptest.NewServer(srv.httpServer.Handler)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/lru/_watch?prefix=user:", nil)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	require.Eventually(t, func() bool { return srv.events.Subscribers() == 1 }, time.Second, time.Millisecond)
+
+	post := func(body string) {
+		resp, err := http.Post(ts.URL+"/api/lru", "application/json", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	post(`{"key":"order:1","value":1}`)
+	post(`{"key":"user:1","value":1}`)
+	post(`{"key":"user:1","value":2}`)
+	delReq, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/lru/user:1", nil)
+	delResp, err := http.DefaultClient.Do(delReq)
+	require.NoError(t, err)
+	delResp.Body.Close()
+
+	sc := bufio.NewScanner(resp.Body)
+	for _, want := range []cache.EventType{cache.EventPut, cache.EventUpdate, cache.EventEvict} {
+		event, data := readSSE(t, sc)
+		assert.Equal(t, string(want), event)
+
+		var ev cache.Event
+		require.NoError(t, json.Unmarshal([]byte(data), &ev))
+		assert.Equal(t, want, ev.Type)
+		assert.Equal(t, "user:1", ev.Key, "events for other prefixes must be filtered out")
+	}
+
+	cancel()
+	assert.Eventually(t, func() bool { return srv.events.Subscribers() == 0 }, time.Second, time.Millisecond,
+		"subscription must be released when the client disconnects")
+}
+
+func TestHandleWatchPrefixRestricted(t *testing.T) {
+	a, err := LoadAuthFile(writeAuthFile(t, `{"keys": [
+		{"id": "tenant", "token": "tenant-token", "scopes": ["read"], "key_prefixes": ["tenant:"]}
+	]}`))
+	require.NoError(t, err)
+	srv := NewServer("localhost:0", 10, time.Minute, WithAuthenticator(a))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/lru/_watch?prefix=other:", nil)
+	req.Header.Set("Authorization", "Bearer tenant-token")
+	rec := httptest.NewRecorder()
+	srv.httpServer.Handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, 0, srv.events.Subscribers())
+}
@@ -0,0 +1,422 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+const (
+	// wsMaxInFlight ограничивает число одновременно выполняемых команд одного соединения;
+	// при достижении лимита чтение новых кадров приостанавливается.
+	wsMaxInFlight = 64
+	// wsMaxWatches ограничивает число подписок одного соединения.
+	wsMaxWatches = 16
+	// wsOutboxSize — размер очереди исходящих кадров соединения.
+	wsOutboxSize = 256
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+)
+
+// Операции WebSocket API.
+const (
+	wsOpGet     = "get"
+	wsOpPut     = "put"
+	wsOpEvict   = "evict"
+	wsOpWatch   = "watch"
+	wsOpUnwatch = "unwatch"
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// wsCommand — кадр с командой клиента. ID возвращается в ответе как есть
+// и позволяет сопоставить ответы, приходящие не по порядку.
+type wsCommand struct {
+	ID             string      `json:"id"`
+	Op             string      `json:"op"`
+	Key            string      `json:"key,omitempty"`
+	Value          interface{} `json:"value,omitempty"`
+	TTLSeconds     *int64      `json:"ttl_seconds,omitempty"`
+	SoftTTLSeconds *int64      `json:"soft_ttl_seconds,omitempty"`
+	Prefix         string      `json:"prefix,omitempty"`
+}
+
+// wsResponse — кадр с результатом команды или событием подписки.
+type wsResponse struct {
+	ID        string       `json:"id"`
+	OK        bool         `json:"ok"`
+	Key       string       `json:"key,omitempty"`
+	Value     interface{}  `json:"value,omitempty"`
+	ExpiresAt int64        `json:"expires_at,omitempty"`
+	Stale     bool         `json:"stale,omitempty"`
+	Event     *cache.Event `json:"event,omitempty"`
+	Error     *wsError     `json:"error,omitempty"`
+}
+
+// wsError повторяет поля problem, значимые для клиента.
+type wsError struct {
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// wsConn — состояние одного WebSocket-соединения.
+type wsConn struct {
+	s         *Server
+	conn      *websocket.Conn
+	principal *Principal
+	client    string
+	logger    *slog.Logger
+	// authorization пересылается узлу-владельцу ключа в кластерном режиме.
+	authorization string
+
+	outbox chan wsResponse
+	// done закрывается, когда соединение завершается.
+	done chan struct{}
+
+	mu      sync.Mutex
+	watches map[string]*cache.Subscription
+	// closed запрещает новые подписки после начала закрытия соединения.
+	closed bool
+}
+
+// handleWebSocket обрабатывает GET /api/lru/_ws — мультиплексированный доступ
+// к кэшу по WebSocket. Права проверяются для каждой команды отдельно.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	logger := loggerFromContext(r.Context())
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade сам ответил клиенту ошибкой.
+		logger.Warn("WebSocket upgrade failed",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	c := &wsConn{
+		s:             s,
+		conn:          conn,
+		principal:     principalFromContext(r.Context()),
+		client:        clientIdentity(r),
+		logger:        logger,
+		authorization: r.Header.Get("Authorization"),
+		outbox:        make(chan wsResponse, wsOutboxSize),
+		done:          make(chan struct{}),
+		watches:       make(map[string]*cache.Subscription),
+	}
+
+	logger.Info("WebSocket connection opened")
+
+	// Контекст не отменяется при завершении HTTP-обработчика раньше соединения,
+	// поэтому команды получают собственный контекст, живущий вместе с ним.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	var wg sync.WaitGroup
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		c.writeLoop()
+	}()
+
+	commands := c.readLoop(ctx, &wg)
+
+	cancel()
+	c.closeWatches()
+	wg.Wait()
+	close(c.done)
+	<-writerDone
+	_ = conn.Close()
+
+	logger.Info("WebSocket connection closed",
+		slog.Int("commands", commands),
+		slog.Duration("duration", time.Since(start)),
+	)
+}
+
+// readLoop читает команды и запускает их выполнение, пока соединение открыто.
+// Возвращает число принятых команд.
+func (c *wsConn) readLoop(ctx context.Context, wg *sync.WaitGroup) int {
+	c.conn.SetReadLimit(maxRawValueSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	// Закрываем соединение при остановке сервера, чтобы прервать ReadMessage.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-c.s.streamsDone:
+			_ = c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down"),
+				time.Now().Add(wsWriteWait))
+			_ = c.conn.Close()
+		case <-stop:
+		}
+	}()
+
+	inFlight := make(chan struct{}, wsMaxInFlight)
+	commands := 0
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				c.logger.Warn("WebSocket read failed",
+					slog.String("error", err.Error()),
+				)
+			}
+			return commands
+		}
+		commands++
+
+		var cmd wsCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			c.send(wsResponse{Error: &wsError{Status: http.StatusBadRequest, Code: codeInvalidJSON, Detail: "frame is not valid JSON"}})
+			continue
+		}
+
+		// Подписка живёт долго и не занимает слот in-flight; их число
+		// ограничено отдельно в watch.
+		if cmd.Op == wsOpWatch {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.send(c.execute(ctx, cmd))
+			}()
+			continue
+		}
+
+		inFlight <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-inFlight
+				wg.Done()
+			}()
+			c.send(c.execute(ctx, cmd))
+		}()
+	}
+}
+
+// writeLoop — единственный писатель в соединение: отправляет кадры из outbox и пинги.
+func (c *wsConn) writeLoop() {
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case resp := <-c.outbox:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteJSON(resp); err != nil {
+				// Читатель получит ошибку и завершит соединение.
+				_ = c.conn.Close()
+				c.discard()
+				return
+			}
+		case <-ping.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				_ = c.conn.Close()
+				c.discard()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// discard разбирает outbox после ошибки записи, чтобы не блокировать отправителей.
+func (c *wsConn) discard() {
+	for {
+		select {
+		case <-c.outbox:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// send ставит кадр в очередь на отправку.
+func (c *wsConn) send(resp wsResponse) {
+	select {
+	case c.outbox <- resp:
+	case <-c.done:
+	}
+}
+
+// execute выполняет одну команду и возвращает ответ на неё.
+func (c *wsConn) execute(ctx context.Context, cmd wsCommand) wsResponse {
+	scope, ok := wsOpScopes[cmd.Op]
+	if !ok {
+		return wsFail(cmd, http.StatusBadRequest, codeInvalidCommand, "unknown op "+cmd.Op)
+	}
+	if c.principal != nil && !c.principal.Can(scope) {
+		return wsFail(cmd, http.StatusForbidden, codeForbidden, "missing scope "+string(scope))
+	}
+	if c.principal != nil && cmd.Op != wsOpWatch && cmd.Op != wsOpUnwatch && !c.principal.AllowsKey(cmd.Key) {
+		return wsFail(cmd, http.StatusForbidden, codeForbidden, "access to this key is not allowed")
+	}
+	if limiter := c.s.limiter.Load(); limiter != nil {
+		write := cmd.Op == wsOpPut || cmd.Op == wsOpEvict
+		if ok, _ := limiter.allow(c.client, write, time.Now()); !ok {
+			return wsFail(cmd, http.StatusTooManyRequests, codeRateLimited, "too many requests")
+		}
+	}
+
+	if (cmd.Op == wsOpPut || cmd.Op == wsOpEvict) && c.s.isReplica() {
+		return wsFail(cmd, http.StatusConflict, codeReadOnlyReplica, "this node is a read-only replica of "+c.s.follower.Leader())
+	}
+
+	if c.s.cluster != nil && cmd.Key != "" && (cmd.Op == wsOpGet || cmd.Op == wsOpPut || cmd.Op == wsOpEvict) {
+		if owner, local := c.s.cluster.Owner(cmd.Key); !local {
+			return c.remoteCommand(ctx, owner, cmd)
+		}
+	}
+
+	switch cmd.Op {
+	case wsOpGet:
+		value, expiresAt, stale, err := c.s.get(ctx, cmd.Key)
+		if err != nil {
+			return wsCacheFail(cmd, err)
+		}
+		return wsResponse{ID: cmd.ID, OK: true, Key: cmd.Key, Value: value, ExpiresAt: expiresAt.Unix(), Stale: stale}
+
+	case wsOpPut:
+		var ttl, softTTL time.Duration
+		if cmd.TTLSeconds != nil {
+			ttl = time.Duration(*cmd.TTLSeconds) * time.Second
+		}
+		if cmd.SoftTTLSeconds != nil {
+			if *cmd.SoftTTLSeconds <= 0 {
+				return wsFail(cmd, http.StatusBadRequest, codeInvalidTTL, "soft_ttl_seconds must be > 0")
+			}
+			softTTL = time.Duration(*cmd.SoftTTLSeconds) * time.Second
+		}
+		if err := c.s.put(ctx, cmd.Key, cmd.Value, softTTL, ttl); err != nil {
+			return wsCacheFail(cmd, err)
+		}
+		return wsResponse{ID: cmd.ID, OK: true, Key: cmd.Key}
+
+	case wsOpEvict:
+		_, err := c.s.cache.Evict(ctx, cmd.Key)
+		if err == nil || errors.Is(err, cache.ErrKeyNotFound) {
+			c.s.broadcastEvict(cmd.Key)
+		}
+		if err != nil {
+			return wsCacheFail(cmd, err)
+		}
+		return wsResponse{ID: cmd.ID, OK: true, Key: cmd.Key}
+
+	case wsOpWatch:
+		return c.watch(cmd)
+
+	default: // wsOpUnwatch
+		c.mu.Lock()
+		sub, ok := c.watches[cmd.ID]
+		c.mu.Unlock()
+		if !ok {
+			return wsFail(cmd, http.StatusNotFound, codeInvalidCommand, "no watch with this id")
+		}
+		sub.Close()
+		return wsResponse{ID: cmd.ID, OK: true}
+	}
+}
+
+// wsOpScopes — право, необходимое для каждой операции.
+var wsOpScopes = map[string]Scope{
+	wsOpGet:     ScopeRead,
+	wsOpPut:     ScopeWrite,
+	wsOpEvict:   ScopeDelete,
+	wsOpWatch:   ScopeRead,
+	wsOpUnwatch: ScopeRead,
+}
+
+// watch подписывает соединение на изменения ключей с префиксом cmd.Prefix.
+// События приходят с ID команды watch; подписка отменяется командой unwatch
+// с тем же ID.
+func (c *wsConn) watch(cmd wsCommand) wsResponse {
+	if c.principal != nil && !c.principal.AllowsKey(cmd.Prefix) {
+		return wsFail(cmd, http.StatusForbidden, codeForbidden, "watching this prefix is not allowed")
+	}
+
+	c.mu.Lock()
+	switch _, exists := c.watches[cmd.ID]; {
+	case c.closed:
+		c.mu.Unlock()
+		return wsFail(cmd, http.StatusServiceUnavailable, codeInvalidCommand, "connection is closing")
+	case exists:
+		c.mu.Unlock()
+		return wsFail(cmd, http.StatusConflict, codeInvalidCommand, "watch with this id already exists")
+	case len(c.watches) >= wsMaxWatches:
+		c.mu.Unlock()
+		return wsFail(cmd, http.StatusTooManyRequests, codeInvalidCommand, "too many watches on this connection")
+	}
+	sub := c.s.events.Subscribe(cmd.Prefix, watchBufferSize)
+	c.watches[cmd.ID] = sub
+	c.mu.Unlock()
+
+	// Подтверждение ставится в очередь до первого события подписки.
+	c.send(wsResponse{ID: cmd.ID, OK: true})
+
+	for ev := range sub.Events() {
+		if ev.Key != "" && c.principal != nil && !c.principal.AllowsKey(ev.Key) {
+			continue
+		}
+		c.send(wsResponse{ID: cmd.ID, OK: true, Event: &ev})
+	}
+
+	c.mu.Lock()
+	delete(c.watches, cmd.ID)
+	c.mu.Unlock()
+
+	if errors.Is(sub.Err(), cache.ErrSubscriberTooSlow) {
+		c.logger.Warn("WebSocket watch dropped",
+			slog.String("watch_id", cmd.ID),
+			slog.String("prefix", cmd.Prefix),
+		)
+		return wsFail(cmd, http.StatusServiceUnavailable, codeSubscriberTooSlow, sub.Err().Error())
+	}
+	// Подписка отменена клиентом или соединение закрывается.
+	return wsResponse{ID: cmd.ID, OK: true, Event: &cache.Event{Type: wsEventUnwatched}}
+}
+
+// wsEventUnwatched завершает поток событий подписки, отменённой клиентом.
+const wsEventUnwatched cache.EventType = "unwatched"
+
+// closeWatches отменяет все подписки соединения.
+func (c *wsConn) closeWatches() {
+	c.mu.Lock()
+	c.closed = true
+	subs := make([]*cache.Subscription, 0, len(c.watches))
+	for _, sub := range c.watches {
+		subs = append(subs, sub)
+	}
+	c.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+}
+
+func wsFail(cmd wsCommand, status int, code, detail string) wsResponse {
+	return wsResponse{ID: cmd.ID, Key: cmd.Key, Error: &wsError{Status: status, Code: code, Detail: detail}}
+}
+
+func wsCacheFail(cmd wsCommand, err error) wsResponse {
+	status, code, detail := cacheErrorStatus(err)
+	return wsFail(cmd, status, code, detail)
+}
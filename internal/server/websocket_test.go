@@ -0,0 +1,133 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+func dialWS(t *testing.T, srv *Server, header http.Header) *websocket.Conn {
+	t.Helper()
+	ts := httptest.NewServer(srv.httpServer.Handler)
+	t.Cleanup(ts.Close)
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/api/lru/_ws", header)
+	require.NoError(t, err)
+	resp.Body.Close()
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// readResponses читает n кадров и раскладывает их по ID.
+func readResponses(t *testing.T, conn *websocket.Conn, n int) map[string]wsResponse {
+	t.Helper()
+	got := make(map[string]wsResponse, n)
+	for i := 0; i < n; i++ {
+		var resp wsResponse
+		require.NoError(t, conn.ReadJSON(&resp))
+		got[resp.ID] = resp
+	}
+	return got
+}
+
+func TestWebSocketPipelining(t *testing.T) {
+	srv := NewServer("localhost:0", 100, time.Minute)
+	conn := dialWS(t, srv, nil)
+
+	const n = 50
+	for i := 0; i < n; i++ {
+		key := "k" + strconv.Itoa(i)
+		require.NoError(t, conn.WriteJSON(wsCommand{ID: "put-" + key, Op: wsOpPut, Key: key, Value: key}))
+	}
+	for id, resp := range readResponses(t, conn, n) {
+		assert.True(t, resp.OK, id)
+	}
+
+	for i := 0; i < n; i++ {
+		key := "k" + strconv.Itoa(i)
+		require.NoError(t, conn.WriteJSON(wsCommand{ID: "get-" + key, Op: wsOpGet, Key: key}))
+	}
+	require.NoError(t, conn.WriteJSON(wsCommand{ID: "missing", Op: wsOpGet, Key: "nope"}))
+	require.NoError(t, conn.WriteJSON(wsCommand{ID: "bad", Op: "increment", Key: "k1"}))
+
+	got := readResponses(t, conn, n+2)
+	for i := 0; i < n; i++ {
+		key := "k" + strconv.Itoa(i)
+		resp := got["get-"+key]
+		assert.True(t, resp.OK, key)
+		assert.Equal(t, key, resp.Value)
+	}
+	require.NotNil(t, got["missing"].Error)
+	assert.Equal(t, codeKeyNotFound, got["missing"].Error.Code)
+	assert.Equal(t, http.StatusNotFound, got["missing"].Error.Status)
+	require.NotNil(t, got["bad"].Error)
+	assert.Equal(t, codeInvalidCommand, got["bad"].Error.Code)
+}
+
+func TestWebSocketWatch(t *testing.T) {
+	srv := NewServer("localhost:0", 100, time.Minute)
+	conn := dialWS(t, srv, nil)
+
+	require.NoError(t, conn.WriteJSON(wsCommand{ID: "w", Op: wsOpWatch, Prefix: "user:"}))
+	var ack wsResponse
+	require.NoError(t, conn.ReadJSON(&ack))
+	assert.Equal(t, wsResponse{ID: "w", OK: true}, ack)
+
+	require.NoError(t, conn.WriteJSON(wsCommand{ID: "p1", Op: wsOpPut, Key: "order:1", Value: 1}))
+	require.NoError(t, conn.WriteJSON(wsCommand{ID: "p2", Op: wsOpPut, Key: "user:1", Value: 1}))
+
+	var events []cache.Event
+	acks := 0
+	for acks < 2 || len(events) < 1 {
+		var resp wsResponse
+		require.NoError(t, conn.ReadJSON(&resp))
+		if resp.ID == "w" {
+			require.NotNil(t, resp.Event)
+			events = append(events, *resp.Event)
+			continue
+		}
+		acks++
+	}
+	require.Len(t, events, 1)
+	assert.Equal(t, cache.EventPut, events[0].Type)
+	assert.Equal(t, "user:1", events[0].Key)
+
+	require.NoError(t, conn.WriteJSON(wsCommand{ID: "w", Op: wsOpUnwatch}))
+	got := readResponses(t, conn, 1)
+	assert.True(t, got["w"].OK)
+	assert.Eventually(t, func() bool { return srv.events.Subscribers() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestWebSocketScopes(t *testing.T) {
+	a, err := LoadAuthFile(writeAuthFile(t, `{"keys": [
+		{"id": "reader", "token": "read-token", "scopes": ["read"], "key_prefixes": ["user:"]}
+	]}`))
+	require.NoError(t, err)
+	srv := NewServer("localhost:0", 10, time.Minute, WithAuthenticator(a))
+
+	ts := httptest.NewServer(srv.httpServer.Handler)
+	defer ts.Close()
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/api/lru/_ws", nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	conn := dialWS(t, srv, http.Header{"Authorization": {"Bearer read-token"}})
+	require.NoError(t, conn.WriteJSON(wsCommand{ID: "put", Op: wsOpPut, Key: "user:1", Value: 1}))
+	require.NoError(t, conn.WriteJSON(wsCommand{ID: "get", Op: wsOpGet, Key: "order:1"}))
+
+	got := readResponses(t, conn, 2)
+	require.NotNil(t, got["put"].Error)
+	assert.Equal(t, codeForbidden, got["put"].Error.Code)
+	require.NotNil(t, got["get"].Error)
+	assert.Equal(t, codeForbidden, got["get"].Error.Code)
+}
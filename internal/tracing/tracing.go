@@ -0,0 +1,123 @@
+// Package tracing настраивает OpenTelemetry: экспортёр трейсов, сэмплирование
+// и W3C trace-context propagation.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Поддерживаемые экспортёры.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+)
+
+// Options описывает настройки трассировки.
+type Options struct {
+	// Exporter — один из ExporterNone, ExporterStdout, ExporterFile, ExporterOTLP.
+	Exporter string
+	// FilePath — файл, куда пишутся спаны при Exporter == ExporterFile.
+	FilePath string
+	// OTLPEndpoint — host:port OTLP/HTTP-коллектора. Пустое значение означает
+	// значение по умолчанию или OTEL_EXPORTER_OTLP_ENDPOINT.
+	OTLPEndpoint string
+	// OTLPInsecure отключает TLS при отправке в коллектор.
+	OTLPInsecure bool
+	// SampleRatio — доля трассируемых корневых запросов, от 0 до 1.
+	SampleRatio float64
+	// ServiceName — значение атрибута service.name.
+	ServiceName string
+}
+
+// ShutdownFunc сбрасывает накопленные спаны и останавливает экспортёр.
+type ShutdownFunc func(ctx context.Context) error
+
+// Setup устанавливает глобальные TracerProvider и propagator.
+// При Exporter == ExporterNone устанавливается только propagator, чтобы
+// входящий trace-context всё равно передавался дальше.
+func Setup(ctx context.Context, opts Options) (ShutdownFunc, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var (
+		exporter sdktrace.SpanExporter
+		closer   io.Closer
+		err      error
+	)
+	switch opts.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		if opts.FilePath == "" {
+			return nil, errors.New("tracing file exporter requires a file path")
+		}
+		f, ferr := os.OpenFile(opts.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if ferr != nil {
+			return nil, fmt.Errorf("open tracing file: %w", ferr)
+		}
+		closer = f
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	case ExporterOTLP:
+		var clientOpts []otlptracehttp.Option
+		if opts.OTLPEndpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpoint(opts.OTLPEndpoint))
+		}
+		if opts.OTLPInsecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, clientOpts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		if closer != nil {
+			closer.Close()
+		}
+		return nil, fmt.Errorf("create %s exporter: %w", opts.Exporter, err)
+	}
+
+	serviceName := opts.ServiceName
+	if serviceName == "" {
+		serviceName = "lru-cache-service"
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("build tracing resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closer != nil {
+			err = errors.Join(err, closer.Close())
+		}
+		return err
+	}, nil
+}
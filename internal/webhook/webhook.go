@@ -0,0 +1,393 @@
+// Package webhook доставляет события кэша во внешние системы HTTP-запросами
+// с подписью HMAC, повторными попытками и ограниченной очередью.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// Заголовки запроса с событием.
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	// HeaderSignature содержит "sha256=" и hex HMAC-SHA256 от строки
+	// "<timestamp>.<тело запроса>", вычисленный на секрете получателя.
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// subscriptionBuffer — буфер подписки диспетчера на шину событий. Диспетчер
+// только перекладывает события в очередь, поэтому буфер нужен лишь на всплески.
+const subscriptionBuffer = 4096
+
+// Endpoint описывает получателя событий.
+type Endpoint struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+	// KeyPrefixes ограничивает события ключами с этими префиксами; пустой список — все ключи.
+	KeyPrefixes []string `json:"key_prefixes,omitempty"`
+	// Events — типы событий; по умолчанию expire и evict.
+	Events []cache.EventType `json:"events,omitempty"`
+}
+
+// file описывает формат файла с настройками вебхуков.
+type file struct {
+	Webhooks []Endpoint `json:"webhooks"`
+}
+
+// LoadFile читает список получателей из JSON-файла.
+func LoadFile(path string) ([]Endpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read webhooks file: %w", err)
+	}
+
+	var f file
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parse webhooks file: %w", err)
+	}
+
+	for i, e := range f.Webhooks {
+		u, err := url.Parse(e.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook #%d: url must be an absolute http or https URL", i)
+		}
+		if e.Secret == "" {
+			return nil, fmt.Errorf("webhook %q: missing secret", e.URL)
+		}
+		for _, typ := range e.Events {
+			switch typ {
+			case cache.EventPut, cache.EventUpdate, cache.EventEvict, cache.EventExpire, cache.EventClear:
+			default:
+				return nil, fmt.Errorf("webhook %q: unknown event type %q", e.URL, typ)
+			}
+		}
+	}
+	return f.Webhooks, nil
+}
+
+// Options описывает параметры доставки.
+type Options struct {
+	Endpoints []Endpoint
+	// QueueSize ограничивает число недоставленных событий, включая ожидающие
+	// повтора; при переполнении новые события отбрасываются.
+	QueueSize int
+	// Workers — число одновременных доставок.
+	Workers int
+	// MaxAttempts — сколько раз пытаться доставить событие.
+	MaxAttempts int
+	// InitialBackoff и MaxBackoff задают экспоненциальную паузу между попытками.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Timeout ограничивает одну попытку доставки.
+	Timeout time.Duration
+	// Client позволяет подменить HTTP-клиент (например, в тестах).
+	Client *http.Client
+}
+
+// Payload — тело запроса с событием.
+type Payload struct {
+	ID     string          `json:"id"`
+	Type   cache.EventType `json:"type"`
+	Key    string          `json:"key,omitempty"`
+	Reason string          `json:"reason,omitempty"`
+	Time   time.Time       `json:"time"`
+}
+
+// delivery — событие для конкретного получателя.
+type delivery struct {
+	endpoint *Endpoint
+	payload  Payload
+	body     []byte
+	attempt  int
+}
+
+// Dispatcher отбирает события из шины кэша и доставляет их получателям.
+type Dispatcher struct {
+	opts   Options
+	client *http.Client
+
+	queue chan *delivery
+	// pending — число принятых, но ещё не завершённых доставок.
+	pending atomic.Int64
+	dropped atomic.Int64
+}
+
+// New создаёт диспетчер. Доставка начинается после вызова Run.
+func New(opts Options) *Dispatcher {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1000
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 8
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Minute
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	opts.Endpoints = append([]Endpoint(nil), opts.Endpoints...)
+	for i := range opts.Endpoints {
+		if len(opts.Endpoints[i].Events) == 0 {
+			opts.Endpoints[i].Events = []cache.EventType{cache.EventExpire, cache.EventEvict}
+		}
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	return &Dispatcher{
+		opts:   opts,
+		client: client,
+		// Ёмкость канала равна лимиту pending, поэтому постановка в очередь никогда не блокируется.
+		queue: make(chan *delivery, opts.QueueSize),
+	}
+}
+
+// Dropped возвращает число событий, отброшенных из-за переполнения очереди
+// или исчерпания попыток.
+func (d *Dispatcher) Dropped() int64 {
+	return d.dropped.Load()
+}
+
+// Run подписывается на bus и доставляет события, пока не отменён ctx.
+// Недоставленные к этому моменту события теряются.
+func (d *Dispatcher) Run(ctx context.Context, bus *cache.EventBus) {
+	var wg sync.WaitGroup
+	for i := 0; i < d.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+	defer wg.Wait()
+
+	for {
+		sub := bus.Subscribe("", subscriptionBuffer)
+		if !d.consume(ctx, sub) {
+			sub.Close()
+			return
+		}
+		slog.Error("Webhook dispatcher fell behind cache events, resubscribing",
+			slog.Any("error", sub.Err()),
+		)
+	}
+}
+
+// consume перекладывает события подписки в очередь. Возвращает false,
+// если ctx отменён, и true, если шина закрыла подписку.
+func (d *Dispatcher) consume(ctx context.Context, sub *cache.Subscription) bool {
+	for {
+		select {
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return true
+			}
+			d.dispatch(ev)
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// dispatch ставит событие в очередь для каждого подходящего получателя.
+func (d *Dispatcher) dispatch(ev cache.Event) {
+	for i := range d.opts.Endpoints {
+		e := &d.opts.Endpoints[i]
+		if !e.matches(ev) {
+			continue
+		}
+
+		p := Payload{ID: newID(), Type: ev.Type, Key: ev.Key, Reason: ev.Reason, Time: ev.Time}
+		body, err := json.Marshal(p)
+		if err != nil {
+			slog.Error("Failed to encode webhook payload", slog.String("error", err.Error()))
+			continue
+		}
+
+		if d.pending.Add(1) > int64(d.opts.QueueSize) {
+			d.pending.Add(-1)
+			d.dropped.Add(1)
+			slog.Warn("Webhook queue is full, dropping event",
+				slog.String("url", e.URL),
+				slog.String("type", string(ev.Type)),
+				slog.String("key", ev.Key),
+			)
+			continue
+		}
+		d.queue <- &delivery{endpoint: e, payload: p, body: body}
+	}
+}
+
+func (e *Endpoint) matches(ev cache.Event) bool {
+	typeOK := false
+	for _, typ := range e.Events {
+		if typ == ev.Type {
+			typeOK = true
+			break
+		}
+	}
+	if !typeOK {
+		return false
+	}
+	if len(e.KeyPrefixes) == 0 || ev.Type == cache.EventClear {
+		return true
+	}
+	for _, prefix := range e.KeyPrefixes {
+		if strings.HasPrefix(ev.Key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// work выполняет доставки из очереди.
+func (d *Dispatcher) work(ctx context.Context) {
+	for {
+		select {
+		case dl := <-d.queue:
+			d.attempt(ctx, dl)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// attempt выполняет одну попытку доставки и при временной ошибке планирует повтор.
+func (d *Dispatcher) attempt(ctx context.Context, dl *delivery) {
+	dl.attempt++
+	err := d.send(ctx, dl)
+	if err == nil {
+		d.pending.Add(-1)
+		return
+	}
+
+	logger := slog.With(
+		slog.String("url", dl.endpoint.URL),
+		slog.String("id", dl.payload.ID),
+		slog.String("type", string(dl.payload.Type)),
+		slog.String("key", dl.payload.Key),
+		slog.Int("attempt", dl.attempt),
+		slog.String("error", err.Error()),
+	)
+
+	var perm *permanentError
+	if errors.As(err, &perm) || dl.attempt >= d.opts.MaxAttempts || ctx.Err() != nil {
+		d.pending.Add(-1)
+		d.dropped.Add(1)
+		logger.Error("Webhook delivery failed, giving up")
+		return
+	}
+
+	delay := d.backoff(dl.attempt)
+	logger.Warn("Webhook delivery failed, will retry", slog.Duration("retry_in", delay))
+	time.AfterFunc(delay, func() {
+		d.queue <- dl
+	})
+}
+
+// backoff возвращает паузу перед попыткой attempt+1: экспонента с джиттером ±50%.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.opts.InitialBackoff
+	for i := 1; i < attempt && delay < d.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.opts.MaxBackoff {
+		delay = d.opts.MaxBackoff
+	}
+	return delay/2 + time.Duration(mathrand.Int64N(int64(delay)))
+}
+
+// permanentError — ошибка, при которой повтор бессмыслен.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// send отправляет событие. Ответы 2xx считаются успехом, 408, 429 и 5xx —
+// временной ошибкой, остальные — постоянной.
+func (d *Dispatcher) send(ctx context.Context, dl *delivery) error {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.endpoint.URL, bytes.NewReader(dl.body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "lru-cache-service-webhook")
+	req.Header.Set(HeaderID, dl.payload.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(dl.endpoint.Secret, timestamp, dl.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= 500:
+		return fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	default:
+		return &permanentError{err: fmt.Errorf("receiver responded with status %d", resp.StatusCode)}
+	}
+}
+
+// Sign вычисляет значение заголовка HeaderSignature. Получатель должен
+// вычислить его сам и сравнить с присланным через hmac.Equal.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newID генерирует идентификатор события, по которому получатель может
+// отбрасывать повторные доставки.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
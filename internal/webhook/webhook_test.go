@@ -0,0 +1,205 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/titoffon/lru-cache-service/pkg/cache"
+)
+
+// receiver — тестовый получатель, проверяющий подпись и запоминающий события.
+type receiver struct {
+	t      *testing.T
+	secret string
+	// fail — сколько первых запросов завершить с ошибкой status.
+	fail   atomic.Int32
+	status int
+
+	mu       sync.Mutex
+	payloads []Payload
+	attempts atomic.Int32
+}
+
+func (rv *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rv.attempts.Add(1)
+	body, _ := io.ReadAll(r.Body)
+
+	want := Sign(rv.secret, r.Header.Get(HeaderTimestamp), body)
+	if !hmac.Equal([]byte(want), []byte(r.Header.Get(HeaderSignature))) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if rv.fail.Add(-1) >= 0 {
+		w.WriteHeader(rv.status)
+		return
+	}
+
+	var p Payload
+	assert.NoError(rv.t, json.Unmarshal(body, &p))
+	assert.Equal(rv.t, p.ID, r.Header.Get(HeaderID))
+	rv.mu.Lock()
+	rv.payloads = append(rv.payloads, p)
+	rv.mu.Unlock()
+}
+
+func (rv *receiver) received() []Payload {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	return append([]Payload(nil), rv.payloads...)
+}
+
+func startDispatcher(t *testing.T, opts Options) (*Dispatcher, cache.ILRUCache) {
+	t.Helper()
+	bus := cache.NewEventBus()
+	c := cache.NewLRUCache(10, time.Minute, cache.WithEventBus(bus))
+
+	opts.InitialBackoff = 10 * time.Millisecond
+	opts.MaxBackoff = 20 * time.Millisecond
+	d := New(opts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx, bus)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	require.Eventually(t, func() bool { return bus.Subscribers() == 1 }, time.Second, time.Millisecond)
+	return d, c
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	rv := &receiver{t: t, secret: "s3cret"}
+	ts := httptest.NewServer(rv)
+	defer ts.Close()
+
+	_, c := startDispatcher(t, Options{Endpoints: []Endpoint{
+		{URL: ts.URL, Secret: "s3cret", KeyPrefixes: []string{"job:"}},
+	}})
+	ctx := context.Background()
+
+	require.NoError(t, c.Put(ctx, "job:1", 1, 10*time.Millisecond))
+	require.NoError(t, c.Put(ctx, "job:2", 1, 0))
+	require.NoError(t, c.Put(ctx, "user:1", 1, 0))
+	time.Sleep(20 * time.Millisecond)
+	c.(cache.ExpirySweeper).DeleteExpired(ctx)
+	_, err := c.Evict(ctx, "job:2")
+	require.NoError(t, err)
+	_, err = c.Evict(ctx, "user:1")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return len(rv.received()) == 2 }, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	got := map[string]cache.EventType{}
+	for _, p := range rv.received() {
+		got[p.Key] = p.Type
+	}
+	assert.Equal(t, map[string]cache.EventType{"job:1": cache.EventExpire, "job:2": cache.EventEvict}, got,
+		"put events and keys outside of prefixes must not be delivered")
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	rv := &receiver{t: t, secret: "s", status: http.StatusServiceUnavailable}
+	rv.fail.Store(2)
+	ts := httptest.NewServer(rv)
+	defer ts.Close()
+
+	d, c := startDispatcher(t, Options{Endpoints: []Endpoint{{URL: ts.URL, Secret: "s"}}})
+	_ = c.Put(context.Background(), "k", 1, 0)
+	_, err := c.Evict(context.Background(), "k")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return len(rv.received()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(3), rv.attempts.Load())
+	assert.Zero(t, d.Dropped())
+}
+
+func TestDispatcherGivesUp(t *testing.T) {
+	t.Run("Permanent error", func(t *testing.T) {
+		rv := &receiver{t: t, secret: "s", status: http.StatusBadRequest}
+		rv.fail.Store(100)
+		ts := httptest.NewServer(rv)
+		defer ts.Close()
+
+		d, c := startDispatcher(t, Options{Endpoints: []Endpoint{{URL: ts.URL, Secret: "s"}}})
+		_ = c.Put(context.Background(), "k", 1, 0)
+		_, _ = c.Evict(context.Background(), "k")
+
+		require.Eventually(t, func() bool { return d.Dropped() == 1 }, time.Second, 5*time.Millisecond)
+		assert.Equal(t, int32(1), rv.attempts.Load(), "4xx responses must not be retried")
+	})
+
+	t.Run("Attempts exhausted", func(t *testing.T) {
+		rv := &receiver{t: t, secret: "s", status: http.StatusInternalServerError}
+		rv.fail.Store(100)
+		ts := httptest.NewServer(rv)
+		defer ts.Close()
+
+		d, c := startDispatcher(t, Options{Endpoints: []Endpoint{{URL: ts.URL, Secret: "s"}}, MaxAttempts: 3})
+		_ = c.Put(context.Background(), "k", 1, 0)
+		_, _ = c.Evict(context.Background(), "k")
+
+		require.Eventually(t, func() bool { return d.Dropped() == 1 }, time.Second, 5*time.Millisecond)
+		assert.Equal(t, int32(3), rv.attempts.Load())
+	})
+}
+
+func TestDispatcherBoundedQueue(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	d, c := startDispatcher(t, Options{Endpoints: []Endpoint{{URL: ts.URL, Secret: "s"}}, QueueSize: 2, Workers: 1})
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		_ = c.Put(ctx, key, 1, 0)
+		_, _ = c.Evict(ctx, key)
+	}
+
+	require.Eventually(t, func() bool { return d.Dropped() == 2 }, time.Second, 5*time.Millisecond)
+}
+
+func TestLoadFile(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "webhooks.json")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	endpoints, err := LoadFile(write(`{"webhooks": [
+		{"url": "https://example.com/hook", "secret": "s", "key_prefixes": ["job:"], "events": ["expire"]}
+	]}`))
+	require.NoError(t, err)
+	require.Len(t, endpoints, 1)
+	assert.Equal(t, []cache.EventType{cache.EventExpire}, endpoints[0].Events)
+
+	for _, content := range []string{
+		`{"webhooks": [{"url": "example.com", "secret": "s"}]}`,
+		`{"webhooks": [{"url": "https://example.com", "secret": ""}]}`,
+		`{"webhooks": [{"url": "https://example.com", "secret": "s", "events": ["touch"]}]}`,
+		`{"hooks": []}`,
+	} {
+		_, err := LoadFile(write(content))
+		assert.Error(t, err, content)
+	}
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"cmp"
+	"context"
+	"math/bits"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// accessStripeSize — сколько обращений копит одна полоса буфера, прежде чем
+// читатель попытается применить их к списку LRU.
+const accessStripeSize = 64
+
+// access — обращение к записи, ещё не отражённое в порядке LRU.
+type access struct {
+	seq  uint64
+	node *ListNode
+}
+
+// accessStripe — полоса буфера обращений. Выравнивание до размера строки
+// кэша не даёт соседним полосам мешать друг другу.
+type accessStripe struct {
+	mu      sync.Mutex
+	n       int
+	entries [accessStripeSize]access
+	_       [64]byte
+}
+
+// accessLog копит обращения Get, сделанные под разделяемой блокировкой, чтобы
+// перемещение записей в начало списка выполнялось пачкой под эксклюзивной.
+// Читатели пишут в случайную полосу, поэтому почти не конкурируют между собой.
+// Номер обращения сохраняет их порядок: при применении пачки записи встают
+// в начало списка в той же очерёдности, в какой их читали.
+//
+// Буфер ограничен: если полоса заполнена, а эксклюзивную блокировку сразу
+// взять не удалось, обращение теряется и запись не поднимается в начало
+// списка. Так под высокой нагрузкой порядок вытеснения становится
+// приближённым, но чтение никогда не ждёт писателей ради учёта обращений.
+type accessLog struct {
+	seq     atomic.Uint64
+	mask    uint32
+	stripes []accessStripe
+}
+
+func newAccessLog() *accessLog {
+	// Полос не меньше, чем потоков, выполняющих Go-код, с округлением до степени двойки.
+	n := 1 << bits.Len(uint(runtime.GOMAXPROCS(0)-1))
+	if n < 4 {
+		n = 4
+	}
+	return &accessLog{mask: uint32(n - 1), stripes: make([]accessStripe, n)}
+}
+
+// record запоминает обращение к node и сообщает, что полоса заполнена и
+// накопленные обращения пора применить.
+func (l *accessLog) record(node *ListNode) bool {
+	seq := l.seq.Add(1)
+	s := &l.stripes[rand.Uint32()&l.mask]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.n == accessStripeSize {
+		return true
+	}
+	s.entries[s.n] = access{seq: seq, node: node}
+	s.n++
+	return s.n == accessStripeSize
+}
+
+// pending сообщает, есть ли неприменённые обращения.
+func (l *accessLog) pending() bool {
+	for i := range l.stripes {
+		s := &l.stripes[i]
+		s.mu.Lock()
+		n := s.n
+		s.mu.Unlock()
+		if n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// drain забирает накопленные обращения в buf в порядке их совершения.
+func (l *accessLog) drain(buf []access) []access {
+	for i := range l.stripes {
+		s := &l.stripes[i]
+		s.mu.Lock()
+		buf = append(buf, s.entries[:s.n]...)
+		clear(s.entries[:s.n])
+		s.n = 0
+		s.mu.Unlock()
+	}
+	slices.SortFunc(buf, func(a, b access) int { return cmp.Compare(a.seq, b.seq) })
+	return buf
+}
+
+// applyAccesses переносит в начало списка записи, к которым обращались с
+// прошлого применения. Записи, удалённые за это время, пропускаются.
+// Вызывается под эксклюзивной блокировкой.
+func (c *LRUCache) applyAccesses() {
+	c.accessBuf = c.accesses.drain(c.accessBuf[:0])
+	for i, a := range c.accessBuf {
+		if c.cache[a.node.data.key] == a.node {
+			c.moveToFront(a.node)
+		}
+		c.accessBuf[i].node = nil
+	}
+}
+
+// flushAccesses применяет накопленные обращения, если они есть. Вызывается
+// перед операциями только для чтения, которым важен порядок LRU.
+func (c *LRUCache) flushAccesses(ctx context.Context) {
+	if !c.accesses.pending() {
+		return
+	}
+	c.lock(ctx)
+	c.mu.Unlock()
+}
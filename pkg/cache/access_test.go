@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkList проверяет целостность списка LRU и его соответствие map.
+func checkList(t *testing.T, c *LRUCache) {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	var prev *ListNode
+	for node := c.right; node != nil; node = node.next {
+		require.Equal(t, prev, node.prev, "broken prev link at %q", node.data.key)
+		require.Equal(t, node, c.cache[node.data.key], "node %q is not in the map", node.data.key)
+		prev = node
+		n++
+		require.LessOrEqual(t, n, len(c.cache), "list has a cycle")
+	}
+	require.Equal(t, prev, c.left)
+	require.Equal(t, len(c.cache), n)
+	require.LessOrEqual(t, n, c.capacity)
+}
+
+func TestBufferedAccessesKeepLRUOrder(t *testing.T) {
+	c := NewLRUCache(3, time.Minute).(*LRUCache)
+	ctx := context.Background()
+
+	for _, k := range []string{"a", "b", "c"} {
+		require.NoError(t, c.Put(ctx, k, k, 0))
+	}
+	for _, k := range []string{"a", "b"} {
+		_, _, err := c.Get(ctx, k)
+		require.NoError(t, err)
+	}
+	keys, _, err := c.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "a", "c"}, keys)
+
+	// Вытесняются сначала c, затем a: порядок обращений сохранён.
+	_, _, err = c.Get(ctx, "a")
+	require.NoError(t, err)
+	_, _, err = c.Get(ctx, "b")
+	require.NoError(t, err)
+	require.NoError(t, c.Put(ctx, "d", "d", 0))
+	require.NoError(t, c.Put(ctx, "e", "e", 0))
+	_, _, err = c.Get(ctx, "c")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, _, err = c.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	entries, err := c.Snapshot(ctx)
+	require.NoError(t, err)
+	var order []string
+	for _, e := range entries {
+		order = append(order, e.Key)
+	}
+	assert.Equal(t, []string{"b", "d", "e"}, order)
+	checkList(t, c)
+}
+
+func TestBufferedAccessToRemovedEntry(t *testing.T) {
+	c := NewLRUCache(2, time.Minute).(*LRUCache)
+	ctx := context.Background()
+
+	require.NoError(t, c.Put(ctx, "a", 1, 0))
+	require.NoError(t, c.Put(ctx, "b", 2, 0))
+	_, _, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	_, _, err = c.Get(ctx, "b")
+	require.NoError(t, err)
+
+	// Обращения к удалённой записи и к записи из прошлого наполнения не
+	// должны возвращать её узел в список.
+	c.mu.Lock()
+	node := c.cache["a"]
+	c.removeNode(node)
+	delete(c.cache, "a")
+	c.mu.Unlock()
+	c.accesses.record(node)
+
+	require.NoError(t, c.EvictAll(ctx))
+	require.NoError(t, c.Put(ctx, "a", 3, 0))
+	checkList(t, c)
+
+	v, _, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 3, v)
+	_, _, err = c.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestAccessLogDrainOrder(t *testing.T) {
+	l := newAccessLog()
+	nodes := make([]*ListNode, 3*accessStripeSize)
+	full := false
+	for i := range nodes {
+		nodes[i] = &ListNode{data: &item{key: strconv.Itoa(i)}}
+		full = l.record(nodes[i]) || full
+	}
+	assert.True(t, l.pending())
+
+	got := l.drain(nil)
+	assert.False(t, l.pending())
+	assert.LessOrEqual(t, len(got), len(nodes))
+	if !full {
+		assert.Len(t, got, len(nodes), "nothing is dropped until a stripe fills up")
+	}
+	for i := 1; i < len(got); i++ {
+		assert.Less(t, got[i-1].seq, got[i].seq)
+	}
+}
+
+// TestConcurrentAccessStress гоняет все операции параллельно; запускать с -race.
+func TestConcurrentAccessStress(t *testing.T) {
+	c := NewLRUCache(32, time.Minute, WithLoader(func(ctx context.Context, key string) (interface{}, error) {
+		return "refreshed", nil
+	})).(*LRUCache)
+	ctx := context.Background()
+
+	keys := make([]string, 64)
+	for i := range keys {
+		keys[i] = "k" + strconv.Itoa(i)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := keys[(g*31+i)%len(keys)]
+				switch i % 20 {
+				case 0:
+					_, _ = c.Evict(ctx, key)
+				case 1, 2:
+					assert.NoError(t, c.Put(ctx, key, i, time.Duration(1+i%5)*time.Millisecond))
+				case 3:
+					assert.NoError(t, c.PutStale(ctx, key, i, time.Millisecond, time.Minute))
+				case 4, 5, 6:
+					assert.NoError(t, c.Put(ctx, key, i, 0))
+				case 7:
+					_, _, err := c.GetAll(ctx)
+					assert.NoError(t, err)
+				case 8:
+					c.DeleteExpired(ctx)
+				case 9:
+					if i%200 == 9 {
+						assert.NoError(t, c.EvictAll(ctx))
+					}
+				default:
+					if _, _, err := c.Get(ctx, key); err != nil {
+						assert.ErrorIs(t, err, ErrKeyNotFound)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	checkList(t, c)
+}
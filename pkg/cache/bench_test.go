@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const benchKeys = 1024
+
+func benchCache(b *testing.B) (ILRUCache, []string) {
+	b.Helper()
+	c := NewLRUCache(benchKeys, time.Hour)
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+		if err := c.Put(context.Background(), keys[i], i, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return c, keys
+}
+
+// BenchmarkGetParallel — только попадания; запускать с -cpu=1,4,8.
+func BenchmarkGetParallel(b *testing.B) {
+	c, keys := benchCache(b)
+	ctx := context.Background()
+	var seed atomic.Uint32
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(seed.Add(1)) * 7919
+		for pb.Next() {
+			if _, _, err := c.Get(ctx, keys[i%benchKeys]); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
+
+// BenchmarkGetHotKeyParallel — все горутины читают один ключ.
+func BenchmarkGetHotKeyParallel(b *testing.B) {
+	c, keys := benchCache(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, _, err := c.Get(ctx, keys[0]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkMixedParallel — 90% чтений и 10% записей.
+func BenchmarkMixedParallel(b *testing.B) {
+	c, keys := benchCache(b)
+	ctx := context.Background()
+	var seed atomic.Uint32
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(seed.Add(1)) * 7919
+		for pb.Next() {
+			key := keys[i%benchKeys]
+			if i%10 == 0 {
+				if err := c.Put(ctx, key, i, 0); err != nil {
+					b.Fatal(err)
+				}
+			} else if _, _, err := c.Get(ctx, key); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
+
+// gcEntries — сколько записей держит кэш в бенчмарках сборки мусора.
+const gcEntries = 1 << 20
+
+// benchEngines перечисляет движки хранения для сравнительных бенчмарков.
+var benchEngines = []struct {
+	name string
+	new  func(capacity int) ILRUCache
+}{
+	{"lru", func(capacity int) ILRUCache { return NewLRUCache(capacity, time.Hour) }},
+	{"slab", func(capacity int) ILRUCache {
+		return NewSlabCache(capacity, time.Hour, SlabOptions{MaxBytes: 256 << 20})
+	}},
+}
+
+// BenchmarkGCPause измеряет полную сборку мусора при заполненном кэше:
+// ns/op — длительность runtime.GC, pause-ns/op — паузы stop-the-world,
+// heap-objects — число живых объектов в куче.
+func BenchmarkGCPause(b *testing.B) {
+	for _, engine := range benchEngines {
+		b.Run(engine.name, func(b *testing.B) {
+			c := engine.new(gcEntries)
+			ctx := context.Background()
+			for i := 0; i < gcEntries; i++ {
+				key := "key-" + strconv.Itoa(i)
+				if err := c.Put(ctx, key, "value-"+strconv.Itoa(i), 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+			runtime.GC()
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+			}
+			b.StopTimer()
+			runtime.ReadMemStats(&after)
+
+			b.ReportMetric(float64(after.PauseTotalNs-before.PauseTotalNs)/float64(b.N), "pause-ns/op")
+			b.ReportMetric(float64(after.HeapObjects), "heap-objects")
+			runtime.KeepAlive(c)
+		})
+	}
+}
+
+// BenchmarkEnginePut — перезапись существующих ключей строковыми значениями.
+func BenchmarkEnginePut(b *testing.B) {
+	for _, engine := range benchEngines {
+		b.Run(engine.name, func(b *testing.B) {
+			c := engine.new(benchKeys)
+			ctx := context.Background()
+			keys := make([]string, benchKeys)
+			for i := range keys {
+				keys[i] = "key-" + strconv.Itoa(i)
+			}
+			value := strings.Repeat("v", 100)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := c.Put(ctx, keys[i%benchKeys], value, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEngineGet — попадания по строковым значениям.
+func BenchmarkEngineGet(b *testing.B) {
+	for _, engine := range benchEngines {
+		b.Run(engine.name, func(b *testing.B) {
+			c := engine.new(benchKeys)
+			ctx := context.Background()
+			keys := make([]string, benchKeys)
+			value := strings.Repeat("v", 100)
+			for i := range keys {
+				keys[i] = "key-" + strconv.Itoa(i)
+				if err := c.Put(ctx, keys[i], value, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := c.Get(ctx, keys[i%benchKeys]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkTieredPutDemote — каждая запись вытесняет другую на диск. Запись
+// на диск идёт в фоне; Put ждёт её, только когда очередь переполнена.
+func BenchmarkTieredPutDemote(b *testing.B) {
+	l2, err := OpenDiskStore(DiskOptions{Dir: b.TempDir(), MaxBytes: 64 << 20})
+	if err != nil {
+		b.Fatal(err)
+	}
+	c := NewTieredCache(benchKeys, time.Hour, l2)
+	defer c.Close()
+	ctx := context.Background()
+	value := strings.Repeat("v", 100)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.Put(ctx, "key-"+strconv.Itoa(i), value, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -3,9 +3,12 @@ package cache
 
 import (
 	"context"
-	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 /*
@@ -15,7 +18,8 @@ ILRUCache описывает интерфейс LRU-кэша. Он поддер
 */
 type ILRUCache interface {
 	// Put добавляет или обновляет запись в кэше с заданным TTL.
-	// Если TTL <= 0, используется значение c.defaultTTL.
+	// Если TTL == 0, используется значение c.defaultTTL; отрицательный TTL даёт ErrInvalidTTL.
+	// Пустой ключ даёт ErrEmptyKey.
 	// При переполнении кэша (количество элементов >= capacity) удаляется LRU-элемент.
 	Put(ctx context.Context, key string, value interface{}, ttl time.Duration) error
 
@@ -35,16 +39,26 @@ type ILRUCache interface {
 	EvictAll(ctx context.Context) error 
 }
 
-// ErrKeyNotFound сигнализирует о том, что ключ не существует.
-var (
-	ErrKeyNotFound = errors.New("key not found")
-)
-
 // item хранит данные записи кэша.
 type item struct {
 	key       string
 	value     interface{}
 	expiresAt time.Time
+
+	// staleAt — момент истечения мягкого TTL; нулевое значение означает,
+	// что запись не устаревает до expiresAt.
+	staleAt time.Time
+	// softTTL и hardTTL запоминаются, чтобы фоновое обновление продлило
+	// запись на те же сроки.
+	softTTL time.Duration
+	hardTTL time.Duration
+	// gen меняется при каждой записи значения; по нему фоновое обновление
+	// понимает, что запись успели перезаписать.
+	gen uint64
+	// retryAt — раньше этого момента повторное обновление после ошибки не запускается.
+	retryAt time.Time
+	// demoted — порядковый номер вытеснения из L1 в TieredCache.
+	demoted uint64
 }
 
 // ListNode представляет узел двусвязного списка, используемого
@@ -61,41 +75,106 @@ type LRUCache struct {
 	mu			sync.RWMutex
     capacity 	int
     cache 		map[string]*ListNode
-	defaultTTL  time.Duration
+	// defaultTTL хранит time.Duration; атомарен, потому что читается и вне
+	// блокировки, а меняется через SetDefaultTTL.
+	defaultTTL  atomic.Int64
     left 		*ListNode // Least Recently Used
     right 		*ListNode // Most Recently Used
+
+	// compression — параметры сжатия значений; nil означает хранение как есть.
+	compression *CompressionOptions
+
+	// loader обновляет устаревшие записи в фоне; nil означает, что устаревшие
+	// значения отдаются без обновления до истечения жёсткого TTL.
+	loader Loader
+	// refreshing — ключи, для которых сейчас выполняется фоновое обновление.
+	refreshing map[string]struct{}
+	gen        uint64
+
+	// loads — выполняющиеся загрузки GetOrLoad; защищены своим мьютексом, а
+	// не mu, чтобы загрузка не блокировала остальные операции.
+	loads loadGroup
+
+	// accesses — попадания Get, ещё не применённые к порядку LRU; accessBuf —
+	// переиспользуемый буфер для их применения, защищён mu.
+	accesses  *accessLog
+	accessBuf []access
+
+	// events — шина событий об изменениях; nil означает, что события не публикуются.
+	events *EventBus
+
+	// demote получает записи, вытесненные из-за нехватки места, вместо
+	// события EventEvict; используется TieredCache. Вызывается под блокировкой.
+	demote func(it *item)
 }
 
 // NewLRUCache создаёт новый LRUCache с заданной ёмкостью (capacity)
 // и временем жизни по умолчанию (defaultTTL).
-func NewLRUCache(capacity int, defaultTTL time.Duration) ILRUCache {
-    return &LRUCache{
+func NewLRUCache(capacity int, defaultTTL time.Duration, opts ...Option) ILRUCache {
+    c := &LRUCache{
         capacity: capacity,
         cache: make(map[string]*ListNode, capacity),
-		defaultTTL: defaultTTL,
+		refreshing: make(map[string]struct{}),
+		accesses: newAccessLog(),
+	}
+	c.defaultTTL.Store(int64(defaultTTL))
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
 // Put добавляет или обновляет запись в кэше с указанным TTL.
 func (c *LRUCache) Put(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
-	c.mu.Lock()
+	if key == "" {
+		return ErrEmptyKey
+	}
+	if ttl < 0 {
+		return ErrInvalidTTL
+	}
+
+	return c.put(ctx, key, value, 0, ttl)
+}
+
+// put сохраняет запись; softTTL == 0 означает запись без мягкого TTL.
+func (c *LRUCache) put(ctx context.Context, key string, value interface{}, softTTL, ttl time.Duration) error {
+	ctx, span := startSpan(ctx, "LRUCache.Put", key)
+	defer span.End()
+
+	// Сжатие выполняется до захвата блокировки, чтобы не держать её на время работы gzip.
+	original := value
+	value = c.compress(value)
+
+	c.lock(ctx)
 	defer c.mu.Unlock()
 
-	if ttl <= 0 {
-		ttl = c.defaultTTL
+	if ttl == 0 {
+		ttl = c.DefaultTTL()
 	}
 
-	expiresAt := time.Now().Add(ttl)
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	var staleAt time.Time
+	if softTTL > 0 {
+		staleAt = now.Add(softTTL)
+	}
+	c.gen++
 
 	if node, ok := c.cache[key]; ok {
 		node.data.value = value
 		node.data.expiresAt = expiresAt
+		node.data.staleAt = staleAt
+		node.data.softTTL = softTTL
+		node.data.hardTTL = ttl
+		node.data.gen = c.gen
+		node.data.retryAt = time.Time{}
 		c.moveToFront(node)
+		c.publishValue(EventUpdate, node.data, ReasonPut, original)
 		return nil
 	}
 
 	if len(c.cache) >= c.capacity {
-		c.removeLeastUsed()
+		c.evictForCapacity(span)
 	}
 
 	newNode := &ListNode{
@@ -103,39 +182,104 @@ func (c *LRUCache) Put(ctx context.Context, key string, value interface{}, ttl t
 			key:       key,
 			value:     value,
 			expiresAt: expiresAt,
+			staleAt:   staleAt,
+			softTTL:   softTTL,
+			hardTTL:   ttl,
+			gen:       c.gen,
 		},
 	}
 	c.cache[key] = newNode
 	c.addToFront(newNode)
+	c.publishValue(EventPut, newNode.data, ReasonPut, original)
 
 	return nil
 }
 
 // Get возвращает значение и время истечения TTL для заданного ключа.
+// Устаревшие по мягкому TTL значения тоже возвращаются; отличить их позволяет GetStale.
 func (c *LRUCache) Get(ctx context.Context, key string) (interface{}, time.Time, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	value, expiresAt, _, err := c.get(ctx, key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	value, err = decompress(value)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return value, expiresAt, nil
+}
 
+// get возвращает значение в том виде, в каком оно хранится, и обновляет его позицию в LRU.
+// stale == true означает, что мягкий TTL записи истёк; в этом случае get
+// запускает фоновое обновление через loader.
+//
+// Попадание в свежую запись обходится разделяемой блокировкой: перемещение
+// в начало списка откладывается в буфер обращений (см. accessLog). Эксклюзивная
+// блокировка нужна только для удаления истёкшей записи и запуска обновления устаревшей.
+func (c *LRUCache) get(ctx context.Context, key string) (value interface{}, expiresAt time.Time, stale bool, err error) {
+	ctx, span := startSpan(ctx, "LRUCache.Get", key)
+	defer span.End()
+
+	c.rlock(ctx)
 	node, ok := c.cache[key]
 	if !ok {
-		return nil, time.Time{}, ErrKeyNotFound
+		c.mu.RUnlock()
+		span.SetAttributes(attribute.Bool("cache.hit", false))
+		return nil, time.Time{}, false, ErrKeyNotFound
+	}
+	now := time.Now()
+	if !now.After(node.data.expiresAt) && (node.data.staleAt.IsZero() || !now.After(node.data.staleAt)) {
+		value, expiresAt = node.data.value, node.data.expiresAt
+		full := c.accesses.record(node)
+		c.mu.RUnlock()
+		// Заполненную полосу применяет тот читатель, которому первым удалось
+		// взять блокировку без ожидания; остальные не ждут.
+		if full && c.mu.TryLock() {
+			c.applyAccesses()
+			c.mu.Unlock()
+		}
+		span.SetAttributes(attribute.Bool("cache.hit", true), attribute.Bool("cache.stale", false))
+		return value, expiresAt, false, nil
 	}
+	c.mu.RUnlock()
+
+	c.lock(ctx)
+	defer c.mu.Unlock()
 
-	if time.Now().After(node.data.expiresAt) {
+	// Пока блокировка была снята, запись могли удалить или перезаписать.
+	node, ok = c.cache[key]
+	if !ok {
+		span.SetAttributes(attribute.Bool("cache.hit", false))
+		return nil, time.Time{}, false, ErrKeyNotFound
+	}
+
+	now = time.Now()
+	if now.After(node.data.expiresAt) {
 		c.removeNode(node)
 		delete(c.cache, key)
-		return nil, time.Time{}, ErrKeyNotFound
+		c.publish(EventExpire, key, ReasonTTL)
+		span.SetAttributes(attribute.Bool("cache.hit", false), attribute.Bool("cache.expired", true))
+		return nil, time.Time{}, false, ErrKeyNotFound
 	}
 
 	c.moveToFront(node)
+	stale = !node.data.staleAt.IsZero() && now.After(node.data.staleAt)
+	span.SetAttributes(attribute.Bool("cache.hit", true), attribute.Bool("cache.stale", stale))
+	if stale {
+		c.startRefresh(ctx, node.data, now)
+	}
 
-	return node.data.value, node.data.expiresAt, nil
+	return node.data.value, node.data.expiresAt, stale, nil
 }
 
 // GetAll Получение всего текущего наполнения кэша в виде двух списков: списка ключей и списка значений.
 // Пары ключ-значение располагаются на соответствующих индексах.
 func (c *LRUCache) GetAll(ctx context.Context) ([]string, []interface{}, error) {
-	c.mu.RLock()
+	ctx, span := startSpan(ctx, "LRUCache.GetAll", "")
+	defer span.End()
+
+	c.flushAccesses(ctx)
+	c.rlock(ctx)
 	defer c.mu.RUnlock()
 
 	if len(c.cache) == 0 {
@@ -149,8 +293,12 @@ func (c *LRUCache) GetAll(ctx context.Context) ([]string, []interface{}, error)
 	for current != nil {
 
 		if time.Now().Before(current.data.expiresAt) {
+			value, err := decompress(current.data.value)
+			if err != nil {
+				return nil, nil, err
+			}
 			keys = append(keys, current.data.key)
-			values = append(values, current.data.value)
+			values = append(values, value)
 		}
 		current = current.next
 	}
@@ -160,7 +308,10 @@ func (c *LRUCache) GetAll(ctx context.Context) ([]string, []interface{}, error)
 
 // Evict удаляет элемент по ключу из кэша.
 func (c *LRUCache) Evict(ctx context.Context, key string) (interface{}, error) {
-	c.mu.Lock()
+	ctx, span := startSpan(ctx, "LRUCache.Evict", key)
+	defer span.End()
+
+	c.lock(ctx)
 	defer c.mu.Unlock()
 
 	node, ok := c.cache[key]
@@ -171,23 +322,64 @@ func (c *LRUCache) Evict(ctx context.Context, key string) (interface{}, error) {
 	val := node.data.value
 	c.removeNode(node)
 	delete(c.cache, key)
+	c.publish(EventEvict, key, ReasonDelete)
 
-	return val, nil
+	return decompress(val)
 }
 
 // EvictAll полностью очищает кэш.
 func (c *LRUCache) EvictAll(ctx context.Context) error {
-	c.mu.Lock()
+	ctx, span := startSpan(ctx, "LRUCache.EvictAll", "")
+	defer span.End()
+
+	c.lock(ctx)
 	defer c.mu.Unlock()
 
+	span.SetAttributes(attribute.Int("cache.evicted", len(c.cache)))
+
 	c.right = nil
 	c.left = nil
 	c.cache = make(map[string]*ListNode, c.capacity)
+	c.publish(EventClear, "", ReasonDelete)
 	return nil
 } 
 
 
 
+// ExpirySweeper реализуется кэшами, умеющими удалять истёкшие записи заранее,
+// не дожидаясь обращения к ним.
+type ExpirySweeper interface {
+	// DeleteExpired удаляет все записи с истёкшим TTL и возвращает их число.
+	DeleteExpired(ctx context.Context) int
+}
+
+// DeleteExpired удаляет все записи с истёкшим TTL, публикуя для каждой EventExpire.
+// Обходит весь список под эксклюзивной блокировкой, поэтому вызывать его стоит
+// периодически, а не на каждую операцию.
+func (c *LRUCache) DeleteExpired(ctx context.Context) int {
+	ctx, span := startSpan(ctx, "LRUCache.DeleteExpired", "")
+	defer span.End()
+
+	c.lock(ctx)
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for node := c.right; node != nil; {
+		next := node.next
+		if now.After(node.data.expiresAt) {
+			c.removeNode(node)
+			delete(c.cache, node.data.key)
+			c.publish(EventExpire, node.data.key, ReasonTTL)
+			removed++
+		}
+		node = next
+	}
+
+	span.SetAttributes(attribute.Int("cache.expired", removed))
+	return removed
+}
+
 // moveToFront перемещает заданный узел в начало очереди (right).
 func (c *LRUCache) moveToFront(node *ListNode){
 	
@@ -228,13 +420,31 @@ func (c *LRUCache) addToFront(node *ListNode){
 }
 
 // removeLeastUsed удаляет наиболее "старый" элемент (left) из списка и map.
-func (c *LRUCache) removeLeastUsed(){
+// Возвращает удалённую запись и false, если список пуст.
+func (c *LRUCache) removeLeastUsed() (*item, bool) {
 	if c.left == nil {
-		return
+		return nil, false
 	}
 	oldLeft := c.left
 	c.removeNode(oldLeft)
 	delete(c.cache, oldLeft.data.key)
+	return oldLeft.data, true
+}
+
+// evictForCapacity вытесняет LRU-запись, чтобы освободить место. Если задан
+// demote, запись передаётся ему вместо публикации события: она не исчезает
+// из кэша, а переходит на следующий уровень.
+func (c *LRUCache) evictForCapacity(span trace.Span) {
+	evicted, ok := c.removeLeastUsed()
+	if !ok {
+		return
+	}
+	recordEviction(span, evicted.key)
+	if c.demote != nil {
+		c.demote(evicted)
+		return
+	}
+	c.publish(EventEvict, evicted.key, ReasonCapacity)
 }
 
 
@@ -130,4 +130,15 @@ func TestEvictAll(t *testing.T) {
 
 	_, _, err = c.Get(ctx, "k3")
 	assert.Equal(t, ErrKeyNotFound, err, "k3 must be evicted")
-}
\ No newline at end of file
+}
+
+func TestPutInvalidArguments(t *testing.T) {
+	c := NewLRUCache(2, time.Second)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, c.Put(ctx, "", "value", 0), ErrEmptyKey)
+	assert.ErrorIs(t, c.Put(ctx, "key", "value", -time.Second), ErrInvalidTTL)
+
+	_, _, err := c.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrKeyNotFound, "rejected Put must not store anything")
+}
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// EncodingGzip — значение Content-Encoding для сжатых gzip данных.
+const EncodingGzip = "gzip"
+
+// CompressionOptions задаёт параметры сжатия значений внутри кэша.
+type CompressionOptions struct {
+	// Threshold — минимальный размер значения в байтах, начиная с которого оно сжимается.
+	Threshold int
+	// Level — уровень gzip (gzip.BestSpeed..gzip.BestCompression); 0 означает gzip.DefaultCompression.
+	Level int
+}
+
+// Option настраивает необязательные параметры LRUCache.
+type Option func(*LRUCache)
+
+// WithCompression включает прозрачное gzip-сжатие значений при Put
+// и распаковку при Get. Сжимаются строки, []byte, RawValue и документы
+// (map[string]interface{} и []interface{}); остальные значения хранятся как есть.
+// Документы сериализуются gob, поэтому типы вложенных значений (целые числа,
+// []byte) после распаковки те же, что при Put; документы с типами, которые gob
+// не знает, хранятся несжатыми. Сжатый вариант сохраняется, только если он
+// меньше исходного.
+func WithCompression(opts CompressionOptions) Option {
+	return func(c *LRUCache) {
+		if opts.Level == 0 {
+			opts.Level = gzip.DefaultCompression
+		}
+		c.compression = &opts
+	}
+}
+
+// CompressedValue — значение в том виде, в каком оно хранится в кэше.
+type CompressedValue struct {
+	// Encoding — алгоритм сжатия, сейчас всегда EncodingGzip.
+	Encoding string
+	// ContentType — тип содержимого для RawValue, пустой для остальных значений.
+	ContentType string
+	Data        []byte
+	// Stale сообщает, что мягкий TTL записи истёк (см. StaleCache).
+	Stale bool
+}
+
+// CompressedReader реализуется кэшами, которые умеют отдавать значение
+// без распаковки, например, чтобы передать его клиенту с Content-Encoding: gzip.
+type CompressedReader interface {
+	// GetCompressed возвращает сжатое значение по ключу. Если значение
+	// хранится несжатым, возвращается ErrNotCompressed.
+	GetCompressed(ctx context.Context, key string) (CompressedValue, time.Time, error)
+}
+
+// valueKind запоминает исходный тип сжатого значения, чтобы восстановить его при Get.
+type valueKind uint8
+
+const (
+	kindBytes valueKind = iota
+	kindString
+	kindRaw
+	// kindJSON — документ в JSON; так сжимали прежние версии, такие записи
+	// могут остаться на дисковом уровне.
+	kindJSON
+	kindGob
+)
+
+// gobDocument оборачивает документ: gob не кодирует interface{} на верхнем уровне.
+type gobDocument struct {
+	V interface{}
+}
+
+// compressed — сжатое представление значения внутри item.
+type compressed struct {
+	kind        valueKind
+	contentType string
+	data        []byte
+}
+
+// compress сжимает значение, если оно подходит по типу и размеру.
+// Иначе возвращает значение без изменений.
+func (c *LRUCache) compress(value interface{}) interface{} {
+	if c.compression == nil {
+		return value
+	}
+
+	var (
+		kind        valueKind
+		contentType string
+		plain       []byte
+	)
+	switch v := value.(type) {
+	case []byte:
+		kind, plain = kindBytes, v
+	case string:
+		kind, plain = kindString, []byte(v)
+	case RawValue:
+		kind, contentType, plain = kindRaw, v.ContentType, v.Data
+	case map[string]interface{}, []interface{}:
+		var doc bytes.Buffer
+		if err := gob.NewEncoder(&doc).Encode(gobDocument{V: v}); err != nil {
+			return value
+		}
+		kind, plain = kindGob, doc.Bytes()
+	default:
+		return value
+	}
+
+	if len(plain) < c.compression.Threshold {
+		return value
+	}
+
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, c.compression.Level)
+	if err != nil {
+		return value
+	}
+	if _, err := zw.Write(plain); err != nil {
+		return value
+	}
+	if err := zw.Close(); err != nil {
+		return value
+	}
+	if buf.Len() >= len(plain) {
+		return value
+	}
+
+	return &compressed{kind: kind, contentType: contentType, data: buf.Bytes()}
+}
+
+// decompress восстанавливает исходное значение; несжатые значения возвращаются как есть.
+func decompress(value interface{}) (interface{}, error) {
+	cv, ok := value.(*compressed)
+	if !ok {
+		return value, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(cv.data))
+	if err != nil {
+		return nil, fmt.Errorf("decompress value: %w", err)
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("decompress value: %w", err)
+	}
+
+	switch cv.kind {
+	case kindBytes:
+		return plain, nil
+	case kindString:
+		return string(plain), nil
+	case kindRaw:
+		return RawValue{ContentType: cv.contentType, Data: plain}, nil
+	case kindJSON:
+		var v interface{}
+		if err := json.Unmarshal(plain, &v); err != nil {
+			return nil, fmt.Errorf("decode decompressed value: %w", err)
+		}
+		return v, nil
+	case kindGob:
+		var doc gobDocument
+		if err := gob.NewDecoder(bytes.NewReader(plain)).Decode(&doc); err != nil {
+			return nil, fmt.Errorf("decode decompressed value: %w", err)
+		}
+		return doc.V, nil
+	default:
+		return nil, fmt.Errorf("unknown compressed value kind %d", cv.kind)
+	}
+}
+
+// GetCompressed возвращает значение в сжатом виде без распаковки.
+func (c *LRUCache) GetCompressed(ctx context.Context, key string) (CompressedValue, time.Time, error) {
+	value, expiresAt, stale, err := c.get(ctx, key)
+	if err != nil {
+		return CompressedValue{}, time.Time{}, err
+	}
+
+	cv, ok := value.(*compressed)
+	if !ok {
+		return CompressedValue{}, time.Time{}, ErrNotCompressed
+	}
+	return CompressedValue{Encoding: EncodingGzip, ContentType: cv.contentType, Data: cv.data, Stale: stale}, expiresAt, nil
+}
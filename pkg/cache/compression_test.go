@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	c := NewLRUCache(10, time.Minute, WithCompression(CompressionOptions{Threshold: 64}))
+	ctx := context.Background()
+
+	doc := strings.Repeat(`{"field": "highly compressible"}`, 100)
+	values := map[string]interface{}{
+		"string": doc,
+		"bytes":  []byte(doc),
+		"raw":    RawValue{ContentType: "text/html", Data: []byte(doc)},
+		"json":   map[string]interface{}{"items": []interface{}{doc, 1.5, true}},
+		"small":  "tiny",
+		"number": 42,
+	}
+
+	for key, value := range values {
+		require.NoError(t, c.Put(ctx, key, value, 0))
+	}
+
+	for key, value := range values {
+		t.Run(key, func(t *testing.T) {
+			got, _, err := c.Get(ctx, key)
+			require.NoError(t, err)
+			assert.Equal(t, value, got)
+		})
+	}
+
+	keys, all, err := c.GetAll(ctx)
+	require.NoError(t, err)
+	for i, key := range keys {
+		assert.Equal(t, values[key], all[i], "GetAll must return decompressed %s", key)
+	}
+
+	evicted, err := c.Evict(ctx, "string")
+	require.NoError(t, err)
+	assert.Equal(t, doc, evicted)
+}
+
+func TestCompressionPreservesDocumentTypes(t *testing.T) {
+	c := NewLRUCache(10, time.Minute, WithCompression(CompressionOptions{Threshold: 64})).(*LRUCache)
+	ctx := context.Background()
+
+	// Такие типы даёт разбор MessagePack и CBOR: целые числа и двоичные поля
+	// не должны превращаться в float64 и base64 после сжатия.
+	doc := map[string]interface{}{
+		"count":  int64(7),
+		"small":  int8(-3),
+		"flags":  uint16(512),
+		"binary": bytes.Repeat([]byte{0x00, 0xff}, 256),
+		"none":   nil,
+		"items":  []interface{}{uint8(1), "x", 2.5},
+	}
+	require.NoError(t, c.Put(ctx, "doc", doc, 0))
+	_, stored := c.cache["doc"].data.value.(*compressed)
+	require.True(t, stored, "document above the threshold must be compressed")
+
+	got, _, err := c.Get(ctx, "doc")
+	require.NoError(t, err)
+	assert.Equal(t, doc, got)
+}
+
+func TestCompressionStoresLessMemory(t *testing.T) {
+	c := NewLRUCache(10, time.Minute, WithCompression(CompressionOptions{Threshold: 64})).(*LRUCache)
+	ctx := context.Background()
+
+	doc := strings.Repeat("a", 10000)
+	require.NoError(t, c.Put(ctx, "doc", doc, 0))
+	require.NoError(t, c.Put(ctx, "small", "tiny", 0))
+
+	stored, ok := c.cache["doc"].data.value.(*compressed)
+	require.True(t, ok, "value above the threshold must be stored compressed")
+	assert.Less(t, len(stored.data), len(doc))
+
+	_, ok = c.cache["small"].data.value.(*compressed)
+	assert.False(t, ok, "value below the threshold must be stored as is")
+}
+
+func TestGetCompressed(t *testing.T) {
+	c := NewLRUCache(10, time.Minute, WithCompression(CompressionOptions{Threshold: 64}))
+	ctx := context.Background()
+	cr, ok := c.(CompressedReader)
+	require.True(t, ok)
+
+	html := strings.Repeat("<p>hello</p>", 100)
+	require.NoError(t, c.Put(ctx, "page", RawValue{ContentType: "text/html", Data: []byte(html)}, 0))
+	require.NoError(t, c.Put(ctx, "small", "tiny", 0))
+
+	cv, _, err := cr.GetCompressed(ctx, "page")
+	require.NoError(t, err)
+	assert.Equal(t, EncodingGzip, cv.Encoding)
+	assert.Equal(t, "text/html", cv.ContentType)
+
+	zr, err := gzip.NewReader(bytes.NewReader(cv.Data))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, html, string(plain))
+
+	_, _, err = cr.GetCompressed(ctx, "small")
+	assert.ErrorIs(t, err, ErrNotCompressed)
+
+	_, _, err = cr.GetCompressed(ctx, "missing")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
@@ -0,0 +1,392 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diskEntryExt — расширение файлов записей в каталоге DiskStore.
+const diskEntryExt = ".entry"
+
+func init() {
+	// Значения JSON-документов приходят как map[string]interface{} и []interface{};
+	// gob должен знать эти типы, чтобы сохранять их внутри interface{}.
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register(RawValue{})
+}
+
+// DiskOptions задаёт параметры дискового хранилища.
+type DiskOptions struct {
+	// Dir — каталог с файлами записей; создаётся, если его нет.
+	Dir string
+	// MaxBytes — наибольший суммарный размер файлов записей; при превышении
+	// удаляются наименее недавно использованные.
+	MaxBytes int64
+}
+
+// diskRecord — содержимое файла записи. Сжатые значения сохраняются как есть,
+// без распаковки.
+type diskRecord struct {
+	Key       string
+	ExpiresAt time.Time
+	StaleAt   time.Time
+	SoftTTL   time.Duration
+	HardTTL   time.Duration
+
+	Compressed  bool
+	Kind        valueKind
+	ContentType string
+	Data        []byte
+
+	Value interface{}
+}
+
+// diskEntry — запись индекса DiskStore.
+type diskEntry struct {
+	key       string
+	file      string
+	size      int64
+	expiresAt time.Time
+}
+
+// DiskStore хранит записи в отдельных файлах каталога и вытесняет наименее
+// недавно использованные при превышении лимита размера. Индекс ключей
+// держится в памяти и восстанавливается из каталога при открытии.
+type DiskStore struct {
+	opts DiskOptions
+
+	mu    sync.Mutex
+	index map[string]*list.Element
+	// lru упорядочен от наиболее (Front) к наименее (Back) недавно использованной записи.
+	lru  *list.List
+	size int64
+}
+
+// OpenDiskStore открывает хранилище в opts.Dir и восстанавливает индекс по
+// уже лежащим там файлам: порядок LRU — по времени изменения файлов.
+// Повреждённые и истёкшие файлы удаляются.
+func OpenDiskStore(opts DiskOptions) (*DiskStore, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("disk store directory is required")
+	}
+	if opts.MaxBytes <= 0 {
+		return nil, errors.New("disk store size limit must be positive")
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create disk store directory: %w", err)
+	}
+
+	s := &DiskStore{opts: opts, index: make(map[string]*list.Element), lru: list.New()}
+
+	files, err := os.ReadDir(opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("read disk store directory: %w", err)
+	}
+	type found struct {
+		entry *diskEntry
+		mod   time.Time
+	}
+	var entries []found
+	now := time.Now()
+	for _, f := range files {
+		name := f.Name()
+		path := filepath.Join(opts.Dir, name)
+		if strings.HasPrefix(name, ".tmp-") {
+			// Запись, прерванная остановкой процесса.
+			_ = os.Remove(path)
+			continue
+		}
+		if f.IsDir() || filepath.Ext(name) != diskEntryExt {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		rec, err := readDiskRecord(path)
+		if err != nil || now.After(rec.ExpiresAt) || diskFileName(rec.Key) != name {
+			if err != nil {
+				slog.Warn("Removing unreadable disk cache entry",
+					slog.String("file", path),
+					slog.String("error", err.Error()),
+				)
+			}
+			_ = os.Remove(path)
+			continue
+		}
+		entries = append(entries, found{
+			entry: &diskEntry{key: rec.Key, file: path, size: info.Size(), expiresAt: rec.ExpiresAt},
+			mod:   info.ModTime(),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].mod.After(entries[j].mod) })
+	for _, e := range entries {
+		s.index[e.entry.key] = s.lru.PushBack(e.entry)
+		s.size += e.entry.size
+	}
+	s.evictOverLimit()
+	return s, nil
+}
+
+// Len возвращает число записей.
+func (s *DiskStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.index)
+}
+
+// Size возвращает суммарный размер файлов записей в байтах.
+func (s *DiskStore) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// diskWrite — файл записи, записанный во временный файл, но ещё не
+// добавленный в хранилище (см. DiskStore.prepare).
+type diskWrite struct {
+	key       string
+	tmp       string
+	size      int64
+	expiresAt time.Time
+}
+
+// store сохраняет запись и возвращает ключи, вытесненные из-за лимита размера.
+func (s *DiskStore) store(it *item) ([]string, error) {
+	w, err := s.prepare(it)
+	if err != nil {
+		return nil, err
+	}
+	return s.commit(w)
+}
+
+// prepare записывает запись во временный файл. Запись становится видна
+// только после commit; discard отменяет её.
+func (s *DiskStore) prepare(it *item) (*diskWrite, error) {
+	rec := diskRecord{
+		Key:       it.key,
+		ExpiresAt: it.expiresAt,
+		StaleAt:   it.staleAt,
+		SoftTTL:   it.softTTL,
+		HardTTL:   it.hardTTL,
+	}
+	if cv, ok := it.value.(*compressed); ok {
+		rec.Compressed, rec.Kind, rec.ContentType, rec.Data = true, cv.kind, cv.contentType, cv.data
+	} else {
+		rec.Value = it.value
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&rec); err != nil {
+		return nil, fmt.Errorf("encode disk cache entry: %w", err)
+	}
+	size := int64(buf.Len())
+	if size > s.opts.MaxBytes {
+		return nil, fmt.Errorf("entry of %d bytes exceeds disk store limit", size)
+	}
+
+	tmp, err := os.CreateTemp(s.opts.Dir, ".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return &diskWrite{key: it.key, tmp: tmp.Name(), size: size, expiresAt: it.expiresAt}, nil
+}
+
+// commit добавляет подготовленную запись и возвращает ключи, вытесненные
+// из-за лимита размера.
+func (s *DiskStore) commit(w *diskWrite) ([]string, error) {
+	path := filepath.Join(s.opts.Dir, diskFileName(w.key))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Переименование под блокировкой: файл и индекс меняются вместе.
+	if err := os.Rename(w.tmp, path); err != nil {
+		os.Remove(w.tmp)
+		return nil, err
+	}
+	if el, ok := s.index[w.key]; ok {
+		s.size -= el.Value.(*diskEntry).size
+		s.lru.Remove(el)
+	}
+	s.index[w.key] = s.lru.PushFront(&diskEntry{key: w.key, file: path, size: w.size, expiresAt: w.expiresAt})
+	s.size += w.size
+	return s.evictOverLimit(), nil
+}
+
+// discard удаляет подготовленную, но не нужную больше запись.
+func (s *DiskStore) discard(w *diskWrite) {
+	os.Remove(w.tmp)
+}
+
+// evictOverLimit удаляет наименее недавно использованные записи, пока
+// размер превышает лимит. Вызывается под s.mu.
+func (s *DiskStore) evictOverLimit() []string {
+	var evicted []string
+	for s.size > s.opts.MaxBytes {
+		el := s.lru.Back()
+		if el == nil {
+			break
+		}
+		e := el.Value.(*diskEntry)
+		s.removeElement(el)
+		evicted = append(evicted, e.key)
+	}
+	return evicted
+}
+
+// load читает запись; ErrKeyNotFound означает, что записи нет.
+func (s *DiskStore) load(key string) (*diskRecord, error) {
+	s.mu.Lock()
+	el, ok := s.index[key]
+	if !ok {
+		s.mu.Unlock()
+		return nil, ErrKeyNotFound
+	}
+	s.lru.MoveToFront(el)
+	file := el.Value.(*diskEntry).file
+	s.mu.Unlock()
+	return readEntry(file)
+}
+
+// read читает запись, не меняя её позиции в LRU.
+func (s *DiskStore) read(key string) (*diskRecord, error) {
+	s.mu.Lock()
+	el, ok := s.index[key]
+	if !ok {
+		s.mu.Unlock()
+		return nil, ErrKeyNotFound
+	}
+	file := el.Value.(*diskEntry).file
+	s.mu.Unlock()
+	return readEntry(file)
+}
+
+func readEntry(file string) (*diskRecord, error) {
+	rec, err := readDiskRecord(file)
+	if errors.Is(err, os.ErrNotExist) {
+		// Запись удалили, пока файл читался.
+		return nil, ErrKeyNotFound
+	}
+	return rec, err
+}
+
+// remove удаляет запись и сообщает, была ли она.
+func (s *DiskStore) remove(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.index[key]
+	if ok {
+		s.removeElement(el)
+	}
+	return ok
+}
+
+// removeExpired удаляет истёкшие записи и возвращает их ключи.
+func (s *DiskStore) removeExpired(now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []string
+	for el := s.lru.Front(); el != nil; {
+		next := el.Next()
+		if e := el.Value.(*diskEntry); now.After(e.expiresAt) {
+			s.removeElement(el)
+			expired = append(expired, e.key)
+		}
+		el = next
+	}
+	return expired
+}
+
+// keys возвращает ключи от наиболее к наименее недавно использованному.
+func (s *DiskStore) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.index))
+	for el := s.lru.Front(); el != nil; el = el.Next() {
+		keys = append(keys, el.Value.(*diskEntry).key)
+	}
+	return keys
+}
+
+// clear удаляет все записи.
+func (s *DiskStore) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for el := s.lru.Front(); el != nil; {
+		next := el.Next()
+		s.removeElement(el)
+		el = next
+	}
+}
+
+// removeElement удаляет запись из индекса и её файл. Вызывается под s.mu.
+func (s *DiskStore) removeElement(el *list.Element) {
+	e := el.Value.(*diskEntry)
+	s.lru.Remove(el)
+	delete(s.index, e.key)
+	s.size -= e.size
+	if err := os.Remove(e.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Failed to remove disk cache entry",
+			slog.String("file", e.file),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// item восстанавливает запись кэша из файла.
+func (rec *diskRecord) item() *item {
+	it := &item{
+		key:       rec.Key,
+		value:     rec.Value,
+		expiresAt: rec.ExpiresAt,
+		staleAt:   rec.StaleAt,
+		softTTL:   rec.SoftTTL,
+		hardTTL:   rec.HardTTL,
+	}
+	if rec.Compressed {
+		it.value = &compressed{kind: rec.Kind, contentType: rec.ContentType, data: rec.Data}
+	}
+	return it
+}
+
+func readDiskRecord(path string) (*diskRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rec diskRecord
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&rec); err != nil {
+		return nil, fmt.Errorf("decode disk cache entry: %w", err)
+	}
+	return &rec, nil
+}
+
+// diskFileName возвращает имя файла записи: ключи могут содержать любые
+// символы, поэтому имя строится из их хеша.
+func diskFileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]) + diskEntryExt
+}
@@ -0,0 +1,28 @@
+package cache
+
+import "errors"
+
+// Ошибки, возвращаемые реализациями ILRUCache. Сравнивать их следует через errors.Is.
+var (
+	// ErrKeyNotFound сигнализирует о том, что ключ не существует или его TTL истёк.
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrEmptyKey возвращается при попытке использовать пустой ключ.
+	ErrEmptyKey = errors.New("empty key")
+
+	// ErrInvalidTTL возвращается, если передан отрицательный TTL или мягкий TTL
+	// не укладывается в жёсткий.
+	ErrInvalidTTL = errors.New("invalid ttl")
+
+	// ErrNotCompressed возвращается GetCompressed, если значение хранится несжатым.
+	ErrNotCompressed = errors.New("value is not compressed")
+
+	// ErrInvalidCapacity возвращается Resize, если новая ёмкость меньше единицы.
+	ErrInvalidCapacity = errors.New("invalid capacity")
+
+	// ErrValueTooLarge возвращается SlabCache, если запись не помещается в отведённую память.
+	ErrValueTooLarge = errors.New("value too large")
+
+	// ErrUnsupportedValue возвращается SlabCache для значений, которые он не умеет сериализовать.
+	ErrUnsupportedValue = errors.New("unsupported value type")
+)
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType — вид изменения записи кэша.
+type EventType string
+
+const (
+	// EventPut — добавлена новая запись.
+	EventPut EventType = "put"
+	// EventUpdate — значение существующей записи заменено.
+	EventUpdate EventType = "update"
+	// EventEvict — запись удалена вручную или вытеснена из-за нехватки места.
+	EventEvict EventType = "evict"
+	// EventExpire — обнаружена и удалена запись с истёкшим TTL. Истечение
+	// обнаруживается при обращении к ключу или при вызове DeleteExpired.
+	EventExpire EventType = "expire"
+	// EventClear — кэш полностью очищен; Key пустой.
+	EventClear EventType = "clear"
+)
+
+// Причины событий.
+const (
+	ReasonPut      = "put"
+	ReasonRefresh  = "refresh"
+	ReasonDelete   = "delete"
+	ReasonCapacity = "capacity"
+	ReasonTTL      = "ttl"
+)
+
+// Event описывает изменение записи кэша.
+type Event struct {
+	// Seq — порядковый номер события в шине, начиная с 1.
+	Seq    uint64    `json:"seq"`
+	Type   EventType `json:"type"`
+	Key    string    `json:"key,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+
+	// Value, ExpiresAt и StaleAt заполняются для EventPut и EventUpdate и
+	// нужны для репликации; в JSON-представление события не попадают.
+	// Value передаётся в исходном, несжатом виде и не должен изменяться.
+	Value     interface{} `json:"-"`
+	ExpiresAt time.Time   `json:"-"`
+	StaleAt   time.Time   `json:"-"`
+}
+
+// ErrSubscriberTooSlow сообщает, что подписка закрыта шиной, потому что её
+// буфер переполнился.
+var ErrSubscriberTooSlow = errors.New("subscriber is too slow")
+
+// EventBus рассылает события кэша подписчикам. Публикация никогда не
+// блокируется: подписчик, не успевающий разбирать свой буфер, отключается.
+type EventBus struct {
+	mu   sync.Mutex
+	seq  uint64
+	subs map[*Subscription]struct{}
+}
+
+// NewEventBus создаёт пустую шину событий.
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[*Subscription]struct{})}
+}
+
+// WithEventBus включает публикацию изменений кэша в шину b.
+func WithEventBus(b *EventBus) Option {
+	return func(c *LRUCache) {
+		c.events = b
+	}
+}
+
+// Subscription — подписка на события с ключами, начинающимися с prefix.
+// События EventClear доставляются всем подписчикам.
+type Subscription struct {
+	bus    *EventBus
+	prefix string
+	ch     chan Event
+	err    error
+}
+
+// Subscribe создаёт подписку на события ключей с префиксом prefix
+// с буфером на buffer событий.
+func (b *EventBus) Subscribe(prefix string, buffer int) *Subscription {
+	if buffer < 1 {
+		buffer = 1
+	}
+	s := &Subscription{bus: b, prefix: prefix, ch: make(chan Event, buffer)}
+
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Events возвращает канал событий. Канал закрывается после Close или
+// при отключении медленного подписчика (см. Err).
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Err возвращает ErrSubscriberTooSlow, если подписка закрыта шиной из-за
+// переполнения буфера. Вызывать после закрытия канала Events.
+func (s *Subscription) Err() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.err
+}
+
+// Close отменяет подписку. Повторный вызов безопасен.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s, nil)
+}
+
+// Subscribers возвращает число активных подписок.
+func (b *EventBus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// publish присваивает событию номер и рассылает его подписчикам без блокировки.
+func (b *EventBus) publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	if len(b.subs) == 0 {
+		return
+	}
+	ev.Seq = b.seq
+	ev.Time = time.Now()
+	for s := range b.subs {
+		if ev.Type != EventClear && !strings.HasPrefix(ev.Key, s.prefix) {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			b.remove(s, ErrSubscriberTooSlow)
+		}
+	}
+}
+
+// remove закрывает подписку. Вызывается под b.mu.
+func (b *EventBus) remove(s *Subscription, err error) {
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	s.err = err
+	close(s.ch)
+}
+
+// publish отправляет событие в шину, если она подключена.
+func (c *LRUCache) publish(typ EventType, key, reason string) {
+	if c.events != nil {
+		c.events.publish(Event{Type: typ, Key: key, Reason: reason})
+	}
+}
+
+// publishValue отправляет в шину событие о записи значения value в it.
+func (c *LRUCache) publishValue(typ EventType, it *item, reason string, value interface{}) {
+	if c.events != nil {
+		c.events.publish(Event{Type: typ, Key: it.key, Reason: reason, Value: value, ExpiresAt: it.expiresAt, StaleAt: it.staleAt})
+	}
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func drain(s *Subscription) []Event {
+	var events []Event
+	for {
+		select {
+		case ev, ok := <-s.Events():
+			if !ok {
+				return events
+			}
+			events = append(events, ev)
+		default:
+			return events
+		}
+	}
+}
+
+func TestCacheEvents(t *testing.T) {
+	bus := NewEventBus()
+	c := NewLRUCache(2, time.Minute, WithEventBus(bus))
+	ctx := context.Background()
+
+	sub := bus.Subscribe("", 16)
+	defer sub.Close()
+
+	require.NoError(t, c.Put(ctx, "a", 1, 0))
+	require.NoError(t, c.Put(ctx, "a", 2, 0))
+	require.NoError(t, c.Put(ctx, "b", 1, 0))
+	require.NoError(t, c.Put(ctx, "c", 1, 0))
+	_, err := c.Evict(ctx, "b")
+	require.NoError(t, err)
+	require.NoError(t, c.Put(ctx, "d", 1, 10*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+	_, _, err = c.Get(ctx, "d")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+	require.NoError(t, c.EvictAll(ctx))
+
+	type got struct {
+		typ    EventType
+		key    string
+		reason string
+	}
+	var events []got
+	for i, ev := range drain(sub) {
+		assert.Equal(t, uint64(i+1), ev.Seq)
+		events = append(events, got{ev.Type, ev.Key, ev.Reason})
+	}
+	assert.Equal(t, []got{
+		{EventPut, "a", ReasonPut},
+		{EventUpdate, "a", ReasonPut},
+		{EventPut, "b", ReasonPut},
+		{EventEvict, "a", ReasonCapacity},
+		{EventPut, "c", ReasonPut},
+		{EventEvict, "b", ReasonDelete},
+		{EventPut, "d", ReasonPut},
+		{EventExpire, "d", ReasonTTL},
+		{EventClear, "", ReasonDelete},
+	}, events)
+}
+
+func TestSubscriptionPrefix(t *testing.T) {
+	bus := NewEventBus()
+	c := NewLRUCache(10, time.Minute, WithEventBus(bus))
+	ctx := context.Background()
+
+	sub := bus.Subscribe("user:", 16)
+	defer sub.Close()
+
+	require.NoError(t, c.Put(ctx, "user:1", 1, 0))
+	require.NoError(t, c.Put(ctx, "order:1", 1, 0))
+	require.NoError(t, c.EvictAll(ctx))
+
+	events := drain(sub)
+	require.Len(t, events, 2)
+	assert.Equal(t, "user:1", events[0].Key)
+	assert.Equal(t, EventClear, events[1].Type, "clear events reach every subscriber")
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	bus := NewEventBus()
+	c := NewLRUCache(10, time.Minute, WithEventBus(bus))
+	ctx := context.Background()
+
+	slow := bus.Subscribe("", 2)
+	fast := bus.Subscribe("", 16)
+	defer fast.Close()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, c.Put(ctx, "k", i, 0))
+	}
+
+	assert.Len(t, drain(slow), 2)
+	_, ok := <-slow.Events()
+	assert.False(t, ok, "slow subscriber must be closed")
+	assert.ErrorIs(t, slow.Err(), ErrSubscriberTooSlow)
+	assert.Len(t, drain(fast), 3)
+	assert.Equal(t, 1, bus.Subscribers())
+
+	slow.Close()
+	fast.Close()
+	fast.Close()
+	assert.Equal(t, 0, bus.Subscribers())
+	assert.NoError(t, fast.Err())
+}
+
+func TestDeleteExpired(t *testing.T) {
+	bus := NewEventBus()
+	c := NewLRUCache(10, time.Minute, WithEventBus(bus))
+	ctx := context.Background()
+
+	require.NoError(t, c.Put(ctx, "short1", 1, 10*time.Millisecond))
+	require.NoError(t, c.Put(ctx, "long", 1, 0))
+	require.NoError(t, c.Put(ctx, "short2", 1, 10*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+
+	sub := bus.Subscribe("", 16)
+	defer sub.Close()
+
+	assert.Equal(t, 2, c.(ExpirySweeper).DeleteExpired(ctx))
+
+	keys, _, err := c.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"long"}, keys)
+
+	events := drain(sub)
+	require.Len(t, events, 2)
+	for _, ev := range events {
+		assert.Equal(t, EventExpire, ev.Type)
+		assert.Equal(t, ReasonTTL, ev.Reason)
+	}
+}
+
+func TestEventCarriesUncompressedValue(t *testing.T) {
+	bus := NewEventBus()
+	c := NewLRUCache(2, time.Minute, WithEventBus(bus), WithCompression(CompressionOptions{Threshold: 1}))
+	ctx := context.Background()
+
+	sub := bus.Subscribe("", 4)
+	defer sub.Close()
+
+	value := strings.Repeat("compressible ", 100)
+	require.NoError(t, c.(StaleCache).PutStale(ctx, "a", value, time.Second, time.Minute))
+
+	events := drain(sub)
+	require.Len(t, events, 1)
+	assert.Equal(t, value, events[0].Value)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), events[0].ExpiresAt, time.Second)
+	assert.WithinDuration(t, time.Now().Add(time.Second), events[0].StaleAt, time.Second)
+
+	data, err := json.Marshal(events[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "compressible")
+}
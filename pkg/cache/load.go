@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LoadingCache реализуется кэшами, умеющими заполнять промахи через загрузчик.
+type LoadingCache interface {
+	// GetOrLoad возвращает значение key, а при промахе загружает его через
+	// load и сохраняет с TTL ttl (0 — TTL по умолчанию). Одновременные
+	// промахи по одному ключу выполняют одну загрузку. Если load возвращает
+	// ErrKeyNotFound, ничего не сохраняется.
+	GetOrLoad(ctx context.Context, key string, ttl time.Duration, load Loader) (value interface{}, expiresAt time.Time, err error)
+}
+
+// loadCall — выполняющаяся загрузка ключа.
+type loadCall struct {
+	done      chan struct{}
+	value     interface{}
+	expiresAt time.Time
+	err       error
+}
+
+// loadGroup объединяет одновременные загрузки одного ключа. Нулевое значение
+// готово к использованию.
+type loadGroup struct {
+	mu    sync.Mutex
+	calls map[string]*loadCall
+}
+
+// getOrLoad реализует GetOrLoad поверх Get и Put кэша c. spanName — имя
+// span'а загрузки, defaultTTL — TTL кэша по умолчанию.
+func (g *loadGroup) getOrLoad(ctx context.Context, c ILRUCache, spanName, key string, ttl, defaultTTL time.Duration, load Loader) (interface{}, time.Time, error) {
+	if key == "" {
+		return nil, time.Time{}, ErrEmptyKey
+	}
+	if ttl < 0 {
+		return nil, time.Time{}, ErrInvalidTTL
+	}
+	if value, expiresAt, err := c.Get(ctx, key); err == nil {
+		return value, expiresAt, nil
+	}
+
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.value, call.expiresAt, call.err
+		case <-ctx.Done():
+			return nil, time.Time{}, ctx.Err()
+		}
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*loadCall)
+	}
+	call := &loadCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	// Пока ключ попадал в calls, его могла сохранить завершившаяся загрузка.
+	if value, expiresAt, err := c.Get(ctx, key); err == nil {
+		call.value, call.expiresAt = value, expiresAt
+		return value, expiresAt, nil
+	}
+
+	ctx, span := startSpan(ctx, spanName, key)
+	defer span.End()
+
+	// Загрузку разделяют ожидающие вызовы, поэтому отмена запроса-инициатора её не прерывает.
+	value, err := load(context.WithoutCancel(ctx), key)
+	if err != nil {
+		span.RecordError(err)
+		call.err = err
+		return nil, time.Time{}, err
+	}
+	if err := c.Put(ctx, key, value, ttl); err != nil {
+		call.err = err
+		return nil, time.Time{}, err
+	}
+
+	if ttl == 0 {
+		ttl = defaultTTL
+	}
+	call.value, call.expiresAt = value, time.Now().Add(ttl)
+	return call.value, call.expiresAt, nil
+}
+
+// GetOrLoad реализует LoadingCache.
+func (c *LRUCache) GetOrLoad(ctx context.Context, key string, ttl time.Duration, load Loader) (interface{}, time.Time, error) {
+	return c.loads.getOrLoad(ctx, c, "LRUCache.Load", key, ttl, c.DefaultTTL(), load)
+}
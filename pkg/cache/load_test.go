@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOrLoadLoadsOnce(t *testing.T) {
+	c := NewLRUCache(10, time.Minute).(*LRUCache)
+	ctx := context.Background()
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(ctx context.Context, key string) (interface{}, error) {
+		loads.Add(1)
+		<-release
+		return "loaded-" + key, nil
+	}
+
+	const callers = 20
+	var wg sync.WaitGroup
+	results := make([]interface{}, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _, err := c.GetOrLoad(ctx, "k", time.Hour, load)
+			assert.NoError(t, err)
+			results[i] = v
+		}()
+	}
+	require.Eventually(t, func() bool { return loads.Load() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), loads.Load())
+	for _, v := range results {
+		assert.Equal(t, "loaded-k", v)
+	}
+
+	// Загруженное значение сохранено с заданным TTL.
+	v, expiresAt, err := c.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "loaded-k", v)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Second)
+
+	// Попадание не вызывает загрузчик.
+	v, _, err = c.GetOrLoad(ctx, "k", 0, load)
+	require.NoError(t, err)
+	assert.Equal(t, "loaded-k", v)
+	assert.Equal(t, int32(1), loads.Load())
+}
+
+func TestGetOrLoadErrors(t *testing.T) {
+	c := NewLRUCache(10, time.Minute).(*LRUCache)
+	ctx := context.Background()
+
+	_, _, err := c.GetOrLoad(ctx, "missing", 0, func(context.Context, string) (interface{}, error) {
+		return nil, ErrKeyNotFound
+	})
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	boom := errors.New("backend down")
+	_, _, err = c.GetOrLoad(ctx, "k", 0, func(context.Context, string) (interface{}, error) {
+		return nil, boom
+	})
+	assert.ErrorIs(t, err, boom)
+	_, _, err = c.Get(ctx, "k")
+	assert.ErrorIs(t, err, ErrKeyNotFound, "failed load must not be cached")
+
+	_, _, err = c.GetOrLoad(ctx, "", 0, nil)
+	assert.ErrorIs(t, err, ErrEmptyKey)
+	_, _, err = c.GetOrLoad(ctx, "k", -time.Second, nil)
+	assert.ErrorIs(t, err, ErrInvalidTTL)
+}
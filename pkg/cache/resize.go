@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Settings — текущие параметры кэша.
+type Settings struct {
+	// Capacity — наибольшее число записей.
+	Capacity int
+	// DefaultTTL применяется к записям, сохранённым без явного TTL.
+	DefaultTTL time.Duration
+	// Len — число записей, включая истёкшие, но ещё не удалённые.
+	Len int
+}
+
+// Reconfigurable реализуется кэшами, ёмкость и TTL по умолчанию которых
+// можно менять без перезапуска и потери записей.
+type Reconfigurable interface {
+	// Resize меняет ёмкость. При уменьшении сразу вытесняются наименее
+	// недавно использованные записи с событием EventEvict по причине capacity;
+	// возвращается их число. Ёмкость меньше единицы даёт ErrInvalidCapacity.
+	Resize(ctx context.Context, capacity int) (int, error)
+	// SetDefaultTTL меняет TTL по умолчанию для последующих записей; сроки
+	// уже сохранённых не меняются. TTL <= 0 даёт ErrInvalidTTL.
+	SetDefaultTTL(ttl time.Duration) error
+	// Settings возвращает текущие параметры.
+	Settings() Settings
+}
+
+// Resize меняет ёмкость кэша, вытесняя лишние записи при уменьшении.
+func (c *LRUCache) Resize(ctx context.Context, capacity int) (int, error) {
+	if capacity < 1 {
+		return 0, ErrInvalidCapacity
+	}
+
+	ctx, span := startSpan(ctx, "LRUCache.Resize", "")
+	defer span.End()
+
+	c.lock(ctx)
+	defer c.mu.Unlock()
+
+	c.capacity = capacity
+	evicted := 0
+	for len(c.cache) > capacity {
+		c.evictForCapacity(span)
+		evicted++
+	}
+
+	span.SetAttributes(attribute.Int("cache.capacity", capacity), attribute.Int("cache.evicted", evicted))
+	return evicted, nil
+}
+
+// SetDefaultTTL меняет TTL по умолчанию для последующих записей.
+func (c *LRUCache) SetDefaultTTL(ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	c.defaultTTL.Store(int64(ttl))
+	return nil
+}
+
+// DefaultTTL возвращает TTL по умолчанию.
+func (c *LRUCache) DefaultTTL() time.Duration {
+	return time.Duration(c.defaultTTL.Load())
+}
+
+// Settings возвращает текущие параметры кэша.
+func (c *LRUCache) Settings() Settings {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return Settings{
+		Capacity:   c.capacity,
+		DefaultTTL: c.DefaultTTL(),
+		Len:        len(c.cache),
+	}
+}
+
+// Resize меняет ёмкость L1. Вытесненные при уменьшении записи переносятся
+// на диск, а не удаляются; возвращается число перенесённых записей.
+func (t *TieredCache) Resize(ctx context.Context, capacity int) (int, error) {
+	evicted, err := t.l1.Resize(ctx, capacity)
+	t.flush(ctx)
+	return evicted, err
+}
+
+// SetDefaultTTL работает как LRUCache.SetDefaultTTL.
+func (t *TieredCache) SetDefaultTTL(ttl time.Duration) error {
+	return t.l1.SetDefaultTTL(ttl)
+}
+
+// Settings возвращает параметры L1; Len учитывает записи обоих уровней.
+func (t *TieredCache) Settings() Settings {
+	s := t.l1.Settings()
+	s.Len += t.l2.Len()
+	return s
+}
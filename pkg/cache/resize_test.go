@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResizeShrinkEvictsLRU(t *testing.T) {
+	bus := NewEventBus()
+	c := NewLRUCache(4, time.Minute, WithEventBus(bus)).(*LRUCache)
+	ctx := context.Background()
+
+	for _, k := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, c.Put(ctx, k, k, 0))
+	}
+	_, _, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+
+	sub := bus.Subscribe("", 16)
+	defer sub.Close()
+
+	evicted, err := c.Resize(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, evicted)
+	keys, _, err := c.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "d"}, keys)
+
+	var got []string
+	for _, ev := range drain(sub) {
+		assert.Equal(t, EventEvict, ev.Type)
+		assert.Equal(t, ReasonCapacity, ev.Reason)
+		got = append(got, ev.Key)
+	}
+	assert.Equal(t, []string{"b", "c"}, got)
+
+	// Новая ёмкость действует и для последующих записей.
+	require.NoError(t, c.Put(ctx, "e", "e", 0))
+	keys, _, err = c.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e", "a"}, keys)
+	assert.Equal(t, Settings{Capacity: 2, DefaultTTL: time.Minute, Len: 2}, c.Settings())
+	checkList(t, c)
+}
+
+func TestResizeGrow(t *testing.T) {
+	c := NewLRUCache(1, time.Minute).(*LRUCache)
+	ctx := context.Background()
+
+	evicted, err := c.Resize(ctx, 3)
+	require.NoError(t, err)
+	assert.Zero(t, evicted)
+	for _, k := range []string{"a", "b", "c"} {
+		require.NoError(t, c.Put(ctx, k, k, 0))
+	}
+	keys, _, err := c.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, keys, 3)
+
+	_, err = c.Resize(ctx, 0)
+	assert.ErrorIs(t, err, ErrInvalidCapacity)
+	assert.Equal(t, 3, c.Settings().Capacity)
+}
+
+func TestSetDefaultTTL(t *testing.T) {
+	c := NewLRUCache(4, time.Minute).(*LRUCache)
+	ctx := context.Background()
+
+	require.NoError(t, c.Put(ctx, "old", 1, 0))
+	require.NoError(t, c.SetDefaultTTL(time.Hour))
+	require.NoError(t, c.Put(ctx, "new", 2, 0))
+
+	_, expOld, err := c.Get(ctx, "old")
+	require.NoError(t, err)
+	_, expNew, err := c.Get(ctx, "new")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expOld, time.Second)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expNew, time.Second)
+
+	// Мягкий TTL проверяется относительно нового TTL по умолчанию.
+	require.NoError(t, c.PutStale(ctx, "stale", 3, 30*time.Minute, 0))
+
+	assert.ErrorIs(t, c.SetDefaultTTL(0), ErrInvalidTTL)
+	assert.ErrorIs(t, c.SetDefaultTTL(-time.Second), ErrInvalidTTL)
+	assert.Equal(t, time.Hour, c.DefaultTTL())
+}
+
+func TestTieredResizeDemotes(t *testing.T) {
+	l2 := openDisk(t, t.TempDir(), 1<<20)
+	c := NewTieredCache(3, time.Minute, l2)
+	ctx := context.Background()
+
+	for _, k := range []string{"a", "b", "c"} {
+		require.NoError(t, c.Put(ctx, k, k, 0))
+	}
+	evicted, err := c.Resize(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, evicted)
+	assert.Equal(t, 2, l2.Len())
+	assert.Equal(t, Settings{Capacity: 1, DefaultTTL: time.Minute, Len: 3}, c.Settings())
+
+	v, _, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "a", v)
+}
+
+func TestSlabResize(t *testing.T) {
+	c := NewSlabCache(2, time.Minute, SlabOptions{})
+	ctx := context.Background()
+
+	_, err := c.Resize(ctx, 5)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, c.Put(ctx, "k"+strconv.Itoa(i), i, 0))
+	}
+	evicted, err := c.Resize(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, evicted)
+	keys, _, err := c.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k4", "k3"}, keys)
+
+	require.NoError(t, c.SetDefaultTTL(time.Hour))
+	assert.Equal(t, Settings{Capacity: 2, DefaultTTL: time.Hour, Len: 2}, c.Settings())
+	checkSlab(t, c)
+}
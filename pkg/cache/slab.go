@@ -0,0 +1,874 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// slabPageSize — размер страницы, которыми SlabCache выделяет память под блоки.
+	slabPageSize = 1 << 20
+	// defaultSlabBlockSize — размер блока по умолчанию.
+	defaultSlabBlockSize = 64
+	// defaultSlabMaxBytes — объём памяти под данные по умолчанию.
+	defaultSlabMaxBytes = 64 << 20
+	// slabNone — отсутствующий индекс записи или блока.
+	slabNone int32 = -1
+)
+
+// SlabOptions задаёт параметры SlabCache.
+type SlabOptions struct {
+	// MaxBytes — объём памяти под ключи и значения, округляется вверх до
+	// страницы в 1 МиБ. При нехватке места вытесняются наименее недавно
+	// использованные записи. По умолчанию 64 МиБ.
+	MaxBytes int
+	// BlockSize — размер блока, из цепочек которых складываются записи.
+	// Меньший блок экономит память на коротких значениях, больший — ускоряет
+	// чтение длинных. По умолчанию 64 байта.
+	BlockSize int
+	// Events — шина событий об изменениях; nil означает, что события не публикуются.
+	Events *EventBus
+}
+
+// slabKind — тип значения, сериализованного в блоки.
+type slabKind uint8
+
+const (
+	slabKindNil slabKind = iota
+	slabKindBool
+	slabKindString
+	slabKindBytes
+	slabKindRaw
+	// slabKindJSON — map[string]interface{} и []interface{}; числа внутри
+	// документа после чтения становятся float64.
+	slabKindJSON
+	slabKindInt
+	slabKindInt8
+	slabKindInt16
+	slabKindInt32
+	slabKindInt64
+	slabKindUint
+	slabKindUint8
+	slabKindUint16
+	slabKindUint32
+	slabKindUint64
+	slabKindFloat32
+	slabKindFloat64
+)
+
+// slabEntry — метаданные записи. Структура не содержит указателей, поэтому
+// таблица записей не сканируется сборщиком мусора.
+type slabEntry struct {
+	hash      uint64
+	expiresAt int64
+	// first — первый блок цепочки с ключом, типом содержимого и значением.
+	first int32
+	// prev ведёт к более, next — к менее недавно использованной записи;
+	// у свободных записей next связывает список свободных.
+	prev int32
+	next int32
+	// chain — следующая запись с тем же хешем ключа.
+	chain    int32
+	keyLen   uint32
+	ctLen    uint32
+	valueLen uint32
+	kind     slabKind
+}
+
+// SlabCache — реализация ILRUCache, хранящая ключи и сериализованные значения
+// в больших байтовых страницах, а связи списка LRU — индексами вместо
+// указателей (в духе bigcache и freecache). При миллионах записей сборщику
+// мусора почти нечего обходить: таблица записей, цепочки блоков и индекс
+// ключей не содержат указателей, а страниц немного.
+//
+// Значение разбивается на блоки фиксированного размера, связанные в цепочку;
+// освобождённые блоки переиспользуются любыми записями. Записи ограничены
+// и числом (capacity), и объёмом (SlabOptions.MaxBytes); при нехватке любого
+// из них вытесняются наименее недавно использованные.
+//
+// Хранятся значения nil, bool, строки, []byte, RawValue, целые и вещественные
+// числа, map[string]interface{} и []interface{} (в виде JSON). Для остальных
+// типов Put возвращает ErrUnsupportedValue. Get каждый раз декодирует
+// значение заново, поэтому возвращаемые значения не разделяют память с кэшем.
+// Мягкий TTL, сжатие и фоновое обновление не поддерживаются.
+type SlabCache struct {
+	mu       sync.Mutex
+	capacity int
+	// defaultTTL хранит time.Duration и читается до захвата блокировки.
+	defaultTTL atomic.Int64
+	events     *EventBus
+	// hash вычисляет хеш ключа; в тестах подменяется, чтобы получить коллизии.
+	hash func(key string) uint64
+
+	blockSize     int
+	blocksPerPage int
+	maxPages      int
+	pages         [][]byte
+	// nextBlock связывает блоки в цепочки записей и в список свободных.
+	nextBlock  []int32
+	freeBlock  int32
+	freeBlocks int
+
+	entries   []slabEntry
+	freeEntry int32
+	index     map[uint64]int32
+	// head — наиболее, tail — наименее недавно использованная запись.
+	head int32
+	tail int32
+	len  int
+
+	// loads — выполняющиеся загрузки GetOrLoad.
+	loads loadGroup
+}
+
+// NewSlabCache создаёт SlabCache на capacity записей с TTL по умолчанию defaultTTL.
+// Таблица записей выделяется сразу, страницы под данные — по мере заполнения.
+func NewSlabCache(capacity int, defaultTTL time.Duration, opts SlabOptions) *SlabCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = defaultSlabBlockSize
+	}
+	if opts.BlockSize > slabPageSize {
+		opts.BlockSize = slabPageSize
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultSlabMaxBytes
+	}
+
+	c := &SlabCache{
+		capacity:      capacity,
+		events:        opts.Events,
+		blockSize:     opts.BlockSize,
+		blocksPerPage: slabPageSize / opts.BlockSize,
+		maxPages:      (opts.MaxBytes + slabPageSize - 1) / slabPageSize,
+		freeBlock:     slabNone,
+		entries:       make([]slabEntry, capacity),
+		index:         make(map[uint64]int32, capacity),
+	}
+	c.defaultTTL.Store(int64(defaultTTL))
+	seed := maphash.MakeSeed()
+	c.hash = func(key string) uint64 { return maphash.String(seed, key) }
+	c.resetEntries()
+	return c
+}
+
+// resetEntries делает все записи свободными. Вызывается под c.mu.
+func (c *SlabCache) resetEntries() {
+	c.freeEntry = slabNone
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		c.entries[i] = slabEntry{next: c.freeEntry}
+		c.freeEntry = int32(i)
+	}
+	c.head, c.tail = slabNone, slabNone
+	c.len = 0
+}
+
+// slabValue — значение в сериализованном виде.
+type slabValue struct {
+	kind slabKind
+	ct   string
+	str  string
+	data []byte
+}
+
+func (v *slabValue) size() int {
+	return len(v.ct) + len(v.str) + len(v.data)
+}
+
+// encodeSlabValue сериализует значение для записи в блоки.
+func encodeSlabValue(value interface{}) (slabValue, error) {
+	var num [8]byte
+	putInt := func(kind slabKind, n int64) slabValue {
+		binary.LittleEndian.PutUint64(num[:], uint64(n))
+		return slabValue{kind: kind, data: num[:]}
+	}
+	putUint := func(kind slabKind, n uint64) slabValue {
+		binary.LittleEndian.PutUint64(num[:], n)
+		return slabValue{kind: kind, data: num[:]}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return slabValue{kind: slabKindNil}, nil
+	case bool:
+		if v {
+			return slabValue{kind: slabKindBool, data: []byte{1}}, nil
+		}
+		return slabValue{kind: slabKindBool, data: []byte{0}}, nil
+	case string:
+		return slabValue{kind: slabKindString, str: v}, nil
+	case []byte:
+		return slabValue{kind: slabKindBytes, data: v}, nil
+	case RawValue:
+		return slabValue{kind: slabKindRaw, ct: v.ContentType, data: v.Data}, nil
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return slabValue{}, fmt.Errorf("%w: %v", ErrUnsupportedValue, err)
+		}
+		return slabValue{kind: slabKindJSON, data: data}, nil
+	case int:
+		return putInt(slabKindInt, int64(v)), nil
+	case int8:
+		return putInt(slabKindInt8, int64(v)), nil
+	case int16:
+		return putInt(slabKindInt16, int64(v)), nil
+	case int32:
+		return putInt(slabKindInt32, int64(v)), nil
+	case int64:
+		return putInt(slabKindInt64, v), nil
+	case uint:
+		return putUint(slabKindUint, uint64(v)), nil
+	case uint8:
+		return putUint(slabKindUint8, uint64(v)), nil
+	case uint16:
+		return putUint(slabKindUint16, uint64(v)), nil
+	case uint32:
+		return putUint(slabKindUint32, uint64(v)), nil
+	case uint64:
+		return putUint(slabKindUint64, v), nil
+	case float32:
+		return putUint(slabKindFloat32, uint64(math.Float32bits(v))), nil
+	case float64:
+		return putUint(slabKindFloat64, math.Float64bits(v)), nil
+	default:
+		return slabValue{}, fmt.Errorf("%w: %T", ErrUnsupportedValue, value)
+	}
+}
+
+// decode восстанавливает исходное значение.
+func (v *slabValue) decode() (interface{}, error) {
+	var n uint64
+	if len(v.data) == 8 {
+		n = binary.LittleEndian.Uint64(v.data)
+	}
+	switch v.kind {
+	case slabKindNil:
+		return nil, nil
+	case slabKindBool:
+		return v.data[0] == 1, nil
+	case slabKindString:
+		return v.str, nil
+	case slabKindBytes:
+		return v.data, nil
+	case slabKindRaw:
+		return RawValue{ContentType: v.ct, Data: v.data}, nil
+	case slabKindJSON:
+		var doc interface{}
+		if err := json.Unmarshal(v.data, &doc); err != nil {
+			return nil, err
+		}
+		return doc, nil
+	case slabKindInt:
+		return int(n), nil
+	case slabKindInt8:
+		return int8(n), nil
+	case slabKindInt16:
+		return int16(n), nil
+	case slabKindInt32:
+		return int32(n), nil
+	case slabKindInt64:
+		return int64(n), nil
+	case slabKindUint:
+		return uint(n), nil
+	case slabKindUint8:
+		return uint8(n), nil
+	case slabKindUint16:
+		return uint16(n), nil
+	case slabKindUint32:
+		return uint32(n), nil
+	case slabKindUint64:
+		return n, nil
+	case slabKindFloat32:
+		return math.Float32frombits(uint32(n)), nil
+	case slabKindFloat64:
+		return math.Float64frombits(n), nil
+	default:
+		return nil, fmt.Errorf("unknown slab value kind %d", v.kind)
+	}
+}
+
+// lock захватывает блокировку, выделяя ожидание в отдельный span.
+func (c *SlabCache) lock(ctx context.Context) {
+	_, span := tracer.Start(ctx, "SlabCache.lockWait")
+	c.mu.Lock()
+	span.End()
+}
+
+// Put добавляет или обновляет запись в кэше с указанным TTL.
+func (c *SlabCache) Put(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	if ttl < 0 {
+		return ErrInvalidTTL
+	}
+	if ttl == 0 {
+		ttl = c.DefaultTTL()
+	}
+
+	ctx, span := startSpan(ctx, "SlabCache.Put", key)
+	defer span.End()
+
+	v, err := encodeSlabValue(value)
+	if err != nil {
+		return err
+	}
+	size := len(key) + v.size()
+	if size > math.MaxUint32 {
+		return ErrValueTooLarge
+	}
+	blocks := (size + c.blockSize - 1) / c.blockSize
+	if blocks > c.maxPages*c.blocksPerPage {
+		return ErrValueTooLarge
+	}
+
+	c.lock(ctx)
+	defer c.mu.Unlock()
+
+	hash := c.hash(key)
+	typ := EventPut
+	if idx := c.find(hash, key); idx != slabNone {
+		// Старое значение освобождается целиком, новое пишется в свежую цепочку.
+		c.remove(idx)
+		typ = EventUpdate
+	}
+
+	if c.len >= c.capacity {
+		c.evictTail(span)
+	}
+	first := c.allocBlocks(blocks, span)
+
+	idx := c.freeEntry
+	e := &c.entries[idx]
+	c.freeEntry = e.next
+	*e = slabEntry{
+		hash:      hash,
+		expiresAt: time.Now().Add(ttl).UnixNano(),
+		first:     first,
+		chain:     slabNone,
+		keyLen:    uint32(len(key)),
+		ctLen:     uint32(len(v.ct)),
+		valueLen:  uint32(len(v.str) + len(v.data)),
+		kind:      v.kind,
+	}
+	if head, ok := c.index[hash]; ok {
+		e.chain = head
+	}
+	c.index[hash] = idx
+	c.pushFront(idx)
+	c.len++
+
+	w := slabCursor{c: c, block: first}
+	w.writeString(key)
+	w.writeString(v.ct)
+	w.writeString(v.str)
+	w.write(v.data)
+
+	if c.events != nil {
+		c.events.publish(Event{Type: typ, Key: key, Reason: ReasonPut, Value: value, ExpiresAt: time.Unix(0, e.expiresAt)})
+	}
+	return nil
+}
+
+// Get возвращает значение и время истечения TTL для заданного ключа.
+func (c *SlabCache) Get(ctx context.Context, key string) (interface{}, time.Time, error) {
+	ctx, span := startSpan(ctx, "SlabCache.Get", key)
+	defer span.End()
+
+	c.lock(ctx)
+	idx := c.find(c.hash(key), key)
+	if idx == slabNone {
+		c.mu.Unlock()
+		span.SetAttributes(attribute.Bool("cache.hit", false))
+		return nil, time.Time{}, ErrKeyNotFound
+	}
+	e := &c.entries[idx]
+	if time.Now().UnixNano() > e.expiresAt {
+		c.remove(idx)
+		c.publish(EventExpire, key, ReasonTTL)
+		c.mu.Unlock()
+		span.SetAttributes(attribute.Bool("cache.hit", false), attribute.Bool("cache.expired", true))
+		return nil, time.Time{}, ErrKeyNotFound
+	}
+	c.moveToFront(idx)
+	expiresAt := time.Unix(0, e.expiresAt)
+	v := c.read(idx)
+	c.mu.Unlock()
+
+	span.SetAttributes(attribute.Bool("cache.hit", true))
+	value, err := v.decode()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return value, expiresAt, nil
+}
+
+// GetAll возвращает неистёкшие записи от наиболее к наименее недавно использованной.
+func (c *SlabCache) GetAll(ctx context.Context) ([]string, []interface{}, error) {
+	ctx, span := startSpan(ctx, "SlabCache.GetAll", "")
+	defer span.End()
+
+	c.lock(ctx)
+	now := time.Now().UnixNano()
+	keys := make([]string, 0, c.len)
+	raw := make([]slabValue, 0, c.len)
+	for idx := c.head; idx != slabNone; idx = c.entries[idx].next {
+		if now > c.entries[idx].expiresAt {
+			continue
+		}
+		keys = append(keys, c.key(idx))
+		raw = append(raw, c.read(idx))
+	}
+	c.mu.Unlock()
+
+	if len(keys) == 0 {
+		return nil, nil, nil
+	}
+	values := make([]interface{}, len(raw))
+	for i := range raw {
+		value, err := raw[i].decode()
+		if err != nil {
+			return nil, nil, err
+		}
+		values[i] = value
+	}
+	return keys, values, nil
+}
+
+// Evict удаляет элемент по ключу из кэша.
+func (c *SlabCache) Evict(ctx context.Context, key string) (interface{}, error) {
+	ctx, span := startSpan(ctx, "SlabCache.Evict", key)
+	defer span.End()
+
+	c.lock(ctx)
+	idx := c.find(c.hash(key), key)
+	if idx == slabNone {
+		c.mu.Unlock()
+		return nil, ErrKeyNotFound
+	}
+	v := c.read(idx)
+	c.remove(idx)
+	c.publish(EventEvict, key, ReasonDelete)
+	c.mu.Unlock()
+
+	return v.decode()
+}
+
+// EvictAll полностью очищает кэш. Выделенные страницы сохраняются для новых записей.
+func (c *SlabCache) EvictAll(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "SlabCache.EvictAll", "")
+	defer span.End()
+
+	c.lock(ctx)
+	defer c.mu.Unlock()
+
+	span.SetAttributes(attribute.Int("cache.evicted", c.len))
+	c.resetEntries()
+	clear(c.index)
+	c.freeBlock, c.freeBlocks = slabNone, 0
+	for b := len(c.nextBlock) - 1; b >= 0; b-- {
+		c.nextBlock[b] = c.freeBlock
+		c.freeBlock = int32(b)
+		c.freeBlocks++
+	}
+	c.publish(EventClear, "", ReasonDelete)
+	return nil
+}
+
+// DeleteExpired удаляет все записи с истёкшим TTL, публикуя для каждой EventExpire.
+func (c *SlabCache) DeleteExpired(ctx context.Context) int {
+	ctx, span := startSpan(ctx, "SlabCache.DeleteExpired", "")
+	defer span.End()
+
+	c.lock(ctx)
+	defer c.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	removed := 0
+	for idx := c.head; idx != slabNone; {
+		next := c.entries[idx].next
+		if now > c.entries[idx].expiresAt {
+			key := c.key(idx)
+			c.remove(idx)
+			c.publish(EventExpire, key, ReasonTTL)
+			removed++
+		}
+		idx = next
+	}
+
+	span.SetAttributes(attribute.Int("cache.expired", removed))
+	return removed
+}
+
+// GetOrLoad реализует LoadingCache.
+func (c *SlabCache) GetOrLoad(ctx context.Context, key string, ttl time.Duration, load Loader) (interface{}, time.Time, error) {
+	return c.loads.getOrLoad(ctx, c, "SlabCache.Load", key, ttl, c.DefaultTTL(), load)
+}
+
+// Snapshot возвращает неистёкшие записи в порядке LRU, начиная с самой старой.
+func (c *SlabCache) Snapshot(ctx context.Context) ([]Entry, error) {
+	ctx, span := startSpan(ctx, "SlabCache.Snapshot", "")
+	defer span.End()
+
+	c.lock(ctx)
+	now := time.Now().UnixNano()
+	entries := make([]Entry, 0, c.len)
+	raw := make([]slabValue, 0, c.len)
+	for idx := c.tail; idx != slabNone; idx = c.entries[idx].prev {
+		if now > c.entries[idx].expiresAt {
+			continue
+		}
+		entries = append(entries, Entry{Key: c.key(idx), ExpiresAt: time.Unix(0, c.entries[idx].expiresAt)})
+		raw = append(raw, c.read(idx))
+	}
+	c.mu.Unlock()
+
+	for i := range raw {
+		value, err := raw[i].decode()
+		if err != nil {
+			return nil, err
+		}
+		entries[i].Value = value
+	}
+
+	span.SetAttributes(attribute.Int("cache.entries", len(entries)))
+	return entries, nil
+}
+
+// Resize меняет ёмкость кэша, вытесняя лишние записи при уменьшении.
+// При увеличении таблица записей дорастает до новой ёмкости; при уменьшении
+// она не сжимается.
+func (c *SlabCache) Resize(ctx context.Context, capacity int) (int, error) {
+	if capacity < 1 {
+		return 0, ErrInvalidCapacity
+	}
+
+	ctx, span := startSpan(ctx, "SlabCache.Resize", "")
+	defer span.End()
+
+	c.lock(ctx)
+	defer c.mu.Unlock()
+
+	for i := len(c.entries); i < capacity; i++ {
+		c.entries = append(c.entries, slabEntry{next: c.freeEntry})
+		c.freeEntry = int32(i)
+	}
+	c.capacity = capacity
+	evicted := 0
+	for c.len > capacity {
+		c.evictTail(span)
+		evicted++
+	}
+
+	span.SetAttributes(attribute.Int("cache.capacity", capacity), attribute.Int("cache.evicted", evicted))
+	return evicted, nil
+}
+
+// SetDefaultTTL меняет TTL по умолчанию для последующих записей.
+func (c *SlabCache) SetDefaultTTL(ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	c.defaultTTL.Store(int64(ttl))
+	return nil
+}
+
+// DefaultTTL возвращает TTL по умолчанию.
+func (c *SlabCache) DefaultTTL() time.Duration {
+	return time.Duration(c.defaultTTL.Load())
+}
+
+// Settings возвращает текущие параметры кэша.
+func (c *SlabCache) Settings() Settings {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Settings{Capacity: c.capacity, DefaultTTL: c.DefaultTTL(), Len: c.len}
+}
+
+// SlabStats описывает заполнение SlabCache.
+type SlabStats struct {
+	Entries int `json:"entries"`
+	// AllocatedBytes — объём выделенных страниц, UsedBytes — занятых блоков.
+	AllocatedBytes int `json:"allocated_bytes"`
+	UsedBytes      int `json:"used_bytes"`
+	MaxBytes       int `json:"max_bytes"`
+}
+
+// Stats возвращает текущее заполнение кэша.
+func (c *SlabCache) Stats() SlabStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return SlabStats{
+		Entries:        c.len,
+		AllocatedBytes: len(c.pages) * slabPageSize,
+		UsedBytes:      (len(c.nextBlock) - c.freeBlocks) * c.blockSize,
+		MaxBytes:       c.maxPages * slabPageSize,
+	}
+}
+
+func (c *SlabCache) publish(typ EventType, key, reason string) {
+	if c.events != nil {
+		c.events.publish(Event{Type: typ, Key: key, Reason: reason})
+	}
+}
+
+// find ищет запись по хешу и ключу; slabNone означает, что записи нет.
+// Вызывается под c.mu.
+func (c *SlabCache) find(hash uint64, key string) int32 {
+	idx, ok := c.index[hash]
+	if !ok {
+		return slabNone
+	}
+	for ; idx != slabNone; idx = c.entries[idx].chain {
+		e := &c.entries[idx]
+		if int(e.keyLen) != len(key) {
+			continue
+		}
+		r := slabCursor{c: c, block: e.first}
+		if r.equal(key) {
+			return idx
+		}
+	}
+	return slabNone
+}
+
+// key читает ключ записи. Вызывается под c.mu.
+func (c *SlabCache) key(idx int32) string {
+	var b strings.Builder
+	r := slabCursor{c: c, block: c.entries[idx].first}
+	r.readString(&b, int(c.entries[idx].keyLen))
+	return b.String()
+}
+
+// read копирует значение записи из блоков. Вызывается под c.mu.
+func (c *SlabCache) read(idx int32) slabValue {
+	e := &c.entries[idx]
+	r := slabCursor{c: c, block: e.first}
+	r.skip(int(e.keyLen))
+
+	v := slabValue{kind: e.kind}
+	if e.ctLen > 0 {
+		var b strings.Builder
+		r.readString(&b, int(e.ctLen))
+		v.ct = b.String()
+	}
+	if e.kind == slabKindString {
+		var b strings.Builder
+		r.readString(&b, int(e.valueLen))
+		v.str = b.String()
+	} else if e.valueLen > 0 {
+		v.data = make([]byte, e.valueLen)
+		r.read(v.data)
+	}
+	return v
+}
+
+// remove удаляет запись из индекса и списка и освобождает её блоки.
+// Вызывается под c.mu.
+func (c *SlabCache) remove(idx int32) {
+	e := &c.entries[idx]
+	if head := c.index[e.hash]; head == idx {
+		if e.chain == slabNone {
+			delete(c.index, e.hash)
+		} else {
+			c.index[e.hash] = e.chain
+		}
+	} else {
+		for p := head; p != slabNone; p = c.entries[p].chain {
+			if c.entries[p].chain == idx {
+				c.entries[p].chain = e.chain
+				break
+			}
+		}
+	}
+
+	c.unlink(idx)
+	c.freeChain(e.first)
+	*e = slabEntry{next: c.freeEntry}
+	c.freeEntry = idx
+	c.len--
+}
+
+// evictTail вытесняет наименее недавно использованную запись. Вызывается под c.mu.
+func (c *SlabCache) evictTail(span trace.Span) {
+	if c.tail == slabNone {
+		return
+	}
+	key := c.key(c.tail)
+	c.remove(c.tail)
+	recordEviction(span, key)
+	c.publish(EventEvict, key, ReasonCapacity)
+}
+
+// allocBlocks выделяет цепочку из n блоков, добавляя страницы, пока не
+// достигнут лимит, а затем вытесняя LRU-записи. Вызывающий проверяет, что
+// n не превышает общего числа блоков. Вызывается под c.mu.
+func (c *SlabCache) allocBlocks(n int, span trace.Span) int32 {
+	for c.freeBlocks < n {
+		if len(c.pages) < c.maxPages {
+			c.addPage()
+			continue
+		}
+		c.evictTail(span)
+	}
+
+	first := c.freeBlock
+	last := first
+	for i := 1; i < n; i++ {
+		last = c.nextBlock[last]
+	}
+	c.freeBlock = c.nextBlock[last]
+	c.nextBlock[last] = slabNone
+	c.freeBlocks -= n
+	return first
+}
+
+// addPage выделяет страницу и добавляет её блоки в список свободных.
+func (c *SlabCache) addPage() {
+	c.pages = append(c.pages, make([]byte, slabPageSize))
+	base := len(c.nextBlock)
+	c.nextBlock = append(c.nextBlock, make([]int32, c.blocksPerPage)...)
+	for b := base + c.blocksPerPage - 1; b >= base; b-- {
+		c.nextBlock[b] = c.freeBlock
+		c.freeBlock = int32(b)
+	}
+	c.freeBlocks += c.blocksPerPage
+}
+
+// freeChain возвращает цепочку блоков в список свободных.
+func (c *SlabCache) freeChain(first int32) {
+	last, n := first, 1
+	for c.nextBlock[last] != slabNone {
+		last = c.nextBlock[last]
+		n++
+	}
+	c.nextBlock[last] = c.freeBlock
+	c.freeBlock = first
+	c.freeBlocks += n
+}
+
+func (c *SlabCache) pushFront(idx int32) {
+	e := &c.entries[idx]
+	e.prev, e.next = slabNone, c.head
+	if c.head != slabNone {
+		c.entries[c.head].prev = idx
+	}
+	c.head = idx
+	if c.tail == slabNone {
+		c.tail = idx
+	}
+}
+
+func (c *SlabCache) unlink(idx int32) {
+	e := &c.entries[idx]
+	if e.prev != slabNone {
+		c.entries[e.prev].next = e.next
+	} else {
+		c.head = e.next
+	}
+	if e.next != slabNone {
+		c.entries[e.next].prev = e.prev
+	} else {
+		c.tail = e.prev
+	}
+}
+
+func (c *SlabCache) moveToFront(idx int32) {
+	if idx == c.head {
+		return
+	}
+	c.unlink(idx)
+	c.pushFront(idx)
+}
+
+// slabCursor последовательно читает и пишет байты цепочки блоков.
+type slabCursor struct {
+	c     *SlabCache
+	block int32
+	off   int
+}
+
+// chunk возвращает свободный остаток текущего блока, переходя к следующему,
+// если текущий исчерпан.
+func (r *slabCursor) chunk() []byte {
+	if r.off == r.c.blockSize {
+		r.block = r.c.nextBlock[r.block]
+		r.off = 0
+	}
+	page := r.c.pages[int(r.block)/r.c.blocksPerPage]
+	start := int(r.block)%r.c.blocksPerPage*r.c.blockSize + r.off
+	return page[start : start-r.off+r.c.blockSize]
+}
+
+func (r *slabCursor) write(data []byte) {
+	for len(data) > 0 {
+		n := copy(r.chunk(), data)
+		r.off += n
+		data = data[n:]
+	}
+}
+
+func (r *slabCursor) writeString(s string) {
+	for len(s) > 0 {
+		n := copy(r.chunk(), s)
+		r.off += n
+		s = s[n:]
+	}
+}
+
+func (r *slabCursor) read(dst []byte) {
+	for len(dst) > 0 {
+		n := copy(dst, r.chunk())
+		r.off += n
+		dst = dst[n:]
+	}
+}
+
+func (r *slabCursor) readString(b *strings.Builder, n int) {
+	b.Grow(n)
+	for n > 0 {
+		chunk := r.chunk()
+		if len(chunk) > n {
+			chunk = chunk[:n]
+		}
+		b.Write(chunk)
+		r.off += len(chunk)
+		n -= len(chunk)
+	}
+}
+
+func (r *slabCursor) skip(n int) {
+	for n > 0 {
+		step := min(len(r.chunk()), n)
+		r.off += step
+		n -= step
+	}
+}
+
+// equal сравнивает следующие len(s) байт с s.
+func (r *slabCursor) equal(s string) bool {
+	for len(s) > 0 {
+		chunk := r.chunk()
+		n := min(len(chunk), len(s))
+		if string(chunk[:n]) != s[:n] {
+			return false
+		}
+		r.off += n
+		s = s[n:]
+	}
+	return true
+}
@@ -0,0 +1,309 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkSlab проверяет целостность списка LRU, индекса и учёта блоков SlabCache.
+func checkSlab(t *testing.T, c *SlabCache) {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, used := 0, 0
+	prev := slabNone
+	for idx := c.head; idx != slabNone; idx = c.entries[idx].next {
+		e := &c.entries[idx]
+		require.Equal(t, prev, e.prev, "broken prev link at %d", idx)
+		require.Equal(t, idx, c.find(e.hash, c.key(idx)), "entry %d is not in the index", idx)
+		for b := e.first; b != slabNone; b = c.nextBlock[b] {
+			used++
+		}
+		prev = idx
+		n++
+		require.LessOrEqual(t, n, c.capacity, "list has a cycle")
+	}
+	require.Equal(t, prev, c.tail)
+	require.Equal(t, c.len, n)
+
+	free := 0
+	for b := c.freeBlock; b != slabNone; b = c.nextBlock[b] {
+		free++
+	}
+	require.Equal(t, c.freeBlocks, free)
+	require.Equal(t, len(c.nextBlock), used+free, "blocks leaked")
+}
+
+func TestSlabPutGet(t *testing.T) {
+	c := NewSlabCache(2, time.Minute, SlabOptions{})
+	ctx := context.Background()
+
+	require.NoError(t, c.Put(ctx, "a", "1", 0))
+	require.NoError(t, c.Put(ctx, "b", "2", 0))
+	_, _, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, c.Put(ctx, "c", "3", 0))
+
+	_, _, err = c.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	keys, values, err := c.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "a"}, keys)
+	assert.Equal(t, []interface{}{"3", "1"}, values)
+
+	require.NoError(t, c.Put(ctx, "a", strings.Repeat("x", 1000), time.Hour))
+	v, expiresAt, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("x", 1000), v)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Second)
+
+	assert.ErrorIs(t, c.Put(ctx, "", 1, 0), ErrEmptyKey)
+	assert.ErrorIs(t, c.Put(ctx, "k", 1, -time.Second), ErrInvalidTTL)
+	checkSlab(t, c)
+}
+
+func TestSlabValueKinds(t *testing.T) {
+	c := NewSlabCache(64, time.Minute, SlabOptions{BlockSize: 8})
+	ctx := context.Background()
+
+	values := []interface{}{
+		nil, true, false, "", "строка", []byte("bytes"),
+		RawValue{ContentType: "text/plain", Data: []byte("raw")},
+		int(-1), int8(-8), int16(-16), int32(-32), int64(-64),
+		uint(1), uint8(8), uint16(16), uint32(32), uint64(1 << 63),
+		float32(1.5), float64(2.25),
+		map[string]interface{}{"a": 1.0, "b": []interface{}{"x", nil}},
+		[]interface{}{1.0, "two", true},
+	}
+	for i, want := range values {
+		key := "k" + strconv.Itoa(i)
+		require.NoError(t, c.Put(ctx, key, want, 0))
+		got, _, err := c.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "value %d", i)
+	}
+
+	assert.ErrorIs(t, c.Put(ctx, "t", time.Now(), 0), ErrUnsupportedValue)
+	assert.ErrorIs(t, c.Put(ctx, "s", struct{}{}, 0), ErrUnsupportedValue)
+	checkSlab(t, c)
+}
+
+func TestSlabTTL(t *testing.T) {
+	bus := NewEventBus()
+	c := NewSlabCache(4, time.Minute, SlabOptions{Events: bus})
+	ctx := context.Background()
+	sub := bus.Subscribe("", 16)
+	defer sub.Close()
+
+	require.NoError(t, c.Put(ctx, "a", 1, 10*time.Millisecond))
+	require.NoError(t, c.Put(ctx, "b", 2, 10*time.Millisecond))
+	require.NoError(t, c.Put(ctx, "c", 3, 0))
+	time.Sleep(20 * time.Millisecond)
+
+	_, _, err := c.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	keys, _, err := c.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, keys)
+	assert.Equal(t, 1, c.DeleteExpired(ctx))
+	assert.Equal(t, 1, c.Stats().Entries)
+
+	var expired []string
+	for _, ev := range drain(sub) {
+		if ev.Type == EventExpire {
+			expired = append(expired, ev.Key)
+		}
+	}
+	assert.Equal(t, []string{"a", "b"}, expired)
+	checkSlab(t, c)
+}
+
+func TestSlabEvents(t *testing.T) {
+	bus := NewEventBus()
+	c := NewSlabCache(2, time.Minute, SlabOptions{Events: bus})
+	ctx := context.Background()
+	sub := bus.Subscribe("", 16)
+	defer sub.Close()
+
+	require.NoError(t, c.Put(ctx, "a", 1, 0))
+	require.NoError(t, c.Put(ctx, "a", 2, 0))
+	require.NoError(t, c.Put(ctx, "b", 1, 0))
+	require.NoError(t, c.Put(ctx, "c", 1, 0))
+	v, err := c.Evict(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	_, err = c.Evict(ctx, "b")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	require.NoError(t, c.EvictAll(ctx))
+
+	type got struct {
+		typ    EventType
+		key    string
+		reason string
+	}
+	var events []got
+	for _, ev := range drain(sub) {
+		events = append(events, got{ev.Type, ev.Key, ev.Reason})
+	}
+	assert.Equal(t, []got{
+		{EventPut, "a", ReasonPut},
+		{EventUpdate, "a", ReasonPut},
+		{EventPut, "b", ReasonPut},
+		{EventEvict, "a", ReasonCapacity},
+		{EventPut, "c", ReasonPut},
+		{EventEvict, "b", ReasonDelete},
+		{EventClear, "", ReasonDelete},
+	}, events)
+
+	keys, _, err := c.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	checkSlab(t, c)
+}
+
+func TestSlabEvictsByBytes(t *testing.T) {
+	c := NewSlabCache(1000, time.Minute, SlabOptions{MaxBytes: slabPageSize, BlockSize: 1024})
+	ctx := context.Background()
+
+	// Страница вмещает 1024 блока, каждая запись занимает 257.
+	value := make([]byte, 256*1024)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, c.Put(ctx, "k"+strconv.Itoa(i), value, 0))
+	}
+	keys, _, err := c.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k4", "k3", "k2"}, keys)
+	assert.Equal(t, slabPageSize, c.Stats().AllocatedBytes)
+
+	assert.ErrorIs(t, c.Put(ctx, "big", make([]byte, slabPageSize), 0), ErrValueTooLarge)
+	checkSlab(t, c)
+}
+
+func TestSlabHashCollisions(t *testing.T) {
+	c := NewSlabCache(8, time.Minute, SlabOptions{BlockSize: 4})
+	c.hash = func(string) uint64 { return 42 }
+	ctx := context.Background()
+
+	for _, k := range []string{"alpha", "beta", "alphabet", "gamma"} {
+		require.NoError(t, c.Put(ctx, k, k, 0))
+	}
+	for _, k := range []string{"alpha", "beta", "alphabet", "gamma"} {
+		v, _, err := c.Get(ctx, k)
+		require.NoError(t, err)
+		assert.Equal(t, k, v)
+	}
+	_, _, err := c.Get(ctx, "alphabe")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	// Удаление из середины и головы цепочки коллизий.
+	_, err = c.Evict(ctx, "beta")
+	require.NoError(t, err)
+	_, err = c.Evict(ctx, "gamma")
+	require.NoError(t, err)
+	v, _, err := c.Get(ctx, "alphabet")
+	require.NoError(t, err)
+	assert.Equal(t, "alphabet", v)
+	checkSlab(t, c)
+}
+
+func TestSlabSnapshotOrder(t *testing.T) {
+	c := NewSlabCache(3, time.Minute, SlabOptions{})
+	ctx := context.Background()
+
+	for _, k := range []string{"a", "b", "c"} {
+		require.NoError(t, c.Put(ctx, k, k, 0))
+	}
+	_, _, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+
+	entries, err := c.Snapshot(ctx)
+	require.NoError(t, err)
+	var order []string
+	for _, e := range entries {
+		order = append(order, e.Key)
+		assert.Equal(t, e.Key, e.Value)
+	}
+	assert.Equal(t, []string{"b", "c", "a"}, order)
+}
+
+func TestSlabGetOrLoad(t *testing.T) {
+	c := NewSlabCache(4, time.Minute, SlabOptions{})
+	ctx := context.Background()
+	var _ LoadingCache = c
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(_ context.Context, key string) (interface{}, error) {
+		loads.Add(1)
+		<-release
+		return "loaded " + key, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _, err := c.GetOrLoad(ctx, "k", 0, load)
+			assert.NoError(t, err)
+			assert.Equal(t, "loaded k", v)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), loads.Load())
+
+	v, _, err := c.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "loaded k", v)
+	checkSlab(t, c)
+}
+
+// TestSlabConcurrent гоняет все операции параллельно; запускать с -race.
+func TestSlabConcurrent(t *testing.T) {
+	c := NewSlabCache(32, time.Minute, SlabOptions{MaxBytes: 1, BlockSize: 16 << 10})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := "k" + strconv.Itoa((g*31+i)%64)
+				switch i % 10 {
+				case 0:
+					_, _ = c.Evict(ctx, key)
+				case 1, 2, 3:
+					value := strings.Repeat("v", i%(40<<10))
+					assert.NoError(t, c.Put(ctx, key, value, time.Duration(1+i%5)*time.Millisecond))
+				case 4:
+					_, _, err := c.GetAll(ctx)
+					assert.NoError(t, err)
+				case 5:
+					c.DeleteExpired(ctx)
+				case 6:
+					if i%200 == 6 {
+						assert.NoError(t, c.EvictAll(ctx))
+					}
+				default:
+					if _, _, err := c.Get(ctx, key); err != nil {
+						assert.ErrorIs(t, err, ErrKeyNotFound)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	checkSlab(t, c)
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Entry — запись кэша вместе со сроками её жизни.
+type Entry struct {
+	Key   string
+	Value interface{}
+	// ExpiresAt — момент истечения TTL.
+	ExpiresAt time.Time
+	// StaleAt — момент истечения мягкого TTL; нулевое значение означает,
+	// что запись не устаревает до ExpiresAt.
+	StaleAt time.Time
+}
+
+// Snapshotter реализуется кэшами, умеющими отдавать всё содержимое вместе
+// со сроками жизни записей, например для полной синхронизации реплики.
+type Snapshotter interface {
+	// Snapshot возвращает неистёкшие записи от наименее к наиболее недавно
+	// использованной: если записать их в пустой кэш по порядку, порядок
+	// вытеснения сохранится.
+	Snapshot(ctx context.Context) ([]Entry, error)
+}
+
+// Snapshot возвращает неистёкшие записи в порядке LRU, начиная с самой старой.
+// Значения распаковываются после снятия блокировки.
+func (c *LRUCache) Snapshot(ctx context.Context) ([]Entry, error) {
+	ctx, span := startSpan(ctx, "LRUCache.Snapshot", "")
+	defer span.End()
+
+	c.flushAccesses(ctx)
+	c.rlock(ctx)
+	now := time.Now()
+	entries := make([]Entry, 0, len(c.cache))
+	for node := c.left; node != nil; node = node.prev {
+		if now.After(node.data.expiresAt) {
+			continue
+		}
+		entries = append(entries, Entry{
+			Key:       node.data.key,
+			Value:     node.data.value,
+			ExpiresAt: node.data.expiresAt,
+			StaleAt:   node.data.staleAt,
+		})
+	}
+	c.mu.RUnlock()
+
+	for i := range entries {
+		value, err := decompress(entries[i].Value)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].Value = value
+	}
+
+	span.SetAttributes(attribute.Int("cache.entries", len(entries)))
+	return entries, nil
+}
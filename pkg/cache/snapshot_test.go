@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	c := NewLRUCache(10, time.Minute, WithCompression(CompressionOptions{Threshold: 1}))
+	ctx := context.Background()
+
+	require.NoError(t, c.Put(ctx, "a", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", 0))
+	require.NoError(t, c.Put(ctx, "b", 2.0, time.Hour))
+	require.NoError(t, c.Put(ctx, "gone", 3.0, 10*time.Millisecond))
+	require.NoError(t, c.(StaleCache).PutStale(ctx, "c", RawValue{ContentType: "text/plain", Data: []byte("c")}, time.Second, time.Minute))
+	_, _, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+
+	entries, err := c.(Snapshotter).Snapshot(ctx)
+	require.NoError(t, err)
+
+	var keys []string
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	// От наименее к наиболее недавно использованной; истёкшие пропущены.
+	assert.Equal(t, []string{"b", "c", "a"}, keys)
+	assert.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", entries[2].Value)
+	assert.Equal(t, RawValue{ContentType: "text/plain", Data: []byte("c")}, entries[1].Value)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), entries[0].ExpiresAt, time.Second)
+	assert.True(t, entries[0].StaleAt.IsZero())
+	assert.WithinDuration(t, time.Now().Add(time.Second), entries[1].StaleAt, time.Second)
+}
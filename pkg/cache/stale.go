@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+)
+
+// refreshRetryDelay — пауза перед повторной попыткой обновления после ошибки
+// загрузчика, чтобы горячий ключ не забрасывал источник запросами.
+const refreshRetryDelay = time.Second
+
+// Loader загружает актуальное значение ключа для фонового обновления устаревшей записи.
+type Loader func(ctx context.Context, key string) (interface{}, error)
+
+// WithLoader регистрирует загрузчик, которым обновляются записи с истёкшим
+// мягким TTL. Для каждого ключа одновременно выполняется не больше одного
+// обновления; пока оно идёт, читатели получают устаревшее значение.
+func WithLoader(l Loader) Option {
+	return func(c *LRUCache) {
+		c.loader = l
+	}
+}
+
+// StaleCache реализуется кэшами, поддерживающими мягкий TTL
+// (stale-while-revalidate и stale-if-error).
+type StaleCache interface {
+	// PutStale сохраняет запись с мягким TTL softTTL и жёстким TTL ttl.
+	// После softTTL запись считается устаревшей, но отдаётся до истечения ttl.
+	// ttl == 0 означает TTL по умолчанию; softTTL должен быть > 0 и не больше ttl,
+	// иначе возвращается ErrInvalidTTL.
+	PutStale(ctx context.Context, key string, value interface{}, softTTL, ttl time.Duration) error
+
+	// GetStale работает как Get и дополнительно сообщает, истёк ли мягкий TTL записи.
+	GetStale(ctx context.Context, key string) (value interface{}, expiresAt time.Time, stale bool, err error)
+
+	// Refreshes сообщает, зарегистрирован ли загрузчик (WithLoader). Без него
+	// устаревшие записи не обновляются и отдаются до истечения жёсткого TTL.
+	Refreshes() bool
+}
+
+// PutStale добавляет или обновляет запись с мягким и жёстким TTL.
+func (c *LRUCache) PutStale(ctx context.Context, key string, value interface{}, softTTL, ttl time.Duration) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	if ttl < 0 || softTTL <= 0 {
+		return ErrInvalidTTL
+	}
+	hardTTL := ttl
+	if hardTTL == 0 {
+		hardTTL = c.DefaultTTL()
+	}
+	if softTTL > hardTTL {
+		return ErrInvalidTTL
+	}
+
+	return c.put(ctx, key, value, softTTL, ttl)
+}
+
+// GetStale возвращает значение, время истечения жёсткого TTL и признак устаревания.
+func (c *LRUCache) GetStale(ctx context.Context, key string) (interface{}, time.Time, bool, error) {
+	value, expiresAt, stale, err := c.get(ctx, key)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	value, err = decompress(value)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	return value, expiresAt, stale, nil
+}
+
+// Refreshes сообщает, зарегистрирован ли загрузчик.
+func (c *LRUCache) Refreshes() bool {
+	return c.loader != nil
+}
+
+// startRefresh запускает фоновое обновление записи it, если есть загрузчик,
+// обновление ещё не идёт и не действует пауза после ошибки.
+// Вызывается под эксклюзивной блокировкой.
+func (c *LRUCache) startRefresh(ctx context.Context, it *item, now time.Time) {
+	if c.loader == nil || now.Before(it.retryAt) {
+		return
+	}
+	if _, ok := c.refreshing[it.key]; ok {
+		return
+	}
+	c.refreshing[it.key] = struct{}{}
+
+	// Обновление переживает запрос, который его запустил, но остаётся в том же трейсе.
+	go c.refresh(context.WithoutCancel(ctx), it.key, it.gen, it.softTTL, it.hardTTL)
+}
+
+// refresh загружает новое значение и заменяет им запись, если её не успели
+// перезаписать или удалить. При ошибке устаревшее значение остаётся в кэше
+// до истечения жёсткого TTL.
+func (c *LRUCache) refresh(ctx context.Context, key string, gen uint64, softTTL, hardTTL time.Duration) {
+	ctx, span := startSpan(ctx, "LRUCache.refresh", key)
+	defer span.End()
+
+	loaded, err := c.loader(ctx, key)
+	value := loaded
+	if err == nil {
+		value = c.compress(value)
+	}
+
+	c.lock(ctx)
+	defer c.mu.Unlock()
+
+	delete(c.refreshing, key)
+
+	node, ok := c.cache[key]
+	if !ok || node.data.gen != gen {
+		return
+	}
+
+	now := time.Now()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		slog.Warn("Failed to refresh stale cache entry",
+			slog.String("key", key),
+			slog.Time("expires_at", node.data.expiresAt),
+			slog.String("error", err.Error()),
+		)
+		node.data.retryAt = now.Add(refreshRetryDelay)
+		return
+	}
+
+	c.gen++
+	node.data.value = value
+	node.data.staleAt = now.Add(softTTL)
+	node.data.expiresAt = now.Add(hardTTL)
+	node.data.gen = c.gen
+	node.data.retryAt = time.Time{}
+	c.publishValue(EventUpdate, node.data, ReasonRefresh, loaded)
+}
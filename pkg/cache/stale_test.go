@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutStaleInvalidArguments(t *testing.T) {
+	c := NewLRUCache(2, time.Minute).(*LRUCache)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, c.PutStale(ctx, "", "v", time.Second, time.Minute), ErrEmptyKey)
+	assert.ErrorIs(t, c.PutStale(ctx, "k", "v", 0, time.Minute), ErrInvalidTTL)
+	assert.ErrorIs(t, c.PutStale(ctx, "k", "v", time.Second, -time.Second), ErrInvalidTTL)
+	assert.ErrorIs(t, c.PutStale(ctx, "k", "v", 2*time.Minute, time.Minute), ErrInvalidTTL)
+	assert.ErrorIs(t, c.PutStale(ctx, "k", "v", 2*time.Minute, 0), ErrInvalidTTL, "soft TTL is checked against the default TTL")
+	assert.NoError(t, c.PutStale(ctx, "k", "v", 30*time.Second, 0))
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	c := NewLRUCache(2, time.Minute, WithLoader(func(ctx context.Context, key string) (interface{}, error) {
+		loads.Add(1)
+		<-release
+		return "fresh", nil
+	})).(*LRUCache)
+	ctx := context.Background()
+
+	require.NoError(t, c.PutStale(ctx, "k", "old", 50*time.Millisecond, time.Minute))
+
+	v, _, stale, err := c.GetStale(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "old", v)
+	assert.False(t, stale)
+
+	time.Sleep(60 * time.Millisecond)
+
+	// Пока обновление не завершилось, все читатели получают старое значение,
+	// а загрузчик вызывается один раз.
+	for i := 0; i < 5; i++ {
+		v, _, stale, err = c.GetStale(ctx, "k")
+		require.NoError(t, err)
+		assert.Equal(t, "old", v)
+		assert.True(t, stale)
+	}
+	v, _, err = c.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "old", v, "Get also serves the stale value")
+
+	close(release)
+	require.Eventually(t, func() bool {
+		v, _, stale, err := c.GetStale(ctx, "k")
+		return err == nil && v == "fresh" && !stale
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(1), loads.Load())
+}
+
+func TestStaleIfError(t *testing.T) {
+	var loads atomic.Int32
+	c := NewLRUCache(2, time.Minute, WithLoader(func(ctx context.Context, key string) (interface{}, error) {
+		loads.Add(1)
+		return nil, errors.New("source unavailable")
+	})).(*LRUCache)
+	ctx := context.Background()
+
+	require.NoError(t, c.PutStale(ctx, "k", "old", 20*time.Millisecond, 200*time.Millisecond))
+	time.Sleep(30 * time.Millisecond)
+
+	v, _, stale, err := c.GetStale(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "old", v)
+	assert.True(t, stale)
+	require.Eventually(t, func() bool { return loads.Load() == 1 }, time.Second, time.Millisecond)
+
+	// После ошибки значение продолжает отдаваться, а повтор откладывается.
+	v, _, _, err = c.GetStale(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "old", v)
+	assert.Equal(t, int32(1), loads.Load())
+
+	time.Sleep(200 * time.Millisecond)
+	_, _, _, err = c.GetStale(ctx, "k")
+	assert.ErrorIs(t, err, ErrKeyNotFound, "stale value must not outlive the hard TTL")
+}
+
+func TestRefreshDoesNotOverwriteNewerPut(t *testing.T) {
+	release := make(chan struct{})
+	done := make(chan struct{})
+	c := NewLRUCache(2, time.Minute, WithLoader(func(ctx context.Context, key string) (interface{}, error) {
+		defer close(done)
+		<-release
+		return "loaded", nil
+	})).(*LRUCache)
+	ctx := context.Background()
+
+	require.NoError(t, c.PutStale(ctx, "k", "old", 10*time.Millisecond, time.Minute))
+	time.Sleep(20 * time.Millisecond)
+	_, _, _, err := c.GetStale(ctx, "k")
+	require.NoError(t, err)
+
+	require.NoError(t, c.Put(ctx, "k", "explicit", 0))
+	close(release)
+	<-done
+
+	assert.Eventually(t, func() bool {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return len(c.refreshing) == 0
+	}, time.Second, time.Millisecond)
+	v, _, stale, err := c.GetStale(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "explicit", v)
+	assert.False(t, stale)
+}
@@ -0,0 +1,535 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TieredCache — двухуровневый кэш: записи, вытесненные из LRUCache в памяти
+// (L1) из-за нехватки места, переносятся в DiskStore (L2) со своим лимитом
+// размера и вытеснением по LRU. Промах в L1 проверяет L2 и при попадании
+// возвращает запись в L1 с исходными сроками жизни. Событие EventEvict с
+// причиной capacity публикуется, только когда запись покидает L2.
+//
+// Вытесненные записи пишутся на диск фоновой горутиной, поэтому Put и Get не
+// ждут файлового ввода-вывода. Пока запись не записана, она читается из
+// очереди. Если в очереди больше maxPendingDemotions записей, операция,
+// вытеснившая запись, сама записывает очередь на диск: так очередь
+// ограничена, когда диск не успевает. Close дописывает очередь и
+// останавливает горутину.
+type TieredCache struct {
+	l1 *LRUCache
+	l2 *DiskStore
+
+	// mu упорядочивает перенос записей между уровнями с Put, Evict и EvictAll,
+	// чтобы удалённое или перезаписанное значение не вернулось из L2.
+	mu sync.Mutex
+
+	// pending — вытесненные из L1 записи, которые ещё не записаны на диск.
+	// Заполняется под блокировкой L1, поэтому защищена отдельным мьютексом.
+	pendingMu sync.Mutex
+	pending   map[string]*item
+	// demotions нумерует вытеснения, чтобы pending обходилась по порядку.
+	demotions uint64
+
+	// flushMu не даёт двум flush одновременно писать одни и те же записи.
+	flushMu sync.Mutex
+	// wake будит фоновый писатель; stop и stopped останавливают его.
+	wake      chan struct{}
+	stop      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+	closed    atomic.Bool
+
+	// loads — выполняющиеся загрузки GetOrLoad.
+	loads loadGroup
+}
+
+// NewTieredCache создаёт кэш с L1 на capacity записей и L2 в l2. Параметры
+// opts применяются к L1.
+func NewTieredCache(capacity int, defaultTTL time.Duration, l2 *DiskStore, opts ...Option) *TieredCache {
+	t := &TieredCache{
+		l1:      NewLRUCache(capacity, defaultTTL, opts...).(*LRUCache),
+		l2:      l2,
+		pending: make(map[string]*item),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	t.l1.demote = t.enqueueDemoted
+	go t.writeDemoted()
+	return t
+}
+
+// maxPendingDemotions — сколько вытесненных записей может ждать фоновой
+// записи на диск, прежде чем вытеснившие их операции начнут писать сами.
+const maxPendingDemotions = 256
+
+// writeDemoted — фоновый писатель вытесненных записей.
+func (t *TieredCache) writeDemoted() {
+	defer close(t.stopped)
+	for {
+		select {
+		case <-t.wake:
+			t.flush(context.Background())
+		case <-t.stop:
+			t.flush(context.Background())
+			return
+		}
+	}
+}
+
+// scheduleFlush передаёт вытесненные записи фоновому писателю. Если очередь
+// переполнена или писатель остановлен, записывает их сам.
+func (t *TieredCache) scheduleFlush(ctx context.Context) {
+	t.pendingMu.Lock()
+	n := len(t.pending)
+	t.pendingMu.Unlock()
+	if n == 0 {
+		return
+	}
+	if n > maxPendingDemotions || t.closed.Load() {
+		t.flush(ctx)
+		return
+	}
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close записывает на диск ожидающие записи и останавливает фоновый писатель.
+// Кэш остаётся рабочим: после Close вытесненные записи пишутся синхронно.
+func (t *TieredCache) Close() error {
+	t.closeOnce.Do(func() {
+		t.closed.Store(true)
+		close(t.stop)
+		<-t.stopped
+	})
+	return nil
+}
+
+// enqueueDemoted принимает запись, вытесненную из L1. Вызывается под блокировкой L1.
+func (t *TieredCache) enqueueDemoted(it *item) {
+	t.pendingMu.Lock()
+	t.demotions++
+	it.demoted = t.demotions
+	t.pending[it.key] = it
+	t.pendingMu.Unlock()
+}
+
+// pendingItems возвращает ожидающие записи от раньше к позже вытесненной.
+func (t *TieredCache) pendingItems() []*item {
+	t.pendingMu.Lock()
+	items := make([]*item, 0, len(t.pending))
+	for _, it := range t.pending {
+		items = append(items, it)
+	}
+	t.pendingMu.Unlock()
+	sort.Slice(items, func(i, j int) bool { return items[i].demoted < items[j].demoted })
+	return items
+}
+
+// flush записывает на диск вытесненные из L1 записи.
+func (t *TieredCache) flush(ctx context.Context) {
+	t.flushMu.Lock()
+	defer t.flushMu.Unlock()
+
+	items := t.pendingItems()
+	if len(items) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, it := range items {
+		if now.After(it.expiresAt) {
+			t.dropPending(it)
+			t.l1.publish(EventExpire, it.key, ReasonTTL)
+			continue
+		}
+
+		// Файл пишется вне t.mu, а в L2 запись попадает под t.mu вместе с
+		// удалением из pending: читатели видят её ровно в одном из мест.
+		w, err := t.l2.prepare(it)
+
+		var evicted []string
+		t.mu.Lock()
+		t.pendingMu.Lock()
+		current := t.pending[it.key] == it
+		if current {
+			delete(t.pending, it.key)
+		}
+		t.pendingMu.Unlock()
+		switch {
+		case err == nil && current:
+			evicted, err = t.l2.commit(w)
+		case err == nil:
+			// Пока запись сохранялась, её перезаписали, удалили или вернули
+			// в L1: копия на диске устарела.
+			t.l2.discard(w)
+		}
+		t.mu.Unlock()
+
+		if err != nil && current {
+			slog.Warn("Failed to demote cache entry to disk, dropping it",
+				slog.String("key", it.key),
+				slog.String("error", err.Error()),
+			)
+			evicted = append(evicted, it.key)
+		}
+
+		for _, key := range evicted {
+			t.l1.publish(EventEvict, key, ReasonCapacity)
+		}
+	}
+}
+
+// dropPending убирает it из pending, если её не успели заменить.
+func (t *TieredCache) dropPending(it *item) {
+	t.pendingMu.Lock()
+	if t.pending[it.key] == it {
+		delete(t.pending, it.key)
+	}
+	t.pendingMu.Unlock()
+}
+
+// takePending забирает из pending запись key. Вызывается под t.mu.
+func (t *TieredCache) takePending(key string) (*item, bool) {
+	t.pendingMu.Lock()
+	defer t.pendingMu.Unlock()
+	it, ok := t.pending[key]
+	if ok {
+		delete(t.pending, key)
+	}
+	return it, ok
+}
+
+// forget удаляет key из pending и L2 перед записью в L1.
+func (t *TieredCache) forget(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.takePending(key)
+	t.l2.remove(key)
+}
+
+// Put добавляет или обновляет запись в L1; прежняя копия в L2 удаляется.
+func (t *TieredCache) Put(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	if ttl < 0 {
+		return ErrInvalidTTL
+	}
+	t.forget(key)
+	err := t.l1.Put(ctx, key, value, ttl)
+	t.scheduleFlush(ctx)
+	return err
+}
+
+// PutStale работает как LRUCache.PutStale.
+func (t *TieredCache) PutStale(ctx context.Context, key string, value interface{}, softTTL, ttl time.Duration) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	hardTTL := ttl
+	if hardTTL == 0 {
+		hardTTL = t.l1.DefaultTTL()
+	}
+	if ttl < 0 || softTTL <= 0 || softTTL > hardTTL {
+		return ErrInvalidTTL
+	}
+	t.forget(key)
+	err := t.l1.PutStale(ctx, key, value, softTTL, ttl)
+	t.scheduleFlush(ctx)
+	return err
+}
+
+// Refreshes работает как LRUCache.Refreshes.
+func (t *TieredCache) Refreshes() bool {
+	return t.l1.Refreshes()
+}
+
+// Get возвращает значение из L1, а при промахе — из L2, возвращая запись в L1.
+func (t *TieredCache) Get(ctx context.Context, key string) (interface{}, time.Time, error) {
+	value, expiresAt, _, err := t.GetStale(ctx, key)
+	return value, expiresAt, err
+}
+
+// GetStale работает как Get и дополнительно сообщает, истёк ли мягкий TTL записи.
+func (t *TieredCache) GetStale(ctx context.Context, key string) (interface{}, time.Time, bool, error) {
+	value, expiresAt, stale, err := t.l1.GetStale(ctx, key)
+	if err == nil || key == "" {
+		return value, expiresAt, stale, err
+	}
+
+	ctx, span := startSpan(ctx, "TieredCache.promote", key)
+	defer span.End()
+
+	it, err := t.promote(ctx, key)
+	if err != nil {
+		span.SetAttributes(attribute.Bool("cache.l2_hit", false))
+		return nil, time.Time{}, false, err
+	}
+	span.SetAttributes(attribute.Bool("cache.l2_hit", true))
+	t.scheduleFlush(ctx)
+
+	value, err = decompress(it.value)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	stale = !it.staleAt.IsZero() && time.Now().After(it.staleAt)
+	return value, it.expiresAt, stale, nil
+}
+
+// GetCompressed реализует CompressedReader: запись из L2 сначала
+// возвращается в L1 и отдаётся оттуда.
+func (t *TieredCache) GetCompressed(ctx context.Context, key string) (CompressedValue, time.Time, error) {
+	cv, expiresAt, err := t.l1.GetCompressed(ctx, key)
+	if !errors.Is(err, ErrKeyNotFound) || key == "" {
+		return cv, expiresAt, err
+	}
+	if _, _, _, err := t.GetStale(ctx, key); err != nil {
+		return CompressedValue{}, time.Time{}, err
+	}
+	return t.l1.GetCompressed(ctx, key)
+}
+
+// GetOrLoad реализует LoadingCache: промахом считается отсутствие ключа на
+// обоих уровнях.
+func (t *TieredCache) GetOrLoad(ctx context.Context, key string, ttl time.Duration, load Loader) (interface{}, time.Time, error) {
+	return t.loads.getOrLoad(ctx, t, "TieredCache.Load", key, ttl, t.l1.DefaultTTL(), load)
+}
+
+// promote переносит key из pending или L2 в L1.
+func (t *TieredCache) promote(ctx context.Context, key string) (*item, error) {
+	t.mu.Lock()
+	if it, ok := t.takePending(key); ok {
+		defer t.mu.Unlock()
+		if time.Now().After(it.expiresAt) {
+			t.l1.publish(EventExpire, key, ReasonTTL)
+			return nil, ErrKeyNotFound
+		}
+		if !t.l1.promote(ctx, it) {
+			return t.l1Item(ctx, key)
+		}
+		return it, nil
+	}
+	t.mu.Unlock()
+
+	rec, err := t.l2.load(key)
+	if err != nil {
+		if !errors.Is(err, ErrKeyNotFound) {
+			slog.Warn("Failed to read cache entry from disk",
+				slog.String("key", key),
+				slog.String("error", err.Error()),
+			)
+			t.l2.remove(key)
+		}
+		return nil, ErrKeyNotFound
+	}
+	it := rec.item()
+	if time.Now().After(it.expiresAt) {
+		if t.l2.remove(key) {
+			t.l1.publish(EventExpire, key, ReasonTTL)
+		}
+		return nil, ErrKeyNotFound
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Запись с диска возвращается, только если её не удалили и не
+	// перезаписали, пока файл читался.
+	if !t.l2.remove(key) || !t.l1.promote(ctx, it) {
+		return t.l1Item(ctx, key)
+	}
+	return it, nil
+}
+
+// l1Item возвращает текущую запись key из L1.
+func (t *TieredCache) l1Item(ctx context.Context, key string) (*item, error) {
+	value, expiresAt, stale, err := t.l1.get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	it := &item{key: key, value: value, expiresAt: expiresAt}
+	if stale {
+		it.staleAt = time.Now()
+	}
+	return it, nil
+}
+
+// GetAll возвращает записи L1, а затем L2, каждую группу от наиболее к наименее
+// недавно использованной. Порядок LRU при этом не меняется.
+func (t *TieredCache) GetAll(ctx context.Context) ([]string, []interface{}, error) {
+	keys, values, err := t.l1.GetAll(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		seen[k] = true
+	}
+
+	now := time.Now()
+	// Позже вытесненные записи использовались недавнее.
+	pending := t.pendingItems()
+	for i := len(pending) - 1; i >= 0; i-- {
+		it := pending[i]
+		if seen[it.key] || now.After(it.expiresAt) {
+			continue
+		}
+		value, err := decompress(it.value)
+		if err != nil {
+			return nil, nil, err
+		}
+		seen[it.key] = true
+		keys = append(keys, it.key)
+		values = append(values, value)
+	}
+
+	for _, key := range t.l2.keys() {
+		if seen[key] {
+			continue
+		}
+		rec, err := t.l2.read(key)
+		if err != nil || now.After(rec.ExpiresAt) {
+			continue
+		}
+		value, err := decompress(rec.item().value)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	return keys, values, nil
+}
+
+// Snapshot реализует Snapshotter: сначала идут записи L2 от самой старой,
+// затем ожидающие переноса на диск и в конце записи L1 в порядке LRU.
+// Записанные по порядку в пустой TieredCache той же ёмкости, они
+// распределятся по уровням так же.
+func (t *TieredCache) Snapshot(ctx context.Context) ([]Entry, error) {
+	ctx, span := startSpan(ctx, "TieredCache.Snapshot", "")
+	defer span.End()
+
+	l1, err := t.l1.Snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(l1))
+	for _, e := range l1 {
+		seen[e.Key] = true
+	}
+
+	now := time.Now()
+	var entries []Entry
+	add := func(it *item) error {
+		if seen[it.key] || now.After(it.expiresAt) {
+			return nil
+		}
+		value, err := decompress(it.value)
+		if err != nil {
+			return err
+		}
+		seen[it.key] = true
+		entries = append(entries, Entry{Key: it.key, Value: value, ExpiresAt: it.expiresAt, StaleAt: it.staleAt})
+		return nil
+	}
+
+	keys := t.l2.keys()
+	for i := len(keys) - 1; i >= 0; i-- {
+		rec, err := t.l2.read(keys[i])
+		if err != nil {
+			continue
+		}
+		if err := add(rec.item()); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, it := range t.pendingItems() {
+		if err := add(it); err != nil {
+			return nil, err
+		}
+	}
+
+	entries = append(entries, l1...)
+	span.SetAttributes(attribute.Int("cache.entries", len(entries)))
+	return entries, nil
+}
+
+// Evict удаляет ключ с обоих уровней.
+func (t *TieredCache) Evict(ctx context.Context, key string) (interface{}, error) {
+	var stored interface{}
+	t.mu.Lock()
+	if it, ok := t.takePending(key); ok {
+		stored = it.value
+	} else if rec, err := t.l2.read(key); err == nil {
+		stored = rec.item().value
+	}
+	onDisk := t.l2.remove(key)
+	t.mu.Unlock()
+
+	value, err := t.l1.Evict(ctx, key)
+	if !errors.Is(err, ErrKeyNotFound) || (stored == nil && !onDisk) {
+		return value, err
+	}
+	t.l1.publish(EventEvict, key, ReasonDelete)
+	return decompress(stored)
+}
+
+// EvictAll очищает оба уровня.
+func (t *TieredCache) EvictAll(ctx context.Context) error {
+	t.mu.Lock()
+	t.pendingMu.Lock()
+	t.pending = make(map[string]*item)
+	t.pendingMu.Unlock()
+	t.l2.clear()
+	t.mu.Unlock()
+
+	return t.l1.EvictAll(ctx)
+}
+
+// DeleteExpired удаляет истёкшие записи с обоих уровней, публикуя для каждой EventExpire.
+func (t *TieredCache) DeleteExpired(ctx context.Context) int {
+	removed := t.l1.DeleteExpired(ctx)
+	for _, key := range t.l2.removeExpired(time.Now()) {
+		t.l1.publish(EventExpire, key, ReasonTTL)
+		removed++
+	}
+	return removed
+}
+
+// promote добавляет запись, перенесённую с другого уровня, сохраняя её сроки
+// жизни и не публикуя событий. Если ключ уже есть, запись не добавляется.
+func (c *LRUCache) promote(ctx context.Context, it *item) bool {
+	ctx, span := startSpan(ctx, "LRUCache.promote", it.key)
+	defer span.End()
+
+	c.lock(ctx)
+	defer c.mu.Unlock()
+
+	if _, ok := c.cache[it.key]; ok {
+		return false
+	}
+	if len(c.cache) >= c.capacity {
+		c.evictForCapacity(span)
+	}
+	// Копия: it продолжают читать вне блокировки, а запись в L1 меняется на месте.
+	cp := *it
+	c.gen++
+	cp.gen = c.gen
+	cp.retryAt = time.Time{}
+	node := &ListNode{data: &cp}
+	c.cache[it.key] = node
+	c.addToFront(node)
+	return true
+}
@@ -0,0 +1,350 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openDisk(t *testing.T, dir string, maxBytes int64) *DiskStore {
+	t.Helper()
+	s, err := OpenDiskStore(DiskOptions{Dir: dir, MaxBytes: maxBytes})
+	require.NoError(t, err)
+	return s
+}
+
+func TestTieredDemotesAndPromotes(t *testing.T) {
+	bus := NewEventBus()
+	l2 := openDisk(t, t.TempDir(), 1<<20)
+	c := NewTieredCache(2, time.Minute, l2, WithEventBus(bus))
+	ctx := context.Background()
+
+	sub := bus.Subscribe("", 16)
+	defer sub.Close()
+
+	require.NoError(t, c.Put(ctx, "a", "va", 0))
+	require.NoError(t, c.Put(ctx, "b", "vb", 30*time.Second))
+	_, expB, err := c.Get(ctx, "b")
+	require.NoError(t, err)
+	require.NoError(t, c.Put(ctx, "c", "vc", 0))
+	require.NoError(t, c.Put(ctx, "d", "vd", 0))
+
+	// a и b ушли на диск, но остаются доступны.
+	c.flush(ctx)
+	assert.Equal(t, 2, l2.Len())
+	v, expiresAt, err := c.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "vb", v)
+	assert.True(t, expB.Equal(expiresAt), "TTL must be preserved")
+
+	// Поднятая запись вытеснила c на диск.
+	c.flush(ctx)
+	assert.Equal(t, 2, l2.Len())
+	v, _, err = c.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "va", v)
+
+	for _, ev := range drain(sub) {
+		assert.NotEqual(t, EventEvict, ev.Type, "demotion is not an eviction: %+v", ev)
+	}
+}
+
+func TestTieredDiskLimit(t *testing.T) {
+	bus := NewEventBus()
+	dir := t.TempDir()
+	payload := strings.Repeat("x", 1000)
+
+	probe := openDisk(t, t.TempDir(), 1<<20)
+	_, err := probe.store(&item{key: "k0", value: payload, expiresAt: time.Now().Add(time.Minute)})
+	require.NoError(t, err)
+
+	// На диске помещаются две записи.
+	l2 := openDisk(t, dir, probe.Size()*2+probe.Size()/2)
+	c := NewTieredCache(1, time.Minute, l2, WithEventBus(bus))
+	ctx := context.Background()
+	sub := bus.Subscribe("", 16)
+	defer sub.Close()
+
+	for _, k := range []string{"k0", "k1", "k2", "k3"} {
+		require.NoError(t, c.Put(ctx, k, payload, 0))
+	}
+	c.flush(ctx)
+	assert.Equal(t, 2, l2.Len())
+	assert.LessOrEqual(t, l2.Size(), probe.Size()*2+probe.Size()/2)
+
+	_, _, err = c.Get(ctx, "k0")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	for _, k := range []string{"k1", "k2", "k3"} {
+		_, _, err = c.Get(ctx, k)
+		assert.NoError(t, err, k)
+	}
+
+	var evicted []string
+	for _, ev := range drain(sub) {
+		if ev.Type == EventEvict {
+			assert.Equal(t, ReasonCapacity, ev.Reason)
+			evicted = append(evicted, ev.Key)
+		}
+	}
+	assert.Contains(t, evicted, "k0")
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, l2.Len())
+}
+
+func TestDiskStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	l2 := openDisk(t, dir, 1<<20)
+	c := NewTieredCache(1, time.Minute, l2, WithCompression(CompressionOptions{Threshold: 64}))
+	ctx := context.Background()
+
+	doc := strings.Repeat(`{"field": "highly compressible"}`, 100)
+	values := map[string]interface{}{
+		"string": doc,
+		"raw":    RawValue{ContentType: "text/html", Data: []byte(doc)},
+		"json":   map[string]interface{}{"items": []interface{}{doc, 1.5, true}},
+		"number": 42,
+	}
+	for key, value := range values {
+		require.NoError(t, c.Put(ctx, key, value, 0))
+	}
+	require.NoError(t, c.Put(ctx, "last", "v", 0))
+	require.NoError(t, c.Put(ctx, "short", "v", time.Millisecond))
+	require.NoError(t, c.Put(ctx, "tail", "v", 0))
+	require.NoError(t, os.WriteFile(dir+"/broken"+diskEntryExt, []byte("garbage"), 0o644))
+	require.NoError(t, os.WriteFile(dir+"/.tmp-123", []byte("partial"), 0o644))
+	time.Sleep(5 * time.Millisecond)
+
+	reopened := openDisk(t, dir, 1<<20)
+	assert.Equal(t, len(values)+1, reopened.Len(), "expired and broken files are dropped")
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, reopened.Len())
+
+	c = NewTieredCache(10, time.Minute, reopened)
+	for key, value := range values {
+		got, _, err := c.Get(ctx, key)
+		require.NoError(t, err, key)
+		assert.Equal(t, value, got, key)
+	}
+}
+
+func TestTieredDeleteAndOverwrite(t *testing.T) {
+	l2 := openDisk(t, t.TempDir(), 1<<20)
+	c := NewTieredCache(1, time.Minute, l2)
+	ctx := context.Background()
+
+	require.NoError(t, c.Put(ctx, "a", "old", 0))
+	require.NoError(t, c.Put(ctx, "b", "vb", 0))
+	c.flush(ctx)
+	require.Equal(t, 1, l2.Len())
+
+	// Перезапись не должна поднять старое значение с диска.
+	require.NoError(t, c.Put(ctx, "a", "new", 0))
+	v, _, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "new", v)
+
+	// b теперь на диске.
+	v, err = c.Evict(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "vb", v)
+	_, _, err = c.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, err = c.Evict(ctx, "b")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	require.NoError(t, c.Put(ctx, "c", "vc", 0))
+	require.NoError(t, c.EvictAll(ctx))
+	assert.Zero(t, l2.Len())
+	keys, _, err := c.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestTieredGetAllAndExpiry(t *testing.T) {
+	l2 := openDisk(t, t.TempDir(), 1<<20)
+	c := NewTieredCache(2, time.Minute, l2)
+	ctx := context.Background()
+
+	require.NoError(t, c.Put(ctx, "a", 1, 20*time.Millisecond))
+	require.NoError(t, c.Put(ctx, "b", 2, 0))
+	require.NoError(t, c.Put(ctx, "c", 3, 0))
+	require.NoError(t, c.Put(ctx, "d", 4, 0))
+
+	keys, values, err := c.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d", "c", "b", "a"}, keys)
+	assert.Equal(t, []interface{}{4, 3, 2, 1}, values)
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, 1, c.DeleteExpired(ctx))
+	assert.Equal(t, 1, l2.Len())
+	_, _, err = c.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestTieredConcurrentAccess(t *testing.T) {
+	l2 := openDisk(t, t.TempDir(), 1<<20)
+	c := NewTieredCache(4, time.Minute, l2)
+	ctx := context.Background()
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := keys[(g+i)%len(keys)]
+				switch i % 5 {
+				case 0:
+					_, _ = c.Evict(ctx, key)
+				case 1, 2:
+					assert.NoError(t, c.Put(ctx, key, key, 0))
+				default:
+					if v, _, err := c.Get(ctx, key); err == nil {
+						assert.Equal(t, key, v)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Каждый ключ хранится не более чем на одном уровне.
+	got, _, err := c.GetAll(ctx)
+	require.NoError(t, err)
+	seen := map[string]bool{}
+	for _, k := range got {
+		assert.False(t, seen[k], k)
+		seen[k] = true
+	}
+	for _, k := range l2.keys() {
+		_, _, _, err := c.l1.get(ctx, k)
+		assert.ErrorIs(t, err, ErrKeyNotFound, k)
+	}
+}
+
+func TestTieredSnapshot(t *testing.T) {
+	l2 := openDisk(t, t.TempDir(), 1<<20)
+	c := NewTieredCache(2, time.Minute, l2)
+	ctx := context.Background()
+
+	for i, k := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, c.Put(ctx, k, i, 0))
+	}
+	var _ Snapshotter = c
+
+	entries, err := c.Snapshot(ctx)
+	require.NoError(t, err)
+	keys := make([]string, 0, len(entries))
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d"}, keys, "disk entries come first, oldest to newest")
+	assert.Equal(t, 1, entries[1].Value)
+	assert.False(t, entries[0].ExpiresAt.IsZero())
+
+	// Восстановленный по снимку кэш раскладывает записи по уровням так же.
+	restored := NewTieredCache(2, time.Minute, openDisk(t, t.TempDir(), 1<<20))
+	for _, e := range entries {
+		require.NoError(t, restored.Put(ctx, e.Key, e.Value, time.Until(e.ExpiresAt)))
+	}
+	got, _, err := restored.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d", "c", "b", "a"}, got)
+}
+
+func TestTieredGetOrLoad(t *testing.T) {
+	l2 := openDisk(t, t.TempDir(), 1<<20)
+	c := NewTieredCache(1, time.Minute, l2)
+	ctx := context.Background()
+	var _ LoadingCache = c
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(_ context.Context, key string) (interface{}, error) {
+		loads.Add(1)
+		<-release
+		return "loaded " + key, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _, err := c.GetOrLoad(ctx, "k", 0, load)
+			assert.NoError(t, err)
+			assert.Equal(t, "loaded k", v)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), loads.Load())
+
+	// Запись, ушедшая на диск, не считается промахом.
+	require.NoError(t, c.Put(ctx, "other", "v", 0))
+	v, _, err := c.GetOrLoad(ctx, "k", 0, load)
+	require.NoError(t, err)
+	assert.Equal(t, "loaded k", v)
+	assert.Equal(t, int32(1), loads.Load())
+}
+
+func TestTieredGetCompressed(t *testing.T) {
+	l2 := openDisk(t, t.TempDir(), 1<<20)
+	c := NewTieredCache(1, time.Minute, l2, WithCompression(CompressionOptions{Threshold: 16}))
+	ctx := context.Background()
+	var _ CompressedReader = c
+
+	page := strings.Repeat("<p>hello</p>", 100)
+	require.NoError(t, c.Put(ctx, "page", page, 0))
+	require.NoError(t, c.Put(ctx, "other", "v", 0))
+	c.flush(ctx)
+	require.Equal(t, 1, l2.Len())
+
+	cv, _, err := c.GetCompressed(ctx, "page")
+	require.NoError(t, err)
+	assert.Equal(t, EncodingGzip, cv.Encoding)
+	assert.Less(t, len(cv.Data), len(page))
+
+	_, _, err = c.GetCompressed(ctx, "missing")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestTieredBackgroundDemotion(t *testing.T) {
+	dir := t.TempDir()
+	l2 := openDisk(t, dir, 1<<20)
+	c := NewTieredCache(1, time.Minute, l2)
+	ctx := context.Background()
+
+	// Очередь на запись ограничена, даже если писатель не успевает.
+	for i := 0; i < 4*maxPendingDemotions; i++ {
+		require.NoError(t, c.Put(ctx, "k"+strconv.Itoa(i), i, 0))
+		c.pendingMu.Lock()
+		pending := len(c.pending)
+		c.pendingMu.Unlock()
+		require.LessOrEqual(t, pending, maxPendingDemotions+1)
+	}
+
+	// Close дописывает очередь: после перезапуска записи на месте.
+	require.NoError(t, c.Close())
+	assert.Equal(t, 4*maxPendingDemotions-1, l2.Len())
+	reopened := openDisk(t, dir, 1<<20)
+	assert.Equal(t, l2.Len(), reopened.Len())
+
+	// После Close вытеснение пишет на диск сразу.
+	require.NoError(t, c.Put(ctx, "last", 0, 0))
+	assert.Equal(t, 4*maxPendingDemotions, l2.Len())
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer берётся из глобального TracerProvider; пока провайдер не настроен,
+// спаны ничего не стоят.
+var tracer = otel.Tracer("github.com/titoffon/lru-cache-service/pkg/cache")
+
+// startSpan открывает span операции кэша с атрибутом ключа.
+func startSpan(ctx context.Context, name, key string) (context.Context, trace.Span) {
+	if key == "" {
+		return tracer.Start(ctx, name)
+	}
+	return tracer.Start(ctx, name, trace.WithAttributes(attribute.String("cache.key", key)))
+}
+
+// lock захватывает эксклюзивную блокировку, выделяя ожидание в отдельный span,
+// чтобы в трейсе было видно, сколько операция простояла в очереди на мьютекс.
+// Накопленные обращения Get применяются сразу после захвата, поэтому операция
+// видит актуальный порядок LRU.
+func (c *LRUCache) lock(ctx context.Context) {
+	_, span := tracer.Start(ctx, "LRUCache.lockWait")
+	c.mu.Lock()
+	span.End()
+	c.applyAccesses()
+}
+
+// rlock захватывает разделяемую блокировку аналогично lock.
+func (c *LRUCache) rlock(ctx context.Context) {
+	_, span := tracer.Start(ctx, "LRUCache.rlockWait")
+	c.mu.RLock()
+	span.End()
+}
+
+// recordEviction отмечает в span'е вытеснение ключа из-за нехватки места.
+func recordEviction(span trace.Span, key string) {
+	span.AddEvent("evict", trace.WithAttributes(
+		attribute.String("cache.key", key),
+		attribute.String("cache.evict_reason", "capacity"),
+	))
+}
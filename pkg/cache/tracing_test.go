@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	c := NewLRUCache(1, time.Minute)
+	ctx, root := otel.Tracer("test").Start(context.Background(), "root")
+
+	require.NoError(t, c.Put(ctx, "k1", "v1", 0))
+	require.NoError(t, c.Put(ctx, "k2", "v2", 0))
+	_, _, err := c.Get(ctx, "k1")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	root.End()
+
+	spans := recorder.Ended()
+	byName := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		assert.Equal(t, root.SpanContext().TraceID(), s.SpanContext().TraceID(), "all spans belong to the caller's trace")
+		byName[s.Name()] = append(byName[s.Name()], s)
+	}
+
+	require.Len(t, byName["LRUCache.Put"], 2)
+	require.Len(t, byName["LRUCache.Get"], 1)
+	assert.Len(t, byName["LRUCache.lockWait"], 2, "every exclusive lock acquisition gets its own span")
+	assert.Len(t, byName["LRUCache.rlockWait"], 1, "Get takes the shared lock")
+
+	// Второй Put вытеснил k1 из-за ёмкости.
+	secondPut := byName["LRUCache.Put"][1]
+	require.Len(t, secondPut.Events(), 1)
+	assert.Equal(t, "evict", secondPut.Events()[0].Name)
+
+	get := byName["LRUCache.Get"][0]
+	for _, lockSpan := range byName["LRUCache.rlockWait"] {
+		if lockSpan.Parent().SpanID() == get.SpanContext().SpanID() {
+			return
+		}
+	}
+	t.Fatal("lock wait span of Get must be a child of the Get span")
+}
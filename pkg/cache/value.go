@@ -0,0 +1,8 @@
+package cache
+
+// RawValue — непрозрачное значение с типом содержимого, например изображение,
+// protobuf или заранее сериализованный HTML. Кэш хранит его как есть.
+type RawValue struct {
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
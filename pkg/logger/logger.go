@@ -6,10 +6,18 @@ import (
 	"os"
 )
 
+// level — уровень глобального логера; меняется SetLevel без пересоздания логера.
+var level slog.LevelVar
+
 // InitGlobalLogger инициализирует глобальный логер с заданным уровнем.
 func InitGlobalLogger(levelStr string) {
-	level := ParseLogLevel(levelStr)
-	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})))
+	level.Set(ParseLogLevel(levelStr))
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: &level})))
+}
+
+// SetLevel меняет уровень глобального логера на лету.
+func SetLevel(levelStr string) {
+	level.Set(ParseLogLevel(levelStr))
 }
 
 // ParseLogLevel преобразует строковое значение уровня логирования в тип slog.Level.